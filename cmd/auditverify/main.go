@@ -0,0 +1,92 @@
+// Command auditverify checks that an audit log written by the web server
+// with -audit-log was not tampered with.
+//
+//	go run ./cmd/auditverify audit.log
+//
+// The log is read from stdin when no file is provided. A log read from a
+// file is also checked against the checkpoint the server keeps next to it,
+// audit.log.head, so that events removed from the end of the log are
+// detected. The command exits with status 1 and names the first broken
+// event when the chain is broken or the log is truncated. A torn final line,
+// left by a crash while an event was written, is reported on stderr and
+// ignored, as the server drops it when it opens the log.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+)
+
+// Exit statuses
+const (
+	exitOK       = 0
+	exitTampered = 1
+	exitError    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Verifies the log named by the arguments, or read from stdin, and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 1 {
+		fmt.Fprintln(stderr, "usage: auditverify [file]")
+		return exitError
+	}
+
+	input := stdin
+	var checkpoint audit.Checkpoint
+	if len(args) == 1 {
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		defer file.Close()
+		input = file
+
+		checkpoint, err = audit.ReadCheckpoint(audit.CheckpointPath(args[0]))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+	}
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	// Every recorded event ends with a newline
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if torn := len(data) - complete; torn > 0 {
+		fmt.Fprintf(stderr, "warning: ignoring %d bytes of a torn final line\n", torn)
+	}
+
+	count, err := verify(data[:complete], checkpoint)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitTampered
+	}
+	fmt.Fprintf(stdout, "OK: %d events verified\n", count)
+	return exitOK
+}
+
+// Reads the events and verifies their chain up to the checkpoint,
+// returning the number of events
+func verify(data []byte, checkpoint audit.Checkpoint) (int, error) {
+	events, err := audit.ReadEvents(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	if err := audit.VerifyEvents(events); err != nil {
+		return len(events), err
+	}
+	return len(events), audit.VerifyCheckpoint(events, checkpoint)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+)
+
+// Writes a log of three events with its checkpoint and returns its path and lines
+func setupTestLog(t *testing.T) (string, [][]byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, err := audit.OpenLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	for _, action := range []string{audit.ActionReceiptInsert, audit.ActionReceiptUpdate, audit.ActionReceiptDelete} {
+		event := audit.Event{TenantID: "default", Principal: "apikey:ops", Action: action, Resource: "receipt:receipt-1"}
+		if _, err := auditLog.Record(event); err != nil {
+			t.Fatalf("Failed to record event: %v", err)
+		}
+	}
+	auditLog.Close()
+
+	data, _ := os.ReadFile(path)
+	return path, bytes.SplitAfter(data, []byte("\n"))[:3]
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name           string
+		edit           func(lines [][]byte) [][]byte
+		expectedStatus int
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			"Valid log",
+			func(lines [][]byte) [][]byte { return lines },
+			exitOK, "OK: 3 events verified", "",
+		},
+		{
+			"Edited entry",
+			func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte("apikey:ops"), []byte("apikey:eve"), 1)
+				return lines
+			},
+			exitTampered, "", "event 2 was modified",
+		},
+		{
+			"Removed entry",
+			func(lines [][]byte) [][]byte { return [][]byte{lines[0], lines[2]} },
+			exitTampered, "", "event 2 has sequence 3",
+		},
+		{
+			"Removed last entry",
+			func(lines [][]byte) [][]byte { return lines[:2] },
+			exitTampered, "", "the checkpoint is at event 3",
+		},
+		{
+			"Torn tail",
+			func(lines [][]byte) [][]byte { return append(lines, []byte(`{"sequence":4,"time":"2024-01-`)) },
+			exitOK, "OK: 3 events verified", "torn final line",
+		},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			path, lines := setupTestLog(t)
+			os.WriteFile(path, bytes.Join(entry.edit(lines), nil), 0o600)
+
+			var stdout, stderr bytes.Buffer
+			status := run([]string{path}, nil, &stdout, &stderr)
+
+			if status != entry.expectedStatus {
+				t.Errorf("Expected status %d, received %d with %s", entry.expectedStatus, status, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), entry.expectedOutput) {
+				t.Errorf("Expected the output to contain %q, received %q", entry.expectedOutput, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), entry.expectedErr) {
+				t.Errorf("Expected the errors to contain %q, received %q", entry.expectedErr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunFromStdin(t *testing.T) {
+	_, lines := setupTestLog(t)
+
+	var stdout, stderr bytes.Buffer
+	status := run(nil, bytes.NewReader(bytes.Join(lines, nil)), &stdout, &stderr)
+
+	if status != exitOK || !strings.Contains(stdout.String(), "OK: 3 events verified") {
+		t.Errorf("Expected the log to verify, received status %d with %s%s", status, stdout.String(), stderr.String())
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/analytics"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+)
+
+// Number of retailers returned when the request sets no limit, and the most it can ask for
+const (
+	defaultTopRetailers = 10
+	maxTopRetailers     = 100
+)
+
+type RangeResponse struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+type SummaryResponse struct {
+	RangeResponse
+	Receipts      int     `json:"receipts"`
+	PointsIssued  int     `json:"pointsIssued"`
+	AveragePoints float64 `json:"averagePoints"`
+	Spend         string  `json:"spend"`
+}
+
+type DayResponse struct {
+	Date     string `json:"date"`
+	Receipts int    `json:"receipts"`
+	Points   int    `json:"points"`
+	Spend    string `json:"spend"`
+}
+
+type RetailerResponse struct {
+	Retailer string `json:"retailer"`
+	Receipts int    `json:"receipts"`
+	Points   int    `json:"points"`
+	Spend    string `json:"spend"`
+}
+
+type HourResponse struct {
+	Hour     int `json:"hour"`
+	Receipts int `json:"receipts"`
+}
+
+// Return the points issued, receipts and spend of the tenant in the range
+func (h *Handlers) AnalyticsSummary(w http.ResponseWriter, r *http.Request) {
+	dates, ok := h.analyticsRange(w, r)
+	if !ok {
+		return
+	}
+
+	summary := h.Analytics.Summary(tenant.FromContext(r.Context()).ID, dates)
+	response := SummaryResponse{
+		RangeResponse: rangeResponse(dates),
+		Receipts:      summary.Receipts,
+		PointsIssued:  summary.Points,
+		AveragePoints: summary.AveragePoints,
+		Spend:         analytics.FormatCents(summary.SpendCents),
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+	}
+}
+
+// Return the receipts, points and spend of every day of the range
+func (h *Handlers) AnalyticsReceiptsPerDay(w http.ResponseWriter, r *http.Request) {
+	dates, ok := h.analyticsRange(w, r)
+	if !ok {
+		return
+	}
+
+	days, err := h.Analytics.Days(tenant.FromContext(r.Context()).ID, dates)
+	if errors.Is(err, analytics.ErrRangeTooLong) {
+		msg := map[string]string{"error": "The receipts span more than " + strconv.Itoa(h.Analytics.MaxDays) + " days, set from and to."}
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, msg)
+		return
+	}
+	response := make([]DayResponse, 0, len(days))
+	for _, day := range days {
+		response = append(response, DayResponse{
+			Date:     day.Date,
+			Receipts: day.Receipts,
+			Points:   day.Points,
+			Spend:    analytics.FormatCents(day.SpendCents),
+		})
+	}
+
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+	}
+}
+
+// Return the retailers with the most spend, or points, in the range
+func (h *Handlers) AnalyticsTopRetailers(w http.ResponseWriter, r *http.Request) {
+	dates, ok := h.analyticsRange(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	invalid := make(map[string]string)
+	by := query.Get("by")
+	if by == "" {
+		by = analytics.BySpend
+	}
+	if by != analytics.BySpend && by != analytics.ByPoints {
+		invalid["by"] = "This parameter must be spend or points"
+	}
+	limit := defaultTopRetailers
+	if query.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 || limit > maxTopRetailers {
+			invalid["limit"] = "This parameter must be a number between 1 and " + strconv.Itoa(maxTopRetailers)
+		}
+	}
+	if len(invalid) > 0 {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, invalid)
+		return
+	}
+
+	retailers := h.Analytics.TopRetailers(tenant.FromContext(r.Context()).ID, dates, by, limit)
+	response := make([]RetailerResponse, 0, len(retailers))
+	for _, retailer := range retailers {
+		response = append(response, RetailerResponse{
+			Retailer: retailer.Name,
+			Receipts: retailer.Receipts,
+			Points:   retailer.Points,
+			Spend:    analytics.FormatCents(retailer.SpendCents),
+		})
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+	}
+}
+
+// Return the number of receipts purchased during each hour of the day
+func (h *Handlers) AnalyticsHours(w http.ResponseWriter, r *http.Request) {
+	dates, ok := h.analyticsRange(w, r)
+	if !ok {
+		return
+	}
+
+	hours := h.Analytics.Hours(tenant.FromContext(r.Context()).ID, dates)
+	response := make([]HourResponse, len(hours))
+	for hour, receipts := range hours {
+		response[hour] = HourResponse{Hour: hour, Receipts: receipts}
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+	}
+}
+
+// Reads the range of purchase dates from the from and to query parameters,
+// and responds with the errors when they are invalid or span more than
+// the configured number of days
+func (h *Handlers) analyticsRange(w http.ResponseWriter, r *http.Request) (analytics.Range, bool) {
+	query := r.URL.Query()
+	var dates analytics.Range
+
+	invalid := make(map[string]string)
+	for param, value := range map[string]*time.Time{"from": &dates.From, "to": &dates.To} {
+		if query.Get(param) == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", query.Get(param))
+		if err != nil {
+			invalid[param] = "This parameter must be a date such as 2022-01-31"
+			continue
+		}
+		*value = parsed
+	}
+	if len(invalid) == 0 && dates.Validate() != nil {
+		invalid["to"] = "This parameter cannot be before from"
+	}
+	if maxDays := h.Analytics.MaxDays; len(invalid) == 0 && maxDays > 0 && dates.Days() > maxDays {
+		invalid["to"] = "This parameter cannot be more than " + strconv.Itoa(maxDays) + " days after from"
+	}
+	if len(invalid) > 0 {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, invalid)
+		return dates, false
+	}
+
+	return dates, true
+}
+
+func rangeResponse(dates analytics.Range) RangeResponse {
+	var response RangeResponse
+	if !dates.From.IsZero() {
+		response.From = dates.From.Format("2006-01-02")
+	}
+	if !dates.To.IsZero() {
+		response.To = dates.To.Format("2006-01-02")
+	}
+	return response
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Stores receipts of two days and of another tenant
+func setupAnalytics() *TestDependencies {
+	d := setupTestDependencies()
+	d.receiptStore.Insert(models.Receipt{ID: "a", Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "35.35", Points: 28})
+	d.receiptStore.Insert(models.Receipt{ID: "b", Retailer: "Target", PurchaseDate: "2022-01-03", PurchaseTime: "14:33", Total: "1.25", Points: 31})
+	d.receiptStore.Insert(models.Receipt{ID: "c", Retailer: "M&M Corner Market", PurchaseDate: "2022-01-03", PurchaseTime: "14:33", Total: "9.00", Points: 109})
+	d.receiptStore.Insert(models.Receipt{ID: "d", TenantID: "brand-a", Retailer: "Costco", PurchaseDate: "2022-01-01", PurchaseTime: "09:00", Total: "100.00", Points: 6})
+	return d
+}
+
+func analyticsRequest(t *testing.T, handler http.HandlerFunc, url string, expectedStatus int, dst any) {
+	t.Helper()
+	resp := httptest.NewRecorder()
+	handler(resp, httptest.NewRequest(http.MethodGet, url, nil))
+
+	if resp.Code != expectedStatus {
+		t.Fatalf("Expected status %d for %s, got %d with %s", expectedStatus, url, resp.Code, resp.Body.String())
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+}
+
+func TestAnalyticsSummary(t *testing.T) {
+	d := setupAnalytics()
+
+	var summary SummaryResponse
+	analyticsRequest(t, d.handlers.AnalyticsSummary, "/analytics/summary", http.StatusOK, &summary)
+	if summary.Receipts != 3 || summary.PointsIssued != 168 || summary.AveragePoints != 56 || summary.Spend != "45.60" {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	analyticsRequest(t, d.handlers.AnalyticsSummary, "/analytics/summary?from=2022-01-02&to=2022-01-31", http.StatusOK, &summary)
+	if summary.From != "2022-01-02" || summary.Receipts != 2 || summary.PointsIssued != 140 || summary.AveragePoints != 70 {
+		t.Errorf("Unexpected summary of the range %+v", summary)
+	}
+
+	// New receipts are counted right away
+	d.receiptStore.Insert(models.Receipt{ID: "e", Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "10:00", Total: "1.00", Points: 10})
+	analyticsRequest(t, d.handlers.AnalyticsSummary, "/analytics/summary?from=2022-01-02", http.StatusOK, &summary)
+	if summary.Receipts != 3 || summary.PointsIssued != 150 {
+		t.Errorf("Expected the new receipt to be counted, received %+v", summary)
+	}
+
+	var invalid map[string]string
+	analyticsRequest(t, d.handlers.AnalyticsSummary, "/analytics/summary?from=2022-01-31&to=2022-01-01", http.StatusBadRequest, &invalid)
+	if invalid["to"] == "" {
+		t.Errorf("Expected an error on to, received %+v", invalid)
+	}
+	analyticsRequest(t, d.handlers.AnalyticsSummary, "/analytics/summary?from=01/01/2022", http.StatusBadRequest, &invalid)
+	if invalid["from"] == "" {
+		t.Errorf("Expected an error on from, received %+v", invalid)
+	}
+}
+
+func TestAnalyticsReceiptsPerDay(t *testing.T) {
+	d := setupAnalytics()
+
+	var days []DayResponse
+	analyticsRequest(t, d.handlers.AnalyticsReceiptsPerDay, "/analytics/receipts-per-day?to=2022-01-04", http.StatusOK, &days)
+	expected := []DayResponse{
+		{"2022-01-01", 1, 28, "35.35"},
+		{"2022-01-02", 0, 0, "0.00"},
+		{"2022-01-03", 2, 140, "10.25"},
+		{"2022-01-04", 0, 0, "0.00"},
+	}
+	if len(days) != len(expected) {
+		t.Fatalf("Expected %+v, received %+v", expected, days)
+	}
+	for i := range expected {
+		if days[i] != expected[i] {
+			t.Errorf("Expected %+v, received %+v", expected[i], days[i])
+		}
+	}
+
+	var invalid map[string]string
+	analyticsRequest(t, d.handlers.AnalyticsReceiptsPerDay, "/analytics/receipts-per-day?from=2000-01-01&to=2022-01-01", http.StatusBadRequest, &invalid)
+	analyticsRequest(t, d.handlers.AnalyticsReceiptsPerDay, "/analytics/receipts-per-day?from=0001-01-01&to=9999-12-31", http.StatusBadRequest, &invalid)
+	if invalid["to"] == "" {
+		t.Errorf("Expected an error on to, received %+v", invalid)
+	}
+
+	// Half-open ranges are limited by the days with receipts they reach
+	analyticsRequest(t, d.handlers.AnalyticsReceiptsPerDay, "/analytics/receipts-per-day?from=2000-01-01", http.StatusBadRequest, &invalid)
+	if invalid["error"] == "" {
+		t.Errorf("Expected an error, received %+v", invalid)
+	}
+}
+
+func TestAnalyticsTopRetailers(t *testing.T) {
+	d := setupAnalytics()
+
+	var retailers []RetailerResponse
+	analyticsRequest(t, d.handlers.AnalyticsTopRetailers, "/analytics/top-retailers", http.StatusOK, &retailers)
+	if len(retailers) != 2 || retailers[0] != (RetailerResponse{"Target", 2, 59, "36.60"}) {
+		t.Errorf("Expected Target to lead by spend, received %+v", retailers)
+	}
+
+	analyticsRequest(t, d.handlers.AnalyticsTopRetailers, "/analytics/top-retailers?by=points&limit=1", http.StatusOK, &retailers)
+	if len(retailers) != 1 || retailers[0].Retailer != "M&M Corner Market" {
+		t.Errorf("Expected M&M Corner Market to lead by points, received %+v", retailers)
+	}
+
+	var invalid map[string]string
+	analyticsRequest(t, d.handlers.AnalyticsTopRetailers, "/analytics/top-retailers?by=receipts&limit=0", http.StatusBadRequest, &invalid)
+	if invalid["by"] == "" || invalid["limit"] == "" {
+		t.Errorf("Expected errors on by and limit, received %+v", invalid)
+	}
+}
+
+func TestAnalyticsHours(t *testing.T) {
+	d := setupAnalytics()
+
+	var hours []HourResponse
+	analyticsRequest(t, d.handlers.AnalyticsHours, "/analytics/hours", http.StatusOK, &hours)
+	if len(hours) != 24 || hours[13].Receipts != 1 || hours[14] != (HourResponse{14, 2}) || hours[9].Receipts != 0 {
+		t.Errorf("Unexpected hours %+v", hours)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/requestid"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+)
+
+// Number of audit events returned when the request sets no limit
+const defaultAuditLimit = 100
+
+// Return the audit events of the tenant matching the query filters, most recent first
+func (h *Handlers) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		TenantID:  tenant.FromContext(r.Context()).ID,
+		Principal: query.Get("principal"),
+		Action:    query.Get("action"),
+		Resource:  query.Get("resource"),
+		RequestID: query.Get("requestId"),
+		Limit:     defaultAuditLimit,
+	}
+
+	invalid := make(map[string]string)
+	for param, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if query.Get(param) == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, query.Get(param))
+		if err != nil {
+			invalid[param] = "This parameter must be an RFC 3339 time"
+			continue
+		}
+		*value = parsed
+	}
+	if query.Get("limit") != "" {
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 {
+			invalid["limit"] = "This parameter must be a positive number"
+		}
+		filter.Limit = limit
+	}
+	if len(invalid) > 0 {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, invalid)
+		return
+	}
+
+	events := h.Audit.Events(filter)
+	if events == nil {
+		events = []audit.Event{}
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, events)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Records the mutation of the resource by the principal of the request.
+// Before and after are the states of the resource, nil when it does not exist
+func (h *Handlers) audit(ctx context.Context, action, resource string, before, after any) {
+	h.auditTenant(ctx, tenant.FromContext(ctx).ID, action, resource, before, after)
+}
+
+// Records the mutation of the resource of the tenant by the principal of the request,
+// for mutations outside the tenant in the context such as restoring a dump
+func (h *Handlers) auditTenant(ctx context.Context, tenantID, action, resource string, before, after any) {
+	_, err := h.Audit.Record(audit.Event{
+		TenantID:   tenantID,
+		Principal:  auth.PrincipalFromContext(ctx).Name(),
+		RequestID:  requestid.FromContext(ctx),
+		Action:     action,
+		Resource:   resource,
+		BeforeHash: audit.HashState(before),
+		AfterHash:  audit.HashState(after),
+	})
+	if err != nil {
+		h.ErrorLog.Printf("Failed to record %s of %s in the audit log: %v", action, resource, err)
+	}
+}
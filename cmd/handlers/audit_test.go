@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/requestid"
+	"kweeuhree.receipt-processor-challenge/internal/tiers"
+)
+
+func TestAuditTrail(t *testing.T) {
+	d := setupTestDependencies()
+
+	// Insert, update and delete a receipt on behalf of a principal
+	body, _ := json.Marshal(ValidReceipt)
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer(body))
+	ctx := auth.WithPrincipal(req.Context(), &auth.Principal{ID: "ops", Method: "apikey"})
+	req = req.WithContext(requestid.WithID(ctx, "request-1"))
+	resp := httptest.NewRecorder()
+	d.handlers.ProcessReceipt(resp, req)
+	var processed IdResponse
+	json.NewDecoder(resp.Body).Decode(&processed)
+
+	receiptRequest(d.handlers.PatchReceipt, http.MethodPatch, processed.ID, `{"total": "3.00"}`, `"1"`)
+	receiptRequest(d.handlers.DeleteReceipt, http.MethodDelete, processed.ID, "", "")
+
+	events := d.handlers.Audit.Events(audit.Filter{Resource: receiptResource(processed.ID)})
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 audit events, received %d", len(events))
+	}
+	insert, update, deletion := events[2], events[1], events[0]
+	if insert.Action != audit.ActionReceiptInsert || insert.Principal != "apikey:ops" || insert.RequestID != "request-1" {
+		t.Errorf("Expected the insert by apikey:ops in request-1, received %+v", insert)
+	}
+	if insert.BeforeHash != "" || insert.AfterHash != update.BeforeHash {
+		t.Errorf("Expected the update to start from the inserted state, received %+v and %+v", insert, update)
+	}
+	if deletion.Action != audit.ActionReceiptDelete || deletion.BeforeHash != update.AfterHash || deletion.AfterHash != "" {
+		t.Errorf("Expected the deletion of the updated state, received %+v", deletion)
+	}
+	if err := d.handlers.Audit.Verify(); err != nil {
+		t.Errorf("Expected an intact chain, received %v", err)
+	}
+}
+
+func TestAuditPointsAdjustment(t *testing.T) {
+	d := setupTestDependencies()
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+
+	memberRequest(d.handlers.CreateAdjustment, member.ID, `{"points": 50, "reason": "Goodwill"}`, "adjust-1")
+	// A replayed request does not move points again
+	memberRequest(d.handlers.CreateAdjustment, member.ID, `{"points": 50, "reason": "Goodwill"}`, "adjust-1")
+
+	events := d.handlers.Audit.Events(audit.Filter{Action: audit.ActionPointsAdjustment})
+	if len(events) != 1 {
+		t.Fatalf("Expected a single adjustment event, received %d", len(events))
+	}
+	if events[0].BeforeHash == events[0].AfterHash {
+		t.Errorf("Expected the balance to differ before and after the adjustment")
+	}
+}
+
+func TestAuditReceiptPoints(t *testing.T) {
+	d := setupTestDependencies()
+	program, _ := tiers.NewProgram(tiers.BasisLifetimePoints, []tiers.Tier{
+		{Name: "bronze", Threshold: 0, Multiplier: 1},
+		{Name: "gold", Threshold: 30, Multiplier: 1},
+	})
+	d.handlers.Tiers = program
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+
+	// The receipt earns 31 points and promotes the member to gold,
+	// deleting it takes them back and demotes the member again
+	receiptID := processMemberReceipt(t, d, member.ID)
+	receiptRequest(d.handlers.DeleteReceipt, http.MethodDelete, receiptID, "", "")
+
+	tests := []struct {
+		action   string
+		expected int
+	}{
+		{audit.ActionPointsEarn, 1},
+		{audit.ActionPointsReversal, 1},
+		{audit.ActionMemberTier, 2},
+	}
+
+	for _, entry := range tests {
+		events := d.handlers.Audit.Events(audit.Filter{Action: entry.action, Resource: models.MemberAccount(member.ID)})
+		if len(events) != entry.expected {
+			t.Errorf("Expected %d %s events, received %d", entry.expected, entry.action, len(events))
+		}
+	}
+
+	earn := d.handlers.Audit.Events(audit.Filter{Action: audit.ActionPointsEarn})
+	reversal := d.handlers.Audit.Events(audit.Filter{Action: audit.ActionPointsReversal})
+	if len(earn) == 1 && len(reversal) == 1 && reversal[0].BeforeHash != earn[0].AfterHash {
+		t.Errorf("Expected the reversal to start from the balance left by the earn")
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	d := setupTestDependencies()
+	for _, action := range []string{audit.ActionReceiptInsert, audit.ActionReceiptInsert, audit.ActionReceiptDelete} {
+		d.handlers.audit(context.Background(), action, "receipt:1", nil, nil)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedEvents int
+	}{
+		{"All events", "", http.StatusOK, 3},
+		{"By action", "?action=receipt.insert", http.StatusOK, 2},
+		{"By principal", "?principal=apikey:ops", http.StatusOK, 0},
+		{"With limit", "?limit=1", http.StatusOK, 1},
+		{"Invalid limit", "?limit=none", http.StatusBadRequest, 0},
+		{"Invalid since", "?since=yesterday", http.StatusBadRequest, 0},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/audit"+entry.query, nil)
+			resp := httptest.NewRecorder()
+			d.handlers.ListAuditEvents(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if resp.Code != http.StatusOK {
+				return
+			}
+			var events []audit.Event
+			if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(events) != entry.expectedEvents {
+				t.Errorf("Expected %d events, received %d", entry.expectedEvents, len(events))
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/receiptcsv"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+)
+
+// Largest CSV file accepted by the import
+const maxImportBytes = 10 << 20
+
+// Receipts written between two flushes of the export
+const exportFlushInterval = 100
+
+type ImportResult struct {
+	// Line of the first row of the receipt
+	Line int `json:"line"`
+	// Value of the id column of the receipt, or its line
+	Key         string            `json:"key"`
+	ID          string            `json:"id,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	FieldErrors map[string]string `json:"fieldErrors,omitempty"`
+}
+
+type ImportResponse struct {
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// Imports the receipts of a CSV file. Every receipt is validated and
+// stored on its own, and the result of every receipt is reported
+func (h *Handlers) ImportReceipts(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" {
+		msg := map[string]string{"error": "Content-Type must be text/csv."}
+		h.Helpers.EncodeJSON(w, http.StatusUnsupportedMediaType, msg)
+		return
+	}
+
+	mapping, err := h.csvMapping(r.URL.Query())
+	if err != nil {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	records, err := receiptcsv.Read(http.MaxBytesReader(w, r.Body, maxImportBytes), mapping)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.Helpers.ClientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	tenantID := tenant.FromContext(r.Context()).ID
+	response := ImportResponse{Results: make([]ImportResult, 0, len(records))}
+	for _, record := range records {
+		result := ImportResult{Line: record.Line, Key: record.Key}
+		result.ID, result.Error, result.FieldErrors = h.importRecord(r, tenantID, record)
+		if result.ID != "" {
+			response.Imported++
+		} else {
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+	}
+}
+
+// Validates and stores a receipt read from CSV, and returns its id or why it was not stored
+func (h *Handlers) importRecord(r *http.Request, tenantID string, record receiptcsv.Record) (string, string, map[string]string) {
+	if record.Err != nil {
+		return "", record.Err.Error(), nil
+	}
+
+	input := ReceiptInput{
+		Retailer:     record.Retailer,
+		PurchaseDate: record.PurchaseDate,
+		PurchaseTime: record.PurchaseTime,
+		Total:        record.Total,
+		Items:        record.Items,
+		MemberID:     record.MemberID,
+		TimeZone:     record.TimeZone,
+	}
+	h.ValidateReceipt(tenantID, &input)
+	if !input.Valid() {
+		return "", "The receipt is invalid.", input.FieldErrors
+	}
+
+	id, err := h.CreateAndStore(r.Context(), input)
+	if errors.Is(err, models.ErrQuotaExceeded) {
+		return "", "Receipt quota exceeded for this tenant.", nil
+	}
+	if err != nil {
+		h.ErrorLog.Printf("Failed to store imported receipt: %v", err)
+		return "", "The receipt could not be stored.", nil
+	}
+
+	return id, "", nil
+}
+
+// Streams the receipts of the tenant as CSV, with one row per item
+// unless the layout is receipts
+func (h *Handlers) ExportReceipts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "csv" {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be csv."})
+		return
+	}
+
+	mapping, err := h.csvMapping(query)
+	if err != nil {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	layout := query.Get("layout")
+	if layout == "" {
+		layout = receiptcsv.LayoutItems
+	}
+	writer, err := receiptcsv.NewWriter(w, mapping, layout)
+	if err != nil {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="receipts.csv"`)
+
+	// The response has started once rows are written, so failures can only be logged
+	receipts := h.ReceiptStore.List(tenant.FromContext(r.Context()).ID)
+	for i, receipt := range receipts {
+		if err := writer.Write(receipt); err != nil {
+			h.ErrorLog.Printf("Failed to export receipts: %v", err)
+			return
+		}
+		if (i+1)%exportFlushInterval == 0 {
+			if err := writer.Flush(); err != nil {
+				h.ErrorLog.Printf("Failed to export receipts: %v", err)
+				return
+			}
+		}
+	}
+
+	// A tenant without receipts still receives the header row
+	if len(receipts) == 0 {
+		writer.WriteHeader()
+	}
+	if err := writer.Flush(); err != nil {
+		h.ErrorLog.Printf("Failed to export receipts: %v", err)
+	}
+}
+
+// Returns the configured CSV mapping overridden by the map.<field> query parameters
+func (h *Handlers) csvMapping(query url.Values) (receiptcsv.Mapping, error) {
+	override := make(receiptcsv.Mapping)
+	for name, values := range query {
+		if field, found := strings.CutPrefix(name, "map."); found {
+			override[field] = values[0]
+		}
+	}
+	if err := override.Validate(); err != nil {
+		return nil, err
+	}
+
+	return h.CSVMapping.Merge(override), nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/receiptcsv"
+)
+
+const importCSV = "Receipt,Store,purchaseDate,purchaseTime,total,timeZone,shortDescription,price\n" +
+	"a,Target,2022-01-02,13:13,1.25,,Pepsi - 12-oz,1.25\n" +
+	"b,Target,2022-01-02,13:13,2.50,America/New_York,Pepsi - 12-oz,1.25\n" +
+	"b,,,,,,Pepsi - 12-oz,1.25\n" +
+	"c,,2022-01-02,13:13,1.25,,Pepsi - 12-oz,1.25\n"
+
+func TestImportReceipts(t *testing.T) {
+	d := setupTestDependencies()
+	d.handlers.CSVMapping = receiptcsv.Mapping{receiptcsv.FieldID: "Receipt"}
+
+	req := httptest.NewRequest(http.MethodPost, "/receipts/import?map.retailer=Store", strings.NewReader(importCSV))
+	req.Header.Set("Content-Type", "text/csv")
+	resp := httptest.NewRecorder()
+
+	d.handlers.ImportReceipts(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d with %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var response ImportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Imported != 2 || response.Failed != 1 || len(response.Results) != 3 {
+		t.Fatalf("Expected 2 imported and 1 failed receipt, received %+v", response)
+	}
+
+	// The first receipt scores like ValidReceipt, the rows of b form a single receipt
+	first, err := d.receiptStore.Get(models.DefaultTenantID, response.Results[0].ID)
+	if err != nil || first.Points != 31 {
+		t.Errorf("Expected the first receipt to score 31 points, received %+v, %v", first, err)
+	}
+	second, _ := d.receiptStore.Get(models.DefaultTenantID, response.Results[1].ID)
+	if len(second.Items) != 2 || second.Total != "2.50" {
+		t.Errorf("Expected the rows of receipt b to be grouped, received %+v", second)
+	}
+	if purchasedAt := time.Date(2022, 1, 2, 18, 13, 0, 0, time.UTC); second.TimeZone != "America/New_York" || !second.PurchasedAt.Equal(purchasedAt) {
+		t.Errorf("Expected receipt b to be read in New York, received %s at %s", second.TimeZone, second.PurchasedAt)
+	}
+	failed := response.Results[2]
+	if failed.Key != "c" || failed.Line != 5 || failed.FieldErrors["retailerName"] == "" {
+		t.Errorf("Expected receipt c to fail without a retailer, received %+v", failed)
+	}
+}
+
+func TestImportReceiptsErrors(t *testing.T) {
+	d := setupTestDependencies()
+	tests := []struct {
+		name           string
+		contentType    string
+		query          string
+		body           string
+		expectedStatus int
+	}{
+		{"JSON body", "application/json", "", `{}`, http.StatusUnsupportedMediaType},
+		{"No item columns", "text/csv", "", "retailer,total\nTarget,1.25\n", http.StatusBadRequest},
+		{"Unknown mapped field", "text/csv", "?map.store=Store", importCSV, http.StatusBadRequest},
+		{"Too large", "text/csv", "", "retailer,items\n" + strings.Repeat("a", maxImportBytes), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/receipts/import"+entry.query, strings.NewReader(entry.body))
+			req.Header.Set("Content-Type", entry.contentType)
+			resp := httptest.NewRecorder()
+
+			d.handlers.ImportReceipts(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+		})
+	}
+}
+
+func TestExportReceipts(t *testing.T) {
+	d := setupTestDependencies()
+	receipt, _ := d.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	d.receiptStore.Insert(receipt)
+	d.receiptStore.Insert(models.Receipt{ID: "other", TenantID: "brand-a"})
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedRows   []string
+	}{
+		{"Item rows", "?format=csv", http.StatusOK, []string{
+			"id,retailer,purchaseDate,purchaseTime,total,memberId,points,timeZone,shortDescription,price",
+			receipt.ID + ",Target,2022-01-02,13:13,1.25,,31,UTC,Pepsi - 12-oz,1.25",
+		}},
+		{"Receipt rows with mapping", "?layout=receipts&map.points=Points", http.StatusOK, []string{
+			"id,retailer,purchaseDate,purchaseTime,total,memberId,Points,timeZone,items",
+			receipt.ID + `,Target,2022-01-02,13:13,1.25,,31,UTC,"[{""ShortDescription"":""Pepsi - 12-oz"",""Price"":""1.25""}]"`,
+		}},
+		{"Unknown format", "?format=xlsx", http.StatusBadRequest, nil},
+		{"Unknown layout", "?layout=columns", http.StatusBadRequest, nil},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/receipts/export"+entry.query, nil)
+			resp := httptest.NewRecorder()
+
+			d.handlers.ExportReceipts(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if entry.expectedRows == nil {
+				return
+			}
+			if contentType := resp.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+				t.Errorf("Expected a CSV response, received %s", contentType)
+			}
+			expected := strings.Join(entry.expectedRows, "\n") + "\n"
+			if resp.Body.String() != expected {
+				t.Errorf("Expected:\n%s\nReceived:\n%s", expected, resp.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/storedump"
+)
+
+// Restore modes
+const (
+	// The dump replaces every receipt of the store
+	RestoreReplace = "replace"
+	// The dump is added to the store, replacing receipts with the same tenant and id
+	RestoreMerge = "merge"
+)
+
+// Largest dump accepted by the restore unless configured otherwise.
+// A restore holds the whole dump in memory until it is checked
+const DefaultMaxRestoreBytes = 64 << 20
+
+type RestoreResponse struct {
+	Mode string `json:"mode"`
+	// Receipts read from the dump
+	Restored int `json:"restored"`
+	// Receipts held by the store after the restore, deleted ones included
+	Receipts int `json:"receipts"`
+}
+
+// Streams every receipt of every tenant as an NDJSON dump
+func (h *Handlers) DumpStore(w http.ResponseWriter, r *http.Request) {
+	if !h.spansTenants(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", storedump.ContentType)
+	w.Header().Set(storedump.VersionHeader, strconv.Itoa(storedump.Version))
+	w.Header().Set("Content-Disposition", `attachment; filename="receipts.ndjson"`)
+
+	// The response has started once lines are written, so failures can only
+	// be logged. The header announces the number of receipts, so a client
+	// detects a dump cut short
+	err := storedump.Write(w, h.ReceiptStore.Entries(), time.Now())
+	if err != nil {
+		h.ErrorLog.Printf("Failed to dump the receipt store: %v", err)
+	}
+}
+
+// Restores the store from an NDJSON dump, replacing its content or merging
+// the dump into it. Nothing is restored unless the whole dump is valid
+func (h *Handlers) RestoreStore(w http.ResponseWriter, r *http.Request) {
+	if !h.spansTenants(w, r) {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != storedump.ContentType {
+		msg := map[string]string{"error": "Content-Type must be " + storedump.ContentType + "."}
+		h.Helpers.EncodeJSON(w, http.StatusUnsupportedMediaType, msg)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = RestoreMerge
+	}
+	if mode != RestoreReplace && mode != RestoreMerge {
+		msg := map[string]string{"error": "mode must be replace or merge."}
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	maxBytes := h.MaxRestoreBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxRestoreBytes
+	}
+	header, entries, err := storedump.Read(http.MaxBytesReader(w, r.Body, maxBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.Helpers.ClientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err == nil {
+		err = h.checkMembers(entries)
+	}
+
+	// Receipts whose points may have to move, as they were before the restore
+	var previous []models.StoreEntry
+	if err == nil {
+		previous = h.ReceiptStore.Entries()
+		if mode == RestoreReplace {
+			err = h.ReceiptStore.Replace(entries)
+		} else {
+			err = h.ReceiptStore.Merge(entries)
+		}
+	}
+	if err != nil {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	h.reconcileLedger(r.Context(), mode, previous, entries)
+
+	response := RestoreResponse{Mode: mode, Restored: len(entries), Receipts: len(h.ReceiptStore.Entries())}
+	h.audit(r.Context(), audit.ActionStoreRestore, "store", nil, struct {
+		Header storedump.Header `json:"header"`
+		RestoreResponse
+	}{header, response})
+	h.InfoLog.Printf("Restored %d receipts from a dump of %s (%s)", len(entries), header.CreatedAt.Format(time.RFC3339), mode)
+
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+	}
+}
+
+// Dumps hold receipts only. Rejects the dump when one of its receipts
+// credits a member that does not exist, as processing it would
+func (h *Handlers) checkMembers(entries []models.StoreEntry) error {
+	for _, entry := range entries {
+		receipt := entry.Receipt
+		if receipt.MemberID == "" {
+			continue
+		}
+		if _, err := h.MemberStore.Get(receipt.TenantID, receipt.MemberID); err != nil {
+			return fmt.Errorf("receipt %s credits member %s, which does not exist in tenant %s", receipt.ID, receipt.MemberID, receipt.TenantID)
+		}
+	}
+	return nil
+}
+
+// Moves points so that members hold those of their live receipts after a
+// restore: receipts that are gone, deleted or changed give their points
+// back, and restored receipts credit theirs
+func (h *Handlers) reconcileLedger(ctx context.Context, mode string, previous, restored []models.StoreEntry) {
+	type key struct{ tenantID, id string }
+
+	var keys []key
+	receipts := func(entries []models.StoreEntry) map[key]models.Receipt {
+		byKey := make(map[key]models.Receipt, len(entries))
+		for _, entry := range entries {
+			k := key{models.TenantKey(entry.Receipt.TenantID), entry.Receipt.ID}
+			byKey[k] = entry.Receipt
+			keys = append(keys, k)
+		}
+		return byKey
+	}
+	before, after := receipts(previous), receipts(restored)
+
+	credited := func(receipt models.Receipt, exists bool) bool {
+		return exists && receipt.MemberID != "" && receipt.DeletedAt.IsZero()
+	}
+	reviewed := make(map[key]bool)
+	seen := make(map[key]bool, len(keys))
+	for _, k := range keys {
+		old, hadOld := before[k]
+		receipt, hasNew := after[k]
+		// A merge leaves the receipts missing from the dump untouched
+		if seen[k] || (mode == RestoreMerge && !hasNew) {
+			continue
+		}
+		seen[k] = true
+		if credited(old, hadOld) && credited(receipt, hasNew) && old.MemberID == receipt.MemberID &&
+			old.Points == receipt.Points && old.Total == receipt.Total {
+			continue
+		}
+
+		if credited(old, hadOld) {
+			if err := h.reverse(ctx, k.tenantID, old.MemberID, k.id); err != nil {
+				h.ErrorLog.Printf("Failed to reverse the points of restored receipt with ID %s. Error: %+v", k.id, err)
+			}
+			reviewed[key{k.tenantID, old.MemberID}] = true
+		}
+		if credited(receipt, hasNew) {
+			if err := h.earn(ctx, k.tenantID, receipt); err != nil {
+				h.ErrorLog.Printf("Failed to credit the points of restored receipt with ID %s. Error: %+v", k.id, err)
+			}
+			reviewed[key{k.tenantID, receipt.MemberID}] = true
+		}
+	}
+
+	for member := range reviewed {
+		h.reviewTier(ctx, member.tenantID, member.id)
+	}
+}
+
+// Dumps span every tenant, so principals bound to a tenant cannot use them
+func (h *Handlers) spansTenants(w http.ResponseWriter, r *http.Request) bool {
+	if principal := auth.PrincipalFromContext(r.Context()); principal != nil && principal.Tenant != "" {
+		msg := map[string]string{"error": "Dumps span every tenant and cannot be used by a principal bound to a tenant."}
+		h.Helpers.EncodeJSON(w, http.StatusForbidden, msg)
+		return false
+	}
+	return true
+}
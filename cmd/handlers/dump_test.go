@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/storedump"
+)
+
+// Returns the dump of the store served by the handlers
+func dumpStore(t *testing.T, d *TestDependencies) []byte {
+	t.Helper()
+	resp := httptest.NewRecorder()
+	d.handlers.DumpStore(resp, httptest.NewRequest(http.MethodGet, "/admin/dump", nil))
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	if version := resp.Header().Get(storedump.VersionHeader); version != strconv.Itoa(storedump.Version) {
+		t.Errorf("Expected format version %d, received %q", storedump.Version, version)
+	}
+	return resp.Body.Bytes()
+}
+
+func restoreRequest(d *TestDependencies, mode string, dump []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/restore?mode="+mode, bytes.NewReader(dump))
+	req.Header.Set("Content-Type", storedump.ContentType)
+	resp := httptest.NewRecorder()
+	d.handlers.RestoreStore(resp, req)
+	return resp
+}
+
+func TestDumpAndRestoreStore(t *testing.T) {
+	source := setupTestDependencies()
+	receipt, _ := source.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	source.receiptStore.Insert(receipt)
+	source.receiptStore.Insert(models.Receipt{ID: "other", TenantID: "brand-a"})
+	dump := dumpStore(t, source)
+
+	tests := []struct {
+		mode             string
+		expectedReceipts int
+	}{
+		{RestoreReplace, 2},
+		{RestoreMerge, 3},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.mode, func(t *testing.T) {
+			d := setupTestDependencies()
+			d.receiptStore.Insert(models.Receipt{ID: "existing"})
+
+			resp := restoreRequest(d, entry.mode, dump)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d with %s", http.StatusOK, resp.Code, resp.Body.String())
+			}
+			var response RestoreResponse
+			json.NewDecoder(resp.Body).Decode(&response)
+			if response.Restored != 2 || response.Receipts != entry.expectedReceipts {
+				t.Errorf("Expected 2 restored and %d stored receipts, received %+v", entry.expectedReceipts, response)
+			}
+
+			restored, err := d.receiptStore.Get(models.DefaultTenantID, receipt.ID)
+			if err != nil || restored.Points != 31 || restored.Retailer != receipt.Retailer {
+				t.Errorf("Expected the receipt to be restored, received %+v, %v", restored, err)
+			}
+			if events := d.handlers.Audit.Events(audit.Filter{Action: audit.ActionStoreRestore}); len(events) != 1 {
+				t.Errorf("Expected the restore to be audited, received %d events", len(events))
+			}
+		})
+	}
+}
+
+func TestRestoreStoreErrors(t *testing.T) {
+	d := setupTestDependencies()
+	d.receiptStore.Insert(models.Receipt{ID: "existing"})
+	dump := dumpStore(t, d)
+	truncated := strings.SplitN(string(dump), "\n", 2)[0] + "\n"
+	truncated = strings.Replace(truncated, `"receipts":1`, `"receipts":2`, 1)
+
+	tests := []struct {
+		name           string
+		mode           string
+		contentType    string
+		body           string
+		principal      *auth.Principal
+		expectedStatus int
+	}{
+		{"Unknown mode", "overwrite", storedump.ContentType, string(dump), nil, http.StatusBadRequest},
+		{"JSON body", RestoreReplace, "application/json", string(dump), nil, http.StatusUnsupportedMediaType},
+		{"Not a dump", RestoreReplace, storedump.ContentType, `{"id":"a"}`, nil, http.StatusBadRequest},
+		{"Cut short", RestoreReplace, storedump.ContentType, truncated, nil, http.StatusBadRequest},
+		{"Tenant-bound principal", RestoreReplace, storedump.ContentType, string(dump), &auth.Principal{ID: "a", Tenant: "brand-a"}, http.StatusForbidden},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/restore?mode="+entry.mode, strings.NewReader(entry.body))
+			req.Header.Set("Content-Type", entry.contentType)
+			req = req.WithContext(auth.WithPrincipal(req.Context(), entry.principal))
+			resp := httptest.NewRecorder()
+
+			d.handlers.RestoreStore(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			// A rejected restore leaves the store unchanged
+			if _, err := d.receiptStore.Get(models.DefaultTenantID, "existing"); err != nil {
+				t.Errorf("Expected the store to be unchanged, got %v", err)
+			}
+		})
+	}
+}
+
+// Stores two receipts of member m1, and returns a dump that moves one of
+// them to member m2 before a third receipt of m2 is stored
+func setupLedgerRestore(t *testing.T) (*TestDependencies, []byte) {
+	d := setupTestDependencies()
+	d.handlers.MemberStore.Insert(models.Member{ID: "m1"})
+	d.handlers.MemberStore.Insert(models.Member{ID: "m2"})
+	kept, _ := d.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	kept.MemberID = "m1"
+	moved, _ := d.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	moved.MemberID = "m1"
+	for _, receipt := range []models.Receipt{kept, moved} {
+		d.receiptStore.Insert(receipt)
+		d.handlers.Ledger.Earn(models.DefaultTenantID, receipt.MemberID, receipt.ID, receipt.Points, 125, "tester")
+	}
+	lines := strings.Split(string(dumpStore(t, d)), "\n")
+	for i, line := range lines {
+		if strings.Contains(line, `"id":"`+moved.ID+`"`) {
+			lines[i] = strings.Replace(line, `"memberId":"m1"`, `"memberId":"m2"`, 1)
+		}
+	}
+	dump := []byte(strings.Join(lines, "\n"))
+	gone, _ := d.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	gone.MemberID = "m2"
+	d.receiptStore.Insert(gone)
+	d.handlers.Ledger.Earn(models.DefaultTenantID, gone.MemberID, gone.ID, gone.Points, 125, "tester")
+
+	return d, dump
+}
+
+func TestRestoreStoreLedger(t *testing.T) {
+	tests := []struct {
+		mode       string
+		expectedM1 int
+		expectedM2 int
+	}{
+		// The earlier receipt of m2 is no longer stored
+		{RestoreReplace, 31, 31},
+		// The earlier receipt of m2 is left alone
+		{RestoreMerge, 31, 62},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.mode, func(t *testing.T) {
+			d, dump := setupLedgerRestore(t)
+			if resp := restoreRequest(d, entry.mode, dump); resp.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d with %s", http.StatusOK, resp.Code, resp.Body.String())
+			}
+			if balance := d.handlers.Ledger.Balance(models.DefaultTenantID, models.MemberAccount("m1")); balance != entry.expectedM1 {
+				t.Errorf("Expected m1 to hold %d points, holds %d", entry.expectedM1, balance)
+			}
+			if balance := d.handlers.Ledger.Balance(models.DefaultTenantID, models.MemberAccount("m2")); balance != entry.expectedM2 {
+				t.Errorf("Expected m2 to hold %d points, holds %d", entry.expectedM2, balance)
+			}
+		})
+	}
+
+	// Restoring the same dump again moves no points
+	d, dump := setupLedgerRestore(t)
+	restoreRequest(d, RestoreMerge, dump)
+	entries := len(d.handlers.Ledger.Entries(models.DefaultTenantID, models.MemberAccount("m1")))
+	restoreRequest(d, RestoreMerge, dump)
+	if again := len(d.handlers.Ledger.Entries(models.DefaultTenantID, models.MemberAccount("m1"))); again != entries {
+		t.Errorf("Expected no new ledger entry, received %d more", again-entries)
+	}
+
+	// Receipts cannot credit members that do not exist
+	unknown := bytes.Replace(dump, []byte(`"memberId":"m2"`), []byte(`"memberId":"m3"`), 1)
+	if resp := restoreRequest(d, RestoreReplace, unknown); resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown member, got %d", http.StatusBadRequest, resp.Code)
+	}
+}
+
+func TestRestoreStoreTooLarge(t *testing.T) {
+	d := setupTestDependencies()
+	d.receiptStore.Insert(models.Receipt{ID: "existing"})
+	dump := dumpStore(t, d)
+	d.handlers.MaxRestoreBytes = int64(len(dump) - 1)
+
+	if resp := restoreRequest(d, RestoreReplace, dump); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, resp.Code)
+	}
+}
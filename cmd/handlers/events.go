@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/stream"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
+)
+
+// Events kept for clients resuming a stream when the server sets no size
+const DefaultEventBuffer = 1000
+
+// Time between two comments keeping idle streams open through proxies
+const heartbeatInterval = 15 * time.Second
+
+// Receipt events sent to the event stream
+var streamedEvents = map[string]bool{
+	webhook.EventReceiptProcessed: true,
+	webhook.EventReceiptDeleted:   true,
+}
+
+// Stream the receipt events of the tenant as Server-Sent Events. Clients
+// resume after the event named by the Last-Event-ID header, or by the
+// lastEventId query parameter, as long as it is still buffered
+func (h *Handlers) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.Helpers.ServerError(w, fmt.Errorf("streaming is not supported by the response writer"))
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var resumeAfter uint64
+	if lastEventID != "" {
+		var err error
+		resumeAfter, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			msg := map[string]string{"error": "The last event ID must be a positive number."}
+			h.Helpers.EncodeJSON(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	subscription, backlog := h.Events.Subscribe(tenant.FromContext(r.Context()).ID, resumeAfter)
+	defer subscription.Cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range backlog {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-subscription.Events():
+			if !open {
+				// The client fell behind or the server is shutting down
+				return
+			}
+			writeEvent(w, event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// Notifies the webhook subscribers and the event stream of the tenant in the context of a receipt event
+func (h *Handlers) publish(ctx context.Context, eventType string, receipt models.Receipt) {
+	tenantID := tenant.FromContext(ctx).ID
+	data := receiptResponse(receipt)
+
+	_, err := h.Outbox.Publish(tenantID, eventType, data)
+	if err != nil {
+		h.ErrorLog.Printf("Failed to publish %s of receipt with ID %s: %v", eventType, receipt.ID, err)
+	}
+
+	if streamedEvents[eventType] {
+		_, err = h.Events.Publish(tenantID, eventType, data)
+		if err != nil {
+			h.ErrorLog.Printf("Failed to stream %s of receipt with ID %s: %v", eventType, receipt.ID, err)
+		}
+	}
+}
+
+// Writes the event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, event stream.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
+)
+
+// Serves the event stream of the tenant from a test server
+func streamServer(d *TestDependencies, t *tenant.Tenant) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.handlers.StreamEvents(w, r.WithContext(tenant.WithTenant(r.Context(), t)))
+	}))
+}
+
+// Reads the id, event and data fields of the next event, skipping comments
+func readEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read the event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(fields) > 0 {
+			return fields
+		}
+		if name, value, found := strings.Cut(line, ": "); found && name != "" {
+			fields[name] = value
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	d := setupTestDependencies()
+	brandA := &tenant.Tenant{ID: "brand-a"}
+	ctx := tenant.WithTenant(context.Background(), brandA)
+
+	// Events published before the client connects
+	firstID, _ := d.handlers.CreateAndStore(ctx, *ValidReceipt)
+	secondID, _ := d.handlers.CreateAndStore(ctx, *ValidReceipt)
+
+	server := streamServer(d, brandA)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect to the stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected an event stream, received %s", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+
+	// The event after the last one seen is replayed
+	event := readEvent(t, reader)
+	if event["id"] != "2" || event["event"] != webhook.EventReceiptProcessed || !strings.Contains(event["data"], secondID) {
+		t.Errorf("Expected the second receipt to be replayed, received %v", event)
+	}
+	if strings.Contains(event["data"], firstID) {
+		t.Errorf("Expected the event already seen not to be replayed")
+	}
+
+	// Events of other tenants are filtered out, and live events follow
+	d.handlers.CreateAndStore(tenant.WithTenant(context.Background(), &tenant.Tenant{ID: "brand-b"}), *ValidReceipt)
+
+	deleteReq := httptest.NewRequest(http.MethodDelete, "/receipts/"+secondID, nil)
+	params := httprouter.Params{{Key: "id", Value: secondID}}
+	deleteReq = deleteReq.WithContext(context.WithValue(ctx, httprouter.ParamsKey, params))
+	d.handlers.DeleteReceipt(httptest.NewRecorder(), deleteReq)
+
+	event = readEvent(t, reader)
+	if event["id"] != "4" || event["event"] != webhook.EventReceiptDeleted || !strings.Contains(event["data"], `"points":31`) {
+		t.Errorf("Expected the deletion of the second receipt with its points, received %v", event)
+	}
+}
+
+func TestStreamEventsInvalidLastEventID(t *testing.T) {
+	d := setupTestDependencies()
+	req := httptest.NewRequest(http.MethodGet, "/events?lastEventId=abc", nil)
+	resp := httptest.NewRecorder()
+
+	d.handlers.StreamEvents(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.Code)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/receiptspb"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+)
+
+// ReceiptsService serves the receipt endpoints over gRPC with the
+// validation, scoring and stores of the HTTP handlers
+type ReceiptsService struct {
+	receiptspb.UnimplementedReceiptsServer
+	handlers *Handlers
+}
+
+func NewReceiptsService(handlers *Handlers) *ReceiptsService {
+	return &ReceiptsService{handlers: handlers}
+}
+
+// Validates, scores and stores the receipt, and returns its id
+func (s *ReceiptsService) ProcessReceipt(ctx context.Context, req *receiptspb.ProcessReceiptRequest) (*receiptspb.ProcessReceiptResponse, error) {
+	id, err := s.process(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &receiptspb.ProcessReceiptResponse{Id: id}, nil
+}
+
+// Returns the points awarded to the receipt
+func (s *ReceiptsService) GetPoints(ctx context.Context, req *receiptspb.GetPointsRequest) (*receiptspb.GetPointsResponse, error) {
+	receipt, err := s.receipt(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &receiptspb.GetPointsResponse{Points: int64(receipt.Points), Breakdown: breakdownMessage(receipt)}, nil
+}
+
+// Returns the current revision of the receipt
+func (s *ReceiptsService) GetReceipt(ctx context.Context, req *receiptspb.GetReceiptRequest) (*receiptspb.Receipt, error) {
+	receipt, err := s.receipt(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return receiptMessage(receipt), nil
+}
+
+// Soft-deletes the receipt and takes back the points it earned its member
+func (s *ReceiptsService) DeleteReceipt(ctx context.Context, req *receiptspb.DeleteReceiptRequest) (*receiptspb.DeleteReceiptResponse, error) {
+	_, err := s.handlers.RemoveReceipt(ctx, req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "No receipt found for that ID.")
+	}
+	return &receiptspb.DeleteReceiptResponse{}, nil
+}
+
+// Processes the receipts of the stream one at a time. A rejected receipt
+// is answered with its status and does not end the stream
+func (s *ReceiptsService) BatchProcess(stream receiptspb.Receipts_BatchProcessServer) error {
+	for index := int64(0); ; index++ {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		response := &receiptspb.BatchProcessResponse{Index: index}
+		id, err := s.process(stream.Context(), req)
+		if err != nil {
+			rejection := status.Convert(err)
+			if rejection.Code() == codes.Internal {
+				return err
+			}
+			response.Code = int32(rejection.Code())
+			response.Message = rejection.Message()
+			response.FieldErrors = fieldErrors(rejection)
+		}
+		response.Id = id
+
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+// Stores the receipt of the request and returns its id, or a status error
+func (s *ReceiptsService) process(ctx context.Context, req *receiptspb.ProcessReceiptRequest) (string, error) {
+	input := ReceiptInput{
+		Retailer:     req.GetRetailer(),
+		PurchaseDate: req.GetPurchaseDate(),
+		PurchaseTime: req.GetPurchaseTime(),
+		Total:        req.GetTotal(),
+		MemberID:     req.GetMemberId(),
+		TimeZone:     req.GetTimeZone(),
+	}
+	for _, item := range req.GetItems() {
+		input.Items = append(input.Items, models.Item{ShortDescription: item.GetShortDescription(), Price: item.GetPrice()})
+	}
+
+	s.handlers.ValidateReceipt(tenant.FromContext(ctx).ID, &input)
+	if !input.Valid() {
+		return "", invalidArgument(input.FieldErrors)
+	}
+
+	id, err := s.handlers.CreateAndStore(ctx, input)
+	if errors.Is(err, models.ErrQuotaExceeded) {
+		return "", status.Error(codes.ResourceExhausted, "Receipt quota exceeded for this tenant.")
+	}
+	if err != nil {
+		s.handlers.ErrorLog.Printf("Failed to store receipt: %v", err)
+		return "", status.Error(codes.Internal, "The server encountered a problem and could not process your request.")
+	}
+
+	return id, nil
+}
+
+// Returns the receipt of the tenant in the context, or a NotFound status error
+func (s *ReceiptsService) receipt(ctx context.Context, receiptID string) (models.Receipt, error) {
+	receipt, err := s.handlers.ReceiptStore.Get(tenant.FromContext(ctx).ID, receiptID)
+	if err != nil {
+		return models.Receipt{}, status.Error(codes.NotFound, "No receipt found for that ID.")
+	}
+	return receipt, nil
+}
+
+// Returns an InvalidArgument status carrying the validation errors as field violations
+func invalidArgument(fields map[string]string) error {
+	violations := &errdetails.BadRequest{}
+	for field, description := range fields {
+		violations.FieldViolations = append(violations.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: description,
+		})
+	}
+
+	rejection, err := status.New(codes.InvalidArgument, "The receipt is invalid.").WithDetails(violations)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "The receipt is invalid.")
+	}
+	return rejection.Err()
+}
+
+// Returns the field violations carried by the status
+func fieldErrors(rejection *status.Status) map[string]string {
+	var fields map[string]string
+	for _, detail := range rejection.Details() {
+		violations, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		fields = make(map[string]string)
+		for _, violation := range violations.GetFieldViolations() {
+			fields[violation.GetField()] = violation.GetDescription()
+		}
+	}
+	return fields
+}
+
+func receiptMessage(receipt models.Receipt) *receiptspb.Receipt {
+	message := &receiptspb.Receipt{
+		Id:           receipt.ID,
+		Revision:     int64(receipt.Revision),
+		Retailer:     receipt.Retailer,
+		PurchaseDate: receipt.PurchaseDate,
+		PurchaseTime: receipt.PurchaseTime,
+		Total:        receipt.Total,
+		MemberId:     receipt.MemberID,
+		Points:       int64(receipt.Points),
+		Breakdown:    breakdownMessage(receipt),
+		SubmittedBy:  receipt.SubmittedBy,
+		UpdatedBy:    receipt.UpdatedBy,
+		CreatedAt:    timestamppb.New(receipt.CreatedAt),
+		UpdatedAt:    timestamppb.New(receipt.UpdatedAt),
+		TimeZone:     receipt.TimeZone,
+	}
+	if !receipt.PurchasedAt.IsZero() {
+		message.PurchasedAt = timestamppb.New(receipt.PurchasedAt)
+	}
+	for _, item := range receipt.Items {
+		message.Items = append(message.Items, &receiptspb.Item{ShortDescription: item.ShortDescription, Price: item.Price})
+	}
+	return message
+}
+
+// Returns the points breakdown of receipts scored with a tier multiplier
+func breakdownMessage(receipt models.Receipt) *receiptspb.Breakdown {
+	breakdown := breakdownResponse(receipt)
+	if breakdown == nil {
+		return nil
+	}
+	return &receiptspb.Breakdown{
+		BasePoints: int64(breakdown.BasePoints),
+		Tier:       breakdown.Tier,
+		Multiplier: breakdown.Multiplier,
+	}
+}
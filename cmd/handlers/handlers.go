@@ -1,22 +1,60 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"kweeuhree.receipt-processor-challenge/cmd/helpers"
 	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/analytics"
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/expiry"
 	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/receiptcsv"
+	"kweeuhree.receipt-processor-challenge/internal/retailers"
+	"kweeuhree.receipt-processor-challenge/internal/stream"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/tiers"
+	"kweeuhree.receipt-processor-challenge/internal/timezone"
 	"kweeuhree.receipt-processor-challenge/internal/validator"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
 )
 
 type Handlers struct {
 	ErrorLog     *log.Logger
 	InfoLog      *log.Logger
 	ReceiptStore *models.ReceiptStore
-	Utils        *utils.Utils
-	Helpers      *helpers.Helpers
+	MemberStore  *models.MemberStore
+	Ledger       *models.Ledger
+	ExpiryPolicy expiry.Policy
+	// Membership tiers, members earn unmultiplied points when nil
+	Tiers *tiers.Program
+	// Audit trail of receipt mutations and points movements
+	Audit *audit.Log
+	// Webhook subscriptions and the outbox delivering receipt events to them
+	Webhooks *webhook.SubscriptionStore
+	Outbox   *webhook.Outbox
+	// Receipt events streamed to dashboards
+	Events *stream.Broker
+	// Column names of the CSV import and export
+	CSVMapping receiptcsv.Mapping
+	// Largest dump accepted by the restore, DefaultMaxRestoreBytes when zero
+	MaxRestoreBytes int64
+	// Running totals of the receipt store, kept up to date as receipts change
+	Analytics *analytics.Aggregates
+	// Canonical retailer names, retailers are only trimmed when nil
+	Retailers *retailers.Registry
+	// Zone of receipts naming none whose retailer has none, UTC when nil
+	TimeZone *time.Location
+	Utils    *utils.Utils
+	Helpers  *helpers.Helpers
 }
 
 type ReceiptInput struct {
@@ -25,6 +63,10 @@ type ReceiptInput struct {
 	PurchaseTime string        `json:"purchaseTime"`
 	Total        string        `json:"total"`
 	Items        []models.Item `json:"items"`
+	MemberID     string        `json:"memberId,omitempty"`
+	// IANA time zone or offset from UTC the purchase date and time are
+	// printed in, the zone of the retailer or of the server when empty
+	TimeZone string `json:"timeZone,omitempty"`
 	validator.Validator
 }
 
@@ -33,14 +75,32 @@ type IdResponse struct {
 }
 
 type PointsResponse struct {
-	Points int `json:"points"`
+	Points    int                `json:"points"`
+	Breakdown *BreakdownResponse `json:"breakdown,omitempty"`
+}
+
+type BreakdownResponse struct {
+	BasePoints int     `json:"basePoints"`
+	Tier       string  `json:"tier"`
+	Multiplier float64 `json:"multiplier"`
 }
 
 func NewHandlers(errorLog *log.Logger, infoLog *log.Logger, receiptStore *models.ReceiptStore, utils *utils.Utils, helpers *helpers.Helpers) *Handlers {
+	webhooks := webhook.NewSubscriptionStore()
+	aggregates := analytics.New()
+	receiptStore.Observe(aggregates)
 	return &Handlers{
 		ErrorLog:     errorLog,
 		InfoLog:      infoLog,
 		ReceiptStore: receiptStore,
+		MemberStore:  models.NewMemberStore(),
+		Ledger:       models.NewLedger(),
+		ExpiryPolicy: expiry.Never{},
+		Audit:        audit.NewLog(),
+		Webhooks:     webhooks,
+		Outbox:       webhook.NewOutbox(webhooks, webhook.DefaultRetryPolicy, errorLog, infoLog),
+		Events:       stream.NewBroker(DefaultEventBuffer),
+		Analytics:    aggregates,
 		Utils:        utils,
 		Helpers:      helpers,
 	}
@@ -57,15 +117,20 @@ func (h *Handlers) ProcessReceipt(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
-	input.Validate()
+	h.ValidateReceipt(tenant.FromContext(r.Context()).ID, &input)
 	if !input.Valid() {
 		h.Helpers.EncodeJSON(w, http.StatusBadRequest, input.FieldErrors)
 		return
 	}
 
 	// Create and store new receipt
-	newReceiptID, err := h.CreateAndStore(input)
+	newReceiptID, err := h.CreateAndStore(r.Context(), input)
 
+	if errors.Is(err, models.ErrQuotaExceeded) {
+		msg := map[string]string{"error": "Receipt quota exceeded for this tenant."}
+		h.Helpers.EncodeJSON(w, http.StatusForbidden, msg)
+		return
+	}
 	if err != nil {
 		h.ErrorLog.Printf("Failed to store receipt: %v", err)
 		h.Helpers.ServerError(w, err)
@@ -95,7 +160,7 @@ func (h *Handlers) GetReceiptPoints(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get receipt by its id
-	receipt, err := h.ReceiptStore.Get(receiptID)
+	receipt, err := h.ReceiptStore.Get(tenant.FromContext(r.Context()).ID, receiptID)
 
 	if err != nil {
 		msg := map[string]string{"error": "No receipt found for that ID."}
@@ -105,7 +170,8 @@ func (h *Handlers) GetReceiptPoints(w http.ResponseWriter, r *http.Request) {
 
 	// Construct the response
 	response := PointsResponse{
-		Points: receipt.Points,
+		Points:    receipt.Points,
+		Breakdown: breakdownResponse(receipt),
 	}
 
 	// Write the response struct to the response as JSON
@@ -116,9 +182,21 @@ func (h *Handlers) GetReceiptPoints(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handlers) CreateAndStore(input ReceiptInput) (string, error) {
+// Validates the input and checks that its member exists in the tenant
+func (h *Handlers) ValidateReceipt(tenantID string, input *ReceiptInput) {
+	input.Validate()
+	if input.MemberID != "" {
+		_, err := h.MemberStore.Get(tenantID, input.MemberID)
+		input.CheckField(err == nil, "memberId", "No member found for that ID")
+	}
+}
+
+// Creates a receipt on behalf of the principal in the context and stores it.
+// A receipt whose points cannot be credited to its member is removed again,
+// so that a retried request does not store it twice
+func (h *Handlers) CreateAndStore(ctx context.Context, input ReceiptInput) (string, error) {
 	// Prepare new receipt for storage
-	newReceipt, err := h.ReceiptFactory(input)
+	newReceipt, err := h.ReceiptFactory(ctx, input)
 	if err != nil {
 		return "", err
 	}
@@ -129,44 +207,247 @@ func (h *Handlers) CreateAndStore(input ReceiptInput) (string, error) {
 		return "", err
 	}
 
+	// Record the points earned by the member
+	if newReceipt.MemberID != "" {
+		err = h.earn(ctx, newReceipt.TenantID, newReceipt)
+		if err != nil {
+			if _, evictErr := h.ReceiptStore.Evict(newReceipt.TenantID, newReceipt.ID); evictErr != nil {
+				h.ErrorLog.Printf("Failed to remove receipt with ID %s after its points were not credited. Error: %+v", newReceipt.ID, evictErr)
+			}
+			return "", err
+		}
+		h.reviewTier(ctx, newReceipt.TenantID, newReceipt.MemberID)
+	}
+
+	stored, _ := h.ReceiptStore.Get(newReceipt.TenantID, newReceipt.ID)
+	h.audit(ctx, audit.ActionReceiptInsert, receiptResource(newReceipt.ID), nil, stored)
+	h.publish(ctx, webhook.EventReceiptProcessed, stored)
+
 	return newReceipt.ID, nil
 }
 
-// Constructs a new receipt based on the input
-func (h *Handlers) ReceiptFactory(input ReceiptInput) (models.Receipt, error) {
-	receiptID := uuid.New().String()
+// Constructs a new receipt based on the input, scored with the rules
+// of the tenant in the context and the multiplier of the member's tier
+func (h *Handlers) ReceiptFactory(ctx context.Context, input ReceiptInput) (models.Receipt, error) {
+	return h.scoreReceipt(ctx, uuid.New().String(), input)
+}
+
+// Constructs the receipt with the provided id based on the input and scores it
+func (h *Handlers) scoreReceipt(ctx context.Context, receiptID string, input ReceiptInput) (models.Receipt, error) {
+	receiptTenant := tenant.FromContext(ctx)
 
 	h.InfoLog.Printf("Calculating points for receipt with id: %s", receiptID)
 
-	points, err := h.Utils.CalculatePoints(input.Retailer, input.PurchaseDate, input.PurchaseTime, input.Total, input.Items)
+	calculator := h.Utils
+	if receiptTenant.Rules != nil {
+		calculator = h.Utils.WithRules(*receiptTenant.Rules)
+	}
+
+	canonicalRetailer := h.Retailers.Canonicalize(input.Retailer)
+	pointsRetailer := h.Retailers.PointsName(input.Retailer, canonicalRetailer)
+
+	receiptZone, localZone, err := h.purchaseZones(input.TimeZone, canonicalRetailer)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	purchasedAt, err := timezone.Instant(input.PurchaseDate, input.PurchaseTime, receiptZone)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	// Time rules apply to the local date and time of the purchase
+	localDate, localTime := timezone.Local(purchasedAt, localZone)
+
+	points, err := calculator.CalculatePoints(pointsRetailer, localDate, localTime, input.Total, input.Items)
 	if err != nil {
 		return models.Receipt{}, err
 	}
 
+	breakdown := models.PointsBreakdown{BasePoints: points, Multiplier: 1}
+	if input.MemberID != "" {
+		member, err := h.MemberStore.Get(receiptTenant.ID, input.MemberID)
+		if err == nil && member.Tier != "" {
+			breakdown.Tier = member.Tier
+			breakdown.Multiplier = h.Tiers.Multiplier(member.Tier)
+			points = int(math.Round(float64(points) * breakdown.Multiplier))
+		}
+	}
+
 	h.InfoLog.Printf("Total Points: %d", points)
 
+	now := time.Now().UTC()
 	newReceipt := models.Receipt{
-		ID:           receiptID,
-		Retailer:     input.Retailer,
-		PurchaseDate: input.PurchaseDate,
-		PurchaseTime: input.PurchaseTime,
-		Total:        input.Total,
-		Items:        input.Items,
-		Points:       points,
+		ID:                receiptID,
+		TenantID:          receiptTenant.ID,
+		Retailer:          input.Retailer,
+		CanonicalRetailer: canonicalRetailer,
+		PurchaseDate:      input.PurchaseDate,
+		PurchaseTime:      input.PurchaseTime,
+		TimeZone:          timezone.Name(receiptZone),
+		PurchasedAt:       purchasedAt.UTC(),
+		RequestedTimeZone: input.TimeZone,
+		Total:             input.Total,
+		Items:             input.Items,
+		Points:            points,
+		Breakdown:         breakdown,
+		SubmittedBy:       auth.PrincipalFromContext(ctx).Name(),
+		UpdatedBy:         auth.PrincipalFromContext(ctx).Name(),
+		MemberID:          input.MemberID,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
 	return newReceipt, nil
 }
 
+// Soft-delete the receipt and take back the points it earned its member
 func (h *Handlers) DeleteReceipt(w http.ResponseWriter, r *http.Request) {
 	receiptID := h.Helpers.GetIdFromParams(r, "id")
 
-	// Remove the receipt from receiptStore
-	err := h.ReceiptStore.Delete(receiptID)
+	_, err := h.RemoveReceipt(r.Context(), receiptID)
+	if err != nil {
+		msg := map[string]string{"error": "No receipt found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
 
+// Soft-deletes the receipt of the tenant in the context on behalf of its
+// principal, takes back the points it earned its member and returns it
+func (h *Handlers) RemoveReceipt(ctx context.Context, receiptID string) (models.Receipt, error) {
+	tenantID := tenant.FromContext(ctx).ID
+	principal := auth.PrincipalFromContext(ctx).Name()
+
+	receipt, err := h.ReceiptStore.Get(tenantID, receiptID)
+	if err == nil {
+		err = h.ReceiptStore.Delete(tenantID, receiptID)
+	}
 	if err != nil {
-		h.ErrorLog.Printf("Failed to delete the receipt with ID %s. Error: %+v", receiptID, err)
+		return models.Receipt{}, err
+	}
+
+	h.audit(ctx, audit.ActionReceiptDelete, receiptResource(receiptID), receipt, nil)
+	h.publish(ctx, webhook.EventReceiptDeleted, receipt)
+
+	// Take back the points earned by the member
+	if receipt.MemberID != "" {
+		err = h.reverse(ctx, tenantID, receipt.MemberID, receipt.ID)
+		if err != nil {
+			h.ErrorLog.Printf("Failed to reverse the points of receipt with ID %s. Error: %+v", receiptID, err)
+		}
+		h.reviewTier(ctx, tenantID, receipt.MemberID)
+	}
+
+	h.InfoLog.Printf("Receipt with ID %s deleted by %s", receiptID, principal)
+
+	return receipt, nil
+}
+
+// Bring a soft-deleted receipt back and credit its points to its member again
+func (h *Handlers) RestoreReceipt(w http.ResponseWriter, r *http.Request) {
+	receiptID := h.Helpers.GetIdFromParams(r, "id")
+	tenantID := tenant.FromContext(r.Context()).ID
+	principal := auth.PrincipalFromContext(r.Context()).Name()
+
+	receipt, err := h.ReceiptStore.Restore(tenantID, receiptID)
+	if errors.Is(err, models.ErrQuotaExceeded) {
+		msg := map[string]string{"error": "Receipt quota exceeded for this tenant."}
+		h.Helpers.EncodeJSON(w, http.StatusForbidden, msg)
+		return
+	}
+	if err != nil {
+		msg := map[string]string{"error": "No deleted receipt found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
 		return
 	}
-	h.Helpers.EncodeJSON(w, http.StatusNoContent, "")
+
+	// A receipt whose points cannot be credited again is deleted again
+	if receipt.MemberID != "" {
+		err = h.earn(r.Context(), tenantID, receipt)
+		if err != nil {
+			if deleteErr := h.ReceiptStore.Delete(tenantID, receiptID); deleteErr != nil {
+				h.ErrorLog.Printf("Failed to delete receipt with ID %s after its points were not credited. Error: %+v", receiptID, deleteErr)
+			}
+			h.Helpers.ServerError(w, err)
+			return
+		}
+		h.reviewTier(r.Context(), tenantID, receipt.MemberID)
+	}
+
+	h.audit(r.Context(), audit.ActionReceiptRestore, receiptResource(receiptID), nil, receipt)
+	h.publish(r.Context(), webhook.EventReceiptRestored, receipt)
+
+	h.InfoLog.Printf("Receipt with ID %s restored by %s", receiptID, principal)
+
+	w.Header().Set("ETag", receiptETag(receipt))
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, receiptResponse(receipt))
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Returns the audited resource name of the receipt
+func receiptResource(receiptID string) string {
+	return "receipt:" + receiptID
+}
+
+// Returns the zone the purchase date and time of a receipt are read in and
+// the zone they are local to. Receipts are read in the zone they name, or
+// else the zone of their retailer, or else the zone of the server. Purchases
+// are local to the zone of their retailer, or else the zone they are read in
+func (h *Handlers) purchaseZones(name, canonicalRetailer string) (receiptZone, localZone *time.Location, err error) {
+	retailerZone := h.Retailers.Location(canonicalRetailer)
+
+	switch {
+	case name != "":
+		receiptZone, err = timezone.Parse(name)
+		if err != nil {
+			return nil, nil, err
+		}
+	case retailerZone != nil:
+		receiptZone = retailerZone
+	case h.TimeZone != nil:
+		receiptZone = h.TimeZone
+	default:
+		receiptZone = time.UTC
+	}
+
+	localZone = receiptZone
+	if retailerZone != nil {
+		localZone = retailerZone
+	}
+
+	return receiptZone, localZone, nil
+}
+
+// Returns the purchase instant of receipts stored with one, nil for older receipts
+func purchaseInstant(receipt models.Receipt) *time.Time {
+	if receipt.PurchasedAt.IsZero() {
+		return nil
+	}
+	instant := receipt.PurchasedAt
+	return &instant
+}
+
+// Returns the points breakdown of receipts scored with a tier multiplier
+func breakdownResponse(receipt models.Receipt) *BreakdownResponse {
+	if receipt.Breakdown.Tier == "" {
+		return nil
+	}
+	return &BreakdownResponse{
+		BasePoints: receipt.Breakdown.BasePoints,
+		Tier:       receipt.Breakdown.Tier,
+		Multiplier: receipt.Breakdown.Multiplier,
+	}
+}
+
+// Converts a validated receipt total to cents
+func totalCents(total string) int {
+	amount, err := strconv.ParseFloat(total, 64)
+	if err != nil {
+		return 0
+	}
+	return int(math.Round(amount * 100))
 }
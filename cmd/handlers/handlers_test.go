@@ -8,11 +8,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"kweeuhree.receipt-processor-challenge/cmd/helpers"
 	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
 	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/retailers"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
 )
 
 type TestDependencies struct {
@@ -175,13 +180,14 @@ func TestDeleteReceipt(t *testing.T) {
 	router.DELETE("/receipts/:id/delete", mockHandler)
 
 	tests := []struct {
-		name string
-		id   string
-		url  string
+		name   string
+		id     string
+		url    string
+		status int
 	}{
-		{"Vaild id", SimpleReceipt.ID, "/receipts/123-qwe-456-rty-7890/delete"},
-		{"Invalid id", "123", "/receipts/123/delete"},
-		{"Empty id", "", "/receipts//delete"},
+		{"Vaild id", SimpleReceipt.ID, "/receipts/123-qwe-456-rty-7890/delete", http.StatusNoContent},
+		{"Invalid id", "123", "/receipts/123/delete", http.StatusNotFound},
+		{"Empty id", "", "/receipts//delete", http.StatusNotFound},
 	}
 
 	for _, entry := range tests {
@@ -200,10 +206,13 @@ func TestDeleteReceipt(t *testing.T) {
 			// Attempt to delete the receipt
 			d.handlers.DeleteReceipt(resp, req)
 
-			receipt, _ := d.receiptStore.Get(entry.id)
+			receipt, _ := d.receiptStore.Get(models.DefaultTenantID, entry.id)
 			if receipt.ID != "" {
 				t.Errorf("Expected receipt with id %s to be deleted, but it was not.", entry.id)
 			}
+			if resp.Code != entry.status {
+				t.Errorf("Expected status %d, got %d", entry.status, resp.Code)
+			}
 
 			t.Cleanup(func() {
 				d.receiptStore = models.NewStore()
@@ -211,3 +220,264 @@ func TestDeleteReceipt(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessReceiptRecordsPrincipal(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		expected  string
+	}{
+		{"Anonymous", nil, "anonymous"},
+		{"API key", &auth.Principal{ID: "partner", Method: "api-key"}, "api-key:partner"},
+		{"JWT", &auth.Principal{ID: "user-42", Method: "jwt"}, "jwt:user-42"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			d := setupTestDependencies()
+			body, err := json.Marshal(ValidReceipt)
+			if err != nil {
+				t.Fatalf("Failed to marshal input: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer(body))
+			if entry.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), entry.principal))
+			}
+			resp := httptest.NewRecorder()
+
+			d.handlers.ProcessReceipt(resp, req)
+
+			var response IdResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			receipt, err := d.receiptStore.Get(models.DefaultTenantID, response.ID)
+			if err != nil {
+				t.Fatalf("Expected receipt to be stored: %v", err)
+			}
+			if receipt.SubmittedBy != entry.expected {
+				t.Errorf("Expected receipt submitted by %s, received %s", entry.expected, receipt.SubmittedBy)
+			}
+		})
+	}
+}
+
+func TestProcessReceiptForTenant(t *testing.T) {
+	noOddDay := scoring.DefaultRules()
+	noOddDay.OddDayPoints = 0
+
+	tests := []struct {
+		name           string
+		tenant         *tenant.Tenant
+		quota          int
+		expectedStatus int
+		expectedPoints int
+	}{
+		{"Default rules", &tenant.Tenant{ID: "brand-a"}, 0, http.StatusOK, 28},
+		{"Tenant rules", &tenant.Tenant{ID: "brand-b", Rules: &noOddDay}, 0, http.StatusOK, 22},
+		{"Quota exceeded", &tenant.Tenant{ID: "brand-c"}, 1, http.StatusForbidden, 0},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			d := setupTestDependencies()
+			d.receiptStore.SetQuota(entry.tenant.ID, entry.quota)
+			d.receiptStore.Insert(models.Receipt{ID: "existing", TenantID: entry.tenant.ID})
+
+			input := ReceiptInput{
+				Retailer:     SimpleReceipt.Retailer,
+				PurchaseDate: SimpleReceipt.PurchaseDate,
+				PurchaseTime: SimpleReceipt.PurchaseTime,
+				Total:        SimpleReceipt.Total,
+				Items:        SimpleReceipt.Items,
+			}
+			body, err := json.Marshal(input)
+			if err != nil {
+				t.Fatalf("Failed to marshal input: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer(body))
+			req = req.WithContext(tenant.WithTenant(req.Context(), entry.tenant))
+			resp := httptest.NewRecorder()
+
+			d.handlers.ProcessReceipt(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if entry.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response IdResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			receipt, err := d.receiptStore.Get(entry.tenant.ID, response.ID)
+			if err != nil {
+				t.Fatalf("Expected receipt to be stored for tenant %s: %v", entry.tenant.ID, err)
+			}
+			if receipt.Points != entry.expectedPoints {
+				t.Errorf("Expected %d points, received %d", entry.expectedPoints, receipt.Points)
+			}
+			if _, err := d.receiptStore.Get(models.DefaultTenantID, response.ID); err == nil {
+				t.Errorf("Expected receipt not to be visible to the default tenant")
+			}
+		})
+	}
+}
+
+func TestReceiptFactoryCanonicalRetailer(t *testing.T) {
+	target := retailers.Retailer{Name: "Target", Patterns: []string{`(?i)^target\s+store\s+#\d+$`}}
+
+	tests := []struct {
+		name           string
+		pointsFrom     string
+		retailer       string
+		expectedPoints int
+	}{
+		// Six points for the letters of Target, eight more for "Store" and "123"
+		{"Raw name", retailers.PointsFromRaw, "Target Store #123", 39},
+		{"Canonical name", retailers.PointsFromCanonical, "Target Store #123", 31},
+		{"Alias", retailers.PointsFromCanonical, "TARGET ", 31},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			d := setupTestDependencies()
+			registry, err := retailers.NewRegistry(entry.pointsFrom, []retailers.Retailer{target})
+			if err != nil {
+				t.Fatalf("Failed to create registry: %v", err)
+			}
+			d.handlers.Retailers = registry
+
+			input := *ValidReceipt
+			input.Retailer = entry.retailer
+			receipt, err := d.handlers.ReceiptFactory(context.Background(), input)
+			if err != nil {
+				t.Fatalf("Failed to score receipt: %v", err)
+			}
+
+			if receipt.Retailer != entry.retailer || receipt.CanonicalRetailer != "Target" {
+				t.Errorf("Expected %q to be stored as Target, received %q", receipt.Retailer, receipt.CanonicalRetailer)
+			}
+			if receipt.Points != entry.expectedPoints {
+				t.Errorf("Expected %d points, received %d", entry.expectedPoints, receipt.Points)
+			}
+		})
+	}
+}
+
+func TestReceiptFactoryTimeZone(t *testing.T) {
+	fivePastUTC := time.FixedZone("+05:00", 5*3600)
+
+	tests := []struct {
+		name            string
+		timeZone        string
+		retailerZone    string
+		serverZone      *time.Location
+		date            string
+		clock           string
+		expectedPoints  int
+		expectedZone    string
+		expectedInstant string
+	}{
+		{"Default zone", "", "", nil, "2022-01-02", "13:13", 31, "UTC", "2022-01-02T13:13:00Z"},
+		{"Server zone", "", "", fivePastUTC, "2022-01-02", "13:13", 31, "+05:00", "2022-01-02T08:13:00Z"},
+		{"Receipt zone", "America/New_York", "", fivePastUTC, "2022-01-02", "13:13", 31, "America/New_York", "2022-01-02T18:13:00Z"},
+		{"Retailer zone", "", "America/Chicago", fivePastUTC, "2022-01-02", "13:13", 31, "America/Chicago", "2022-01-02T19:13:00Z"},
+		// A receipt printed in UTC after midnight was purchased on the 1st in New York
+		{"Crossing midnight", "+00:00", "America/New_York", nil, "2022-01-02", "03:30", 37, "+00:00", "2022-01-02T03:30:00Z"},
+		// 14:30 in New York is before the afternoon window in Los Angeles
+		{"Afternoon elsewhere", "America/New_York", "America/Los_Angeles", nil, "2022-01-02", "14:30", 31, "America/New_York", "2022-01-02T19:30:00Z"},
+		{"Afternoon in the receipt zone", "America/New_York", "", nil, "2022-01-02", "14:30", 41, "America/New_York", "2022-01-02T19:30:00Z"},
+		// 18:30 UTC is 13:30 in New York before daylight saving time starts, 14:30 after
+		{"Before daylight saving time", "Z", "America/New_York", nil, "2024-03-09", "18:30", 37, "UTC", "2024-03-09T18:30:00Z"},
+		{"After daylight saving time", "Z", "America/New_York", nil, "2024-03-10", "18:30", 41, "UTC", "2024-03-10T18:30:00Z"},
+		// 02:30 does not exist on the 10th in New York, it is read as 03:30
+		{"Skipped time", "", "America/New_York", nil, "2024-03-10", "02:30", 31, "America/New_York", "2024-03-10T07:30:00Z"},
+		// 01:30 happens twice on the 3rd in New York, the first one is kept
+		{"Repeated time", "", "America/New_York", nil, "2024-11-03", "01:30", 37, "America/New_York", "2024-11-03T05:30:00Z"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			d := setupTestDependencies()
+			d.handlers.TimeZone = entry.serverZone
+			registry, err := retailers.NewRegistry(retailers.PointsFromRaw, []retailers.Retailer{{Name: "Target", TimeZone: entry.retailerZone}})
+			if err != nil {
+				t.Fatalf("Failed to create registry: %v", err)
+			}
+			d.handlers.Retailers = registry
+
+			input := *ValidReceipt
+			input.TimeZone = entry.timeZone
+			input.PurchaseDate = entry.date
+			input.PurchaseTime = entry.clock
+			receipt, err := d.handlers.ReceiptFactory(context.Background(), input)
+			if err != nil {
+				t.Fatalf("Failed to score receipt: %v", err)
+			}
+
+			if receipt.Points != entry.expectedPoints {
+				t.Errorf("Expected %d points, received %d", entry.expectedPoints, receipt.Points)
+			}
+			if receipt.TimeZone != entry.expectedZone {
+				t.Errorf("Expected zone %s, received %s", entry.expectedZone, receipt.TimeZone)
+			}
+			if instant := receipt.PurchasedAt.Format(time.RFC3339); instant != entry.expectedInstant {
+				t.Errorf("Expected instant %s, received %s", entry.expectedInstant, instant)
+			}
+			// The printed date and time are kept as submitted
+			if receipt.PurchaseDate != entry.date || receipt.PurchaseTime != entry.clock {
+				t.Errorf("Expected %s %s to be stored, received %s %s", entry.date, entry.clock, receipt.PurchaseDate, receipt.PurchaseTime)
+			}
+		})
+	}
+}
+
+func TestValidateReceiptTimeZone(t *testing.T) {
+	d := setupTestDependencies()
+
+	for timeZone, valid := range map[string]bool{"": true, "Europe/Paris": true, "-03:00": true, "Europe/Atlantis": false, "+25:00": false} {
+		input := *ValidReceipt
+		input.TimeZone = timeZone
+		d.handlers.ValidateReceipt(models.DefaultTenantID, &input)
+		if _, invalid := input.FieldErrors["timeZone"]; invalid == valid {
+			t.Errorf("Expected %q to be valid: %t", timeZone, valid)
+		}
+	}
+}
+
+func TestGetReceiptPointsOtherTenant(t *testing.T) {
+	d := setupTestDependencies()
+	receipt := *SimpleReceipt
+	receipt.TenantID = "brand-a"
+	d.receiptStore.Insert(receipt)
+
+	tests := []struct {
+		name           string
+		tenantID       string
+		expectedStatus int
+	}{
+		{"Owning tenant", "brand-a", http.StatusOK},
+		{"Other tenant", "brand-b", http.StatusNotFound},
+		{"Default tenant", models.DefaultTenantID, http.StatusNotFound},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/receipts/"+receipt.ID+"/points", nil)
+			params := httprouter.Params{httprouter.Param{Key: "id", Value: receipt.ID}}
+			ctx := context.WithValue(req.Context(), httprouter.ParamsKey, params)
+			ctx = tenant.WithTenant(ctx, &tenant.Tenant{ID: entry.tenantID})
+			req = req.WithContext(ctx)
+			resp := httptest.NewRecorder()
+
+			d.handlers.GetReceiptPoints(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+		})
+	}
+}
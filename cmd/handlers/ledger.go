@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/expiry"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/validator"
+)
+
+type PointsMovementInput struct {
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+	validator.Validator
+}
+
+type LedgerEntryResponse struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Signed amount from the member point of view
+	Points    int       `json:"points"`
+	ReceiptID string    `json:"receiptId,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ExpiringPointsResponse struct {
+	Policy string                `json:"policy"`
+	Points int                   `json:"points"`
+	Lots   []ExpiringLotResponse `json:"lots"`
+}
+
+type ExpiringLotResponse struct {
+	Points    int       `json:"points"`
+	ReceiptID string    `json:"receiptId,omitempty"`
+	EarnedAt  time.Time `json:"earnedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type PointsMovementResponse struct {
+	Entry   LedgerEntryResponse `json:"entry"`
+	Balance int                 `json:"balance"`
+}
+
+// Debit points from the member balance. The Idempotency-Key header is
+// required so that a retried request does not redeem the points twice
+func (h *Handlers) CreateRedemption(w http.ResponseWriter, r *http.Request) {
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		msg := map[string]string{"error": "The Idempotency-Key header is required."}
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	member, ok := h.memberFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	var input PointsMovementInput
+	err := h.Helpers.DecodeJSON(w, r, &input)
+	if err != nil {
+		h.ErrorLog.Printf("Exiting after decoding attempt: %s", err)
+		return
+	}
+
+	input.CheckField(input.Points > 0, "points", "This field must be a positive number")
+	if !input.Valid() {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, input.FieldErrors)
+		return
+	}
+
+	h.postMovement(w, r, member, models.LedgerEntry{
+		Type:           models.EntryRedemption,
+		Debit:          models.MemberAccount(member.ID),
+		Credit:         models.ProgramAccount,
+		Amount:         input.Points,
+		Reason:         input.Reason,
+		IdempotencyKey: idempotencyKey,
+	})
+}
+
+// Add points to or remove points from the member balance by hand
+func (h *Handlers) CreateAdjustment(w http.ResponseWriter, r *http.Request) {
+	member, ok := h.memberFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	var input PointsMovementInput
+	err := h.Helpers.DecodeJSON(w, r, &input)
+	if err != nil {
+		h.ErrorLog.Printf("Exiting after decoding attempt: %s", err)
+		return
+	}
+
+	var v *validator.Validator
+	input.CheckField(input.Points != 0, "points", "This field must be a non-zero number")
+	input.CheckField(v.NotBlank(input.Reason), "reason", "This field cannot be blank")
+	if !input.Valid() {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, input.FieldErrors)
+		return
+	}
+
+	entry := models.LedgerEntry{
+		Type:           models.EntryAdjustment,
+		Debit:          models.ProgramAccount,
+		Credit:         models.MemberAccount(member.ID),
+		Amount:         input.Points,
+		Reason:         input.Reason,
+		IdempotencyKey: r.Header.Get("Idempotency-Key"),
+	}
+	// Negative adjustments move points back to the program
+	if input.Points < 0 {
+		entry.Debit, entry.Credit, entry.Amount = entry.Credit, entry.Debit, -input.Points
+	}
+
+	h.postMovement(w, r, member, entry)
+}
+
+// Audited state of a member account
+type memberBalance struct {
+	MemberID string `json:"memberId"`
+	Balance  int    `json:"balance"`
+}
+
+// Credits the points and spend of the receipt to its member on behalf of the
+// principal in the context, and audits the movement
+func (h *Handlers) earn(ctx context.Context, tenantID string, receipt models.Receipt) error {
+	spend := totalCents(receipt.Total)
+	if receipt.Points <= 0 && spend <= 0 {
+		// Nothing is posted
+		return nil
+	}
+
+	account := models.MemberAccount(receipt.MemberID)
+	before := memberBalance{MemberID: receipt.MemberID, Balance: h.Ledger.Balance(tenantID, account)}
+	principal := auth.PrincipalFromContext(ctx).Name()
+	err := h.Ledger.Earn(tenantID, receipt.MemberID, receipt.ID, receipt.Points, spend, principal)
+	if err != nil {
+		return err
+	}
+
+	after := memberBalance{MemberID: receipt.MemberID, Balance: h.Ledger.Balance(tenantID, account)}
+	h.auditTenant(ctx, tenantID, audit.ActionPointsEarn, account, before, after)
+	return nil
+}
+
+// Takes back what the receipt earned the member on behalf of the principal
+// in the context, and audits the movement
+func (h *Handlers) reverse(ctx context.Context, tenantID, memberID, receiptID string) error {
+	if points, spend := h.Ledger.ReceiptPoints(tenantID, memberID, receiptID); points <= 0 && spend <= 0 {
+		// Nothing is posted
+		return nil
+	}
+
+	account := models.MemberAccount(memberID)
+	before := memberBalance{MemberID: memberID, Balance: h.Ledger.Balance(tenantID, account)}
+	principal := auth.PrincipalFromContext(ctx).Name()
+	err := h.Ledger.ReverseReceipt(tenantID, memberID, receiptID, principal)
+	if err != nil {
+		return err
+	}
+
+	after := memberBalance{MemberID: memberID, Balance: h.Ledger.Balance(tenantID, account)}
+	h.auditTenant(ctx, tenantID, audit.ActionPointsReversal, account, before, after)
+	return nil
+}
+
+// Return the ledger entries of the member, most recent first
+func (h *Handlers) GetMemberLedger(w http.ResponseWriter, r *http.Request) {
+	member, ok := h.memberFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	account := models.MemberAccount(member.ID)
+	entries := h.Ledger.Entries(member.TenantID, account)
+
+	response := make([]LedgerEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, ledgerEntryResponse(entry, account))
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Return the points of the member that expire within the number of days
+// given by the days query parameter, 30 by default
+func (h *Handlers) GetExpiringPoints(w http.ResponseWriter, r *http.Request) {
+	member, ok := h.memberFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			msg := map[string]string{"days": "This parameter must be a positive integer"}
+			h.Helpers.EncodeJSON(w, http.StatusBadRequest, msg)
+			return
+		}
+		days = parsed
+	}
+
+	lots := expiry.Upcoming(h.Ledger, h.ExpiryPolicy, member.TenantID, member.ID, time.Now(), time.Duration(days)*24*time.Hour)
+
+	response := ExpiringPointsResponse{Policy: h.ExpiryPolicy.String(), Lots: []ExpiringLotResponse{}}
+	for _, lot := range lots {
+		response.Points += lot.Remaining
+		response.Lots = append(response.Lots, ExpiringLotResponse{
+			Points:    lot.Remaining,
+			ReceiptID: lot.ReceiptID,
+			EarnedAt:  lot.EarnedAt,
+			ExpiresAt: lot.ExpiresAt,
+		})
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Posts the entry for the member and writes the entry with the new balance
+func (h *Handlers) postMovement(w http.ResponseWriter, r *http.Request, member models.Member, entry models.LedgerEntry) {
+	entry.TenantID = member.TenantID
+	entry.MemberID = member.ID
+	entry.CreatedBy = auth.PrincipalFromContext(r.Context()).Name()
+
+	account := models.MemberAccount(member.ID)
+	before := memberBalance{MemberID: member.ID, Balance: h.Ledger.Balance(member.TenantID, account)}
+
+	posted, replayed, err := h.Ledger.Post(entry)
+	switch {
+	case errors.Is(err, models.ErrInsufficientBalance):
+		msg := map[string]string{"error": "Insufficient points balance."}
+		h.Helpers.EncodeJSON(w, http.StatusUnprocessableEntity, msg)
+		return
+	case errors.Is(err, models.ErrIdempotencyConflict):
+		msg := map[string]string{"error": "The Idempotency-Key was already used for a different request."}
+		h.Helpers.EncodeJSON(w, http.StatusConflict, msg)
+		return
+	case err != nil:
+		h.Helpers.ServerError(w, err)
+		return
+	}
+
+	response := PointsMovementResponse{
+		Entry:   ledgerEntryResponse(posted, account),
+		Balance: h.Ledger.Balance(member.TenantID, account),
+	}
+
+	// Replayed requests did not move any points
+	if !replayed {
+		action := audit.ActionPointsAdjustment
+		if posted.Type == models.EntryRedemption {
+			action = audit.ActionPointsRedemption
+		}
+		after := memberBalance{MemberID: member.ID, Balance: response.Balance}
+		h.audit(r.Context(), action, account, before, after)
+	}
+
+	status := http.StatusCreated
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+		status = http.StatusOK
+	}
+
+	err = h.Helpers.EncodeJSON(w, status, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Returns the member named by the id parameter, or writes a 404 response
+func (h *Handlers) memberFromParams(w http.ResponseWriter, r *http.Request) (models.Member, bool) {
+	memberID := h.Helpers.GetIdFromParams(r, "id")
+	member, err := h.MemberStore.Get(tenant.FromContext(r.Context()).ID, memberID)
+	if err != nil {
+		msg := map[string]string{"error": "No member found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return models.Member{}, false
+	}
+	return member, true
+}
+
+// Constructs the entry response with the amount signed for the account
+func ledgerEntryResponse(entry models.LedgerEntry, account string) LedgerEntryResponse {
+	points := entry.Amount
+	if entry.Debit == account {
+		points = -points
+	}
+	return LedgerEntryResponse{
+		ID:        entry.ID,
+		Type:      entry.Type,
+		Points:    points,
+		ReceiptID: entry.ReceiptID,
+		Reason:    entry.Reason,
+		CreatedBy: entry.CreatedBy,
+		CreatedAt: entry.CreatedAt,
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"kweeuhree.receipt-processor-challenge/internal/expiry"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Sends a request for the member to the handler
+func memberRequest(handler http.HandlerFunc, memberID, body, idempotencyKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/members/"+memberID, bytes.NewBufferString(body))
+	params := httprouter.Params{httprouter.Param{Key: "id", Value: memberID}}
+	req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp := httptest.NewRecorder()
+	handler(resp, req)
+	return resp
+}
+
+func TestCreateRedemption(t *testing.T) {
+	d := setupTestDependencies()
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+	d.handlers.Ledger.Earn("", member.ID, "receipt-1", 100, 0, "test")
+
+	tests := []struct {
+		name            string
+		memberID        string
+		body            string
+		idempotencyKey  string
+		expectedStatus  int
+		expectedBalance int
+	}{
+		{"Redemption", member.ID, `{"points": 30}`, "redeem-1", http.StatusCreated, 70},
+		{"Retried redemption", member.ID, `{"points": 30}`, "redeem-1", http.StatusOK, 70},
+		{"Reused key", member.ID, `{"points": 40}`, "redeem-1", http.StatusConflict, 70},
+		{"Missing idempotency key", member.ID, `{"points": 30}`, "", http.StatusBadRequest, 70},
+		{"Insufficient balance", member.ID, `{"points": 71}`, "redeem-2", http.StatusUnprocessableEntity, 70},
+		{"Negative points", member.ID, `{"points": -10}`, "redeem-3", http.StatusBadRequest, 70},
+		{"Unknown member", "unknown", `{"points": 10}`, "redeem-4", http.StatusNotFound, 70},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			resp := memberRequest(d.handlers.CreateRedemption, entry.memberID, entry.body, entry.idempotencyKey)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if balance := d.handlers.Ledger.Balance("", models.MemberAccount(member.ID)); balance != entry.expectedBalance {
+				t.Errorf("Expected balance %d, received %d", entry.expectedBalance, balance)
+			}
+			if entry.expectedStatus == http.StatusCreated {
+				var response PointsMovementResponse
+				if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Entry.Points != -30 || response.Balance != entry.expectedBalance {
+					t.Errorf("Unexpected response %+v", response)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAdjustment(t *testing.T) {
+	d := setupTestDependencies()
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+
+	tests := []struct {
+		name            string
+		body            string
+		expectedStatus  int
+		expectedBalance int
+	}{
+		{"Positive adjustment", `{"points": 50, "reason": "Missing receipt"}`, http.StatusCreated, 50},
+		{"Negative adjustment", `{"points": -20, "reason": "Duplicate receipt"}`, http.StatusCreated, 30},
+		{"No reason", `{"points": 10}`, http.StatusBadRequest, 30},
+		{"Zero points", `{"points": 0, "reason": "Nothing"}`, http.StatusBadRequest, 30},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			resp := memberRequest(d.handlers.CreateAdjustment, member.ID, entry.body, "")
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if balance := d.handlers.Ledger.Balance("", models.MemberAccount(member.ID)); balance != entry.expectedBalance {
+				t.Errorf("Expected balance %d, received %d", entry.expectedBalance, balance)
+			}
+		})
+	}
+}
+
+func TestDeleteReceiptReversesPoints(t *testing.T) {
+	d := setupTestDependencies()
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+
+	receipt := *SimpleReceipt
+	receipt.MemberID = member.ID
+	d.receiptStore.Insert(receipt)
+	d.handlers.Ledger.Earn("", member.ID, receipt.ID, receipt.Points, 0, "test")
+
+	req := httptest.NewRequest(http.MethodDelete, "/receipts/"+receipt.ID+"/delete", nil)
+	params := httprouter.Params{httprouter.Param{Key: "id", Value: receipt.ID}}
+	req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+	d.handlers.DeleteReceipt(httptest.NewRecorder(), req)
+
+	if balance := d.handlers.Ledger.Balance("", models.MemberAccount(member.ID)); balance != 0 {
+		t.Errorf("Expected points to be reversed, balance is %d", balance)
+	}
+
+	resp := memberRequest(d.handlers.GetMemberLedger, member.ID, "", "")
+	var entries []LedgerEntryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Type != models.EntryReversal || entries[0].Points != -receipt.Points {
+		t.Errorf("Expected earn and reversal entries, received %+v", entries)
+	}
+}
+
+func TestGetExpiringPoints(t *testing.T) {
+	d := setupTestDependencies()
+	d.handlers.ExpiryPolicy = expiry.FixedLifetime{Months: 1}
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+	d.handlers.Ledger.Earn("", member.ID, "receipt-1", 40, 0, "test")
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedPoints int
+	}{
+		{"Within the window", "?days=32", http.StatusOK, 40},
+		{"Outside the window", "?days=7", http.StatusOK, 0},
+		{"Invalid days", "?days=soon", http.StatusBadRequest, 0},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/members/"+member.ID+"/expiring"+entry.query, nil)
+			params := httprouter.Params{httprouter.Param{Key: "id", Value: member.ID}}
+			req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+			resp := httptest.NewRecorder()
+
+			d.handlers.GetExpiringPoints(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if entry.expectedStatus != http.StatusOK {
+				return
+			}
+			var response ExpiringPointsResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Points != entry.expectedPoints {
+				t.Errorf("Expected %d expiring points, received %d", entry.expectedPoints, response.Points)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/requestid"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/validator"
+)
+
+// Number of receipts returned with a member
+const recentReceiptsLimit = 10
+
+type MemberInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	validator.Validator
+}
+
+type MemberResponse struct {
+	ID             string                  `json:"id"`
+	Name           string                  `json:"name"`
+	Email          string                  `json:"email,omitempty"`
+	Balance        int                     `json:"balance"`
+	Tier           string                  `json:"tier,omitempty"`
+	CreatedAt      time.Time               `json:"createdAt"`
+	RecentReceipts []MemberReceiptResponse `json:"recentReceipts,omitempty"`
+}
+
+type MemberReceiptResponse struct {
+	ID           string `json:"id"`
+	Retailer     string `json:"retailer"`
+	PurchaseDate string `json:"purchaseDate"`
+	Points       int    `json:"points"`
+}
+
+// Create a loyalty member and return it
+func (h *Handlers) CreateMember(w http.ResponseWriter, r *http.Request) {
+	var input MemberInput
+	err := h.Helpers.DecodeJSON(w, r, &input)
+	if err != nil {
+		h.ErrorLog.Printf("Exiting after decoding attempt: %s", err)
+		return
+	}
+
+	// Validate input
+	input.Validate()
+	if !input.Valid() {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, input.FieldErrors)
+		return
+	}
+
+	member := models.Member{
+		ID:        uuid.New().String(),
+		TenantID:  tenant.FromContext(r.Context()).ID,
+		Name:      input.Name,
+		Email:     input.Email,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = h.MemberStore.Insert(member)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+
+	err = h.Helpers.EncodeJSON(w, http.StatusCreated, h.memberResponse(member, false))
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Return the member with its balance and recent receipts
+func (h *Handlers) GetMember(w http.ResponseWriter, r *http.Request) {
+	member, ok := h.memberFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, h.memberResponse(member, true))
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Return the members of the tenant
+func (h *Handlers) ListMembers(w http.ResponseWriter, r *http.Request) {
+	members := h.MemberStore.List(tenant.FromContext(r.Context()).ID)
+
+	response := make([]MemberResponse, 0, len(members))
+	for _, member := range members {
+		response = append(response, h.memberResponse(member, false))
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Constructs the member response, optionally with its recent receipts
+func (h *Handlers) memberResponse(member models.Member, withReceipts bool) MemberResponse {
+	response := MemberResponse{
+		ID:        member.ID,
+		Name:      member.Name,
+		Email:     member.Email,
+		Balance:   h.Ledger.Balance(member.TenantID, models.MemberAccount(member.ID)),
+		Tier:      member.Tier,
+		CreatedAt: member.CreatedAt,
+	}
+	if !withReceipts {
+		return response
+	}
+
+	for _, receiptID := range h.recentReceipts(member) {
+		receipt, err := h.ReceiptStore.Get(member.TenantID, receiptID)
+		if err != nil {
+			continue
+		}
+		response.RecentReceipts = append(response.RecentReceipts, MemberReceiptResponse{
+			ID:           receipt.ID,
+			Retailer:     receipt.Retailer,
+			PurchaseDate: receipt.PurchaseDate,
+			Points:       receipt.Points,
+		})
+	}
+
+	return response
+}
+
+// Returns the ids of the latest receipts that earned the member points
+// and were not reversed since, most recent first
+func (h *Handlers) recentReceipts(member models.Member) []string {
+	var receiptIDs []string
+	reversed := make(map[string]bool)
+
+	for _, entry := range h.Ledger.Entries(member.TenantID, models.MemberAccount(member.ID)) {
+		switch {
+		case entry.Type == models.EntryReversal:
+			reversed[entry.ReceiptID] = true
+		case entry.Type == models.EntryEarn && !reversed[entry.ReceiptID]:
+			receiptIDs = append(receiptIDs, entry.ReceiptID)
+		}
+		if len(receiptIDs) == recentReceiptsLimit {
+			break
+		}
+	}
+
+	return receiptIDs
+}
+
+// Moves the member to the tier its standing qualifies for after its points changed,
+// auditing the transition under the principal of the request that changed them
+func (h *Handlers) reviewTier(ctx context.Context, tenantID, memberID string) {
+	transition, moved, err := h.Tiers.Review(h.MemberStore, h.Ledger, tenantID, memberID, time.Now())
+	if err != nil {
+		h.ErrorLog.Printf("Failed to review the tier of member %s: %v", memberID, err)
+		return
+	}
+	if !moved {
+		return
+	}
+
+	h.InfoLog.Printf("Member %s moved to tier %q", transition.MemberID, transition.To)
+
+	event := transition.AuditEvent(auth.PrincipalFromContext(ctx).Name())
+	event.RequestID = requestid.FromContext(ctx)
+	if _, err := h.Audit.Record(event); err != nil {
+		h.ErrorLog.Printf("Failed to record %s of member %s in the audit log: %v", event.Action, memberID, err)
+	}
+}
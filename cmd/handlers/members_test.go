@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Creates a member through the handler and returns the response
+func createTestMember(t *testing.T, d *TestDependencies, input MemberInput) MemberResponse {
+	t.Helper()
+	body, _ := json.Marshal(input)
+	req := httptest.NewRequest(http.MethodPost, "/members", bytes.NewBuffer(body))
+	resp := httptest.NewRecorder()
+
+	d.handlers.CreateMember(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, resp.Code)
+	}
+	var member MemberResponse
+	if err := json.NewDecoder(resp.Body).Decode(&member); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return member
+}
+
+// Sends a GET request for the member to the handler
+func getTestMember(d *TestDependencies, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/members/"+id, nil)
+	params := httprouter.Params{httprouter.Param{Key: "id", Value: id}}
+	req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+	resp := httptest.NewRecorder()
+	d.handlers.GetMember(resp, req)
+	return resp
+}
+
+func TestCreateMember(t *testing.T) {
+	d := setupTestDependencies()
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedField  string
+	}{
+		{"Valid member", `{"name": "Jane Doe", "email": "jane@example.com"}`, http.StatusCreated, ""},
+		{"Member without email", `{"name": "Jane Doe"}`, http.StatusCreated, ""},
+		{"No name", `{"email": "jane@example.com"}`, http.StatusBadRequest, "name"},
+		{"Invalid email", `{"name": "Jane Doe", "email": "jane"}`, http.StatusBadRequest, "email"},
+		{"Invalid JSON", `{"name":}`, http.StatusBadRequest, ""},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/members", bytes.NewBufferString(entry.body))
+			resp := httptest.NewRecorder()
+
+			d.handlers.CreateMember(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if entry.expectedField != "" {
+				var response map[string]string
+				if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode error response: %v", err)
+				}
+				if _, exists := response[entry.expectedField]; !exists {
+					t.Errorf("Expected an error for field %s, received %v", entry.expectedField, response)
+				}
+			}
+		})
+	}
+}
+
+func TestMemberEarnsPoints(t *testing.T) {
+	d := setupTestDependencies()
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+
+	// Process a receipt for the member
+	input := *ValidReceipt
+	input.MemberID = member.ID
+	body, _ := json.Marshal(input)
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer(body))
+	resp := httptest.NewRecorder()
+	d.handlers.ProcessReceipt(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	var processed IdResponse
+	json.NewDecoder(resp.Body).Decode(&processed)
+	receipt, _ := d.receiptStore.Get("", processed.ID)
+
+	// The member balance and recent receipts include the receipt
+	resp = getTestMember(d, member.ID)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	var response MemberResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Balance != receipt.Points {
+		t.Errorf("Expected balance %d, received %d", receipt.Points, response.Balance)
+	}
+	if len(response.RecentReceipts) != 1 || response.RecentReceipts[0].ID != processed.ID {
+		t.Errorf("Expected recent receipt %s, received %+v", processed.ID, response.RecentReceipts)
+	}
+}
+
+func TestProcessReceiptUnknownMember(t *testing.T) {
+	d := setupTestDependencies()
+	input := *ValidReceipt
+	input.MemberID = "unknown"
+	body, _ := json.Marshal(input)
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer(body))
+	resp := httptest.NewRecorder()
+
+	d.handlers.ProcessReceipt(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.Code)
+	}
+	var response map[string]string
+	json.NewDecoder(resp.Body).Decode(&response)
+	if _, exists := response["memberId"]; !exists {
+		t.Errorf("Expected an error for field memberId, received %v", response)
+	}
+}
+
+func TestGetMemberNotFound(t *testing.T) {
+	d := setupTestDependencies()
+	if resp := getTestMember(d, "unknown"); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, resp.Code)
+	}
+}
+
+func TestListMembers(t *testing.T) {
+	d := setupTestDependencies()
+	createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+	createTestMember(t, d, MemberInput{Name: "John Doe"})
+
+	req := httptest.NewRequest(http.MethodGet, "/members", nil)
+	resp := httptest.NewRecorder()
+	d.handlers.ListMembers(resp, req)
+
+	var members []MemberResponse
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(members) != 2 {
+		t.Errorf("Expected 2 members, received %d", len(members))
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"kweeuhree.receipt-processor-challenge/cmd/parser"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+)
+
+// Largest plain-text receipt accepted
+const maxTextReceiptBytes = 64 * 1024
+
+type ParseResponse struct {
+	ID           string            `json:"id,omitempty"`
+	Retailer     string            `json:"retailer"`
+	PurchaseDate string            `json:"purchaseDate"`
+	PurchaseTime string            `json:"purchaseTime"`
+	Total        string            `json:"total"`
+	Items        []models.Item     `json:"items"`
+	MemberID     string            `json:"memberId,omitempty"`
+	TimeZone     string            `json:"timeZone,omitempty"`
+	Confidence   parser.Confidence `json:"confidence"`
+	Error        string            `json:"error,omitempty"`
+	FieldErrors  map[string]string `json:"fieldErrors,omitempty"`
+}
+
+// Parses a plain-text receipt and processes it like a JSON receipt.
+// The receipt is only parsed when dryRun is true, and is rejected when
+// the overall confidence is below minConfidence. The memberId and
+// timeZone query parameters stand in for the fields of a JSON receipt
+func (h *Handlers) ParseReceipt(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/plain" {
+		msg := map[string]string{"error": "Content-Type must be text/plain."}
+		h.Helpers.EncodeJSON(w, http.StatusUnsupportedMediaType, msg)
+		return
+	}
+
+	query := r.URL.Query()
+	dryRun := query.Get("dryRun") == "true"
+	minConfidence := 0.0
+	if value := query.Get("minConfidence"); value != "" {
+		var err error
+		minConfidence, err = strconv.ParseFloat(value, 64)
+		if err != nil || minConfidence < 0 || minConfidence > 1 {
+			msg := map[string]string{"error": "minConfidence must be a number between 0 and 1."}
+			h.Helpers.EncodeJSON(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	text, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTextReceiptBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.Helpers.ClientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		h.Helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	parsed, confidence := parser.Parse(string(text))
+	input := ReceiptInput{
+		Retailer:     parsed.Retailer,
+		PurchaseDate: parsed.PurchaseDate,
+		PurchaseTime: parsed.PurchaseTime,
+		Total:        parsed.Total,
+		Items:        parsed.Items,
+		MemberID:     query.Get("memberId"),
+		TimeZone:     query.Get("timeZone"),
+	}
+	h.ValidateReceipt(tenant.FromContext(r.Context()).ID, &input)
+
+	response := ParseResponse{
+		Retailer:     input.Retailer,
+		PurchaseDate: input.PurchaseDate,
+		PurchaseTime: input.PurchaseTime,
+		Total:        input.Total,
+		Items:        input.Items,
+		MemberID:     input.MemberID,
+		TimeZone:     input.TimeZone,
+		Confidence:   confidence,
+		FieldErrors:  input.FieldErrors,
+	}
+
+	switch {
+	case dryRun:
+		h.Helpers.EncodeJSON(w, http.StatusOK, response)
+		return
+	case !input.Valid():
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, response)
+		return
+	case confidence.Overall < minConfidence:
+		response.Error = "The receipt was parsed with a confidence below minConfidence."
+		h.Helpers.EncodeJSON(w, http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	response.ID, err = h.CreateAndStore(r.Context(), input)
+	if errors.Is(err, models.ErrQuotaExceeded) {
+		msg := map[string]string{"error": "Receipt quota exceeded for this tenant."}
+		h.Helpers.EncodeJSON(w, http.StatusForbidden, msg)
+		return
+	}
+	if err != nil {
+		h.ErrorLog.Printf("Failed to store parsed receipt: %v", err)
+		h.Helpers.ServerError(w, err)
+		return
+	}
+
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+	}
+}
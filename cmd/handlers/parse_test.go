@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Ensures that plain-text receipts are parsed, validated and stored
+func TestParseReceipt(t *testing.T) {
+	target, err := os.ReadFile("../../testdata/receipts/target.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	undated, err := os.ReadFile("../../testdata/receipts/cafe-without-date.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := setupTestDependencies()
+
+	tests := []struct {
+		name           string
+		contentType    string
+		query          string
+		body           string
+		expectedStatus int
+		expectedStored bool
+	}{
+		{"Text receipt", "text/plain; charset=utf-8", "", string(target), http.StatusOK, true},
+		{"Dry run", "text/plain", "?dryRun=true", string(target), http.StatusOK, false},
+		{"Time zone", "text/plain", "?timeZone=Europe/Paris", string(target), http.StatusOK, true},
+		{"Unknown time zone", "text/plain", "?timeZone=Mars/Olympus", string(target), http.StatusBadRequest, false},
+		{"Low confidence", "text/plain", "?minConfidence=0.95", string(target), http.StatusUnprocessableEntity, false},
+		{"Missing fields", "text/plain", "", string(undated), http.StatusBadRequest, false},
+		{"Invalid minConfidence", "text/plain", "?minConfidence=2", string(target), http.StatusBadRequest, false},
+		{"JSON body", "application/json", "", `{"retailer":"Target"}`, http.StatusUnsupportedMediaType, false},
+		{"Too large", "text/plain", "", strings.Repeat("a", maxTextReceiptBytes+1), http.StatusRequestEntityTooLarge, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/receipts/parse"+entry.query, strings.NewReader(entry.body))
+			req.Header.Set("Content-Type", entry.contentType)
+
+			d.handlers.ParseReceipt(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Fatalf("Expected %d, got %d with %s", entry.expectedStatus, resp.Code, resp.Body.String())
+			}
+			if resp.Code == http.StatusUnsupportedMediaType || resp.Code == http.StatusRequestEntityTooLarge {
+				return
+			}
+
+			var response ParseResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if (response.ID != "") != entry.expectedStored {
+				t.Fatalf("Expected the receipt to be stored: %t, received id %q", entry.expectedStored, response.ID)
+			}
+			if entry.expectedStored {
+				receipt, err := d.handlers.ReceiptStore.Get(models.DefaultTenantID, response.ID)
+				if err != nil || receipt.Points != 28 {
+					t.Errorf("Expected the stored receipt to score 28 points, received %+v, %v", receipt, err)
+				}
+				if zone := req.URL.Query().Get("timeZone"); zone != "" && receipt.TimeZone != zone {
+					t.Errorf("Expected the receipt to be read in %s, received %s", zone, receipt.TimeZone)
+				}
+			}
+			if entry.expectedStatus == http.StatusBadRequest && entry.query == "" && response.FieldErrors["purchaseDate"] == "" {
+				t.Errorf("Expected a purchaseDate error, received %+v", response.FieldErrors)
+			}
+			if entry.name == "Unknown time zone" && response.FieldErrors["timeZone"] == "" {
+				t.Errorf("Expected a timeZone error, received %+v", response.FieldErrors)
+			}
+		})
+	}
+}
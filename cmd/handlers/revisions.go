@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
+)
+
+type ReceiptResponse struct {
+	ID                string             `json:"id"`
+	Revision          int                `json:"revision"`
+	Retailer          string             `json:"retailer"`
+	CanonicalRetailer string             `json:"canonicalRetailer,omitempty"`
+	PurchaseDate      string             `json:"purchaseDate"`
+	PurchaseTime      string             `json:"purchaseTime"`
+	TimeZone          string             `json:"timeZone,omitempty"`
+	PurchasedAt       *time.Time         `json:"purchasedAt,omitempty"`
+	Total             string             `json:"total"`
+	Items             []models.Item      `json:"items"`
+	MemberID          string             `json:"memberId,omitempty"`
+	Points            int                `json:"points"`
+	Breakdown         *BreakdownResponse `json:"breakdown,omitempty"`
+	SubmittedBy       string             `json:"submittedBy"`
+	UpdatedBy         string             `json:"updatedBy,omitempty"`
+	CreatedAt         time.Time          `json:"createdAt"`
+	UpdatedAt         time.Time          `json:"updatedAt"`
+}
+
+// Return the current revision of the receipt with its ETag
+func (h *Handlers) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	receipt, ok := h.receiptFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", receiptETag(receipt))
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, receiptResponse(receipt))
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Replace the receipt with the input and rescore it
+func (h *Handlers) UpdateReceipt(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.receiptForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	var input ReceiptInput
+	err := h.Helpers.DecodeJSON(w, r, &input)
+	if err != nil {
+		h.ErrorLog.Printf("Exiting after decoding attempt: %s", err)
+		return
+	}
+
+	h.storeRevision(w, r, current, input)
+}
+
+// Apply the fields present in the input to the receipt and rescore it.
+// Items are replaced as a whole
+func (h *Handlers) PatchReceipt(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.receiptForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	// Decode the body on top of the current receipt
+	input := ReceiptInput{
+		Retailer:     current.Retailer,
+		PurchaseDate: current.PurchaseDate,
+		PurchaseTime: current.PurchaseTime,
+		TimeZone:     current.RequestedTimeZone,
+		Total:        current.Total,
+		Items:        current.Items,
+		MemberID:     current.MemberID,
+	}
+	err := h.Helpers.DecodeJSON(w, r, &input)
+	if err != nil {
+		h.ErrorLog.Printf("Exiting after decoding attempt: %s", err)
+		return
+	}
+
+	h.storeRevision(w, r, current, input)
+}
+
+// Return every revision of the receipt, oldest first
+func (h *Handlers) ListReceiptRevisions(w http.ResponseWriter, r *http.Request) {
+	receiptID := h.Helpers.GetIdFromParams(r, "id")
+	revisions, err := h.ReceiptStore.Revisions(tenant.FromContext(r.Context()).ID, receiptID)
+	if err != nil {
+		msg := map[string]string{"error": "No receipt found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return
+	}
+
+	response := make([]ReceiptResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		response = append(response, receiptResponse(revision))
+	}
+
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Return a single revision of the receipt
+func (h *Handlers) GetReceiptRevision(w http.ResponseWriter, r *http.Request) {
+	receiptID := h.Helpers.GetIdFromParams(r, "id")
+	revisions, err := h.ReceiptStore.Revisions(tenant.FromContext(r.Context()).ID, receiptID)
+	if err != nil {
+		msg := map[string]string{"error": "No receipt found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return
+	}
+
+	number, err := strconv.Atoi(h.Helpers.GetIdFromParams(r, "revision"))
+	if err != nil || number < 1 || number > len(revisions) {
+		msg := map[string]string{"error": "No revision found for that number."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return
+	}
+
+	revision := revisions[number-1]
+	w.Header().Set("ETag", receiptETag(revision))
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, receiptResponse(revision))
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Returns the receipt named by the request params, or writes a 404 response
+func (h *Handlers) receiptFromParams(w http.ResponseWriter, r *http.Request) (models.Receipt, bool) {
+	receiptID := h.Helpers.GetIdFromParams(r, "id")
+	receipt, err := h.ReceiptStore.Get(tenant.FromContext(r.Context()).ID, receiptID)
+	if err != nil {
+		msg := map[string]string{"error": "No receipt found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return models.Receipt{}, false
+	}
+	return receipt, true
+}
+
+// Returns the receipt named by the request params if the If-Match header
+// matches its current revision, or writes the error response
+func (h *Handlers) receiptForUpdate(w http.ResponseWriter, r *http.Request) (models.Receipt, bool) {
+	receipt, ok := h.receiptFromParams(w, r)
+	if !ok {
+		return models.Receipt{}, false
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		msg := map[string]string{"error": "The If-Match header is required to update a receipt."}
+		h.Helpers.EncodeJSON(w, http.StatusPreconditionRequired, msg)
+		return models.Receipt{}, false
+	}
+	if !etagMatches(ifMatch, receiptETag(receipt)) {
+		h.revisionConflict(w)
+		return models.Receipt{}, false
+	}
+
+	return receipt, true
+}
+
+// Validates and scores the input, stores it as the next revision of the
+// current receipt and moves the points of the receipt in the ledger
+func (h *Handlers) storeRevision(w http.ResponseWriter, r *http.Request, current models.Receipt, input ReceiptInput) {
+	tenantID := tenant.FromContext(r.Context()).ID
+
+	// Validate input
+	h.ValidateReceipt(tenantID, &input)
+	if !input.Valid() {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, input.FieldErrors)
+		return
+	}
+
+	receipt, err := h.scoreReceipt(r.Context(), current.ID, input)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+	// The receipt keeps its submitter, the updater is recorded on the revision
+	receipt.SubmittedBy = current.SubmittedBy
+	receipt.CreatedAt = current.CreatedAt
+
+	receipt, err = h.ReceiptStore.Update(receipt, current.Revision)
+	if errors.Is(err, models.ErrRevisionConflict) {
+		h.revisionConflict(w)
+		return
+	}
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+
+	h.audit(r.Context(), audit.ActionReceiptUpdate, receiptResource(receipt.ID), current, receipt)
+	h.publish(r.Context(), webhook.EventReceiptUpdated, receipt)
+
+	// Take back the points of the previous revision and credit the new ones
+	principal := auth.PrincipalFromContext(r.Context()).Name()
+	if current.MemberID != "" {
+		err = h.reverse(r.Context(), tenantID, current.MemberID, current.ID)
+		if err != nil {
+			h.ErrorLog.Printf("Failed to reverse the points of receipt with ID %s. Error: %+v", current.ID, err)
+		}
+		h.reviewTier(r.Context(), tenantID, current.MemberID)
+	}
+	if receipt.MemberID != "" {
+		err = h.earn(r.Context(), tenantID, receipt)
+		if err != nil {
+			h.ErrorLog.Printf("Failed to credit the points of receipt with ID %s. Error: %+v", receipt.ID, err)
+		}
+		h.reviewTier(r.Context(), tenantID, receipt.MemberID)
+	}
+
+	h.InfoLog.Printf("Receipt with ID %s updated to revision %d by %s", receipt.ID, receipt.Revision, principal)
+
+	w.Header().Set("ETag", receiptETag(receipt))
+	err = h.Helpers.EncodeJSON(w, http.StatusOK, receiptResponse(receipt))
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+func (h *Handlers) revisionConflict(w http.ResponseWriter) {
+	msg := map[string]string{"error": "The receipt was modified since it was retrieved."}
+	h.Helpers.EncodeJSON(w, http.StatusPreconditionFailed, msg)
+}
+
+// Returns the strong entity tag of the receipt revision
+func receiptETag(receipt models.Receipt) string {
+	return `"` + strconv.Itoa(receipt.Revision) + `"`
+}
+
+// Reports whether the If-Match header value matches the entity tag,
+// using the strong comparison required for If-Match
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func receiptResponse(receipt models.Receipt) ReceiptResponse {
+	return ReceiptResponse{
+		ID:                receipt.ID,
+		Revision:          receipt.Revision,
+		Retailer:          receipt.Retailer,
+		CanonicalRetailer: receipt.CanonicalRetailer,
+		PurchaseDate:      receipt.PurchaseDate,
+		PurchaseTime:      receipt.PurchaseTime,
+		TimeZone:          receipt.TimeZone,
+		PurchasedAt:       purchaseInstant(receipt),
+		Total:             receipt.Total,
+		Items:             receipt.Items,
+		MemberID:          receipt.MemberID,
+		Points:            receipt.Points,
+		Breakdown:         breakdownResponse(receipt),
+		SubmittedBy:       receipt.SubmittedBy,
+		UpdatedBy:         receipt.UpdatedBy,
+		CreatedAt:         receipt.CreatedAt,
+		UpdatedAt:         receipt.UpdatedAt,
+	}
+}
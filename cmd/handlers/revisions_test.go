@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/retailers"
+)
+
+// Sends a request for the receipt to the handler with the optional If-Match header
+func receiptRequest(handler http.HandlerFunc, method, receiptID, body, ifMatch string, params ...httprouter.Param) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/receipts/"+receiptID, bytes.NewBufferString(body))
+	params = append(params, httprouter.Param{Key: "id", Value: receiptID})
+	req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, httprouter.Params(params)))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	resp := httptest.NewRecorder()
+	handler(resp, req)
+	return resp
+}
+
+func TestUpdateReceipt(t *testing.T) {
+	d := setupTestDependencies()
+	receipt, _ := d.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	d.receiptStore.Insert(receipt)
+
+	resp := receiptRequest(d.handlers.GetReceipt, http.MethodGet, receipt.ID, "", "")
+	etag := resp.Header().Get("ETag")
+	if resp.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("Expected status %d with ETag \"1\", got %d with %s", http.StatusOK, resp.Code, etag)
+	}
+
+	update := *ValidReceipt
+	update.Retailer = "M&M Corner Market"
+	body, _ := json.Marshal(update)
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		body           string
+		ifMatch        string
+		expectedStatus int
+	}{
+		{"Missing If-Match", d.handlers.UpdateReceipt, string(body), "", http.StatusPreconditionRequired},
+		{"Stale If-Match", d.handlers.UpdateReceipt, string(body), `"7"`, http.StatusPreconditionFailed},
+		{"Invalid receipt", d.handlers.UpdateReceipt, `{"retailer": "Target"}`, etag, http.StatusBadRequest},
+		{"Replace receipt", d.handlers.UpdateReceipt, string(body), etag, http.StatusOK},
+		{"Update based on a replaced revision", d.handlers.PatchReceipt, `{"total": "2.00"}`, etag, http.StatusPreconditionFailed},
+		{"Patch receipt", d.handlers.PatchReceipt, `{"total": "2.00"}`, `"2"`, http.StatusOK},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			resp := receiptRequest(entry.handler, http.MethodPut, receipt.ID, entry.body, entry.ifMatch)
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+		})
+	}
+
+	// The patch kept the retailer of the replacement and both were rescored
+	current, _ := d.receiptStore.Get("", receipt.ID)
+	if current.Revision != 3 || current.Retailer != update.Retailer || current.Total != "2.00" {
+		t.Errorf("Expected revision 3 with both updates, received %+v", current)
+	}
+	if current.Points == receipt.Points {
+		t.Errorf("Expected the receipt to be rescored, points are still %d", current.Points)
+	}
+
+	// Prior revisions stay retrievable
+	resp = receiptRequest(d.handlers.ListReceiptRevisions, http.MethodGet, receipt.ID, "", "")
+	var revisions []ReceiptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&revisions); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(revisions) != 3 || revisions[0].Points != receipt.Points {
+		t.Errorf("Expected three revisions starting with the original, received %+v", revisions)
+	}
+
+	resp = receiptRequest(d.handlers.GetReceiptRevision, http.MethodGet, receipt.ID, "", "", httprouter.Param{Key: "revision", Value: "1"})
+	var original ReceiptResponse
+	json.NewDecoder(resp.Body).Decode(&original)
+	if resp.Code != http.StatusOK || original.Retailer != ValidReceipt.Retailer {
+		t.Errorf("Expected the first revision, got %d with %+v", resp.Code, original)
+	}
+
+	resp = receiptRequest(d.handlers.GetReceiptRevision, http.MethodGet, receipt.ID, "", "", httprouter.Param{Key: "revision", Value: "4"})
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown revision, got %d", http.StatusNotFound, resp.Code)
+	}
+}
+
+func TestUpdateReceiptRescoresMemberPoints(t *testing.T) {
+	d := setupTestDependencies()
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+	receiptID := processMemberReceipt(t, d, member.ID)
+
+	resp := receiptRequest(d.handlers.PatchReceipt, http.MethodPatch, receiptID, `{"retailer": "Walgreens Pharmacy"}`, `"1"`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	receipt, _ := d.receiptStore.Get("", receiptID)
+	if balance := d.handlers.Ledger.Balance("", models.MemberAccount(member.ID)); balance != receipt.Points {
+		t.Errorf("Expected balance %d after rescoring, received %d", receipt.Points, balance)
+	}
+}
+
+func TestRestoreReceipt(t *testing.T) {
+	d := setupTestDependencies()
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+	receiptID := processMemberReceipt(t, d, member.ID)
+	receipt, _ := d.receiptStore.Get("", receiptID)
+
+	resp := receiptRequest(d.handlers.DeleteReceipt, http.MethodDelete, receiptID, "", "")
+	if resp.Code != http.StatusNoContent || resp.Body.Len() != 0 {
+		t.Fatalf("Expected status %d without a body, got %d with %q", http.StatusNoContent, resp.Code, resp.Body.String())
+	}
+	resp = receiptRequest(d.handlers.GetReceipt, http.MethodGet, receiptID, "", "")
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("Expected a deleted receipt to be hidden, got %d", resp.Code)
+	}
+
+	resp = receiptRequest(d.handlers.RestoreReceipt, http.MethodPost, receiptID, "", "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	if balance := d.handlers.Ledger.Balance("", models.MemberAccount(member.ID)); balance != receipt.Points {
+		t.Errorf("Expected the points to be credited again, balance is %d", balance)
+	}
+
+	// Only deleted receipts can be restored
+	resp = receiptRequest(d.handlers.RestoreReceipt, http.MethodPost, receiptID, "", "")
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, resp.Code)
+	}
+}
+
+func TestUpdateReceiptKeepsSubmitter(t *testing.T) {
+	d := setupTestDependencies()
+	submitter := auth.WithPrincipal(context.Background(), &auth.Principal{Method: "apikey", ID: "submitter"})
+	receipt, _ := d.handlers.ReceiptFactory(submitter, *ValidReceipt)
+	d.receiptStore.Insert(receipt)
+
+	req := httptest.NewRequest(http.MethodPatch, "/receipts/"+receipt.ID, bytes.NewBufferString(`{"total": "2.00"}`))
+	ctx := auth.WithPrincipal(req.Context(), &auth.Principal{Method: "apikey", ID: "updater"})
+	req = req.WithContext(context.WithValue(ctx, httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: receipt.ID}}))
+	req.Header.Set("If-Match", `"1"`)
+	resp := httptest.NewRecorder()
+	d.handlers.PatchReceipt(resp, req)
+
+	var updated ReceiptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil || resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d with %v", http.StatusOK, resp.Code, err)
+	}
+	if updated.SubmittedBy != "apikey:submitter" || updated.UpdatedBy != "apikey:updater" {
+		t.Errorf("Expected the receipt submitted by apikey:submitter and updated by apikey:updater, received %s and %s", updated.SubmittedBy, updated.UpdatedBy)
+	}
+	if !updated.CreatedAt.Equal(receipt.CreatedAt) {
+		t.Errorf("Expected the creation time %s to be kept, received %s", receipt.CreatedAt, updated.CreatedAt)
+	}
+}
+
+func TestPatchReceiptKeepsPriorItems(t *testing.T) {
+	d := setupTestDependencies()
+	receipt, _ := d.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	d.receiptStore.Insert(receipt)
+	original := receipt.Items[0].ShortDescription
+
+	resp := receiptRequest(d.handlers.PatchReceipt, http.MethodPatch, receipt.ID, `{"items": [{"shortDescription": "Replaced", "price": "1.00"}]}`, `"1"`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	revisions, _ := d.receiptStore.Revisions("", receipt.ID)
+	if len(revisions) != 2 || revisions[0].Items[0].ShortDescription != original || len(revisions[0].Items) != len(receipt.Items) {
+		t.Errorf("Expected revision 1 to keep its items, received %+v", revisions[0].Items)
+	}
+	if revisions[1].Items[0].ShortDescription != "Replaced" {
+		t.Errorf("Expected revision 2 to hold the patched items, received %+v", revisions[1].Items)
+	}
+}
+
+func TestPatchReceiptResolvesDefaultTimeZone(t *testing.T) {
+	d := setupTestDependencies()
+	registry, err := retailers.NewRegistry(retailers.PointsFromRaw, []retailers.Retailer{{Name: "Target", TimeZone: "America/Chicago"}})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	d.handlers.Retailers = registry
+
+	// The receipt names no zone and takes the zone of its retailer
+	receipt, _ := d.handlers.ReceiptFactory(context.Background(), *ValidReceipt)
+	d.receiptStore.Insert(receipt)
+	if receipt.TimeZone != "America/Chicago" || receipt.RequestedTimeZone != "" {
+		t.Fatalf("Expected the zone of the retailer, received %q requested as %q", receipt.TimeZone, receipt.RequestedTimeZone)
+	}
+
+	resp := receiptRequest(d.handlers.PatchReceipt, http.MethodPatch, receipt.ID, `{"retailer": "Walmart"}`, `"1"`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	// Another retailer without a zone falls back to the zone of the server
+	updated, _ := d.receiptStore.Get("", receipt.ID)
+	if updated.TimeZone != "UTC" {
+		t.Errorf("Expected the receipt to be read in UTC after the retailer changed, received %q", updated.TimeZone)
+	}
+}
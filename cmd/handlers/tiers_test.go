@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"kweeuhree.receipt-processor-challenge/internal/tiers"
+)
+
+// Processes the valid receipt for the member and returns its id
+func processMemberReceipt(t *testing.T, d *TestDependencies, memberID string) string {
+	t.Helper()
+	input := *ValidReceipt
+	input.MemberID = memberID
+	body, _ := json.Marshal(input)
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewBuffer(body))
+	resp := httptest.NewRecorder()
+	d.handlers.ProcessReceipt(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	var processed IdResponse
+	json.NewDecoder(resp.Body).Decode(&processed)
+	return processed.ID
+}
+
+func TestTierMultiplier(t *testing.T) {
+	d := setupTestDependencies()
+	program, err := tiers.NewProgram(tiers.BasisLifetimePoints, []tiers.Tier{
+		{Name: "bronze", Threshold: 0, Multiplier: 1},
+		{Name: "gold", Threshold: 30, Multiplier: 1.5},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create program: %v", err)
+	}
+	d.handlers.Tiers = program
+	member := createTestMember(t, d, MemberInput{Name: "Jane Doe"})
+
+	// The first receipt earns 31 points and promotes the member to gold
+	first := processMemberReceipt(t, d, member.ID)
+	second := processMemberReceipt(t, d, member.ID)
+
+	receipt, _ := d.receiptStore.Get("", second)
+	if receipt.Breakdown.Tier != "gold" || receipt.Breakdown.Multiplier != 1.5 {
+		t.Errorf("Expected the gold multiplier in the breakdown, received %+v", receipt.Breakdown)
+	}
+	if receipt.Breakdown.BasePoints != 31 || receipt.Points != 47 {
+		t.Errorf("Expected 31 points multiplied to 47, received %d and %d", receipt.Breakdown.BasePoints, receipt.Points)
+	}
+
+	// The breakdown is returned with the points
+	req := httptest.NewRequest(http.MethodGet, "/receipts/"+second+"/points", nil)
+	params := httprouter.Params{httprouter.Param{Key: "id", Value: second}}
+	req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+	resp := httptest.NewRecorder()
+	d.handlers.GetReceiptPoints(resp, req)
+	var points PointsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&points); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if points.Breakdown == nil || points.Breakdown.Multiplier != 1.5 {
+		t.Errorf("Expected the breakdown in the response, received %+v", points.Breakdown)
+	}
+
+	// Deleting both receipts demotes the member
+	for _, id := range []string{first, second} {
+		req := httptest.NewRequest(http.MethodDelete, "/receipts/"+id+"/delete", nil)
+		params := httprouter.Params{httprouter.Param{Key: "id", Value: id}}
+		req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+		d.handlers.DeleteReceipt(httptest.NewRecorder(), req)
+	}
+
+	var response MemberResponse
+	json.NewDecoder(getTestMember(d, member.ID).Body).Decode(&response)
+	if response.Tier != "bronze" {
+		t.Errorf("Expected the member to be demoted to bronze, received %q", response.Tier)
+	}
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"net/url"
+	"slices"
+	"strings"
+
 	"kweeuhree.receipt-processor-challenge/internal/validator"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
 )
 
 func (input *ReceiptInput) Validate() {
@@ -11,6 +16,7 @@ func (input *ReceiptInput) Validate() {
 	input.CheckField(v.ValidDate(input.PurchaseDate), "purchaseDate", "This field must be a valid date")
 	input.CheckField(v.ValidTime(input.PurchaseTime), "purchaseTime", "This field must be valid time")
 	input.CheckField(v.NotBlank(input.PurchaseTime), "purchaseTime", "This field cannot be blank")
+	input.CheckField(input.TimeZone == "" || v.ValidTimeZone(input.TimeZone), "timeZone", "This field must be an IANA time zone or an offset from UTC")
 	input.CheckField(v.NotBlank(input.Total), "total", "This field cannot be blank")
 	input.CheckField(v.ValidNumber(input.Total), "total", "This field must be a valid number")
 	input.CheckField(v.ItemsNotEmpty(input.Items), "items", "This field must have at least one object")
@@ -18,3 +24,20 @@ func (input *ReceiptInput) Validate() {
 		input.CheckField(v.ValidNumber(item.Price), "items", "Each item price must be a valid number")
 	}
 }
+
+func (input *MemberInput) Validate() {
+	var v *validator.Validator
+	input.CheckField(v.NotBlank(input.Name), "name", "This field cannot be blank")
+	input.CheckField(input.Email == "" || v.ValidEmail(input.Email), "email", "This field must be a valid email address")
+}
+
+func (input *WebhookInput) Validate() {
+	var v *validator.Validator
+	input.CheckField(v.NotBlank(input.URL), "url", "This field cannot be blank")
+	target, err := url.Parse(input.URL)
+	input.CheckField(err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != "", "url", "This field must be an absolute http or https URL")
+	input.CheckField(len(input.Events) > 0, "events", "This field must have at least one event")
+	for _, event := range input.Events {
+		input.CheckField(slices.Contains(webhook.EventTypes, event), "events", "Each event must be one of "+strings.Join(webhook.EventTypes, ", "))
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/validator"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
+)
+
+type WebhookInput struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	validator.Validator
+}
+
+type WebhookResponse struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Only returned when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Only returned for a single subscription
+	DroppedDeliveries *webhook.Dropped `json:"droppedDeliveries,omitempty"`
+}
+
+type DeliveryResponse struct {
+	ID             string    `json:"id"`
+	EventID        string    `json:"eventId"`
+	EventType      string    `json:"eventType"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	NextAttempt    time.Time `json:"nextAttempt"`
+	LastError      string    `json:"lastError,omitempty"`
+	LastStatusCode int       `json:"lastStatusCode,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Subscribe a URL to receipt events and return the subscription with its signing secret
+func (h *Handlers) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var input WebhookInput
+	err := h.Helpers.DecodeJSON(w, r, &input)
+	if err != nil {
+		h.ErrorLog.Printf("Exiting after decoding attempt: %s", err)
+		return
+	}
+
+	// Validate input
+	input.Validate()
+	if !input.Valid() {
+		h.Helpers.EncodeJSON(w, http.StatusBadRequest, input.FieldErrors)
+		return
+	}
+
+	subscription, err := h.Webhooks.Create(tenant.FromContext(r.Context()).ID, input.URL, input.Events, auth.PrincipalFromContext(r.Context()).Name())
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+
+	response := webhookResponse(subscription)
+	response.Secret = subscription.Secret
+
+	err = h.Helpers.EncodeJSON(w, http.StatusCreated, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Return the webhook subscriptions of the tenant
+func (h *Handlers) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions := h.Webhooks.List(tenant.FromContext(r.Context()).ID)
+
+	response := make([]WebhookResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		response = append(response, webhookResponse(subscription))
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Return the webhook subscription with the number of its deliveries dropped over the outbox limits
+func (h *Handlers) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := h.webhookFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	response := webhookResponse(subscription)
+	dropped := h.Outbox.Dropped(subscription.TenantID, subscription.ID)
+	response.DroppedDeliveries = &dropped
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Unsubscribe, events still waiting in the outbox are dropped
+func (h *Handlers) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := h.webhookFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Webhooks.Delete(subscription.TenantID, subscription.ID)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Return the pending and dead-lettered deliveries of the subscription, oldest first
+func (h *Handlers) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := h.webhookFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries := h.Outbox.Deliveries(subscription.TenantID, subscription.ID)
+	response := make([]DeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if status := r.URL.Query().Get("status"); status != "" && delivery.Status != status {
+			continue
+		}
+		response = append(response, deliveryResponse(delivery))
+	}
+
+	err := h.Helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Queue a dead-lettered delivery again
+func (h *Handlers) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := h.webhookFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.Outbox.Redeliver(subscription.TenantID, subscription.ID, h.Helpers.GetIdFromParams(r, "delivery"))
+	if errors.Is(err, webhook.ErrNoDelivery) {
+		msg := map[string]string{"error": "No dead-lettered delivery found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return
+	}
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+
+	err = h.Helpers.EncodeJSON(w, http.StatusAccepted, deliveryResponse(delivery))
+	if err != nil {
+		h.Helpers.ServerError(w, err)
+		return
+	}
+}
+
+// Returns the subscription named by the id param, writing a 404 response when missing
+func (h *Handlers) webhookFromParams(w http.ResponseWriter, r *http.Request) (webhook.Subscription, bool) {
+	subscriptionID := h.Helpers.GetIdFromParams(r, "id")
+	subscription, err := h.Webhooks.Get(tenant.FromContext(r.Context()).ID, subscriptionID)
+	if err != nil {
+		msg := map[string]string{"error": "No webhook found for that ID."}
+		h.Helpers.EncodeJSON(w, http.StatusNotFound, msg)
+		return webhook.Subscription{}, false
+	}
+	return subscription, true
+}
+
+func webhookResponse(subscription webhook.Subscription) WebhookResponse {
+	return WebhookResponse{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		Events:    subscription.Events,
+		CreatedBy: subscription.CreatedBy,
+		CreatedAt: subscription.CreatedAt,
+	}
+}
+
+func deliveryResponse(delivery webhook.Delivery) DeliveryResponse {
+	return DeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttempt:    delivery.NextAttempt,
+		LastError:      delivery.LastError,
+		LastStatusCode: delivery.LastStatusCode,
+		CreatedAt:      delivery.CreatedAt,
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
+)
+
+// Creates a webhook subscription through the handler and returns the response
+func createTestWebhook(t *testing.T, d *TestDependencies, input WebhookInput) WebhookResponse {
+	t.Helper()
+	body, _ := json.Marshal(input)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewBuffer(body))
+	resp := httptest.NewRecorder()
+
+	d.handlers.CreateWebhook(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, resp.Code)
+	}
+	var subscription WebhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&subscription); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return subscription
+}
+
+func TestCreateWebhook(t *testing.T) {
+	d := setupTestDependencies()
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedField  string
+	}{
+		{"Valid webhook", `{"url": "https://partner.example.com/hooks", "events": ["receipt.processed"]}`, http.StatusCreated, ""},
+		{"No URL", `{"events": ["receipt.processed"]}`, http.StatusBadRequest, "url"},
+		{"Relative URL", `{"url": "/hooks", "events": ["receipt.processed"]}`, http.StatusBadRequest, "url"},
+		{"Unsupported scheme", `{"url": "ftp://partner.example.com", "events": ["receipt.processed"]}`, http.StatusBadRequest, "url"},
+		{"No events", `{"url": "https://partner.example.com/hooks", "events": []}`, http.StatusBadRequest, "events"},
+		{"Unknown event", `{"url": "https://partner.example.com/hooks", "events": ["member.created"]}`, http.StatusBadRequest, "events"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewBufferString(entry.body))
+			resp := httptest.NewRecorder()
+
+			d.handlers.CreateWebhook(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+
+			var response map[string]any
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if entry.expectedField != "" {
+				if _, exists := response[entry.expectedField]; !exists {
+					t.Errorf("Expected an error for field %s, received %v", entry.expectedField, response)
+				}
+			} else if response["secret"] == "" || response["secret"] == nil {
+				t.Errorf("Expected the created webhook to carry its secret, received %v", response)
+			}
+		})
+	}
+
+	// The secret is only returned on creation
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	resp := httptest.NewRecorder()
+	d.handlers.ListWebhooks(resp, req)
+	if bytes.Contains(resp.Body.Bytes(), []byte("secret")) {
+		t.Errorf("Expected listed webhooks not to carry their secret, received %s", resp.Body.String())
+	}
+}
+
+// Ensures that subscribers receive signed receipt lifecycle events
+func TestWebhookDeliveries(t *testing.T) {
+	d := setupTestDependencies()
+
+	var mu sync.Mutex
+	var received []webhook.Event
+	var signatures []error
+	var secret string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		signatures = append(signatures, webhook.Verify(secret, r.Header.Get(webhook.HeaderSignature), body, time.Minute, time.Now()))
+
+		var event webhook.Event
+		json.Unmarshal(body, &event)
+		received = append(received, event)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	// The test server listens on loopback
+	d.handlers.Outbox.AllowPrivateNetworks()
+
+	subscription := createTestWebhook(t, d, WebhookInput{
+		URL:    server.URL,
+		Events: []string{webhook.EventReceiptProcessed, webhook.EventReceiptUpdated, webhook.EventReceiptDeleted},
+	})
+	secret = subscription.Secret
+
+	// Process, update and delete a receipt
+	receiptID, err := d.handlers.CreateAndStore(context.Background(), *ValidReceipt)
+	if err != nil {
+		t.Fatalf("Failed to store receipt: %v", err)
+	}
+	update, _ := json.Marshal(ValidReceipt)
+	receiptRequest(d.handlers.UpdateReceipt, http.MethodPut, receiptID, string(update), `"1"`)
+	receiptRequest(d.handlers.DeleteReceipt, http.MethodDelete, receiptID, "", "")
+
+	if delivered := d.handlers.Outbox.Dispatch(context.Background()); delivered != 3 {
+		t.Fatalf("Expected 3 deliveries, received %d", delivered)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{webhook.EventReceiptProcessed, webhook.EventReceiptUpdated, webhook.EventReceiptDeleted}
+	for i, eventType := range expected {
+		if received[i].Type != eventType {
+			t.Errorf("Expected event %d to be %s, received %s", i, eventType, received[i].Type)
+		}
+		if signatures[i] != nil {
+			t.Errorf("Expected event %d to be validly signed, received %v", i, signatures[i])
+		}
+		data := received[i].Data.(map[string]any)
+		if data["id"] != receiptID || data["points"] != float64(31) {
+			t.Errorf("Expected event %d to carry the receipt and its points, received %v", i, data)
+		}
+	}
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	d := setupTestDependencies()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	d.handlers.Outbox = webhook.NewOutbox(d.handlers.Webhooks, webhook.RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Minute, MaxBackoff: time.Minute}, d.handlers.ErrorLog, d.handlers.InfoLog)
+	d.handlers.Outbox.AllowPrivateNetworks()
+	subscription := createTestWebhook(t, d, WebhookInput{URL: server.URL, Events: []string{webhook.EventReceiptProcessed}})
+
+	d.handlers.CreateAndStore(context.Background(), *ValidReceipt)
+	d.handlers.Outbox.Dispatch(context.Background())
+
+	params := httprouter.Params{{Key: "id", Value: subscription.ID}}
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/"+subscription.ID+"/deliveries?status=dead", nil)
+	req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+	resp := httptest.NewRecorder()
+	d.handlers.ListWebhookDeliveries(resp, req)
+
+	var deliveries []DeliveryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected 1 dead letter, received %+v", deliveries)
+	}
+
+	tests := []struct {
+		name           string
+		deliveryID     string
+		expectedStatus int
+	}{
+		{"Dead letter", deliveries[0].ID, http.StatusAccepted},
+		{"Already queued", deliveries[0].ID, http.StatusNotFound},
+		{"Unknown delivery", "unknown", http.StatusNotFound},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			resp := receiptRequest(d.handlers.RedeliverWebhook, http.MethodPost, subscription.ID, "", "", httprouter.Param{Key: "delivery", Value: entry.deliveryID})
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected status %d, got %d", entry.expectedStatus, resp.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+// Package parser extracts receipts from the plain text produced by
+// scanners, and rates how confident it is in every extracted field.
+package parser
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Receipt holds the fields extracted from a plain-text receipt,
+// named like the fields of a JSON receipt
+type Receipt struct {
+	Retailer     string        `json:"retailer"`
+	PurchaseDate string        `json:"purchaseDate"`
+	PurchaseTime string        `json:"purchaseTime"`
+	Total        string        `json:"total"`
+	Items        []models.Item `json:"items"`
+}
+
+// Confidence rates every extracted field from 0, not found, to 1, certain
+type Confidence struct {
+	Retailer     float64 `json:"retailer"`
+	PurchaseDate float64 `json:"purchaseDate"`
+	PurchaseTime float64 `json:"purchaseTime"`
+	Total        float64 `json:"total"`
+	Items        float64 `json:"items"`
+	// Mean of the field confidences
+	Overall float64 `json:"overall"`
+}
+
+var (
+	// Amount at the end of a line, such as 12.25, $1,234.56 or 1,20
+	amount = regexp.MustCompile(`\$?\s?(\d{1,3}(?:[.,]\d{3})*[.,]\d{2}|\d+[.,]\d{2})\s*[A-Z]?$`)
+	// Quantity lines printed above an item, such as 2 @ 1.25
+	quantity = regexp.MustCompile(`^\d+\s*[@xX]\s*\$?\d+[.,]\d{2}$`)
+	// Labels of the total, most specific first
+	totalLabel = regexp.MustCompile(`(?i)^(grand\s+total|total|amount\s+due|balance\s+due|summe)\b`)
+	subtotal   = regexp.MustCompile(`(?i)^sub\s*-?\s*total\b`)
+	tax        = regexp.MustCompile(`(?i)^(sales\s+)?(tax|vat|mwst)\b`)
+	// Lines with an amount that are not items
+	notItem = regexp.MustCompile(`(?i)\b(total|subtotal|tax|vat|mwst|cash|change|tender|visa|mastercard|amex|debit|credit|card|payment|balance|due|summe|tip|savings)\b`)
+
+	// Lines that never name the retailer
+	notRetailer = regexp.MustCompile(`(?i)\b(receipt|customer\s+copy|thank\s+you|invoice)\b`)
+	welcome     = regexp.MustCompile(`(?i)^welcome\s+to\s+`)
+	storeLabel  = regexp.MustCompile(`(?i)^(store|retailer|merchant)\s*:\s*`)
+
+	isoDate   = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	slashDate = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4}|\d{2})\b`)
+	dotDate   = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})\.(\d{4})\b`)
+	monthDate = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+(\d{1,2}),?\s+(\d{4})\b`)
+	dayMonth  = regexp.MustCompile(`(?i)\b(\d{1,2})\s+(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?,?\s+(\d{4})\b`)
+	clock     = regexp.MustCompile(`\b(\d{1,2}):(\d{2})(?::(\d{2}))?(?:\s*([AaPp])\.?[Mm]\.?)?`)
+)
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// Extracts the retailer, purchase date and time, items and total of a
+// plain-text receipt. Fields that are not found are left empty with a
+// confidence of 0, so that validating the input reports them
+func Parse(text string) (Receipt, Confidence) {
+	var receipt Receipt
+	var confidence Confidence
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	receipt.Retailer, confidence.Retailer = parseRetailer(lines)
+	receipt.PurchaseDate, confidence.PurchaseDate = parseDate(lines)
+	receipt.PurchaseTime, confidence.PurchaseTime = parseTime(lines)
+	receipt.Items, receipt.Total, confidence.Items, confidence.Total = parseAmounts(lines)
+
+	confidence.Overall = round((confidence.Retailer + confidence.PurchaseDate + confidence.PurchaseTime + confidence.Total + confidence.Items) / 5)
+
+	return receipt, confidence
+}
+
+// The retailer is labelled, or printed on the first line naming anything
+func parseRetailer(lines []string) (string, float64) {
+	for _, line := range lines {
+		if label := storeLabel.FindString(line); label != "" {
+			return strings.TrimSpace(line[len(label):]), 1
+		}
+	}
+
+	for i, line := range lines {
+		name := strings.Trim(line, "*-=#~_ ")
+		if !strings.ContainsFunc(name, unicode.IsLetter) || notRetailer.MatchString(name) ||
+			amount.MatchString(name) || findDate(name) != "" || clock.MatchString(name) {
+			continue
+		}
+
+		if prefix := welcome.FindString(name); prefix != "" {
+			return name[len(prefix):], 0.9
+		}
+		if i == 0 {
+			return name, 0.9
+		}
+		return name, 0.7
+	}
+
+	return "", 0
+}
+
+// Returns the first purchase date printed in a known layout
+func parseDate(lines []string) (string, float64) {
+	for _, line := range lines {
+		if date, confidence := matchDate(line); date != "" {
+			return date, confidence
+		}
+	}
+	return "", 0
+}
+
+func findDate(line string) string {
+	date, _ := matchDate(line)
+	return date
+}
+
+// Matches the dates of a line, from the least to the most ambiguous layout
+func matchDate(line string) (string, float64) {
+	if match := isoDate.FindStringSubmatch(line); match != nil {
+		if date := formatDate(match[1], match[2], match[3]); date != "" {
+			return date, 1
+		}
+	}
+
+	if match := monthDate.FindStringSubmatch(line); match != nil {
+		if date := formatDate(match[3], strconv.Itoa(int(months[strings.ToLower(match[1])])), match[2]); date != "" {
+			return date, 0.95
+		}
+	}
+	if match := dayMonth.FindStringSubmatch(line); match != nil {
+		if date := formatDate(match[3], strconv.Itoa(int(months[strings.ToLower(match[2])])), match[1]); date != "" {
+			return date, 0.95
+		}
+	}
+
+	if match := slashDate.FindStringSubmatch(line); match != nil {
+		first, _ := strconv.Atoi(match[1])
+		second, _ := strconv.Atoi(match[2])
+		year := match[3]
+		confidence := 0.95
+		if len(year) == 2 {
+			year = "20" + year
+			confidence -= 0.1
+		}
+
+		// Dates are month first unless the first number cannot be a month.
+		// Both readings are possible when both numbers are months
+		month, day := match[1], match[2]
+		switch {
+		case first > 12:
+			month, day = match[2], match[1]
+			confidence -= 0.1
+		case second <= 12 && first != second:
+			confidence -= 0.15
+		}
+		if date := formatDate(year, month, day); date != "" {
+			return date, round(confidence)
+		}
+	}
+
+	// Dotted dates are day first
+	if match := dotDate.FindStringSubmatch(line); match != nil {
+		if date := formatDate(match[3], match[2], match[1]); date != "" {
+			return date, 0.9
+		}
+	}
+
+	return "", 0
+}
+
+// Returns the date as YYYY-MM-DD, or an empty string if it does not exist
+func formatDate(year, month, day string) string {
+	y, _ := strconv.Atoi(year)
+	m, _ := strconv.Atoi(month)
+	d, _ := strconv.Atoi(day)
+
+	date := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if date.Year() != y || int(date.Month()) != m || date.Day() != d {
+		return ""
+	}
+	return date.Format("2006-01-02")
+}
+
+// Returns the first time of day as HH:MM in 24-hour format
+func parseTime(lines []string) (string, float64) {
+	for _, line := range lines {
+		for _, match := range clock.FindAllStringSubmatch(line, -1) {
+			hour, _ := strconv.Atoi(match[1])
+			minute, _ := strconv.Atoi(match[2])
+			confidence := 0.9
+
+			if meridiem := strings.ToLower(match[4]); meridiem != "" {
+				if hour < 1 || hour > 12 {
+					continue
+				}
+				hour %= 12
+				if meridiem == "p" {
+					hour += 12
+				}
+				confidence = 0.95
+			}
+
+			if hour > 23 || minute > 59 {
+				continue
+			}
+			return time.Date(0, 1, 1, hour, minute, 0, 0, time.UTC).Format("15:04"), confidence
+		}
+	}
+	return "", 0
+}
+
+// Collects the items printed above the total, and the total. The total
+// is trusted more when it adds up with the items and taxes, and is the
+// sum of the items when it is not printed
+func parseAmounts(lines []string) ([]models.Item, string, float64, float64) {
+	var items []models.Item
+	var itemsConfidence float64
+	var itemsCents, taxCents int
+	total := ""
+	totalCents := 0
+
+	for _, line := range lines {
+		match := amount.FindStringSubmatchIndex(line)
+		if match == nil || quantity.MatchString(line) {
+			continue
+		}
+		value := normalizeAmount(line[match[2]:match[3]])
+		label := strings.TrimSpace(line[:match[0]])
+
+		switch {
+		case subtotal.MatchString(label):
+			continue
+		case totalLabel.MatchString(label):
+			if total == "" {
+				total = value
+				totalCents = cents(value)
+			}
+			continue
+		case tax.MatchString(label):
+			taxCents += cents(value)
+			continue
+		case total != "" || notItem.MatchString(label) || label == "":
+			continue
+		}
+
+		items = append(items, models.Item{ShortDescription: label, Price: value})
+		itemsCents += cents(value)
+
+		// Descriptions without letters are likely codes or misread lines
+		if strings.ContainsFunc(label, unicode.IsLetter) {
+			itemsConfidence += 0.9
+		} else {
+			itemsConfidence += 0.5
+		}
+	}
+
+	if len(items) > 0 {
+		itemsConfidence = round(itemsConfidence / float64(len(items)))
+	}
+
+	switch {
+	case total == "" && len(items) == 0:
+		return items, "", itemsConfidence, 0
+	case total == "":
+		return items, formatCents(itemsCents), itemsConfidence, 0.5
+	case totalCents == itemsCents || totalCents == itemsCents+taxCents:
+		return items, total, itemsConfidence, 1
+	default:
+		return items, total, itemsConfidence, 0.8
+	}
+}
+
+// Returns the amount with a dot before its cents and no thousands separators
+func normalizeAmount(value string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value)
+	return formatCents(cents(digits[:len(digits)-2] + "." + digits[len(digits)-2:]))
+}
+
+// Returns the number of cents of a normalized amount
+func cents(value string) int {
+	amount, _ := strconv.ParseFloat(value, 64)
+	return int(math.Round(amount * 100))
+}
+
+func formatCents(cents int) string {
+	return strconv.Itoa(cents/100) + "." + strconv.Itoa(cents%100/10) + strconv.Itoa(cents%10)
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Parses every text receipt of the corpus and compares it with the
+// receipt and confidence expected in the JSON file of the same name
+func TestParseCorpus(t *testing.T) {
+	files, err := filepath.Glob("../../testdata/receipts/*.txt")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Expected text receipts in testdata, received %v", err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) {
+			text, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(strings.TrimSuffix(file, ".txt") + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expected struct {
+				Receipt    Receipt    `json:"receipt"`
+				Confidence Confidence `json:"confidence"`
+			}
+			if err := json.Unmarshal(data, &expected); err != nil {
+				t.Fatal(err)
+			}
+
+			receipt, confidence := Parse(string(text))
+			if !reflect.DeepEqual(receipt, expected.Receipt) {
+				t.Errorf("Expected receipt %+v, received %+v", expected.Receipt, receipt)
+			}
+			if confidence != expected.Confidence {
+				t.Errorf("Expected confidence %+v, received %+v", expected.Confidence, confidence)
+			}
+		})
+	}
+}
+
+func TestMatchDate(t *testing.T) {
+	tests := []struct {
+		line               string
+		expectedDate       string
+		expectedConfidence float64
+	}{
+		{"2022-01-02", "2022-01-02", 1},
+		{"Jan 2, 2022", "2022-01-02", 0.95},
+		{"2 January 2022", "2022-01-02", 0.95},
+		{"01/02/2022", "2022-01-02", 0.8},
+		{"12/12/22", "2022-12-12", 0.85},
+		{"25/12/2022", "2022-12-25", 0.85},
+		{"25.12.2022", "2022-12-25", 0.9},
+		{"02/30/2022", "", 0},
+		{"Total 12.25", "", 0},
+	}
+
+	for _, entry := range tests {
+		date, confidence := matchDate(entry.line)
+		if date != entry.expectedDate || confidence != entry.expectedConfidence {
+			t.Errorf("Expected %q to be %q with %v, received %q with %v", entry.line, entry.expectedDate, entry.expectedConfidence, date, confidence)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		line         string
+		expectedTime string
+	}{
+		{"13:01", "13:01"},
+		{"1:01 PM", "13:01"},
+		{"12:30 a.m.", "00:30"},
+		{"12:05 PM", "12:05"},
+		{"08:13:45", "08:13"},
+		{"25:00", ""},
+		{"13:01 PM", ""},
+	}
+
+	for _, entry := range tests {
+		if received, _ := parseTime([]string{entry.line}); received != entry.expectedTime {
+			t.Errorf("Expected %q to be %q, received %q", entry.line, entry.expectedTime, received)
+		}
+	}
+}
+
+func TestParseAmounts(t *testing.T) {
+	lines := []string{"Coffee 1,234.50", "Bagel $2.00 T", "TOTAL 1,300.00"}
+
+	items, total, itemsConfidence, totalConfidence := parseAmounts(lines)
+	if len(items) != 2 || items[0].Price != "1234.50" || items[1].Price != "2.00" {
+		t.Errorf("Unexpected items %+v", items)
+	}
+	// The total does not add up with the items
+	if total != "1300.00" || totalConfidence != 0.8 || itemsConfidence != 0.9 {
+		t.Errorf("Expected total 1300.00 with 0.8, received %s with %v", total, totalConfidence)
+	}
+}
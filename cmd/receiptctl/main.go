@@ -0,0 +1,191 @@
+// Command receiptctl validates and scores receipts without running the server.
+//
+//	go run ./cmd/receiptctl examples/*.json
+//	cat receipts.ndjson | go run ./cmd/receiptctl -breakdown
+//
+// Each file holds one receipt, or several receipts one after the other as in
+// NDJSON. Receipts are read from stdin when no file, or "-", is provided.
+// The command prints the points of every valid receipt and the validation
+// errors of the others, and exits with status 1 when a receipt is invalid
+// and with status 2 when the input cannot be read.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"kweeuhree.receipt-processor-challenge/cmd/handlers"
+	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
+)
+
+// Exit statuses
+const (
+	exitOK      = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+// Result is the outcome of scoring a receipt, printed as a JSON line with -json
+type Result struct {
+	Source    string             `json:"source"`
+	Points    int                `json:"points"`
+	Breakdown []utils.RulePoints `json:"breakdown,omitempty"`
+	Errors    map[string]string  `json:"errors,omitempty"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Scores the receipts of the files named by the arguments and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("receiptctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	breakdown := flags.Bool("breakdown", false, "Print the points awarded by every rule")
+	asJSON := flags.Bool("json", false, "Print one JSON result per receipt")
+	rulesFile := flags.String("rules", "", "Path to a JSON file with the points rules, which only need to list the amounts that differ from the default rules")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: receiptctl [-breakdown] [-json] [-rules file] [file ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	calculator := utils.NewUtils()
+	if *rulesFile != "" {
+		rules, err := scoring.LoadRules(*rulesFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		calculator = calculator.WithRules(rules)
+	}
+
+	sources := flags.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	printer := &printer{out: stdout, breakdown: *breakdown, json: *asJSON}
+	status := exitOK
+	for _, source := range sources {
+		results, err := scoreSource(calculator, source, stdin)
+		for _, result := range results {
+			if len(result.Errors) > 0 {
+				status = max(status, exitInvalid)
+			}
+			printer.print(result)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = exitError
+		}
+	}
+
+	return status
+}
+
+// Scores every receipt of the file, or of stdin for "-"
+func scoreSource(calculator *utils.Utils, source string, stdin io.Reader) ([]Result, error) {
+	input, name := stdin, "stdin"
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input, name = file, source
+	}
+
+	var results []Result
+	decoder := json.NewDecoder(input)
+	for index := 1; ; index++ {
+		var receipt handlers.ReceiptInput
+		err := decoder.Decode(&receipt)
+		if errors.Is(err, io.EOF) {
+			return results, nil
+		}
+		if err != nil {
+			return results, fmt.Errorf("%s: receipt %d: %w", name, index, err)
+		}
+
+		label := name
+		if index > 1 || decoder.More() {
+			label = fmt.Sprintf("%s:%d", name, index)
+		}
+		results = append(results, score(calculator, label, receipt))
+	}
+}
+
+// Validates the receipt like the server does and scores it when it is valid
+func score(calculator *utils.Utils, source string, receipt handlers.ReceiptInput) Result {
+	result := Result{Source: source}
+
+	receipt.Validate()
+	if !receipt.Valid() {
+		result.Errors = receipt.FieldErrors
+		return result
+	}
+
+	breakdown, err := calculator.Breakdown(receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total, receipt.Items)
+	if err != nil {
+		result.Errors = map[string]string{"total": err.Error()}
+		return result
+	}
+	result.Breakdown = breakdown
+	for _, rule := range breakdown {
+		result.Points += rule.Points
+	}
+
+	return result
+}
+
+// Prints results as text, rule breakdown tables or JSON lines
+type printer struct {
+	out       io.Writer
+	breakdown bool
+	json      bool
+}
+
+func (p *printer) print(result Result) {
+	if p.json {
+		if !p.breakdown {
+			result.Breakdown = nil
+		}
+		line, _ := json.Marshal(result)
+		fmt.Fprintln(p.out, string(line))
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		fmt.Fprintf(p.out, "%s: invalid\n", result.Source)
+		fields := make([]string, 0, len(result.Errors))
+		for field := range result.Errors {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Fprintf(p.out, "  %s: %s\n", field, result.Errors[field])
+		}
+		return
+	}
+
+	fmt.Fprintf(p.out, "%s: %d points\n", result.Source, result.Points)
+	if p.breakdown {
+		table := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "  RULE\tPOINTS")
+		for _, rule := range result.Breakdown {
+			fmt.Fprintf(table, "  %s\t%6d\n", rule.Rule, rule.Points)
+		}
+		fmt.Fprintf(table, "  total\t%6d\n", result.Points)
+		table.Flush()
+	}
+}
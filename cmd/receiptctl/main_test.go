@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validLine = `{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:13","total":"1.25","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}]}`
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		stdin          string
+		expectedStatus int
+		expectedOutput []string
+	}{
+		{"Example file", []string{"../../examples/simple-receipt.json"}, "", exitOK, []string{"examples/simple-receipt.json: 31 points"}},
+		{"NDJSON stdin", nil, validLine + "\n" + validLine + "\n", exitOK, []string{"stdin:1: 31 points", "stdin:2: 31 points"}},
+		{"Breakdown", []string{"-breakdown", "-"}, validLine, exitOK, []string{"quarterTotal", "retailerName", "total                 31"}},
+		{"Invalid receipt", nil, `{"retailer":"Target","total":"abc"}`, exitInvalid, []string{"stdin: invalid", "total: This field must be a valid number"}},
+		{"Malformed JSON", nil, `{"retailer":`, exitError, nil},
+		{"Missing file", []string{"missing.json"}, "", exitError, nil},
+		{"Unknown flag", []string{"-verbose"}, "", exitError, nil},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(entry.args, strings.NewReader(entry.stdin), &stdout, &stderr)
+
+			if status != entry.expectedStatus {
+				t.Errorf("Expected status %d, received %d with %s", entry.expectedStatus, status, stderr.String())
+			}
+			for _, expected := range entry.expectedOutput {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("Expected the output to contain %q, received:\n%s", expected, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithRulesAsJSON(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(rules, []byte(`{"quarterPoints": 0}`), 0o600)
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"-json", "-rules", rules}, strings.NewReader(validLine), &stdout, &stderr)
+	if status != exitOK {
+		t.Fatalf("Expected status %d, received %d with %s", exitOK, status, stderr.String())
+	}
+
+	var result Result
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.Points != 6 || result.Breakdown != nil {
+		t.Errorf("Expected 6 points without the quarter rule and no breakdown, received %+v", result)
+	}
+}
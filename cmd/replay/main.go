@@ -0,0 +1,397 @@
+// Command replay sends recorded requests, or synthetic receipts, to a
+// running server and reports latency percentiles, error rates and the
+// receipts whose points differ from the points computed locally.
+//
+//	go run ./cmd/replay -file recorded.jsonl -rate 50 -concurrency 8
+//	go run ./cmd/replay -count 1000 -concurrency 16
+//
+// Every line of the file is either a recorded request such as
+//
+//	{"method": "POST", "path": "/receipts/process", "headers": {"X-Tenant-ID": "brand-a"}, "body": {...}}
+//
+// or a bare receipt, which is posted to /receipts/process. The points of
+// every processed receipt are fetched and compared with the points of the
+// default rules, or of the -rules file. With -tenants, the tenants file of
+// the server, every receipt is scored with the rules of the tenant its
+// X-Tenant-ID header names instead.
+//
+// The points of some receipts cannot be predicted, and are counted as
+// skipped rather than compared:
+//
+//   - receipts with a memberId, which earn the multiplier of the tier the
+//     member reached on the server;
+//   - without -tenants, receipts sent for a tenant other than the one of
+//     -tenant, the default tenant when empty, whose rules are unknown.
+//
+// The points are computed as if the server had no retailer registry and
+// read purchase times in UTC, so replay against a server started without
+// -retailers and with the default -time-zone. The command exits with status 1 when a request
+// failed or a receipt was scored differently.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/cmd/handlers"
+	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+)
+
+// Route of the requests whose points are verified
+const processPath = "/receipts/process"
+
+// Number of mismatches described on stderr, the others are only counted
+const reportedMismatches = 10
+
+// Request is a recorded HTTP request
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Replayer sends requests to the target server and records their outcome
+type Replayer struct {
+	client     *http.Client
+	target     string
+	headers    map[string]string
+	calculator *utils.Utils
+	// Tenants whose rules score their receipts, nil when the rules
+	// of tenants other than the one of the headers are unknown
+	tenants *tenant.Registry
+	stats   *Stats
+	log     io.Writer
+
+	mu         sync.Mutex
+	mismatches int
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:4000", "Base URL of the server")
+	file := flag.String("file", "", "JSONL file of recorded requests or receipts, synthetic receipts are sent when empty")
+	count := flag.Int("count", 100, "Number of synthetic receipts")
+	seed := flag.Int64("seed", 1, "Seed of the synthetic receipts")
+	rate := flag.Float64("rate", 0, "Requests started per second, unlimited when zero")
+	concurrency := flag.Int("concurrency", 4, "Number of requests in flight at once")
+	apiKey := flag.String("api-key", "", "API key sent in the X-API-Key header")
+	tenantID := flag.String("tenant", "", "Tenant sent in the X-Tenant-ID header")
+	rulesFile := flag.String("rules", "", "Path to a JSON file with the points rules of the tenant, the default rules when empty")
+	tenantsFile := flag.String("tenants", "", "Path to the tenants file of the server, to score the receipts of every tenant with its rules")
+	timeout := flag.Duration("timeout", 10*time.Second, "Timeout of a single request")
+	flag.Parse()
+
+	if *concurrency < 1 || *rate < 0 {
+		fmt.Fprintln(os.Stderr, "concurrency must be positive and rate cannot be negative")
+		os.Exit(2)
+	}
+	if *rulesFile != "" && *tenantsFile != "" {
+		fmt.Fprintln(os.Stderr, "the rules of the tenants file replace -rules, provide only one of them")
+		os.Exit(2)
+	}
+
+	calculator := utils.NewUtils()
+	if *rulesFile != "" {
+		rules, err := scoring.LoadRules(*rulesFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		calculator = calculator.WithRules(rules)
+	}
+
+	var tenants *tenant.Registry
+	if *tenantsFile != "" {
+		var err error
+		tenants, err = tenant.LoadRegistry(*tenantsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	var requests []Request
+	var err error
+	if *file != "" {
+		requests, err = readRequests(*file)
+	} else {
+		requests, err = syntheticRequests(*count, *seed)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	headers := make(map[string]string)
+	if *apiKey != "" {
+		headers["X-API-Key"] = *apiKey
+	}
+	if *tenantID != "" {
+		headers["X-Tenant-ID"] = *tenantID
+	}
+
+	replayer := &Replayer{
+		client:     &http.Client{Timeout: *timeout},
+		target:     strings.TrimSuffix(*target, "/"),
+		headers:    headers,
+		calculator: calculator,
+		tenants:    tenants,
+		stats:      NewStats(),
+		log:        os.Stderr,
+	}
+
+	// Stop sending requests on SIGINT and report what was sent
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	elapsed := replayer.Run(ctx, requests, *rate, *concurrency)
+	replayer.stats.Report(os.Stdout, elapsed)
+	fmt.Printf("\nPoints checked: %d, skipped: %d, mismatches: %d\n", replayer.stats.Checked(), replayer.stats.Skipped(), replayer.Mismatches())
+
+	if replayer.Mismatches() > 0 || replayer.stats.Errors() > 0 {
+		os.Exit(1)
+	}
+}
+
+// Sends the requests at the rate with the number of concurrent workers,
+// and returns the time it took
+func (r *Replayer) Run(ctx context.Context, requests []Request, rate float64, concurrency int) time.Duration {
+	start := time.Now()
+
+	jobs := make(chan Request)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				r.Replay(ctx, req)
+			}
+		}()
+	}
+
+	var ticker *time.Ticker
+	if rate > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+	}
+
+send:
+	for i, req := range requests {
+		if ticker != nil && i > 0 {
+			select {
+			case <-ctx.Done():
+				break send
+			case <-ticker.C:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			break send
+		case jobs <- req:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return time.Since(start)
+}
+
+// Sends the request, and verifies the points of the receipt it processed
+func (r *Replayer) Replay(ctx context.Context, req Request) {
+	status, body, err := r.send(ctx, req.Method, req.Path, req.Headers, req.Body)
+	if err != nil || req.Method != http.MethodPost || req.Path != processPath {
+		return
+	}
+
+	expected, valid, known := r.expectedPoints(req)
+	switch {
+	case !valid && status == http.StatusOK:
+		r.mismatch("%s accepted a receipt that is invalid locally: %s", req.Path, req.Body)
+		return
+	case !valid || status != http.StatusOK:
+		return
+	case !known:
+		r.stats.Skip()
+		return
+	}
+
+	var processed handlers.IdResponse
+	if err := json.Unmarshal(body, &processed); err != nil || processed.ID == "" {
+		r.mismatch("%s responded without a receipt id: %s", req.Path, body)
+		return
+	}
+
+	status, body, err = r.send(ctx, http.MethodGet, "/receipts/"+processed.ID+"/points", req.Headers, nil)
+	if err != nil || status != http.StatusOK {
+		return
+	}
+
+	var points handlers.PointsResponse
+	if err := json.Unmarshal(body, &points); err != nil {
+		r.mismatch("receipt %s: unreadable points response: %s", processed.ID, body)
+		return
+	}
+	r.stats.Check()
+	if points.Points != expected {
+		r.mismatch("receipt %s: expected %d points, the server awarded %d", processed.ID, expected, points.Points)
+	}
+}
+
+// Returns the number of receipts scored differently by the server
+func (r *Replayer) Mismatches() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.mismatches
+}
+
+// Sends a request with the default headers overridden by the provided ones,
+// records its latency and returns its status and body
+func (r *Replayer) send(ctx context.Context, method, path string, headers map[string]string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.target+path, bytes.NewReader(body))
+	if err != nil {
+		r.stats.Record(operation(method, path), 0, 0, err)
+		return 0, nil, err
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range r.headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		r.stats.Record(operation(method, path), time.Since(start), 0, err)
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	r.stats.Record(operation(method, path), time.Since(start), resp.StatusCode, err)
+
+	return resp.StatusCode, respBody, err
+}
+
+// Validates and scores the receipt of the request locally, like the server does.
+// Known is false when the server may award other points for reasons
+// the replay cannot see, the tier of a member or unknown tenant rules
+func (r *Replayer) expectedPoints(req Request) (points int, valid, known bool) {
+	var input handlers.ReceiptInput
+	if err := json.Unmarshal(req.Body, &input); err != nil {
+		return 0, false, false
+	}
+	input.Validate()
+	if !input.Valid() {
+		return 0, false, false
+	}
+
+	calculator, known := r.calculatorFor(req.Headers)
+	points, err := calculator.CalculatePoints(input.Retailer, input.PurchaseDate, input.PurchaseTime, input.Total, input.Items)
+	if err != nil {
+		return 0, false, false
+	}
+	return points, true, known && input.MemberID == ""
+}
+
+// Returns the calculator scoring the receipts of the tenant the request is sent for,
+// and whether that tenant's rules are known
+func (r *Replayer) calculatorFor(headers map[string]string) (*utils.Utils, bool) {
+	// The calculator holds the rules of the tenant of the default headers
+	tenantID := models.TenantKey(header(r.headers, "X-Tenant-ID"))
+	if requested := header(headers, "X-Tenant-ID"); requested != "" {
+		tenantID = requested
+	}
+
+	if r.tenants == nil {
+		return r.calculator, tenantID == models.TenantKey(header(r.headers, "X-Tenant-ID"))
+	}
+
+	t, err := r.tenants.Get(tenantID)
+	if err != nil {
+		return r.calculator, false
+	}
+	if t.Rules != nil {
+		return r.calculator.WithRules(*t.Rules), true
+	}
+	return r.calculator, true
+}
+
+// Returns the value of the header, whatever the case its name was recorded in
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (r *Replayer) mismatch(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mismatches++
+	if r.mismatches <= reportedMismatches {
+		fmt.Fprintf(r.log, "Mismatch: "+format+"\n", args...)
+	}
+}
+
+// Reads recorded requests, one per line. Lines without a path are
+// receipts to post to the process route
+func readRequests(path string) ([]Request, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var requests []Request
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, line, err)
+		}
+		if req.Path == "" {
+			req = Request{Method: http.MethodPost, Path: processPath, Body: append(json.RawMessage(nil), data...)}
+		}
+		if req.Method == "" {
+			req.Method = http.MethodGet
+		}
+		requests = append(requests, req)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, errors.New(path + ": no requests to replay")
+	}
+	return requests, nil
+}
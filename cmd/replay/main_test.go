@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"kweeuhree.receipt-processor-challenge/cmd/handlers"
+	"kweeuhree.receipt-processor-challenge/cmd/helpers"
+	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/testdata"
+)
+
+// Serves the process and points routes with the real handlers
+func receiptServer(t *testing.T) *httptest.Server {
+	logger := log.New(io.Discard, "", 0)
+	h := handlers.NewHandlers(logger, logger, models.NewStore(), utils.NewUtils(), &helpers.Helpers{})
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPost, "/receipts/process", h.ProcessReceipt)
+	router.HandlerFunc(http.MethodGet, "/receipts/:id/points", h.GetReceiptPoints)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newReplayer(target string) (*Replayer, *bytes.Buffer) {
+	var log bytes.Buffer
+	return &Replayer{
+		client:     &http.Client{Timeout: 5 * time.Second},
+		target:     target,
+		calculator: utils.NewUtils(),
+		stats:      NewStats(),
+		log:        &log,
+	}, &log
+}
+
+func TestReplaySyntheticReceipts(t *testing.T) {
+	server := receiptServer(t)
+
+	requests, err := syntheticRequests(50, 7)
+	if err != nil {
+		t.Fatalf("Failed to generate receipts: %v", err)
+	}
+
+	replayer, log := newReplayer(server.URL)
+	replayer.Run(context.Background(), requests, 0, 8)
+
+	if replayer.Mismatches() != 0 || replayer.stats.Errors() != 0 {
+		t.Errorf("Expected no mismatches nor errors, received %d and %d:\n%s", replayer.Mismatches(), replayer.stats.Errors(), log)
+	}
+	if replayer.stats.Checked() != 50 {
+		t.Errorf("Expected 50 receipts to be checked, received %d", replayer.stats.Checked())
+	}
+
+	var report bytes.Buffer
+	replayer.stats.Report(&report, time.Second)
+	for _, expected := range []string{"POST /receipts/process 50 0.0%", "GET /receipts/:id/points 50 0.0%", "100 requests in 1s"} {
+		if !strings.Contains(strings.Join(strings.Fields(report.String()), " "), expected) {
+			t.Errorf("Expected the report to contain %q, received:\n%s", expected, report.String())
+		}
+	}
+}
+
+func TestReplayRecordedRequests(t *testing.T) {
+	server := receiptServer(t)
+
+	file := filepath.Join(t.TempDir(), "recorded.jsonl")
+	recorded := strings.Join([]string{
+		`{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:13","total":"1.25","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}]}`,
+		`{"method":"POST","path":"/receipts/process","body":{"retailer":"Target","total":"abc"}}`,
+		`{"path":"/receipts/missing/points"}`,
+		``,
+	}, "\n")
+	os.WriteFile(file, []byte(recorded), 0o600)
+
+	requests, err := readRequests(file)
+	if err != nil {
+		t.Fatalf("Failed to read requests: %v", err)
+	}
+	if len(requests) != 3 || requests[0].Path != processPath || requests[2].Method != http.MethodGet {
+		t.Fatalf("Unexpected requests %+v", requests)
+	}
+
+	replayer, _ := newReplayer(server.URL)
+	replayer.Run(context.Background(), requests, 100, 1)
+
+	// The invalid receipt and the missing receipt fail, as expected locally
+	if replayer.Mismatches() != 0 {
+		t.Errorf("Expected no mismatches, received %d", replayer.Mismatches())
+	}
+	if replayer.stats.Errors() != 2 || replayer.stats.Checked() != 1 {
+		t.Errorf("Expected 2 errors and 1 check, received %d and %d", replayer.stats.Errors(), replayer.stats.Checked())
+	}
+}
+
+func TestReplayReportsMismatches(t *testing.T) {
+	// Awards the same points to every receipt
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPost, "/receipts/process", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"123"}`))
+	})
+	router.HandlerFunc(http.MethodGet, "/receipts/:id/points", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"points":1}`))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	requests, _ := syntheticRequests(3, 1)
+	requests = append(requests, Request{Method: http.MethodPost, Path: processPath, Body: []byte(`{"retailer":""}`)})
+
+	replayer, log := newReplayer(server.URL)
+	replayer.Run(context.Background(), requests, 0, 2)
+
+	if replayer.Mismatches() != 4 {
+		t.Errorf("Expected 4 mismatches, received %d", replayer.Mismatches())
+	}
+	if !strings.Contains(log.String(), "accepted a receipt that is invalid locally") {
+		t.Errorf("Expected the invalid receipt to be reported, received:\n%s", log)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+		{0, time.Millisecond},
+	}
+	for _, entry := range tests {
+		if received := percentile(latencies, entry.p); received != entry.expected {
+			t.Errorf("Expected p%v to be %s, received %s", entry.p, entry.expected, received)
+		}
+	}
+
+	if received := percentile([]time.Duration{3 * time.Millisecond}, 99); received != 3*time.Millisecond {
+		t.Errorf("Expected a single latency to be every percentile, received %s", received)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	tests := map[string]string{
+		"/receipts/process":            "POST /receipts/process",
+		"/receipts/abc-123/points":     "POST /receipts/:id/points",
+		"/members/42":                  "POST /members/:id",
+		"/webhooks/1/deliveries/2/foo": "POST /webhooks/:id/deliveries/2/foo",
+	}
+	for path, expected := range tests {
+		if received := operation(http.MethodPost, path); received != expected {
+			t.Errorf("Expected %s to be %q, received %q", path, expected, received)
+		}
+	}
+}
+
+func TestReplaySkipsUnpredictablePoints(t *testing.T) {
+	// Awards the same points to every receipt
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPost, "/receipts/process", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"123"}`))
+	})
+	router.HandlerFunc(http.MethodGet, "/receipts/:id/points", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"points":1}`))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	receipt := `{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:13","total":"1.25","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}]`
+	requests := []Request{
+		// Members earn the multiplier of their tier
+		{Method: http.MethodPost, Path: processPath, Body: []byte(receipt + `,"memberId":"member-1"}`)},
+		// The rules of brand-b are unknown
+		{Method: http.MethodPost, Path: processPath, Headers: map[string]string{"x-tenant-id": "brand-b"}, Body: []byte(receipt + `}`)},
+	}
+
+	replayer, log := newReplayer(server.URL)
+	replayer.Run(context.Background(), requests, 0, 1)
+
+	if replayer.Mismatches() != 0 || replayer.stats.Skipped() != 2 || replayer.stats.Checked() != 0 {
+		t.Errorf("Expected 2 skipped receipts, received %d mismatches, %d skipped and %d checked:\n%s",
+			replayer.Mismatches(), replayer.stats.Skipped(), replayer.stats.Checked(), log)
+	}
+}
+
+func TestCalculatorFor(t *testing.T) {
+	doubleRetailer := scoring.DefaultRules()
+	doubleRetailer.RetailerCharPoints = 2
+	tenants, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "brand-a", Rules: &doubleRetailer}})
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		tenants  *tenant.Registry
+		requests map[string]string
+		known    bool
+		points   int
+	}{
+		{"Default tenant", nil, nil, nil, true, 28},
+		{"Tenant of the headers", map[string]string{"X-Tenant-ID": "brand-a"}, nil, nil, true, 28},
+		{"Other tenant", nil, nil, map[string]string{"X-Tenant-ID": "brand-a"}, false, 28},
+		{"Tenant of the tenants file", nil, tenants, map[string]string{"X-Tenant-ID": "brand-a"}, true, 34},
+		{"Tenant missing from the tenants file", nil, tenants, map[string]string{"X-Tenant-ID": "brand-c"}, false, 28},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			replayer, _ := newReplayer("")
+			replayer.headers, replayer.tenants = entry.headers, entry.tenants
+
+			calculator, known := replayer.calculatorFor(entry.requests)
+			if known != entry.known {
+				t.Errorf("Expected known to be %t, received %t", entry.known, known)
+			}
+			points, _ := calculator.CalculatePoints("Target", "2022-01-01", "13:01", "35.35", testdata.MountainDewReceiptItems)
+			if points != entry.points {
+				t.Errorf("Expected %d points, received %d", entry.points, points)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Path segments that identify a resource, grouped under a single operation
+var resourceID = regexp.MustCompile(`^/(receipts|members|webhooks)/([^/]+)`)
+
+// Static segments served next to the resource ids
+var staticSegments = map[string]bool{"process": true}
+
+// Stats collects the latencies and failures of every operation
+type Stats struct {
+	mu         sync.Mutex
+	operations map[string]*operationStats
+	checked    int
+	skipped    int
+}
+
+type operationStats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+func NewStats() *Stats {
+	return &Stats{operations: make(map[string]*operationStats)}
+}
+
+// Records a request of the operation. Transport errors and responses
+// other than 2xx count as errors
+func (s *Stats) Record(operation string, latency time.Duration, status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, exists := s.operations[operation]
+	if !exists {
+		stats = &operationStats{}
+		s.operations[operation] = stats
+	}
+	stats.latencies = append(stats.latencies, latency)
+	if err != nil || status < 200 || status > 299 {
+		stats.errors++
+	}
+}
+
+// Counts a receipt whose points were compared
+func (s *Stats) Check() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checked++
+}
+
+// Returns the number of receipts whose points were compared
+func (s *Stats) Checked() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checked
+}
+
+// Counts a processed receipt whose points could not be predicted locally
+func (s *Stats) Skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.skipped++
+}
+
+// Returns the number of receipts whose points were not compared
+func (s *Stats) Skipped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.skipped
+}
+
+// Returns the number of failed requests of every operation
+func (s *Stats) Errors() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errors := 0
+	for _, stats := range s.operations {
+		errors += stats.errors
+	}
+	return errors
+}
+
+// Writes a table of the requests, error rate and latency percentiles of every operation
+func (s *Stats) Report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	operations := make([]string, 0, len(s.operations))
+	total := 0
+	for operation, stats := range s.operations {
+		operations = append(operations, operation)
+		total += len(stats.latencies)
+	}
+	sort.Strings(operations)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "OPERATION\tREQUESTS\tERRORS\tP50\tP90\tP99\tMAX")
+	for _, operation := range operations {
+		stats := s.operations[operation]
+		latencies := append([]time.Duration(nil), stats.latencies...)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		fmt.Fprintf(table, "%s\t%d\t%.1f%%\t%s\t%s\t%s\t%s\n", operation, len(latencies),
+			100*float64(stats.errors)/float64(len(latencies)),
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1])
+	}
+	table.Flush()
+
+	if elapsed > 0 {
+		fmt.Fprintf(w, "\n%d requests in %s (%.1f requests/s)\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+	}
+}
+
+// Returns the nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p / 100 * float64(len(sorted)))
+	if float64(rank) < p/100*float64(len(sorted)) {
+		rank++
+	}
+	return sorted[max(rank, 1)-1]
+}
+
+// Names the operation of a request by its method and route
+func operation(method, path string) string {
+	match := resourceID.FindStringSubmatchIndex(path)
+	if match == nil || staticSegments[path[match[4]:match[5]]] {
+		return method + " " + path
+	}
+	return method + " " + path[:match[4]] + ":id" + path[match[5]:]
+}
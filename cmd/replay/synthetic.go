@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/cmd/handlers"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+var (
+	syntheticRetailers = []string{"Target", "Walgreens", "M&M Corner Market", "Costco", "Trader Joe's"}
+	syntheticItems     = []string{"Mountain Dew 12PK", "Emils Cheese Pizza", "Knorr Creamy Chicken", "Doritos Nacho Cheese", "Gatorade", "Pepsi - 12-oz", "Dasani"}
+)
+
+// Returns requests posting count valid receipts generated from the seed
+func syntheticRequests(count int, seed int64) ([]Request, error) {
+	random := rand.New(rand.NewSource(seed))
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	requests := make([]Request, 0, count)
+	for i := 0; i < count; i++ {
+		purchasedAt := start.Add(time.Duration(random.Int63n(int64(365 * 24 * time.Hour))))
+		receipt := handlers.ReceiptInput{
+			Retailer:     syntheticRetailers[random.Intn(len(syntheticRetailers))],
+			PurchaseDate: purchasedAt.Format("2006-01-02"),
+			PurchaseTime: purchasedAt.Format("15:04"),
+		}
+
+		cents := 0
+		for j := 0; j <= random.Intn(6); j++ {
+			// Whole and quarter dollar prices exercise the total rules
+			price := random.Intn(2000) + 1
+			if random.Intn(4) == 0 {
+				price = price / 25 * 25
+			}
+			cents += price
+			receipt.Items = append(receipt.Items, models.Item{
+				ShortDescription: syntheticItems[random.Intn(len(syntheticItems))],
+				Price:            fmt.Sprintf("%d.%02d", price/100, price%100),
+			})
+		}
+		receipt.Total = fmt.Sprintf("%d.%02d", cents/100, cents%100)
+
+		body, err := json.Marshal(receipt)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, Request{Method: http.MethodPost, Path: processPath, Body: body})
+	}
+
+	return requests, nil
+}
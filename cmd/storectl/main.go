@@ -0,0 +1,250 @@
+// Command storectl backs up the receipt store of a running server and
+// restores it, through the admin dump and restore endpoints.
+//
+//	storectl dump -o backup.ndjson
+//	storectl restore -mode replace backup.ndjson
+//	storectl inspect backup.ndjson
+//
+// The API key of an admin principal is read from -api-key or the
+// RECEIPTS_API_KEY environment variable.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/storedump"
+)
+
+// Exit statuses
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const usage = `Usage: storectl <command> [flags]
+
+Commands:
+  dump     Write the dump of the store to -o, or to stdout
+  restore  Restore the store from a dump file, or from stdin
+  inspect  Check a dump file and count its receipts per tenant
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("storectl "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	target := flags.String("target", "http://localhost:4000", "Base URL of the server")
+	apiKey := flags.String("api-key", os.Getenv("RECEIPTS_API_KEY"), "API key of an admin principal")
+	timeout := flags.Duration("timeout", 5*time.Minute, "Timeout of the request to the server")
+
+	var err error
+	switch args[0] {
+	case "dump":
+		output := flags.String("o", "", "File the dump is written to, stdout when empty")
+		if flags.Parse(args[1:]) != nil {
+			return exitUsage
+		}
+		client := newClient(*target, *apiKey, *timeout)
+		err = dump(client, *output, stdout, stderr)
+	case "restore":
+		mode := flags.String("mode", "merge", "replace the store with the dump, or merge the dump into it")
+		if flags.Parse(args[1:]) != nil {
+			return exitUsage
+		}
+		client := newClient(*target, *apiKey, *timeout)
+		err = restore(client, *mode, flags.Arg(0), stdin, stdout)
+	case "inspect":
+		if flags.Parse(args[1:]) != nil {
+			return exitUsage
+		}
+		err = inspect(flags.Arg(0), stdin, stdout)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+type client struct {
+	http   *http.Client
+	target string
+	apiKey string
+}
+
+func newClient(target, apiKey string, timeout time.Duration) *client {
+	return &client{http: &http.Client{Timeout: timeout}, target: strings.TrimSuffix(target, "/"), apiKey: apiKey}
+}
+
+// Sends the request and returns the response, or an error for statuses other than 200
+func (c *client) do(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.target+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// Downloads the dump. A file is only written once the whole dump was
+// received and checked, so that an interrupted download leaves no partial backup
+func dump(c *client, output string, stdout, stderr io.Writer) error {
+	resp, err := c.do(http.MethodGet, "/admin/dump", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if output == "" {
+		_, err = io.Copy(stdout, resp.Body)
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	header, _, err := readDump(file.Name(), nil)
+	if err != nil {
+		return fmt.Errorf("the downloaded dump is invalid: %w", err)
+	}
+	if err := os.Rename(file.Name(), output); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stderr, "Wrote %d receipts to %s\n", header.Receipts, output)
+	return nil
+}
+
+// Checks the dump locally, then uploads it
+func restore(c *client, mode, path string, stdin io.Reader, stdout io.Writer) error {
+	var data []byte
+	var err error
+	if path == "" || path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, _, err := storedump.Read(bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPost, "/admin/restore?mode="+mode, storedump.ContentType, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Mode     string `json:"mode"`
+		Restored int    `json:"restored"`
+		Receipts int    `json:"receipts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Restored %d receipts (%s), the store holds %d receipts\n", result.Restored, result.Mode, result.Receipts)
+	return nil
+}
+
+// Prints the header of the dump and the live and deleted receipts of every tenant
+func inspect(path string, stdin io.Reader, stdout io.Writer) error {
+	header, entries, err := readDump(path, stdin)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]int)
+	deleted := make(map[string]int)
+	var tenants []string
+	for _, entry := range entries {
+		tenantID := entry.Receipt.TenantID
+		if live[tenantID] == 0 && deleted[tenantID] == 0 {
+			tenants = append(tenants, tenantID)
+		}
+		if entry.Receipt.DeletedAt.IsZero() {
+			live[tenantID]++
+		} else {
+			deleted[tenantID]++
+		}
+	}
+	sort.Strings(tenants)
+
+	fmt.Fprintf(stdout, "Format %s version %d, created %s, %d receipts\n\n", header.Format, header.Version, header.CreatedAt.Format(time.RFC3339), header.Receipts)
+
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TENANT\tRECEIPTS\tDELETED")
+	for _, tenantID := range tenants {
+		fmt.Fprintf(table, "%s\t%d\t%d\n", tenantID, live[tenantID], deleted[tenantID])
+	}
+	return table.Flush()
+}
+
+// Reads the dump at path, or from stdin when path is empty or -
+func readDump(path string, stdin io.Reader) (storedump.Header, []models.StoreEntry, error) {
+	if path == "" || path == "-" {
+		return storedump.Read(stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return storedump.Header{}, nil, err
+	}
+	defer file.Close()
+
+	return storedump.Read(file)
+}
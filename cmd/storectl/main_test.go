@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/cmd/handlers"
+	"kweeuhree.receipt-processor-challenge/cmd/helpers"
+	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Serves the dump and restore endpoints of a store
+func storeServer(t *testing.T, store *models.ReceiptStore) string {
+	logger := log.New(io.Discard, "", 0)
+	h := handlers.NewHandlers(logger, logger, store, utils.NewUtils(), &helpers.Helpers{ErrorLog: logger})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/dump", h.DumpStore)
+	mux.HandleFunc("POST /admin/restore", h.RestoreStore)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestDumpInspectRestore(t *testing.T) {
+	source := models.NewStore()
+	source.Insert(models.Receipt{ID: "a", Retailer: "Target"})
+	source.Insert(models.Receipt{ID: "b", TenantID: "brand-a"})
+	source.Insert(models.Receipt{ID: "c", TenantID: "brand-a"})
+	source.Delete("brand-a", "c")
+	backup := filepath.Join(t.TempDir(), "backup.ndjson")
+
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"dump", "-target", storeServer(t, source), "-o", backup}, nil, &stdout, &stderr); status != exitOK {
+		t.Fatalf("Expected dump to succeed, received %d with %s", status, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Wrote 3 receipts") {
+		t.Errorf("Expected the dump to be reported, received %q", stderr.String())
+	}
+
+	stdout.Reset()
+	if status := run([]string{"inspect", backup}, nil, &stdout, &stderr); status != exitOK {
+		t.Fatalf("Expected inspect to succeed, received %d with %s", status, stderr.String())
+	}
+	for _, expected := range []string{"version 1", "3 receipts", "brand-a  1         1", "default  1         0"} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("Expected the inspection to contain %q, received:\n%s", expected, stdout.String())
+		}
+	}
+
+	target := models.NewStore()
+	target.Insert(models.Receipt{ID: "replaced"})
+	stdout.Reset()
+	if status := run([]string{"restore", "-target", storeServer(t, target), "-mode", "replace", backup}, nil, &stdout, &stderr); status != exitOK {
+		t.Fatalf("Expected restore to succeed, received %d with %s", status, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Restored 3 receipts (replace), the store holds 3 receipts") {
+		t.Errorf("Unexpected restore output %q", stdout.String())
+	}
+	if receipt, err := target.Get(models.DefaultTenantID, "a"); err != nil || receipt.Retailer != "Target" {
+		t.Errorf("Expected receipt a to be restored, received %+v, %v", receipt, err)
+	}
+	if _, err := target.Get(models.DefaultTenantID, "replaced"); err != models.ErrNoRecord {
+		t.Errorf("Expected the store to be replaced, got %v", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.ndjson")
+	os.WriteFile(invalid, []byte(`{"id":"a"}`), 0o600)
+
+	// The server rejects every request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectedStatus int
+	}{
+		{"No command", nil, exitUsage},
+		{"Unknown command", []string{"backup"}, exitUsage},
+		{"Unknown flag", []string{"dump", "-verbose"}, exitUsage},
+		{"Invalid dump", []string{"inspect", invalid}, exitError},
+		{"Invalid dump is not uploaded", []string{"restore", "-target", server.URL, invalid}, exitError},
+		{"Rejected dump", []string{"dump", "-target", server.URL}, exitError},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if status := run(entry.args, strings.NewReader(""), &stdout, &stderr); status != entry.expectedStatus {
+				t.Errorf("Expected status %d, received %d with %s", entry.expectedStatus, status, stderr.String())
+			}
+		})
+	}
+}
@@ -2,16 +2,22 @@ package utils
 
 import (
 	"math"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/rivo/uniseg"
 	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
 )
 
-type Utils struct{}
+type Utils struct {
+	// Rules used to calculate points, DefaultRules when nil
+	Rules *scoring.Rules
+}
 
 func NewUtils() *Utils {
 	return &Utils{}
@@ -61,22 +67,15 @@ func (u *Utils) ConcurrentCalculatePoints(retailer, purchaseDate, purchaseTime,
 }
 
 func (u *Utils) CalculatePoints(retailer, purchaseDate, purchaseTime, total string, items []models.Item) (int, error) {
-	// Convert receipt's total to a float
-	floatTotal, err := strconv.ParseFloat(total, 64)
+	// Get the points awarded by every rule
+	breakdown, err := u.Breakdown(retailer, purchaseDate, purchaseTime, total, items)
 	if err != nil {
 		return 0, err
 	}
 
-	// Get all points of the receipt in a local variable
-	points := []int{
-		u.getRetailerNamePoints(retailer),
-		u.getRoundTotalPoints(floatTotal),
-		u.getQuartersPoints(floatTotal),
-		u.getEveryTwoItemsPoints(items),
-		u.getItemDescriptionPoints(items),
-		u.getLlmGeneratedPoints(floatTotal),
-		u.getOddDayPoints(purchaseDate),
-		u.getPurchaseTimePoints(purchaseTime),
+	points := make([]int, 0, len(breakdown))
+	for _, rule := range breakdown {
+		points = append(points, rule.Points)
 	}
 
 	// Calculate total points of the receipt
@@ -85,26 +84,53 @@ func (u *Utils) CalculatePoints(retailer, purchaseDate, purchaseTime, total stri
 	return totalPoints, nil
 }
 
+// RulePoints is the number of points a rule awarded to a receipt
+type RulePoints struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+}
+
+// Returns the points awarded to the receipt by each rule, in the order they are applied
+func (u *Utils) Breakdown(retailer, purchaseDate, purchaseTime, total string, items []models.Item) ([]RulePoints, error) {
+	// Convert receipt's total to a float
+	floatTotal, err := strconv.ParseFloat(total, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return []RulePoints{
+		{"retailerName", u.getRetailerNamePoints(retailer)},
+		{"roundTotal", u.getRoundTotalPoints(floatTotal)},
+		{"quarterTotal", u.getQuartersPoints(floatTotal)},
+		{"itemPairs", u.getEveryTwoItemsPoints(items)},
+		{"itemDescriptions", u.getItemDescriptionPoints(items)},
+		{"llmGenerated", u.getLlmGeneratedPoints(floatTotal)},
+		{"oddDay", u.getOddDayPoints(purchaseDate)},
+		{"afternoon", u.getPurchaseTimePoints(purchaseTime)},
+	}, nil
+}
+
 // Assigns one point for every alphanumeric character in the retailer name
 func (u *Utils) getRetailerNamePoints(retailerName string) int {
 	points := 0
+	rules := u.rules()
 
-	// Split the retailers name
-	splitChars := strings.Split(retailerName, "")
-
-	// For each character in splitChars, check if the character is alphanumeric
-	for _, char := range splitChars {
+	// For each character of the name, check if the character is alphanumeric
+	for _, char := range retailerName {
 		if u.isAlphanumeric(char) {
-			points += 1
+			points += rules.RetailerCharPoints
 		}
 	}
 
 	return points
 }
 
-// Checks if the character is alphanumeric
-func (u *Utils) isAlphanumeric(char string) bool {
-	return regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString(char)
+// Checks if the character is alphanumeric, in any script in unicode mode
+func (u *Utils) isAlphanumeric(char rune) bool {
+	if u.rules().RetailerCharacters == scoring.CharactersUnicode {
+		return unicode.IsLetter(char) || unicode.IsDigit(char)
+	}
+	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || '0' <= char && char <= '9'
 }
 
 // Assigns 50 points if the total is a round dollar amount with no cents
@@ -113,7 +139,7 @@ func (u *Utils) getRoundTotalPoints(total float64) int {
 
 	// Use modulo operator to determine points
 	if math.Mod(total, 1.00) == 0 {
-		points = 50
+		points = u.rules().RoundTotalPoints
 	}
 
 	return points
@@ -125,7 +151,7 @@ func (u *Utils) getQuartersPoints(total float64) int {
 
 	// Use modulo operator to determine points
 	if math.Mod(total, 0.25) == 0 {
-		points = 25
+		points = u.rules().QuarterPoints
 	}
 
 	return points
@@ -140,7 +166,7 @@ func (u *Utils) getEveryTwoItemsPoints(items []models.Item) int {
 	pairs := (len - (len % 2)) / 2
 
 	if pairs > 0 {
-		points = pairs * 5
+		points = pairs * u.rules().ItemPairPoints
 	}
 
 	return points
@@ -152,18 +178,22 @@ func (u *Utils) getItemDescriptionPoints(items []models.Item) int {
 	// multiply the price by `0.2` and round up to the nearest integer.
 	// The result is the number of points earned.
 	points := 0
+	rules := u.rules()
+	if rules.DescriptionLengthMultiple <= 0 {
+		return points
+	}
 
 	// Loop through items
 	for _, item := range items {
 		// Per each item, trim and get the length
 		trimmedDesc := strings.TrimSpace(item.ShortDescription)
-		trimmedLen := len(trimmedDesc)
+		trimmedLen := u.descriptionLength(trimmedDesc)
 
 		// Use modulo operator to determine points
-		if trimmedLen%3 == 0 {
+		if trimmedLen%rules.DescriptionLengthMultiple == 0 {
 			parsedPrice, _ := strconv.ParseFloat(item.Price, 64)
 			// Round up
-			itemPoints := math.Ceil(parsedPrice * 0.2)
+			itemPoints := math.Ceil(parsedPrice * rules.DescriptionPriceMultiplier)
 			points += int(itemPoints)
 		}
 	}
@@ -171,6 +201,18 @@ func (u *Utils) getItemDescriptionPoints(items []models.Item) int {
 	return points
 }
 
+// Returns the length of the description in the unit set by the rules
+func (u *Utils) descriptionLength(description string) int {
+	switch u.rules().DescriptionLengthUnit {
+	case scoring.LengthRunes:
+		return utf8.RuneCountInString(description)
+	case scoring.LengthGraphemes:
+		return uniseg.GraphemeClusterCount(description)
+	default:
+		return len(description)
+	}
+}
+
 // Assigns points if the program is generated by an LLM
 func (u *Utils) getLlmGeneratedPoints(total float64) int {
 	// If and only if this program is generated using a large language model,
@@ -198,7 +240,7 @@ func (u *Utils) getOddDayPoints(purchaseDate string) int {
 
 	// Use modulo operator to determine points
 	if day%2 == 1 {
-		points = 6
+		points = u.rules().OddDayPoints
 	}
 
 	return points
@@ -211,12 +253,13 @@ func (u *Utils) getPurchaseTimePoints(purchaseTime string) int {
 	layout := "15:04"
 	parsedTime, _ := time.Parse(layout, purchaseTime)
 	// Define starting and ending time for extra bonus
-	bonusStart, _ := time.Parse(layout, "14:00") // 2:00pm
-	bonusEnd, _ := time.Parse(layout, "16:00")   // 4:00pm
+	rules := u.rules()
+	bonusStart, _ := time.Parse(layout, rules.AfternoonStart) // 2:00pm by default
+	bonusEnd, _ := time.Parse(layout, rules.AfternoonEnd)     // 4:00pm by default
 
 	// Determine whether the puchase was made during the bonus window
 	if parsedTime.After(bonusStart) && parsedTime.Before(bonusEnd) {
-		points = 10
+		points = rules.AfternoonPoints
 	}
 
 	return points
@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"regexp"
 	"testing"
+	"unicode"
 
 	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
 	"kweeuhree.receipt-processor-challenge/testdata"
 )
 
@@ -33,14 +36,15 @@ func Test_isAlphanumeric(t *testing.T) {
 	var utils *Utils
 	tests := []struct {
 		name     string
-		char     string
+		char     rune
 		expected bool
 	}{
-		{"Alphanumeric", "1", true},
-		{"Alphanumeric", "a", true},
-		{"Non-alphanumeric", "!", false},
-		{"Non-alphanumeric", "&", false},
-		{"Non-alphanumeric", " ", false},
+		{"Alphanumeric", '1', true},
+		{"Alphanumeric", 'a', true},
+		{"Non-alphanumeric", '!', false},
+		{"Non-alphanumeric", '&', false},
+		{"Non-alphanumeric", ' ', false},
+		{"Non-ASCII letter", 'é', false},
 	}
 
 	for _, entry := range tests {
@@ -48,7 +52,91 @@ func Test_isAlphanumeric(t *testing.T) {
 			result := utils.isAlphanumeric(entry.char)
 
 			if result != entry.expected {
-				t.Errorf("For char %s: expected %t, received %t", entry.char, entry.expected, result)
+				t.Errorf("For char %c: expected %t, received %t", entry.char, entry.expected, result)
+			}
+		})
+	}
+}
+
+// Ensures that the ASCII mode counts the characters the original pattern matched, for every code point
+func Test_isAlphanumericASCII(t *testing.T) {
+	var utils *Utils
+	pattern := regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+	for char := rune(0); char <= unicode.MaxRune; char++ {
+		if utils.isAlphanumeric(char) != pattern.MatchString(string(char)) {
+			t.Fatalf("For char %U: expected %t", char, pattern.MatchString(string(char)))
+		}
+	}
+}
+
+func Test_getRetailerNamePointsUnicode(t *testing.T) {
+	unicodeRules := scoring.DefaultRules()
+	unicodeRules.RetailerCharacters = scoring.CharactersUnicode
+	asciiUtils, unicodeUtils := (*Utils)(nil), (&Utils{}).WithRules(unicodeRules)
+
+	tests := []struct {
+		name            string
+		retailer        string
+		expectedASCII   int
+		expectedUnicode int
+	}{
+		{"ASCII", "M&M Corner Market", 14, 14},
+		{"Precomposed accents", "Caf\u00e9 Ol\u00e9", 5, 7},
+		// Combining marks are not letters, the letters they follow are
+		{"Combining accents", "Cafe\u0301 Ole\u0301", 7, 7},
+		{"Japanese", "東京ストア", 0, 5},
+		{"German", "Bäckerei Müller", 12, 14},
+		{"Arabic-Indic digits", "Store ١٢٣", 5, 8},
+		// Superscripts and numero signs are numbers but not decimal digits
+		{"Other numbers", "Store №5²", 6, 6},
+		{"Emoji", "Target 🎯", 6, 6},
+		{"Emoji sequence", "Pizza 👨\u200d🍳", 5, 5},
+		{"Empty", "", 0, 0},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if result := asciiUtils.getRetailerNamePoints(entry.retailer); result != entry.expectedASCII {
+				t.Errorf("ASCII: expected %d, received %d", entry.expectedASCII, result)
+			}
+			if result := unicodeUtils.getRetailerNamePoints(entry.retailer); result != entry.expectedUnicode {
+				t.Errorf("Unicode: expected %d, received %d", entry.expectedUnicode, result)
+			}
+		})
+	}
+}
+
+func Test_descriptionLength(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		bytes       int
+		runes       int
+		graphemes   int
+	}{
+		{"Empty", "", 0, 0, 0},
+		{"ASCII", "Pizza", 5, 5, 5},
+		{"Precomposed accent", "Caf\u00e9", 5, 4, 4},
+		{"Combining accent", "Cafe\u0301", 6, 5, 4},
+		{"Stacked combining marks", "a\u0301\u0323", 5, 3, 1},
+		{"Hangul syllable from jamo", "\u1100\u1161", 6, 2, 1},
+		{"Emoji", "🍕", 4, 1, 1},
+		{"Emoji with skin tone", "👍🏽", 8, 2, 1},
+		{"Family emoji sequence", "👨\u200d👩\u200d👧", 18, 5, 1},
+		{"Flag", "🇫🇷", 8, 2, 1},
+		{"Keycap", "3\ufe0f\u20e3", 7, 3, 1},
+		{"CRLF", "a\r\nb", 4, 4, 3},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			for unit, expected := range map[string]int{scoring.LengthBytes: entry.bytes, scoring.LengthRunes: entry.runes, scoring.LengthGraphemes: entry.graphemes} {
+				rules := scoring.DefaultRules()
+				rules.DescriptionLengthUnit = unit
+				if result := (&Utils{}).WithRules(rules).descriptionLength(entry.description); result != expected {
+					t.Errorf("Expected %d %s, received %d", expected, unit, result)
+				}
 			}
 		})
 	}
@@ -149,6 +237,33 @@ func Test_getItemDescriptionPoints(t *testing.T) {
 	}
 }
 
+func Test_getItemDescriptionPointsUnicode(t *testing.T) {
+	items := []models.Item{
+		// 5 bytes, 4 runes, 3 graphemes
+		{ShortDescription: "Ole\u0301", Price: "10.00"},
+		// 6 bytes, 5 runes, 5 graphemes
+		{ShortDescription: " Cr\u00e8me ", Price: "5.00"},
+		// 12 bytes, 3 runes, 3 graphemes
+		{ShortDescription: "🍕🍕🍕", Price: "20.00"},
+	}
+
+	tests := map[string]int{
+		scoring.LengthBytes:     5,
+		scoring.LengthRunes:     4,
+		scoring.LengthGraphemes: 6,
+	}
+
+	for unit, expected := range tests {
+		t.Run(unit, func(t *testing.T) {
+			rules := scoring.DefaultRules()
+			rules.DescriptionLengthUnit = unit
+			if result := (&Utils{}).WithRules(rules).getItemDescriptionPoints(items); result != expected {
+				t.Errorf("Expected %d, received %d", expected, result)
+			}
+		})
+	}
+}
+
 func Test_getOddDayPoints(t *testing.T) {
 	var utils *Utils
 	tests := []struct {
@@ -222,3 +337,30 @@ func Test_sum(t *testing.T) {
 		})
 	}
 }
+
+func Test_Breakdown(t *testing.T) {
+	var utils *Utils
+
+	breakdown, err := utils.Breakdown("M&M Corner Market", "2022-03-20", "14:33", "9.00", testdata.GatoradeReceiptItems)
+	if err != nil {
+		t.Fatalf("Failed to break the points down: %v", err)
+	}
+
+	expected := map[string]int{"retailerName": 14, "roundTotal": 50, "quarterTotal": 25, "itemPairs": 10, "afternoon": 10}
+	total := 0
+	for _, rule := range breakdown {
+		if rule.Points != expected[rule.Rule] {
+			t.Errorf("Expected rule %s to award %d points, received %d", rule.Rule, expected[rule.Rule], rule.Points)
+		}
+		total += rule.Points
+	}
+
+	points, _ := utils.CalculatePoints("M&M Corner Market", "2022-03-20", "14:33", "9.00", testdata.GatoradeReceiptItems)
+	if total != points || points != 109 {
+		t.Errorf("Expected the breakdown to add up to 109 points, received %d and %d", total, points)
+	}
+
+	if _, err := utils.Breakdown("Target", "2022-03-20", "14:33", "abc", nil); err == nil {
+		t.Error("Expected an error for an invalid total")
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "kweeuhree.receipt-processor-challenge/internal/scoring"
+
+// Returns a Utils calculating points with the provided rules
+func (u *Utils) WithRules(rules scoring.Rules) *Utils {
+	return &Utils{Rules: &rules}
+}
+
+// Returns the rules used by the calculation, the default ones if none were set
+func (u *Utils) rules() scoring.Rules {
+	if u == nil || u.Rules == nil {
+		return scoring.DefaultRules()
+	}
+	return *u.Rules
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
+	"kweeuhree.receipt-processor-challenge/testdata"
+)
+
+func TestWithRules(t *testing.T) {
+	noOddDay := scoring.DefaultRules()
+	noOddDay.OddDayPoints = 0
+
+	doubleRetailer := scoring.DefaultRules()
+	doubleRetailer.RetailerCharPoints = 2
+
+	lateAfternoon := scoring.DefaultRules()
+	lateAfternoon.AfternoonStart = "15:00"
+	lateAfternoon.AfternoonEnd = "17:00"
+
+	noDescription := scoring.DefaultRules()
+	noDescription.DescriptionLengthMultiple = 0
+
+	tests := []struct {
+		name         string
+		rules        scoring.Rules
+		purchaseTime string
+		expected     int
+	}{
+		{"Default rules", scoring.DefaultRules(), "13:01", 28},
+		{"Odd day rule disabled", noOddDay, "13:01", 22},
+		{"Double retailer points", doubleRetailer, "13:01", 34},
+		{"Shifted afternoon window", lateAfternoon, "16:30", 38},
+		{"Description rule disabled", noDescription, "13:01", 22},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var utils *Utils
+			points, err := utils.WithRules(entry.rules).CalculatePoints("Target", "2022-01-01", entry.purchaseTime, "35.35", testdata.MountainDewReceiptItems)
+			if err != nil {
+				t.Fatalf("Failed to calculate points: %v", err)
+			}
+			if points != entry.expected {
+				t.Errorf("Expected %d points, received %d", entry.expected, points)
+			}
+		})
+	}
+}
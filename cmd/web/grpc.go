@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"kweeuhree.receipt-processor-challenge/cmd/handlers"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/ratelimit"
+	"kweeuhree.receipt-processor-challenge/internal/receiptspb"
+	"kweeuhree.receipt-processor-challenge/internal/requestid"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+)
+
+// Scopes required by the gRPC methods, matching their HTTP routes
+var grpcScopes = map[string]string{
+	receiptspb.Receipts_ProcessReceipt_FullMethodName: auth.ScopeReceiptsWrite,
+	receiptspb.Receipts_GetPoints_FullMethodName:      auth.ScopeReceiptsRead,
+	receiptspb.Receipts_GetReceipt_FullMethodName:     auth.ScopeReceiptsRead,
+	receiptspb.Receipts_DeleteReceipt_FullMethodName:  auth.ScopeReceiptsDelete,
+	receiptspb.Receipts_BatchProcess_FullMethodName:   auth.ScopeReceiptsWrite,
+}
+
+// Rate limited routes of the gRPC methods, methods missing from the map use the default limiter
+var grpcRoutes = map[string]string{
+	receiptspb.Receipts_ProcessReceipt_FullMethodName: "process",
+	receiptspb.Receipts_BatchProcess_FullMethodName:   "process",
+}
+
+// Creates the gRPC server of the receipts service. Its interceptors play
+// the part of the standard middleware chain of the HTTP routes
+func (app *application) grpcServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(app.unaryInterceptor),
+		grpc.ChainStreamInterceptor(app.streamInterceptor),
+	)
+	receiptspb.RegisterReceiptsServer(server, handlers.NewReceiptsService(app.handlers))
+	return server
+}
+
+func (app *application) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer app.recoverRPC(&err)
+
+	ctx, err = app.rpcContext(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (app *application) streamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer app.recoverRPC(&err)
+
+	ctx, err := app.rpcContext(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx, limit: app.rpcLimit(ctx, info.FullMethod)})
+}
+
+// Logs the call, assigns it a request id, authenticates and authorizes
+// its principal and resolves its tenant from the incoming metadata
+func (app *application) rpcContext(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	value := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	app.infoLog.Printf("%s - gRPC %s", remoteAddr, method)
+
+	id := requestid.New(value("x-request-id"))
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	ctx = requestid.WithID(ctx, id)
+
+	principal, err := app.principal(value("x-api-key"), value("authorization"))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid credentials.")
+	}
+	if app.authEnabled() {
+		if principal == nil {
+			return nil, status.Error(codes.Unauthenticated, "Credentials are required.")
+		}
+		if !principal.HasScope(grpcScopes[method]) {
+			return nil, status.Errorf(codes.PermissionDenied, "The %s scope is required.", grpcScopes[method])
+		}
+	}
+	if principal != nil {
+		ctx = auth.WithPrincipal(ctx, principal)
+	}
+
+	// Opening a call takes a token, as does every receipt of a stream after the first
+	if err := app.rpcLimit(ctx, method)(); err != nil {
+		return nil, err
+	}
+
+	t, err := app.tenantFor(principal, value("x-tenant-id"))
+	if errors.Is(err, errTenantMismatch) {
+		return nil, status.Error(codes.PermissionDenied, "The principal is bound to another tenant.")
+	}
+	if errors.Is(err, errTenantNotAllowed) {
+		return nil, status.Error(codes.PermissionDenied, "Selecting a tenant requires the admin scope.")
+	}
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, "Unknown tenant.")
+	}
+
+	return tenant.WithTenant(ctx, t), nil
+}
+
+// Returns a function taking a token from the limiter of the method for the
+// principal in the context, or for the peer IP of anonymous calls. The
+// function returns a ResourceExhausted status once the bucket is empty
+func (app *application) rpcLimit(ctx context.Context, method string) func() error {
+	limiter, exists := app.limiters[grpcRoutes[method]]
+	if !exists {
+		limiter = app.limiters["default"]
+	}
+	if limiter == nil {
+		return func() error { return nil }
+	}
+
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	key := ratelimit.Key(principalKey(auth.PrincipalFromContext(ctx)), ip)
+
+	return func() error {
+		result := limiter.Allow(key)
+		if !result.Allowed {
+			return status.Errorf(codes.ResourceExhausted, "Rate limit exceeded, retry in %d seconds.", int(math.Ceil(result.RetryAfter.Seconds())))
+		}
+		return nil
+	}
+}
+
+// Recovers from a panic of a gRPC handler and replaces its error with an Internal status
+func (app *application) recoverRPC(err *error) {
+	if recovered := recover(); recovered != nil {
+		app.errorLog.Output(2, fmt.Sprintf("%s\n%s", recovered, debug.Stack()))
+		*err = status.Error(codes.Internal, "The server encountered a problem and could not process your request.")
+	}
+}
+
+// Server stream carrying the context built by the stream interceptor.
+// Every message received after the first takes a token from the rate limiter
+type contextStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	limit    func() error
+	received int
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *contextStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.received++
+	if s.received > 1 && s.limit != nil {
+		return s.limit()
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"kweeuhree.receipt-processor-challenge/cmd/handlers"
+	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/ratelimit"
+	"kweeuhree.receipt-processor-challenge/internal/receiptspb"
+)
+
+var validReceipt = &receiptspb.ProcessReceiptRequest{
+	Retailer:     "Target",
+	PurchaseDate: "2022-01-01",
+	PurchaseTime: "13:01",
+	Total:        "35.35",
+	Items: []*receiptspb.Item{
+		{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+		{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+		{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+		{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+		{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+	},
+}
+
+// Serves the gRPC API of an application with its own stores over an
+// in-memory listener, and returns a client connected to it
+func newGRPCClient(t *testing.T, apiKeys *auth.KeyStore, limiters map[string]*ratelimit.Limiter) receiptspb.ReceiptsClient {
+	t.Helper()
+	rpcApp := &application{
+		errorLog: log.New(&logBuffer, "", 0),
+		infoLog:  log.New(&logBuffer, "", 0),
+		helpers:  app.helpers,
+		apiKeys:  apiKeys,
+		limiters: limiters,
+	}
+	rpcApp.handlers = handlers.NewHandlers(rpcApp.errorLog, rpcApp.infoLog, models.NewStore(), utils.NewUtils(), app.helpers)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := rpcApp.grpcServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return receiptspb.NewReceiptsClient(conn)
+}
+
+// Ensures that the gRPC methods share the validation, scoring and store of the HTTP API
+func Test_grpcReceipts(t *testing.T) {
+	client := newGRPCClient(t, nil, nil)
+	ctx := context.Background()
+
+	processed, err := client.ProcessReceipt(ctx, validReceipt)
+	if err != nil {
+		t.Fatalf("Failed to process receipt: %v", err)
+	}
+
+	points, err := client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: processed.GetId()})
+	if err != nil || points.GetPoints() != 28 {
+		t.Errorf("Expected 28 points, received %d and %v", points.GetPoints(), err)
+	}
+
+	receipt, err := client.GetReceipt(ctx, &receiptspb.GetReceiptRequest{Id: processed.GetId()})
+	if err != nil || receipt.GetRevision() != 1 || len(receipt.GetItems()) != 5 || receipt.GetCreatedAt() == nil {
+		t.Errorf("Expected the first revision of the receipt, received %v and %v", receipt, err)
+	}
+
+	// Receipts of another tenant are not visible
+	otherTenant := metadata.AppendToOutgoingContext(ctx, "x-tenant-id", "brand-b")
+	if _, err := client.GetReceipt(otherTenant, &receiptspb.GetReceiptRequest{Id: processed.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected %s for another tenant, received %v", codes.NotFound, err)
+	}
+
+	if _, err := client.DeleteReceipt(ctx, &receiptspb.DeleteReceiptRequest{Id: processed.GetId()}); err != nil {
+		t.Fatalf("Failed to delete receipt: %v", err)
+	}
+	if _, err := client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: processed.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected %s for a deleted receipt, received %v", codes.NotFound, err)
+	}
+	if _, err := client.DeleteReceipt(ctx, &receiptspb.DeleteReceiptRequest{Id: processed.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected %s when deleting twice, received %v", codes.NotFound, err)
+	}
+}
+
+// Ensures that validation errors map to InvalidArgument with field violations
+func Test_grpcInvalidReceipt(t *testing.T) {
+	client := newGRPCClient(t, nil, nil)
+
+	_, err := client.ProcessReceipt(context.Background(), &receiptspb.ProcessReceiptRequest{Retailer: "Target", Total: "abc"})
+	rejection := status.Convert(err)
+	if rejection.Code() != codes.InvalidArgument {
+		t.Fatalf("Expected %s, received %v", codes.InvalidArgument, err)
+	}
+
+	fields := make(map[string]bool)
+	for _, detail := range rejection.Details() {
+		if violations, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range violations.GetFieldViolations() {
+				fields[violation.GetField()] = true
+			}
+		}
+	}
+	for _, field := range []string{"purchaseDate", "purchaseTime", "total", "items"} {
+		if !fields[field] {
+			t.Errorf("Expected a violation of field %s, received %v", field, fields)
+		}
+	}
+}
+
+// Ensures that every receipt of a batch is answered in order, rejected ones included
+func Test_grpcBatchProcess(t *testing.T) {
+	client := newGRPCClient(t, nil, nil)
+
+	stream, err := client.BatchProcess(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	batch := []*receiptspb.ProcessReceiptRequest{validReceipt, {Retailer: "Target"}, validReceipt}
+	for _, req := range batch {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("Failed to send receipt: %v", err)
+		}
+	}
+	stream.CloseSend()
+
+	var responses []*receiptspb.BatchProcessResponse
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to receive response: %v", err)
+		}
+		responses = append(responses, response)
+	}
+
+	if len(responses) != len(batch) {
+		t.Fatalf("Expected %d responses, received %d", len(batch), len(responses))
+	}
+	for i, response := range responses {
+		if response.GetIndex() != int64(i) {
+			t.Errorf("Expected response %d to carry its index, received %d", i, response.GetIndex())
+		}
+	}
+	if responses[0].GetId() == "" || codes.Code(responses[0].GetCode()) != codes.OK {
+		t.Errorf("Expected the first receipt to be stored, received %v", responses[0])
+	}
+	if codes.Code(responses[1].GetCode()) != codes.InvalidArgument || responses[1].GetFieldErrors()["purchaseDate"] == "" {
+		t.Errorf("Expected the second receipt to be rejected with its field errors, received %v", responses[1])
+	}
+}
+
+// Ensures that gRPC calls and the receipts of batch streams are rate limited
+func Test_grpcRateLimit(t *testing.T) {
+	client := newGRPCClient(t, nil, map[string]*ratelimit.Limiter{
+		"default": ratelimit.New(ratelimit.Limit{Rate: 0.001, Burst: 5}),
+		"process": ratelimit.New(ratelimit.Limit{Rate: 0.001, Burst: 2}),
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.ProcessReceipt(ctx, validReceipt); err != nil {
+			t.Fatalf("Failed to process receipt: %v", err)
+		}
+	}
+	if _, err := client.ProcessReceipt(ctx, validReceipt); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected %v, received %v", codes.ResourceExhausted, err)
+	}
+	// Other methods use the default limiter
+	if _, err := client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected %v, received %v", codes.NotFound, err)
+	}
+
+	// Streams cannot be used to get around the process limit: opening the
+	// stream takes the first token, the second receipt the last one
+	client = newGRPCClient(t, nil, map[string]*ratelimit.Limiter{
+		"process": ratelimit.New(ratelimit.Limit{Rate: 0.001, Burst: 2}),
+	})
+	stream, err := client.BatchProcess(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		stream.Send(validReceipt)
+	}
+	stream.CloseSend()
+
+	for i := 0; i < 2; i++ {
+		if response, err := stream.Recv(); err != nil || response.GetId() == "" {
+			t.Fatalf("Expected receipt %d to be stored, received %v, %v", i, response, err)
+		}
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected %v, received %v", codes.ResourceExhausted, err)
+	}
+}
+
+// Ensures that gRPC calls require the scopes of their HTTP routes
+func Test_grpcAuthentication(t *testing.T) {
+	apiKeys, err := auth.NewKeyStore([]auth.APIKey{
+		{ID: "reader", Hash: auth.HashKey("reader-key"), Scopes: []string{auth.ScopeReceiptsRead}},
+		{ID: "writer", Hash: auth.HashKey("writer-key"), Scopes: []string{auth.ScopeReceiptsWrite}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create key store: %v", err)
+	}
+	client := newGRPCClient(t, apiKeys, nil)
+
+	tests := []struct {
+		name         string
+		key          string
+		expectedCode codes.Code
+	}{
+		{"Missing key", "", codes.Unauthenticated},
+		{"Invalid key", "guess", codes.Unauthenticated},
+		{"Missing scope", "reader-key", codes.PermissionDenied},
+		{"Granted scope", "writer-key", codes.OK},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			ctx := context.Background()
+			if entry.key != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", entry.key)
+			}
+			var header metadata.MD
+			_, err := client.ProcessReceipt(ctx, validReceipt, grpc.Header(&header))
+			if status.Code(err) != entry.expectedCode {
+				t.Errorf("Expected %s, received %v", entry.expectedCode, err)
+			}
+			if entry.expectedCode == codes.OK && len(header.Get("x-request-id")) == 0 {
+				t.Error("Expected the response to carry a request id")
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Tracks the conditions reported by the readiness probe
+type readiness struct {
+	storeLoaded atomic.Bool
+	rulesLoaded atomic.Bool
+	draining    atomic.Bool
+}
+
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Reports whether the process is alive and able to serve HTTP requests
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	app.helpers.EncodeJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Reports whether the application is ready to receive traffic:
+// the store has finished loading, the points rules are loaded
+// and the server is not draining for shutdown
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"store":    app.checkStatus(app.ready.storeLoaded.Load(), "loading"),
+		"rules":    app.checkStatus(app.ready.rulesLoaded.Load(), "loading"),
+		"shutdown": app.checkStatus(!app.ready.draining.Load(), "draining"),
+	}
+
+	status := http.StatusOK
+	response := HealthResponse{Status: "ok", Checks: checks}
+	for _, check := range checks {
+		if check != "ok" {
+			status = http.StatusServiceUnavailable
+			response.Status = "unavailable"
+			break
+		}
+	}
+
+	app.helpers.EncodeJSON(w, status, response)
+}
+
+// Returns "ok" if the check passed, or the provided failure reason
+func (app *application) checkStatus(ok bool, reason string) string {
+	if ok {
+		return "ok"
+	}
+	return reason
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Ensures that the liveness probe always reports ok
+func Test_healthz(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+
+	app.healthz(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, resp.Code)
+	}
+}
+
+// Ensures that the readiness probe reflects the store, rules and shutdown state
+func Test_readyz(t *testing.T) {
+	tests := []struct {
+		name           string
+		storeLoaded    bool
+		rulesLoaded    bool
+		draining       bool
+		expectedStatus int
+		failingCheck   string
+	}{
+		{"Ready", true, true, false, http.StatusOK, ""},
+		{"Store loading", false, true, false, http.StatusServiceUnavailable, "store"},
+		{"Rules loading", true, false, false, http.StatusServiceUnavailable, "rules"},
+		{"Draining", true, true, true, http.StatusServiceUnavailable, "shutdown"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			app.ready.storeLoaded.Store(entry.storeLoaded)
+			app.ready.rulesLoaded.Store(entry.rulesLoaded)
+			app.ready.draining.Store(entry.draining)
+
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+
+			app.readyz(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected %d, got %d", entry.expectedStatus, resp.Code)
+			}
+
+			var response HealthResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			for check, status := range response.Checks {
+				if check == entry.failingCheck && status == "ok" {
+					t.Errorf("Expected check %s to fail, but it reported ok", check)
+				}
+				if check != entry.failingCheck && status != "ok" {
+					t.Errorf("Expected check %s to be ok, got %s", check, status)
+				}
+			}
+
+			t.Cleanup(func() {
+				app.ready.storeLoaded.Store(false)
+				app.ready.rulesLoaded.Store(false)
+				app.ready.draining.Store(false)
+			})
+		})
+	}
+}
+
+// Ensures that the probes are served by routes() without being logged
+func Test_probesNotLogged(t *testing.T) {
+	routes := app.routes()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		t.Run(path, func(t *testing.T) {
+			logBuffer.Reset()
+
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			routes.ServeHTTP(resp, req)
+
+			if resp.Code == http.StatusNotFound {
+				t.Errorf("Expected %s to be registered", path)
+			}
+			if strings.Contains(logBuffer.String(), path) {
+				t.Errorf("Expected %s not to be logged, log: %s", path, logBuffer.String())
+			}
+		})
+	}
+}
@@ -1,15 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"google.golang.org/grpc"
 	"kweeuhree.receipt-processor-challenge/cmd/handlers"
 	"kweeuhree.receipt-processor-challenge/cmd/helpers"
 	"kweeuhree.receipt-processor-challenge/cmd/utils"
+	"kweeuhree.receipt-processor-challenge/internal/analytics"
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/expiry"
 	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/ratelimit"
+	"kweeuhree.receipt-processor-challenge/internal/receiptcsv"
+	"kweeuhree.receipt-processor-challenge/internal/retailers"
+	"kweeuhree.receipt-processor-challenge/internal/retention"
+	"kweeuhree.receipt-processor-challenge/internal/stream"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
+	"kweeuhree.receipt-processor-challenge/internal/tiers"
+	"kweeuhree.receipt-processor-challenge/internal/timezone"
+	"kweeuhree.receipt-processor-challenge/internal/webhook"
 )
 
 // Application-wide dependencies
@@ -18,11 +38,56 @@ type application struct {
 	infoLog  *log.Logger
 	handlers *handlers.Handlers
 	helpers  *helpers.Helpers
+	ready    readiness
+	// Rate limiters keyed by route name
+	limiters       map[string]*ratelimit.Limiter
+	trustedProxies *ratelimit.TrustedProxies
+	// Authentication is disabled when neither API keys nor JWT are configured
+	apiKeys     *auth.KeyStore
+	jwtVerifier *auth.JWTVerifier
+	tenants     *tenant.Registry
+	// Enforces the retention policy on the receipt store
+	janitor *retention.Janitor
 }
 
 // Main point of entry
 func main() {
 	addr := flag.String("addr", ":4000", "HTTP network address")
+	grpcAddr := flag.String("grpc-addr", "", "gRPC network address, such as :4001, the gRPC API is disabled when empty")
+	drainDelay := flag.Duration("drain-delay", 5*time.Second, "Time to report not ready before shutting down")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "Time to wait for in-flight requests on shutdown")
+	defaultLimit := flag.String("rate-limit", "", "Default per-client rate limit as rate:burst, e.g. 10:20")
+	processLimit := flag.String("rate-limit-process", "", "Per-client rate limit of POST /receipts/process as rate:burst")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma separated IPs or CIDR ranges allowed to set X-Forwarded-For")
+	apiKeysFile := flag.String("api-keys", "", "Path to the JSON file with hashed API keys and their scopes")
+	jwtConfigFile := flag.String("jwt-config", "", "Path to the JSON file configuring bearer token validation")
+	tenantsFile := flag.String("tenants", "", "Path to the JSON file with tenants, their quotas and points rules")
+	pointsExpiry := flag.String("points-expiry", "never", "Points expiry policy: never, fixed:<months>, calendar-year[:<years>] or inactivity:<months>")
+	expirySweep := flag.Duration("expiry-sweep-interval", time.Hour, "Time between two sweeps of expired points")
+	tiersFile := flag.String("tiers", "", "Path to the JSON file with membership tiers, their thresholds and multipliers")
+	tierReview := flag.Duration("tier-review-interval", time.Hour, "Time between two reviews of the tiers of all members")
+	auditLogFile := flag.String("audit-log", "", "Path to the file the audit trail is appended to, kept in memory when empty")
+	deletedRetention := flag.Duration("deleted-retention", 30*24*time.Hour, "Time a deleted receipt can be restored before it is purged")
+	retentionMaxAge := flag.Duration("retention-max-age", 0, "Maximum age of a receipt before it is evicted, unlimited when zero")
+	retentionAgeBasis := flag.String("retention-age-basis", retention.AgeByIngestion, "Time the age of a receipt is measured from: ingestion or purchaseDate")
+	retentionMaxCount := flag.Int("retention-max-count", 0, "Maximum number of stored receipts, unlimited when zero")
+	retentionMaxMemory := flag.String("retention-max-memory", "0", "Maximum estimated memory held by receipts in bytes or with a KB, MB or GB suffix, unlimited when zero")
+	retentionEviction := flag.String("retention-eviction", retention.EvictOldest, "Order receipts are evicted in once a limit is exceeded: oldest or lru")
+	webhookAttempts := flag.Int("webhook-max-attempts", webhook.DefaultRetryPolicy.MaxAttempts, "Attempts to deliver a webhook event before it is dead-lettered")
+	webhookBackoff := flag.Duration("webhook-backoff", webhook.DefaultRetryPolicy.InitialBackoff, "Delay before the first retry of a failed webhook delivery, doubled after every attempt")
+	webhookMaxBackoff := flag.Duration("webhook-max-backoff", webhook.DefaultRetryPolicy.MaxBackoff, "Maximum delay between two attempts of a webhook delivery")
+	webhookInterval := flag.Duration("webhook-interval", 5*time.Second, "Time between two checks for webhook deliveries due for a retry")
+	webhookWorkers := flag.Int("webhook-workers", webhook.DefaultWorkers, "Number of subscriptions webhooks are delivered to at the same time")
+	webhookMaxPending := flag.Int("webhook-max-pending", webhook.DefaultMaxPending, "Pending webhook deliveries kept for each subscription, the oldest are dropped beyond them")
+	webhookMaxDead := flag.Int("webhook-max-dead", webhook.DefaultMaxDead, "Dead-lettered webhook deliveries kept for each subscription, the oldest are dropped beyond them")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false, "Deliver webhooks to loopback, private and link-local addresses, for local development only")
+	analyticsMaxDays := flag.Int("analytics-max-days", analytics.DefaultMaxDays, "Most days an analytics range can span")
+	eventBuffer := flag.Int("event-buffer", handlers.DefaultEventBuffer, "Number of recent events of each tenant kept for clients resuming the event stream")
+	restoreMaxBytes := flag.String("restore-max-bytes", "64MB", "Largest dump accepted by the restore, in bytes or with a KB, MB or GB suffix")
+	csvMappingFile := flag.String("csv-mapping", "", "Path to the JSON file mapping receipt fields to the CSV columns of imports and exports")
+	timeZone := flag.String("time-zone", "UTC", "IANA time zone or offset from UTC of receipts that name none and whose retailer has none")
+	retailersFile := flag.String("retailers", "", "Path to the JSON file registering canonical retailer names and their aliases")
+	janitorInterval := flag.Duration("janitor-interval", time.Hour, "Time between two sweeps of expired and excess receipts")
 	flag.Parse()
 
 	// Error and info logs
@@ -34,12 +99,156 @@ func main() {
 	helpers := helpers.NewHelpers(errorLog)
 	handlers := handlers.NewHandlers(errorLog, infoLog, receiptStore, utils, helpers)
 
+	// Points expiry policy
+	expiryPolicy, err := expiry.ParsePolicy(*pointsExpiry)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	handlers.ExpiryPolicy = expiryPolicy
+
+	// Membership tiers
+	if *tiersFile != "" {
+		handlers.Tiers, err = tiers.LoadProgram(*tiersFile)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// Audit trail, verified on startup when persisted
+	if *auditLogFile != "" {
+		handlers.Audit, err = audit.OpenLog(*auditLogFile)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if torn := handlers.Audit.Repaired(); torn > 0 {
+			errorLog.Printf("Dropped a torn audit event of %d bytes at the end of %s", torn, *auditLogFile)
+		}
+		defer handlers.Audit.Close()
+	}
+
+	// Webhook deliveries
+	if *webhookAttempts < 1 || *webhookBackoff <= 0 || *webhookMaxBackoff < *webhookBackoff {
+		errorLog.Fatal("webhook retries need at least one attempt and a positive backoff no greater than the maximum")
+	}
+	retryPolicy := webhook.RetryPolicy{MaxAttempts: *webhookAttempts, InitialBackoff: *webhookBackoff, MaxBackoff: *webhookMaxBackoff}
+	handlers.Outbox = webhook.NewOutbox(handlers.Webhooks, retryPolicy, errorLog, infoLog)
+	handlers.Outbox.SetWorkers(*webhookWorkers)
+	handlers.Outbox.SetLimits(*webhookMaxPending, *webhookMaxDead)
+	if *webhookAllowPrivate {
+		handlers.Outbox.AllowPrivateNetworks()
+	}
+
+	// Analytics
+	if *analyticsMaxDays < 1 {
+		errorLog.Fatal("analytics ranges need to span at least one day")
+	}
+	handlers.Analytics.MaxDays = *analyticsMaxDays
+
+	// Event stream
+	handlers.Events = stream.NewBroker(*eventBuffer)
+
+	// Largest dump accepted by the restore
+	handlers.MaxRestoreBytes, err = retention.ParseSize(*restoreMaxBytes)
+	if err != nil || handlers.MaxRestoreBytes <= 0 {
+		errorLog.Fatalf("invalid -restore-max-bytes %q", *restoreMaxBytes)
+	}
+
+	// Column names of CSV imports and exports
+	if *csvMappingFile != "" {
+		handlers.CSVMapping, err = receiptcsv.LoadMapping(*csvMappingFile)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// Zone of receipts naming none
+	handlers.TimeZone, err = timezone.Parse(*timeZone)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Canonical retailer names
+	if *retailersFile != "" {
+		handlers.Retailers, err = retailers.LoadRegistry(*retailersFile)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// Retention policy of the receipt store
+	maxBytes, err := retention.ParseSize(*retentionMaxMemory)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	retentionPolicy := retention.Policy{
+		DeletedRetention: *deletedRetention,
+		MaxAge:           *retentionMaxAge,
+		AgeBasis:         *retentionAgeBasis,
+		MaxCount:         *retentionMaxCount,
+		MaxBytes:         maxBytes,
+		Eviction:         *retentionEviction,
+	}
+	if err := retentionPolicy.Validate(); err != nil {
+		errorLog.Fatal(err)
+	}
+	janitor := retention.NewJanitor(receiptStore, retentionPolicy, handlers.Audit, errorLog, infoLog)
+
+	// Rate limiting configuration
+	limiters, err := newLimiters(map[string]string{"default": *defaultLimit, "process": *processLimit})
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	proxies, err := ratelimit.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Tenants with their quotas and points rules
+	tenants, err := tenant.NewRegistry(nil)
+	if *tenantsFile != "" {
+		tenants, err = tenant.LoadRegistry(*tenantsFile)
+	}
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	tenants.Each(func(t *tenant.Tenant) {
+		receiptStore.SetQuota(t.ID, t.MaxReceipts)
+	})
+
+	// API key authentication
+	var apiKeys *auth.KeyStore
+	if *apiKeysFile != "" {
+		apiKeys, err = auth.LoadKeyStore(*apiKeysFile)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// JWT bearer token authentication
+	var jwtVerifier *auth.JWTVerifier
+	if *jwtConfigFile != "" {
+		jwtVerifier, err = auth.LoadJWTVerifier(*jwtConfigFile)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	if apiKeys == nil && jwtVerifier == nil {
+		infoLog.Print("No API keys or JWT configured, authentication is disabled")
+	}
+
 	// Initialize the application with its dependencies
 	app := &application{
-		errorLog: errorLog,
-		infoLog:  infoLog,
-		handlers: handlers,
-		helpers:  helpers,
+		errorLog:       errorLog,
+		infoLog:        infoLog,
+		handlers:       handlers,
+		helpers:        helpers,
+		limiters:       limiters,
+		trustedProxies: proxies,
+		apiKeys:        apiKeys,
+		jwtVerifier:    jwtVerifier,
+		tenants:        tenants,
+		janitor:        janitor,
 	}
 
 	// HTTP server config
@@ -48,9 +257,112 @@ func main() {
 		ErrorLog: errorLog,
 		Handler:  app.routes(),
 	}
+	// End the event streams, which would otherwise hold the shutdown until it times out
+	srv.RegisterOnShutdown(handlers.Events.Close)
+
+	// Nothing to replay into the in-memory store, and the points rules
+	// of every tenant were loaded with the tenants file
+	app.ready.storeLoaded.Store(true)
+	app.ready.rulesLoaded.Store(true)
+
+	// Drain and shut down gracefully on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Expire points in the background
+	sweeper := expiry.NewSweeper(handlers.Ledger, expiryPolicy, handlers.Audit, errorLog, infoLog)
+	go sweeper.Run(ctx, *expirySweep)
+
+	// Purge deleted receipts once they can no longer be restored
+	// and evict the receipts the retention policy does not keep
+	go janitor.Run(ctx, *janitorInterval)
+
+	// Deliver webhook events as they are published and retry failed deliveries
+	go handlers.Outbox.Run(ctx, *webhookInterval)
+
+	// Promote and demote members as their standing changes over time
+	if handlers.Tiers != nil {
+		reviewer := tiers.NewReviewer(handlers.Tiers, handlers.MemberStore, handlers.Ledger, handlers.Audit, errorLog, infoLog)
+		go reviewer.Run(ctx, *tierReview)
+	}
+
+	// Serve the gRPC API next to the HTTP server
+	var rpcServer *grpc.Server
+	if *grpcAddr != "" {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		rpcServer = app.grpcServer()
+		go func() {
+			infoLog.Printf("Starting gRPC server on %s", *grpcAddr)
+			if err := rpcServer.Serve(listener); err != nil {
+				errorLog.Fatal(err)
+			}
+		}()
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownErr <- app.shutdown(srv, rpcServer, *drainDelay, *shutdownTimeout)
+	}()
 
 	// Listen and serve
 	infoLog.Printf("Starting server on %s", *addr)
-	err := srv.ListenAndServe()
-	errorLog.Fatal(err)
+	err = srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		errorLog.Fatal(err)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		errorLog.Fatal(err)
+	}
+	infoLog.Print("Server stopped")
+}
+
+// Creates a rate limiter per route from the "rate:burst" flag values,
+// routes with an empty value are not limited
+func newLimiters(limits map[string]string) (map[string]*ratelimit.Limiter, error) {
+	limiters := make(map[string]*ratelimit.Limiter)
+	for route, value := range limits {
+		if value == "" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, err
+		}
+		limiters[route] = ratelimit.New(limit)
+	}
+	return limiters, nil
+}
+
+// Marks the application as draining so that the readiness probe fails,
+// waits for the orchestrator to stop routing traffic, then shuts the servers down
+func (app *application) shutdown(srv *http.Server, rpcServer *grpc.Server, drainDelay, timeout time.Duration) error {
+	app.ready.draining.Store(true)
+	app.infoLog.Printf("Draining for %s before shutdown", drainDelay)
+	time.Sleep(drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if rpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			rpcServer.GracefulStop()
+			close(stopped)
+		}()
+		defer func() {
+			// Cancel the calls still running once the timeout elapsed
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				rpcServer.Stop()
+			}
+		}()
+	}
+
+	return srv.Shutdown(ctx)
 }
@@ -1,8 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/justinas/alice"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/requestid"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
 )
 
 // Logs details of incoming HTTP requests
@@ -31,3 +40,190 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Assigns every request an id, the one supplied in the X-Request-ID header
+// when it is acceptable, stores it in the request context and returns it
+// in the response
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.New(r.Header.Get(requestid.Header))
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.WithID(r.Context(), id)))
+	})
+}
+
+// Marks the responses of a deprecated path, whose successor is the same
+// path without the suffix, with the Deprecation and Link headers
+func (app *application) deprecated(suffix string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			successor := strings.TrimSuffix(r.URL.Path, suffix)
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Limits the rate of requests per client on the named route, keyed by the
+// principal set by authenticate or else by the client IP address.
+// Routes without their own limiter share the "default" one,
+// and requests pass through when no limiter is configured
+func (app *application) rateLimit(route string) alice.Constructor {
+	limiter, exists := app.limiters[route]
+	if !exists {
+		limiter = app.limiters["default"]
+	}
+
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result := limiter.Allow(app.trustedProxies.ClientKey(r, principalKey(auth.PrincipalFromContext(r.Context()))))
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				app.helpers.ClientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Returns the name rate limits key the principal by, empty for anonymous callers
+func principalKey(principal *auth.Principal) string {
+	if principal == nil {
+		return ""
+	}
+	return principal.Name()
+}
+
+// Authenticates the request by its X-API-Key header or bearer token and
+// stores the principal in the request context. Requests without credentials
+// continue anonymously, requests with invalid credentials are rejected
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := app.principal(r.Header.Get("X-API-Key"), r.Header.Get("Authorization"))
+		if err != nil {
+			app.unauthorized(w)
+			return
+		}
+		if principal == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// Authenticates the API key or the bearer token of the Authorization value.
+// Returns a nil principal when no credentials are supplied
+func (app *application) principal(apiKey, authorization string) (*auth.Principal, error) {
+	token, isBearer := strings.CutPrefix(authorization, "Bearer ")
+
+	switch {
+	case apiKey != "" && app.apiKeys != nil:
+		return app.apiKeys.Authenticate(apiKey)
+	case isBearer && app.jwtVerifier != nil:
+		return app.jwtVerifier.Authenticate(strings.TrimSpace(token))
+	}
+	return nil, nil
+}
+
+// Rejects requests whose principal was not granted the scope.
+// Every request is allowed when authentication is not configured
+func (app *application) requireScope(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.authEnabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal := auth.PrincipalFromContext(r.Context())
+			if principal == nil {
+				app.unauthorized(w)
+				return
+			}
+			if !principal.HasScope(scope) {
+				app.helpers.ClientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Sends a 401 Unauthorized response with the accepted authentication scheme
+func (app *application) unauthorized(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `ApiKey header="X-API-Key"`)
+	if app.jwtVerifier != nil {
+		w.Header().Add("WWW-Authenticate", "Bearer")
+	}
+	app.helpers.ClientError(w, http.StatusUnauthorized)
+}
+
+// Returns true if API keys or bearer tokens are configured
+func (app *application) authEnabled() bool {
+	return app.apiKeys != nil || app.jwtVerifier != nil
+}
+
+// Resolves the tenant the request acts on and stores it in the request context.
+// Principals bound to a tenant always act on it. The X-Tenant-ID header
+// selects the tenant otherwise, but only for admins or when authentication
+// is disabled; everyone else acts on the default tenant and is refused
+// when the header names another one
+func (app *application) resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, err := app.tenantFor(auth.PrincipalFromContext(r.Context()), r.Header.Get("X-Tenant-ID"))
+		if errors.Is(err, errTenantMismatch) {
+			app.helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, errTenantNotAllowed) {
+			app.helpers.EncodeJSON(w, http.StatusForbidden, map[string]string{"error": "Selecting a tenant requires the admin scope."})
+			return
+		}
+		if err != nil {
+			app.helpers.EncodeJSON(w, http.StatusForbidden, map[string]string{"error": "Unknown tenant."})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), t)))
+	})
+}
+
+var (
+	errTenantMismatch   = errors.New("the principal is bound to another tenant")
+	errTenantNotAllowed = errors.New("selecting a tenant requires the admin scope")
+)
+
+// Returns the tenant the principal acts on, selecting the requested one when it is allowed to
+func (app *application) tenantFor(principal *auth.Principal, requested string) (*tenant.Tenant, error) {
+	tenantID := tenant.Default().ID
+	switch {
+	case principal != nil && principal.Tenant != "":
+		if requested != "" && requested != principal.Tenant {
+			return nil, errTenantMismatch
+		}
+		tenantID = principal.Tenant
+	case requested != "" && (!app.authEnabled() || principal.HasScope(auth.ScopeAdmin)):
+		tenantID = requested
+	case requested != "" && requested != tenantID:
+		return nil, errTenantNotAllowed
+	}
+
+	if app.tenants == nil {
+		return &tenant.Tenant{ID: tenantID}, nil
+	}
+	return app.tenants.Get(tenantID)
+}
@@ -2,13 +2,22 @@ package main
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"kweeuhree.receipt-processor-challenge/cmd/helpers"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/ratelimit"
+	"kweeuhree.receipt-processor-challenge/internal/requestid"
+	"kweeuhree.receipt-processor-challenge/internal/tenant"
 )
 
 // Declare application and logBuffer instance for all tests
@@ -150,3 +159,290 @@ func Test_recoverPanic(t *testing.T) {
 		})
 	}
 }
+
+// Ensures that rateLimit middleware rejects requests over the limit with rate limit headers
+func Test_rateLimit(t *testing.T) {
+	app.limiters = map[string]*ratelimit.Limiter{
+		"default": ratelimit.New(ratelimit.Limit{Rate: 1, Burst: 1}),
+	}
+	t.Cleanup(func() {
+		app.limiters = nil
+	})
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		apiKey         string
+		expectedStatus int
+	}{
+		{"First request", "203.0.113.7:1234", "", http.StatusOK},
+		{"Over the limit", "203.0.113.7:1234", "", http.StatusTooManyRequests},
+		// Unverified keys do not get a bucket of their own
+		{"Made-up API key", "203.0.113.7:1234", "made-up-key", http.StatusTooManyRequests},
+		{"Another client", "198.51.100.1:1234", "", http.StatusOK},
+	}
+
+	middleware := app.rateLimit("process")(testHandler(false))
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", nil)
+			req.RemoteAddr = entry.remoteAddr
+			if entry.apiKey != "" {
+				req.Header.Set("X-API-Key", entry.apiKey)
+			}
+			resp := httptest.NewRecorder()
+
+			middleware.ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			for _, header := range []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"} {
+				if resp.Header().Get(header) == "" {
+					t.Errorf("Expected %s header to be set", header)
+				}
+			}
+			if entry.expectedStatus == http.StatusTooManyRequests && resp.Header().Get("Retry-After") == "" {
+				t.Errorf("Expected Retry-After header to be set")
+			}
+		})
+	}
+}
+
+// Ensures that authenticate and requireScope enforce API keys and their scopes
+func Test_requireScope(t *testing.T) {
+	apiKeys, err := auth.NewKeyStore([]auth.APIKey{
+		{ID: "reader", Hash: auth.HashKey("reader-key"), Scopes: []string{auth.ScopeReceiptsRead}},
+		{ID: "admin", Hash: auth.HashKey("admin-key"), Scopes: []string{auth.ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create key store: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		apiKeys        *auth.KeyStore
+		key            string
+		scope          string
+		expectedStatus int
+	}{
+		{"Authentication disabled", nil, "", auth.ScopeReceiptsDelete, http.StatusOK},
+		{"Missing key", apiKeys, "", auth.ScopeReceiptsRead, http.StatusUnauthorized},
+		{"Invalid key", apiKeys, "guess", auth.ScopeReceiptsRead, http.StatusUnauthorized},
+		{"Granted scope", apiKeys, "reader-key", auth.ScopeReceiptsRead, http.StatusOK},
+		{"Missing scope", apiKeys, "reader-key", auth.ScopeReceiptsDelete, http.StatusForbidden},
+		{"Admin", apiKeys, "admin-key", auth.ScopeReceiptsDelete, http.StatusOK},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			app.apiKeys = entry.apiKeys
+			t.Cleanup(func() {
+				app.apiKeys = nil
+			})
+
+			middleware := app.authenticate(app.requireScope(entry.scope)(testHandler(false)))
+			req := httptest.NewRequest(http.MethodDelete, "/receipts/123/delete", nil)
+			if entry.key != "" {
+				req.Header.Set("X-API-Key", entry.key)
+			}
+			resp := httptest.NewRecorder()
+
+			middleware.ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if resp.Code == http.StatusUnauthorized && resp.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected WWW-Authenticate header to be set")
+			}
+		})
+	}
+}
+
+// Ensures that authenticate accepts bearer tokens and exposes the principal
+func Test_authenticateBearer(t *testing.T) {
+	secret := []byte("a-shared-secret-of-reasonable-length")
+	verifier, err := auth.NewJWTVerifier(
+		auth.JWTConfig{Roles: map[string][]string{"customer": {auth.ScopeReceiptsWrite}}},
+		[]auth.JWK{{Kty: "oct", K: base64.RawURLEncoding.EncodeToString(secret)}},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	app.jwtVerifier = verifier
+	t.Cleanup(func() {
+		app.jwtVerifier = nil
+	})
+
+	// Build an HS256 token for the customer role
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := fmt.Sprintf(`{"sub":"user-42","exp":%d,"roles":["customer"]}`, time.Now().Add(time.Hour).Unix())
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name           string
+		authorization  string
+		scope          string
+		expectedStatus int
+	}{
+		{"Valid token", "Bearer " + token, auth.ScopeReceiptsWrite, http.StatusOK},
+		{"Missing scope", "Bearer " + token, auth.ScopeReceiptsDelete, http.StatusForbidden},
+		{"Invalid token", "Bearer " + token + "x", auth.ScopeReceiptsWrite, http.StatusUnauthorized},
+		{"No token", "", auth.ScopeReceiptsWrite, http.StatusUnauthorized},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var principal *auth.Principal
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal = auth.PrincipalFromContext(r.Context())
+			})
+			middleware := app.authenticate(app.requireScope(entry.scope)(handler))
+
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", nil)
+			if entry.authorization != "" {
+				req.Header.Set("Authorization", entry.authorization)
+			}
+			resp := httptest.NewRecorder()
+
+			middleware.ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if entry.expectedStatus == http.StatusOK && principal.Name() != "jwt:user-42" {
+				t.Errorf("Expected principal jwt:user-42 in context, received %s", principal.Name())
+			}
+		})
+	}
+}
+
+// Ensures that resolveTenant picks the tenant from the principal or the header
+func Test_resolveTenant(t *testing.T) {
+	apiKeys, err := auth.NewKeyStore([]auth.APIKey{
+		{ID: "brand-a", Hash: auth.HashKey("brand-a-key"), Scopes: []string{auth.ScopeReceiptsRead}, Tenant: "brand-a"},
+		{ID: "partner", Hash: auth.HashKey("partner-key"), Scopes: []string{auth.ScopeReceiptsRead}},
+		{ID: "admin", Hash: auth.HashKey("admin-key"), Scopes: []string{auth.ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create key store: %v", err)
+	}
+	tenants, err := tenant.NewRegistry([]tenant.Tenant{{ID: "brand-a"}, {ID: "brand-b"}})
+	if err != nil {
+		t.Fatalf("Failed to create tenants: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		apiKeys        *auth.KeyStore
+		key            string
+		header         string
+		expectedStatus int
+		expectedTenant string
+	}{
+		{"No authentication, no header", nil, "", "", http.StatusOK, "default"},
+		{"No authentication, header", nil, "", "brand-b", http.StatusOK, "brand-b"},
+		{"No authentication, unknown tenant", nil, "", "brand-c", http.StatusForbidden, ""},
+		{"Bound principal", apiKeys, "brand-a-key", "", http.StatusOK, "brand-a"},
+		{"Bound principal, matching header", apiKeys, "brand-a-key", "brand-a", http.StatusOK, "brand-a"},
+		{"Bound principal, other tenant", apiKeys, "brand-a-key", "brand-b", http.StatusForbidden, ""},
+		{"Unbound principal, default tenant", apiKeys, "partner-key", "default", http.StatusOK, "default"},
+		{"Unbound principal, other tenant", apiKeys, "partner-key", "brand-b", http.StatusForbidden, ""},
+		{"Admin selects tenant", apiKeys, "admin-key", "brand-b", http.StatusOK, "brand-b"},
+	}
+
+	app.tenants = tenants
+	t.Cleanup(func() {
+		app.tenants = nil
+	})
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			app.apiKeys = entry.apiKeys
+			t.Cleanup(func() {
+				app.apiKeys = nil
+			})
+
+			var tenantID string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tenantID = tenant.FromContext(r.Context()).ID
+			})
+			middleware := app.authenticate(app.resolveTenant(handler))
+
+			req := httptest.NewRequest(http.MethodGet, "/receipts/123/points", nil)
+			if entry.key != "" {
+				req.Header.Set("X-API-Key", entry.key)
+			}
+			if entry.header != "" {
+				req.Header.Set("X-Tenant-ID", entry.header)
+			}
+			resp := httptest.NewRecorder()
+
+			middleware.ServeHTTP(resp, req)
+
+			if resp.Code != entry.expectedStatus {
+				t.Errorf("Expected %d, got %d", entry.expectedStatus, resp.Code)
+			}
+			if tenantID != entry.expectedTenant {
+				t.Errorf("Expected tenant %q, received %q", entry.expectedTenant, tenantID)
+			}
+		})
+	}
+}
+
+// Ensures that requests get an id, keeping acceptable ids supplied by the client
+func Test_requestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		supplied string
+		kept     bool
+	}{
+		{"No id supplied", "", false},
+		{"Id supplied", "trace-1234", true},
+		{"Id with spaces", "trace 1234", false},
+		{"Id too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			var fromContext string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = requestid.FromContext(r.Context())
+			})
+
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if entry.supplied != "" {
+				req.Header.Set(requestid.Header, entry.supplied)
+			}
+			app.requestID(next).ServeHTTP(resp, req)
+
+			returned := resp.Header().Get(requestid.Header)
+			if returned == "" || returned != fromContext {
+				t.Errorf("Expected the response id %q to match the context id %q", returned, fromContext)
+			}
+			if (returned == entry.supplied) != entry.kept {
+				t.Errorf("Expected supplied id kept to be %t, received %q", entry.kept, returned)
+			}
+		})
+	}
+}
+
+// Ensures that deprecated paths link to their successor
+func Test_deprecated(t *testing.T) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/receipts/123/delete", nil)
+
+	app.deprecated("/delete")(testHandler(false)).ServeHTTP(resp, req)
+
+	if resp.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected the Deprecation header to be set")
+	}
+	if link := resp.Header().Get("Link"); link != `</receipts/123>; rel="successor-version"` {
+		t.Errorf("Expected a link to the successor, received %s", link)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/retention"
+)
+
+type RetentionResponse struct {
+	Policy  PolicyResponse    `json:"policy"`
+	Metrics retention.Metrics `json:"metrics"`
+}
+
+type PolicyResponse struct {
+	DeletedRetention string `json:"deletedRetention"`
+	MaxAge           string `json:"maxAge"`
+	AgeBasis         string `json:"ageBasis"`
+	MaxCount         int    `json:"maxCount"`
+	MaxBytes         int64  `json:"maxBytes"`
+	Eviction         string `json:"eviction"`
+}
+
+// Reports the retention policy and the evictions of the janitor. The metrics
+// span every tenant, so principals bound to a tenant cannot read them
+func (app *application) retentionMetrics(w http.ResponseWriter, r *http.Request) {
+	if principal := auth.PrincipalFromContext(r.Context()); principal != nil && principal.Tenant != "" {
+		msg := map[string]string{"error": "Retention metrics span every tenant and cannot be read by a principal bound to a tenant."}
+		app.helpers.EncodeJSON(w, http.StatusForbidden, msg)
+		return
+	}
+	if app.janitor == nil {
+		app.helpers.NotFound(w)
+		return
+	}
+
+	policy := app.janitor.Policy()
+	response := RetentionResponse{
+		Policy: PolicyResponse{
+			DeletedRetention: policy.DeletedRetention.String(),
+			MaxAge:           policy.MaxAge.String(),
+			AgeBasis:         policy.AgeBasis,
+			MaxCount:         policy.MaxCount,
+			MaxBytes:         policy.MaxBytes,
+			Eviction:         policy.Eviction,
+		},
+		Metrics: app.janitor.Metrics(),
+	}
+
+	err := app.helpers.EncodeJSON(w, http.StatusOK, response)
+	if err != nil {
+		app.helpers.ServerError(w, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/auth"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/retention"
+)
+
+// Ensures that the retention endpoint reports the policy and the evictions
+func Test_retentionMetrics(t *testing.T) {
+	store := models.NewStore()
+	store.Insert(models.Receipt{ID: "first", CreatedAt: time.Now().Add(-time.Hour)})
+	store.Insert(models.Receipt{ID: "second"})
+
+	policy := retention.Policy{MaxCount: 1, AgeBasis: retention.AgeByIngestion, Eviction: retention.EvictOldest}
+	app.janitor = retention.NewJanitor(store, policy, audit.NewLog(), log.New(&logBuffer, "", 0), log.New(&logBuffer, "", 0))
+	defer func() { app.janitor = nil }()
+	app.janitor.Sweep()
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/retention", nil)
+
+	app.retentionMetrics(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, resp.Code)
+	}
+
+	var response RetentionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Policy.MaxCount != 1 || response.Policy.Eviction != retention.EvictOldest {
+		t.Errorf("Expected the configured policy, received %+v", response.Policy)
+	}
+	if response.Metrics.Evictions[retention.ReasonCount] != 1 || response.Metrics.Receipts != 1 {
+		t.Errorf("Expected 1 count eviction leaving 1 receipt, received %+v", response.Metrics)
+	}
+
+	// Admins bound to a tenant cannot read the metrics of every tenant
+	resp = httptest.NewRecorder()
+	bound := &auth.Principal{ID: "brand-a-admin", Method: "apikey", Tenant: "brand-a", Scopes: []string{auth.ScopeAdmin}}
+	req = req.WithContext(auth.WithPrincipal(req.Context(), bound))
+
+	app.retentionMetrics(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("Expected %d for a bound admin, got %d", http.StatusForbidden, resp.Code)
+	}
+}
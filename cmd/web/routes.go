@@ -5,6 +5,7 @@ import (
 
 	"github.com/julienschmidt/httprouter" // Third-party router for lightweight, efficient HTTP routing
 	"github.com/justinas/alice"           // Middleware chaining library for clean, reusable middleware
+	"kweeuhree.receipt-processor-challenge/internal/auth"
 )
 
 // Initializes and configures the application's HTTP routes and middleware chain
@@ -12,21 +13,168 @@ func (app *application) routes() http.Handler {
 	// Initialize the router
 	router := httprouter.New()
 
+	// Rate limited chains: receipt processing has its own per-client
+	// limit, the remaining routes share the default one
+	process := alice.New(app.rateLimit("process"))
+	limited := alice.New(app.rateLimit("default"))
+
 	// Get receipt id
-	router.Handler(http.MethodPost, "/receipts/process", http.HandlerFunc(app.handlers.ProcessReceipt))
+	processReceipt := process.Append(app.requireScope(auth.ScopeReceiptsWrite)).ThenFunc(app.handlers.ProcessReceipt)
+	// Process a plain-text receipt
+	parseReceipt := process.Append(app.requireScope(auth.ScopeReceiptsWrite)).ThenFunc(app.handlers.ParseReceipt)
+	// Import the receipts of a CSV file
+	importReceipts := process.Append(app.requireScope(auth.ScopeReceiptsWrite)).ThenFunc(app.handlers.ImportReceipts)
+	router.Handler(http.MethodPost, "/receipts/:id", app.dispatchParam("id", map[string]http.Handler{
+		"process": processReceipt,
+		"parse":   parseReceipt,
+		"import":  importReceipts,
+	}, nil))
 
 	// Get receipt points
-	router.Handler(http.MethodGet, "/receipts/:id/points", http.HandlerFunc(app.handlers.GetReceiptPoints))
+	router.Handler(http.MethodGet, "/receipts/:id/points",
+		limited.Append(app.requireScope(auth.ScopeReceiptsRead)).ThenFunc(app.handlers.GetReceiptPoints))
+
+	// Get the current revision of a receipt, or export the receipts as CSV
+	router.Handler(http.MethodGet, "/receipts/:id", app.dispatchParam("id", map[string]http.Handler{
+		"export": limited.Append(app.requireScope(auth.ScopeReceiptsRead)).ThenFunc(app.handlers.ExportReceipts),
+	}, limited.Append(app.requireScope(auth.ScopeReceiptsRead)).ThenFunc(app.handlers.GetReceipt)))
+
+	// Replace or partially update a receipt, storing a new revision
+	router.Handler(http.MethodPut, "/receipts/:id",
+		limited.Append(app.requireScope(auth.ScopeReceiptsWrite)).ThenFunc(app.handlers.UpdateReceipt))
+	router.Handler(http.MethodPatch, "/receipts/:id",
+		limited.Append(app.requireScope(auth.ScopeReceiptsWrite)).ThenFunc(app.handlers.PatchReceipt))
+
+	// Get the revisions of a receipt
+	router.Handler(http.MethodGet, "/receipts/:id/revisions",
+		limited.Append(app.requireScope(auth.ScopeReceiptsRead)).ThenFunc(app.handlers.ListReceiptRevisions))
+	router.Handler(http.MethodGet, "/receipts/:id/revisions/:revision",
+		limited.Append(app.requireScope(auth.ScopeReceiptsRead)).ThenFunc(app.handlers.GetReceiptRevision))
+
+	// Soft-delete a receipt
+	deleteReceipt := limited.Append(app.requireScope(auth.ScopeReceiptsDelete)).ThenFunc(app.handlers.DeleteReceipt)
+	router.Handler(http.MethodDelete, "/receipts/:id", deleteReceipt)
+	router.Handler(http.MethodDelete, "/receipts/:id/delete", app.deprecated("/delete")(deleteReceipt))
+
+	// Restore a soft-deleted receipt
+	router.Handler(http.MethodPost, "/receipts/:id/restore",
+		limited.Append(app.requireScope(auth.ScopeReceiptsDelete)).ThenFunc(app.handlers.RestoreReceipt))
+
+	// Create a loyalty member
+	router.Handler(http.MethodPost, "/members",
+		limited.Append(app.requireScope(auth.ScopeMembersWrite)).ThenFunc(app.handlers.CreateMember))
+
+	// List loyalty members
+	router.Handler(http.MethodGet, "/members",
+		limited.Append(app.requireScope(auth.ScopeMembersRead)).ThenFunc(app.handlers.ListMembers))
+
+	// Get a loyalty member with its balance and recent receipts
+	router.Handler(http.MethodGet, "/members/:id",
+		limited.Append(app.requireScope(auth.ScopeMembersRead)).ThenFunc(app.handlers.GetMember))
+
+	// Redeem points of a loyalty member
+	router.Handler(http.MethodPost, "/members/:id/redemptions",
+		limited.Append(app.requireScope(auth.ScopeMembersWrite)).ThenFunc(app.handlers.CreateRedemption))
+
+	// Adjust the points of a loyalty member by hand
+	router.Handler(http.MethodPost, "/members/:id/adjustments",
+		limited.Append(app.requireScope(auth.ScopeAdmin)).ThenFunc(app.handlers.CreateAdjustment))
+
+	// Get the points ledger of a loyalty member
+	router.Handler(http.MethodGet, "/members/:id/ledger",
+		limited.Append(app.requireScope(auth.ScopeMembersRead)).ThenFunc(app.handlers.GetMemberLedger))
+
+	// Get the points of a loyalty member that expire soon
+	router.Handler(http.MethodGet, "/members/:id/expiring",
+		limited.Append(app.requireScope(auth.ScopeMembersRead)).ThenFunc(app.handlers.GetExpiringPoints))
+
+	// Stream the receipt events of the tenant
+	router.Handler(http.MethodGet, "/events",
+		limited.Append(app.requireScope(auth.ScopeReceiptsRead)).ThenFunc(app.handlers.StreamEvents))
 
-	// Delete a receipt
-	router.Handler(http.MethodDelete, "/receipts/:id/delete", http.HandlerFunc(app.handlers.DeleteReceipt))
+	// Subscribe a URL to receipt events
+	router.Handler(http.MethodPost, "/webhooks",
+		limited.Append(app.requireScope(auth.ScopeWebhooks)).ThenFunc(app.handlers.CreateWebhook))
+
+	// List the webhook subscriptions of the tenant
+	router.Handler(http.MethodGet, "/webhooks",
+		limited.Append(app.requireScope(auth.ScopeWebhooks)).ThenFunc(app.handlers.ListWebhooks))
+
+	// Get a webhook subscription
+	router.Handler(http.MethodGet, "/webhooks/:id",
+		limited.Append(app.requireScope(auth.ScopeWebhooks)).ThenFunc(app.handlers.GetWebhook))
+
+	// Delete a webhook subscription
+	router.Handler(http.MethodDelete, "/webhooks/:id",
+		limited.Append(app.requireScope(auth.ScopeWebhooks)).ThenFunc(app.handlers.DeleteWebhook))
+
+	// List the undelivered events of a webhook subscription
+	router.Handler(http.MethodGet, "/webhooks/:id/deliveries",
+		limited.Append(app.requireScope(auth.ScopeWebhooks)).ThenFunc(app.handlers.ListWebhookDeliveries))
+
+	// Queue a dead-lettered event for delivery again
+	router.Handler(http.MethodPost, "/webhooks/:id/deliveries/:delivery/redeliver",
+		limited.Append(app.requireScope(auth.ScopeWebhooks)).ThenFunc(app.handlers.RedeliverWebhook))
+
+	// Get aggregated analytics of the receipts of the tenant
+	analytics := limited.Append(app.requireScope(auth.ScopeAnalyticsRead))
+	router.Handler(http.MethodGet, "/analytics/summary", analytics.ThenFunc(app.handlers.AnalyticsSummary))
+	router.Handler(http.MethodGet, "/analytics/receipts-per-day", analytics.ThenFunc(app.handlers.AnalyticsReceiptsPerDay))
+	router.Handler(http.MethodGet, "/analytics/top-retailers", analytics.ThenFunc(app.handlers.AnalyticsTopRetailers))
+	router.Handler(http.MethodGet, "/analytics/hours", analytics.ThenFunc(app.handlers.AnalyticsHours))
+
+	// Get the audit trail of the tenant
+	router.Handler(http.MethodGet, "/admin/audit",
+		limited.Append(app.requireScope(auth.ScopeAdmin)).ThenFunc(app.handlers.ListAuditEvents))
+
+	// Get the retention policy metrics
+	router.Handler(http.MethodGet, "/admin/retention",
+		limited.Append(app.requireScope(auth.ScopeAdmin)).ThenFunc(app.retentionMetrics))
+
+	// Dump the receipt store as NDJSON, and restore it from a dump
+	router.Handler(http.MethodGet, "/admin/dump",
+		limited.Append(app.requireScope(auth.ScopeAdmin)).ThenFunc(app.handlers.DumpStore))
+	router.Handler(http.MethodPost, "/admin/restore",
+		limited.Append(app.requireScope(auth.ScopeAdmin)).ThenFunc(app.handlers.RestoreStore))
 
 	// Initialize the middleware chain using alice
 	// Includes:
 	// - recoverPanic: Middleware to recover from panics and prevent server crashes;
-	// - logRequest: Middleware to log incoming HTTP requests.
-	standard := alice.New(app.recoverPanic, app.logRequest)
+	// - requestID: Middleware to assign every request an id;
+	// - logRequest: Middleware to log incoming HTTP requests;
+	// - authenticate: Middleware to identify the caller by API key or bearer token;
+	// - resolveTenant: Middleware to select the tenant the request acts on.
+	standard := alice.New(app.recoverPanic, app.requestID, app.logRequest, app.authenticate, app.resolveTenant)
+
+	// Probes are polled every few seconds by the orchestrator, so they
+	// bypass logRequest to keep the request log readable
+	probes := alice.New(app.recoverPanic)
+
+	// Serve the probes next to the router with the 'standard' middleware chain
+	mux := http.NewServeMux()
+	mux.Handle("GET /healthz", probes.ThenFunc(app.healthz))
+	mux.Handle("GET /readyz", probes.ThenFunc(app.readyz))
+	mux.Handle("/", standard.Then(router))
+
+	return mux
+}
 
-	// Return the 'standard' middleware chain
-	return standard.Then(router)
+// Dispatches the requests of a wildcard route on the value of its parameter.
+// httprouter cannot register a static segment such as /receipts/process
+// next to a wildcard such as /receipts/:id/restore, so static paths are
+// served by the wildcard route. Requests for other values are served by
+// fallback, or get a 404 Not Found response when it is nil
+func (app *application) dispatchParam(param string, static map[string]http.Handler, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := httprouter.ParamsFromContext(r.Context()).ByName(param)
+		if handler, exists := static[value]; exists {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if fallback == nil {
+			app.helpers.NotFound(w)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
 }
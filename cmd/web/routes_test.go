@@ -48,3 +48,36 @@ func routeExists(router *httprouter.Router, testRoute, testMethod string, expect
 
 	return recorder.Code == expectedStatus
 }
+
+// Ensures that static segments served by a wildcard route reach their handler
+func Test_dispatchParam(t *testing.T) {
+	static := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	router := httprouter.New()
+	router.Handler(http.MethodPost, "/receipts/:id", app.dispatchParam("id", map[string]http.Handler{"process": static}, nil))
+	router.Handler(http.MethodGet, "/receipts/:id", app.dispatchParam("id", map[string]http.Handler{"export": static}, fallback))
+	router.Handler(http.MethodPost, "/receipts/:id/restore", fallback)
+
+	var registered = []struct {
+		route          string
+		method         string
+		expectedStatus int
+	}{
+		{"/receipts/process", "POST", http.StatusCreated},
+		{"/receipts/123", "POST", http.StatusNotFound},
+		{"/receipts/123/restore", "POST", http.StatusAccepted},
+		{"/receipts/export", "GET", http.StatusCreated},
+		{"/receipts/123", "GET", http.StatusAccepted},
+	}
+
+	for _, route := range registered {
+		if !routeExists(router, route.route, route.method, route.expectedStatus) {
+			t.Errorf("Expected %s %s to respond with %d", route.method, route.route, route.expectedStatus)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package analytics keeps running totals of the stored receipts per
+// tenant and purchase day, so that reports over a date range only add up
+// one bucket per day instead of reading every receipt.
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Metrics retailers can be ranked by
+const (
+	BySpend  = "spend"
+	ByPoints = "points"
+)
+
+const dateLayout = "2006-01-02"
+
+// Longest range reported day by day unless configured otherwise
+const DefaultMaxDays = 366
+
+var (
+	ErrInvalidRange = errors.New("the range must start no later than it ends")
+	ErrRangeTooLong = errors.New("the range spans too many days")
+)
+
+// Range selects purchase dates, both ends included. A zero end is unbounded
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Totals of a set of receipts
+type Totals struct {
+	Receipts int
+	Points   int
+	// Sum of the receipt totals, in cents
+	SpendCents int64
+}
+
+type Summary struct {
+	Totals
+	AveragePoints float64
+}
+
+type Day struct {
+	Date string
+	Totals
+}
+
+type Retailer struct {
+	Name string
+	Totals
+}
+
+// Receipts purchased during each hour of the day
+type Hours [24]int
+
+// Aggregates of the receipts purchased on a day
+type bucket struct {
+	totals    Totals
+	retailers map[string]*Totals
+	hours     Hours
+}
+
+// Aggregates observes a receipt store and maintains the totals of its
+// live receipts per tenant and purchase date
+type Aggregates struct {
+	// Most days a range can span
+	MaxDays int
+
+	mu      sync.RWMutex
+	tenants map[string]map[string]*bucket
+}
+
+func New() *Aggregates {
+	return &Aggregates{MaxDays: DefaultMaxDays, tenants: make(map[string]map[string]*bucket)}
+}
+
+// Adds the receipt to the totals of its purchase date
+func (a *Aggregates) ReceiptAdded(receipt models.Receipt) {
+	a.apply(receipt, 1)
+}
+
+// Takes the receipt out of the totals of its purchase date
+func (a *Aggregates) ReceiptRemoved(receipt models.Receipt) {
+	a.apply(receipt, -1)
+}
+
+func (a *Aggregates) apply(receipt models.Receipt, sign int) {
+	if _, err := time.Parse(dateLayout, receipt.PurchaseDate); err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	days, exists := a.tenants[receipt.TenantID]
+	if !exists {
+		days = make(map[string]*bucket)
+		a.tenants[receipt.TenantID] = days
+	}
+	day, exists := days[receipt.PurchaseDate]
+	if !exists {
+		day = &bucket{retailers: make(map[string]*Totals)}
+		days[receipt.PurchaseDate] = day
+	}
+
+	change := Totals{Receipts: sign, Points: sign * receipt.Points, SpendCents: int64(sign) * cents(receipt.Total)}
+	day.totals.add(change)
+
+	// Receipts stored before retailers were canonicalized fall back to the raw name
+	name := receipt.CanonicalRetailer
+	if name == "" {
+		name = strings.TrimSpace(receipt.Retailer)
+	}
+	retailer, exists := day.retailers[name]
+	if !exists {
+		retailer = &Totals{}
+		day.retailers[name] = retailer
+	}
+	retailer.add(change)
+	if retailer.Receipts == 0 {
+		delete(day.retailers, name)
+	}
+
+	if hour, err := strconv.Atoi(strings.SplitN(receipt.PurchaseTime, ":", 2)[0]); err == nil && hour >= 0 && hour < 24 {
+		day.hours[hour] += sign
+	}
+
+	if day.totals.Receipts == 0 {
+		delete(days, receipt.PurchaseDate)
+	}
+}
+
+// Returns the totals of the receipts of the tenant in the range
+func (a *Aggregates) Summary(tenantID string, r Range) Summary {
+	var summary Summary
+	a.each(tenantID, r, func(_ string, day *bucket) {
+		summary.add(day.totals)
+	})
+	if summary.Receipts > 0 {
+		summary.AveragePoints = math.Round(float64(summary.Points)/float64(summary.Receipts)*100) / 100
+	}
+	return summary
+}
+
+// Returns the totals of every day of the range, including days without
+// receipts. An unbounded range spans the days with receipts, and
+// ErrRangeTooLong is returned when they span more than MaxDays
+func (a *Aggregates) Days(tenantID string, r Range) ([]Day, error) {
+	totals := make(map[string]Totals)
+	first, last := "", ""
+	a.each(tenantID, r, func(date string, day *bucket) {
+		totals[date] = day.totals
+		if first == "" || date < first {
+			first = date
+		}
+		if date > last {
+			last = date
+		}
+	})
+
+	// Without receipts, an unbounded range spans no day
+	if first == "" && (r.From.IsZero() || r.To.IsZero()) {
+		return []Day{}, nil
+	}
+	start, end := r.From, r.To
+	if start.IsZero() {
+		start, _ = time.Parse(dateLayout, first)
+	}
+	if end.IsZero() {
+		end, _ = time.Parse(dateLayout, last)
+	}
+	if span := (Range{From: start, To: end}).Days(); a.MaxDays > 0 && span > a.MaxDays {
+		return nil, ErrRangeTooLong
+	}
+
+	days := []Day{}
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		key := date.Format(dateLayout)
+		days = append(days, Day{Date: key, Totals: totals[key]})
+	}
+	return days, nil
+}
+
+// Returns the retailers of the tenant with the most spend or points in
+// the range, at most limit of them
+func (a *Aggregates) TopRetailers(tenantID string, r Range, by string, limit int) []Retailer {
+	totals := make(map[string]*Totals)
+	a.each(tenantID, r, func(_ string, day *bucket) {
+		for name, retailer := range day.retailers {
+			if totals[name] == nil {
+				totals[name] = &Totals{}
+			}
+			totals[name].add(*retailer)
+		}
+	})
+
+	retailers := make([]Retailer, 0, len(totals))
+	for name, total := range totals {
+		retailers = append(retailers, Retailer{Name: name, Totals: *total})
+	}
+
+	metric := func(retailer Retailer) int64 {
+		if by == ByPoints {
+			return int64(retailer.Points)
+		}
+		return retailer.SpendCents
+	}
+	sort.Slice(retailers, func(i, j int) bool {
+		if metric(retailers[i]) != metric(retailers[j]) {
+			return metric(retailers[i]) > metric(retailers[j])
+		}
+		return retailers[i].Name < retailers[j].Name
+	})
+
+	if limit > 0 && len(retailers) > limit {
+		retailers = retailers[:limit]
+	}
+	return retailers
+}
+
+// Returns the number of receipts of the tenant purchased during each hour of the day
+func (a *Aggregates) Hours(tenantID string, r Range) Hours {
+	var hours Hours
+	a.each(tenantID, r, func(_ string, day *bucket) {
+		for hour, receipts := range day.hours {
+			hours[hour] += receipts
+		}
+	})
+	return hours
+}
+
+// Calls fn with every day of the tenant in the range
+func (a *Aggregates) each(tenantID string, r Range, fn func(date string, day *bucket)) {
+	from, to := "", ""
+	if !r.From.IsZero() {
+		from = r.From.Format(dateLayout)
+	}
+	if !r.To.IsZero() {
+		to = r.To.Format(dateLayout)
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	// Dates in the layout sort like the days they name
+	for date, day := range a.tenants[tenantID] {
+		if (from != "" && date < from) || (to != "" && date > to) {
+			continue
+		}
+		fn(date, day)
+	}
+}
+
+// Checks that the range does not end before it starts
+func (r Range) Validate() error {
+	if !r.From.IsZero() && !r.To.IsZero() && r.To.Before(r.From) {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// Returns the number of days of a bounded range, both ends included,
+// and 0 when either end is unbounded
+func (r Range) Days() int {
+	if r.From.IsZero() || r.To.IsZero() {
+		return 0
+	}
+	// Durations overflow past 292 years, seconds do not
+	return int((r.To.Unix()-r.From.Unix())/(24*60*60)) + 1
+}
+
+func (t *Totals) add(other Totals) {
+	t.Receipts += other.Receipts
+	t.Points += other.Points
+	t.SpendCents += other.SpendCents
+}
+
+// Returns the amount in cents, or 0 when it is not a number
+func cents(amount string) int64 {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(value * 100))
+}
+
+// Formats an amount in cents like receipt totals
+func FormatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return sign + strconv.FormatInt(cents/100, 10) + "." + strconv.FormatInt(cents%100/10, 10) + strconv.FormatInt(cents%10, 10)
+}
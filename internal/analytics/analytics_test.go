@@ -0,0 +1,173 @@
+package analytics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+func date(value string) time.Time {
+	parsed, _ := time.Parse(dateLayout, value)
+	return parsed
+}
+
+// Fills a store observed by the aggregates
+func observedStore() (*models.ReceiptStore, *Aggregates) {
+	store := models.NewStore()
+	aggregates := New()
+	store.Observe(aggregates)
+
+	store.Insert(models.Receipt{ID: "a", Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "35.35", Points: 28})
+	store.Insert(models.Receipt{ID: "b", Retailer: "Target ", PurchaseDate: "2022-01-03", PurchaseTime: "14:33", Total: "1.25", Points: 31})
+	store.Insert(models.Receipt{ID: "c", Retailer: "M&M Corner Market", PurchaseDate: "2022-01-03", PurchaseTime: "14:33", Total: "9.00", Points: 109})
+	store.Insert(models.Receipt{ID: "d", TenantID: "brand-a", Retailer: "Costco", PurchaseDate: "2022-01-01", PurchaseTime: "09:00", Total: "100.00", Points: 6})
+	return store, aggregates
+}
+
+func TestSummary(t *testing.T) {
+	_, aggregates := observedStore()
+
+	tests := []struct {
+		name     string
+		r        Range
+		expected Summary
+	}{
+		{"Unbounded", Range{}, Summary{Totals{3, 168, 4560}, 56}},
+		{"From", Range{From: date("2022-01-02")}, Summary{Totals{2, 140, 1025}, 70}},
+		{"To", Range{To: date("2022-01-01")}, Summary{Totals{1, 28, 3535}, 28}},
+		{"Empty", Range{From: date("2023-01-01")}, Summary{}},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if summary := aggregates.Summary(models.DefaultTenantID, entry.r); summary != entry.expected {
+				t.Errorf("Expected %+v, received %+v", entry.expected, summary)
+			}
+		})
+	}
+}
+
+func TestDays(t *testing.T) {
+	_, aggregates := observedStore()
+
+	expected := []Day{
+		{"2022-01-01", Totals{1, 28, 3535}},
+		{"2022-01-02", Totals{}},
+		{"2022-01-03", Totals{2, 140, 1025}},
+	}
+	if days, _ := aggregates.Days(models.DefaultTenantID, Range{}); !reflect.DeepEqual(days, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, days)
+	}
+
+	days, _ := aggregates.Days("brand-b", Range{From: date("2022-01-01"), To: date("2022-01-02")})
+	if len(days) != 2 || days[1].Receipts != 0 {
+		t.Errorf("Expected 2 empty days for a tenant without receipts, received %+v", days)
+	}
+	if days, _ := aggregates.Days("brand-b", Range{}); len(days) != 0 {
+		t.Errorf("Expected no days for a tenant without receipts, received %+v", days)
+	}
+
+	// Half-open ranges are limited by the days they reach
+	aggregates.MaxDays = 3
+	if _, err := aggregates.Days(models.DefaultTenantID, Range{To: date("2022-01-03")}); err != nil {
+		t.Errorf("Expected 3 days to be reported, received %v", err)
+	}
+	if _, err := aggregates.Days(models.DefaultTenantID, Range{From: date("2000-01-01")}); !errors.Is(err, ErrRangeTooLong) {
+		t.Errorf("Expected %v, received %v", ErrRangeTooLong, err)
+	}
+}
+
+func TestRangeDays(t *testing.T) {
+	tests := []struct {
+		r        Range
+		expected int
+	}{
+		{Range{}, 0},
+		{Range{From: date("2022-01-01")}, 0},
+		{Range{From: date("2022-01-01"), To: date("2022-01-01")}, 1},
+		{Range{From: date("2024-01-01"), To: date("2024-12-31")}, 366},
+		{Range{From: date("0001-01-02"), To: date("9999-12-31")}, 3652058},
+	}
+
+	for _, entry := range tests {
+		if days := entry.r.Days(); days != entry.expected {
+			t.Errorf("Expected %+v to span %d days, received %d", entry.r, entry.expected, days)
+		}
+	}
+}
+
+func TestTopRetailers(t *testing.T) {
+	_, aggregates := observedStore()
+
+	bySpend := aggregates.TopRetailers(models.DefaultTenantID, Range{}, BySpend, 0)
+	expected := []Retailer{{"Target", Totals{2, 59, 3660}}, {"M&M Corner Market", Totals{1, 109, 900}}}
+	if !reflect.DeepEqual(bySpend, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, bySpend)
+	}
+
+	byPoints := aggregates.TopRetailers(models.DefaultTenantID, Range{}, ByPoints, 1)
+	if len(byPoints) != 1 || byPoints[0].Name != "M&M Corner Market" {
+		t.Errorf("Expected M&M Corner Market to lead by points, received %+v", byPoints)
+	}
+}
+
+// Ensures that retailers are grouped under their canonical name when it is known
+func TestTopRetailersCanonical(t *testing.T) {
+	store, aggregates := observedStore()
+	store.Insert(models.Receipt{ID: "e", Retailer: "TARGET STORE #123", CanonicalRetailer: "Target", PurchaseDate: "2022-01-03", PurchaseTime: "10:00", Total: "2.00", Points: 10})
+
+	top := aggregates.TopRetailers(models.DefaultTenantID, Range{}, BySpend, 1)
+	if len(top) != 1 || top[0].Name != "Target" || top[0].Receipts != 3 {
+		t.Errorf("Expected the three Target receipts to be grouped, received %+v", top)
+	}
+}
+
+func TestHours(t *testing.T) {
+	_, aggregates := observedStore()
+
+	hours := aggregates.Hours(models.DefaultTenantID, Range{})
+	if hours[13] != 1 || hours[14] != 2 || hours[9] != 0 {
+		t.Errorf("Unexpected hours %v", hours)
+	}
+}
+
+// Ensures that the aggregates follow updates, deletions, restores and evictions
+func TestAggregatesFollowTheStore(t *testing.T) {
+	store, aggregates := observedStore()
+
+	store.Update(models.Receipt{ID: "a", Retailer: "Walgreens", PurchaseDate: "2022-01-02", PurchaseTime: "08:00", Total: "5.00", Points: 10}, 1)
+	store.Delete(models.DefaultTenantID, "c")
+
+	if summary := aggregates.Summary(models.DefaultTenantID, Range{}); summary.Totals != (Totals{2, 41, 625}) {
+		t.Errorf("Expected the update and deletion to be applied, received %+v", summary)
+	}
+	if top := aggregates.TopRetailers(models.DefaultTenantID, Range{}, BySpend, 0); len(top) != 2 || top[0].Name != "Walgreens" {
+		t.Errorf("Expected Walgreens and Target, received %+v", top)
+	}
+
+	store.Restore(models.DefaultTenantID, "c")
+	store.Evict(models.DefaultTenantID, "b")
+	if summary := aggregates.Summary(models.DefaultTenantID, Range{}); summary.Totals != (Totals{2, 119, 1400}) {
+		t.Errorf("Expected the restore and eviction to be applied, received %+v", summary)
+	}
+
+	store.Replace(nil)
+	if summary := aggregates.Summary(models.DefaultTenantID, Range{}); summary != (Summary{}) {
+		t.Errorf("Expected no receipt after replacing the store, received %+v", summary)
+	}
+	if summary := aggregates.Summary("brand-a", Range{}); summary != (Summary{}) {
+		t.Errorf("Expected the other tenant to be emptied too, received %+v", summary)
+	}
+}
+
+func TestFormatCents(t *testing.T) {
+	tests := map[int64]string{0: "0.00", 5: "0.05", 4560: "45.60", -125: "-1.25"}
+	for cents, expected := range tests {
+		if received := FormatCents(cents); received != expected {
+			t.Errorf("Expected %d to be %s, received %s", cents, expected, received)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audited actions
+const (
+	ActionReceiptInsert    = "receipt.insert"
+	ActionReceiptUpdate    = "receipt.update"
+	ActionReceiptDelete    = "receipt.delete"
+	ActionReceiptRestore   = "receipt.restore"
+	ActionReceiptEvict     = "receipt.evict"
+	ActionReceiptPurge     = "receipt.purge"
+	ActionPointsAdjustment = "points.adjustment"
+	ActionPointsRedemption = "points.redemption"
+	ActionPointsEarn       = "points.earn"
+	ActionPointsReversal   = "points.reversal"
+	ActionPointsExpiry     = "points.expiry"
+	ActionMemberTier       = "member.tier"
+	ActionStoreRestore     = "store.restore"
+)
+
+// Previous hash of the first event of a log
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+var (
+	ErrBrokenChain = errors.New("audit chain is broken")
+	ErrTruncated   = errors.New("audit log is truncated")
+)
+
+// Event records a single mutation. Each event carries the hash of the
+// previous one, so that changing, removing or reordering events breaks
+// the chain of every event that follows
+type Event struct {
+	Sequence  int       `json:"sequence"`
+	Time      time.Time `json:"time"`
+	TenantID  string    `json:"tenantId"`
+	Principal string    `json:"principal"`
+	RequestID string    `json:"requestId,omitempty"`
+	Action    string    `json:"action"`
+	// Mutated resource, such as receipt:<id> or member:<id>
+	Resource string `json:"resource"`
+	// Hashes of the resource state before and after the mutation,
+	// empty when the resource did not exist
+	BeforeHash string `json:"beforeHash,omitempty"`
+	AfterHash  string `json:"afterHash,omitempty"`
+	PrevHash   string `json:"prevHash"`
+	Hash       string `json:"hash"`
+}
+
+// Filter selects events, empty fields match every event
+type Filter struct {
+	TenantID  string
+	Principal string
+	Action    string
+	Resource  string
+	RequestID string
+	Since     time.Time
+	Until     time.Time
+	// Maximum number of events returned, unlimited when zero
+	Limit int
+}
+
+// Checkpoint is the sequence and hash of the last event written to a
+// persisted log. Removing events from the end of the log leaves a valid
+// chain, so the checkpoint is kept in a file next to the log to detect it
+type Checkpoint struct {
+	Sequence int    `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// Log is an append-only, hash-chained journal of events, optionally
+// persisted to a file as one JSON event per line
+type Log struct {
+	mu     sync.RWMutex
+	events []Event
+	file   *os.File
+	// Size of the file up to the last event written,
+	// and the path of its checkpoint
+	size       int64
+	checkpoint string
+	// Bytes of a torn final line dropped when the file was opened
+	repaired int
+	now      func() time.Time
+}
+
+// Creates a log kept in memory only
+func NewLog() *Log {
+	return &Log{now: time.Now}
+}
+
+// Opens the log persisted at path, creating the file if needed.
+// Existing events are verified against the chain and the checkpoint and
+// loaded, new events are appended to the file.
+//
+// A crash while an event was written leaves a torn final line. That event
+// was never recorded, so the line is dropped from the file
+func OpenLog(path string) (*Log, error) {
+	auditLog := NewLog()
+	auditLog.checkpoint = CheckpointPath(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// Every recorded event ends with a newline
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	auditLog.events, err = ReadEvents(bytes.NewReader(data[:complete]))
+	if err != nil {
+		return nil, fmt.Errorf("load audit log: %w", err)
+	}
+	if err := VerifyEvents(auditLog.events); err != nil {
+		return nil, fmt.Errorf("load audit log: %w", err)
+	}
+	checkpoint, err := ReadCheckpoint(auditLog.checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("load audit checkpoint: %w", err)
+	}
+	if err := VerifyCheckpoint(auditLog.events, checkpoint); err != nil {
+		return nil, fmt.Errorf("load audit log: %w", err)
+	}
+
+	if complete < len(data) {
+		if err := os.Truncate(path, int64(complete)); err != nil {
+			return nil, err
+		}
+		auditLog.repaired = len(data) - complete
+	}
+
+	auditLog.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	auditLog.size = int64(complete)
+
+	// The log is ahead of its checkpoint when the server stopped between
+	// writing an event and its checkpoint, or no checkpoint was written yet
+	if len(auditLog.events) > checkpoint.Sequence {
+		if err := auditLog.writeCheckpoint(); err != nil {
+			auditLog.file.Close()
+			return nil, err
+		}
+	}
+
+	return auditLog, nil
+}
+
+// Returns the number of bytes of a torn final line dropped when the log was opened
+func (l *Log) Repaired() int {
+	return l.repaired
+}
+
+// Closes the file the log is persisted to
+func (l *Log) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Appends the event to the log and returns it with its sequence, time and hashes set
+func (l *Log) Record(event Event) (Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Sequence = len(l.events) + 1
+	event.Time = l.now().UTC()
+	event.PrevHash = GenesisHash
+	if len(l.events) > 0 {
+		event.PrevHash = l.events[len(l.events)-1].Hash
+	}
+	event.Hash = event.computeHash()
+
+	if l.file == nil {
+		l.events = append(l.events, event)
+		return event, nil
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return Event{}, err
+	}
+	line = append(line, '\n')
+	// Only events written to the file become part of the chain.
+	// A partly written event is cut off, so that the next one starts a new line
+	_, err = l.file.Write(line)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		l.file.Truncate(l.size)
+		return Event{}, err
+	}
+	l.size += int64(len(line))
+	l.events = append(l.events, event)
+
+	if err := l.writeCheckpoint(); err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
+
+// Replaces the checkpoint with the last event of the log
+func (l *Log) writeCheckpoint() error {
+	last := l.events[len(l.events)-1]
+	data, err := json.Marshal(Checkpoint{Sequence: last.Sequence, Hash: last.Hash})
+	if err != nil {
+		return err
+	}
+
+	// Written aside and renamed, so that a crash never leaves a torn checkpoint
+	temp := l.checkpoint + ".tmp"
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("write audit checkpoint: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, l.checkpoint)
+	}
+	if err != nil {
+		return fmt.Errorf("write audit checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Returns the events matching the filter, most recent first
+func (l *Log) Events(filter Filter) []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var events []Event
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		if filter.matches(l.events[i]) {
+			events = append(events, l.events[i])
+		}
+	}
+
+	return events
+}
+
+// Verifies the chain of the events held by the log
+func (l *Log) Verify() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return VerifyEvents(l.events)
+}
+
+func (f Filter) matches(event Event) bool {
+	switch {
+	case f.TenantID != "" && event.TenantID != f.TenantID:
+		return false
+	case f.Principal != "" && event.Principal != f.Principal:
+		return false
+	case f.Action != "" && event.Action != f.Action:
+		return false
+	case f.Resource != "" && event.Resource != f.Resource:
+		return false
+	case f.RequestID != "" && event.RequestID != f.RequestID:
+		return false
+	case !f.Since.IsZero() && event.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !event.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Returns the SHA-256 hash of the event with its own hash left empty
+func (e Event) computeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the hex SHA-256 hash of the JSON encoding of a resource state,
+// or an empty string for a nil state
+func HashState(state any) string {
+	if state == nil {
+		return ""
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Reads events written one JSON event per line
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+// Returns the path of the checkpoint kept next to the log at path
+func CheckpointPath(path string) string {
+	return path + ".head"
+}
+
+// Reads the checkpoint at path, or returns a zero checkpoint when there is none
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	var checkpoint Checkpoint
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, err
+	}
+
+	err = json.Unmarshal(data, &checkpoint)
+	return checkpoint, err
+}
+
+// Verifies that the events reach the checkpoint and that the event
+// at the checkpoint is the one it recorded
+func VerifyCheckpoint(events []Event, checkpoint Checkpoint) error {
+	switch {
+	case checkpoint.Sequence == 0:
+		return nil
+	case len(events) < checkpoint.Sequence:
+		return fmt.Errorf("%w: the log ends at event %d, the checkpoint is at event %d", ErrTruncated, len(events), checkpoint.Sequence)
+	case events[checkpoint.Sequence-1].Hash != checkpoint.Hash:
+		return fmt.Errorf("%w: event %d does not match the checkpoint", ErrBrokenChain, checkpoint.Sequence)
+	}
+	return nil
+}
+
+// Verifies that the events form an unbroken chain from the start of the log
+func VerifyEvents(events []Event) error {
+	prevHash := GenesisHash
+	for i, event := range events {
+		switch {
+		case event.Sequence != i+1:
+			return fmt.Errorf("%w: event %d has sequence %d", ErrBrokenChain, i+1, event.Sequence)
+		case event.PrevHash != prevHash:
+			return fmt.Errorf("%w: event %d does not follow event %d", ErrBrokenChain, event.Sequence, i)
+		case event.Hash != event.computeHash():
+			return fmt.Errorf("%w: event %d was modified", ErrBrokenChain, event.Sequence)
+		}
+		prevHash = event.Hash
+	}
+	return nil
+}
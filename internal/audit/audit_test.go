@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Records an event for every action on receipt-1, one minute apart
+func setupTestLog(t *testing.T, auditLog *Log, actions ...string) {
+	t.Helper()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auditLog.now = func() time.Time { return now }
+
+	for _, action := range actions {
+		_, err := auditLog.Record(Event{TenantID: "default", Principal: "apikey:ops", Action: action, Resource: "receipt:receipt-1"})
+		if err != nil {
+			t.Fatalf("Failed to record event: %v", err)
+		}
+		now = now.Add(time.Minute)
+	}
+}
+
+func TestRecordChainsEvents(t *testing.T) {
+	auditLog := NewLog()
+	setupTestLog(t, auditLog, ActionReceiptInsert, ActionReceiptUpdate, ActionReceiptDelete)
+
+	events := auditLog.Events(Filter{})
+	if len(events) != 3 || events[0].Action != ActionReceiptDelete {
+		t.Fatalf("Expected three events, most recent first, received %+v", events)
+	}
+	if events[2].PrevHash != GenesisHash || events[1].PrevHash != events[2].Hash {
+		t.Errorf("Expected every event to carry the hash of the previous one")
+	}
+	if err := auditLog.Verify(); err != nil {
+		t.Errorf("Expected an intact chain, received %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(events []Event) []Event
+	}{
+		{"Modified event", func(events []Event) []Event {
+			events[1].Principal = "apikey:someone-else"
+			return events
+		}},
+		{"Removed event", func(events []Event) []Event {
+			return append(events[:1], events[2:]...)
+		}},
+		{"Reordered events", func(events []Event) []Event {
+			events[0], events[1] = events[1], events[0]
+			return events
+		}},
+		{"Rehashed event", func(events []Event) []Event {
+			events[1].Action = ActionReceiptDelete
+			events[1].Hash = events[1].computeHash()
+			return events
+		}},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			auditLog := NewLog()
+			setupTestLog(t, auditLog, ActionReceiptInsert, ActionReceiptUpdate, ActionReceiptDelete)
+
+			events := entry.tamper(append([]Event(nil), auditLog.events...))
+			if err := VerifyEvents(events); !errors.Is(err, ErrBrokenChain) {
+				t.Errorf("Expected %v, received %v", ErrBrokenChain, err)
+			}
+		})
+	}
+}
+
+func TestOpenLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, err := OpenLog(path)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	setupTestLog(t, auditLog, ActionReceiptInsert, ActionReceiptUpdate)
+	auditLog.Close()
+
+	// Reopening the log continues the chain
+	auditLog, err = OpenLog(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen log: %v", err)
+	}
+	setupTestLog(t, auditLog, ActionReceiptDelete)
+	auditLog.Close()
+
+	data, _ := os.ReadFile(path)
+	events, err := ReadEvents(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events in the file, received %d", len(events))
+	}
+	if err := VerifyEvents(events); err != nil {
+		t.Errorf("Expected an intact chain, received %v", err)
+	}
+
+	// A tampered file is refused
+	events[0].Principal = "apikey:someone-else"
+	var tampered bytes.Buffer
+	for _, event := range events {
+		line, _ := json.Marshal(event)
+		tampered.Write(append(line, '\n'))
+	}
+	os.WriteFile(path, tampered.Bytes(), 0o600)
+	if _, err := OpenLog(path); !errors.Is(err, ErrBrokenChain) {
+		t.Errorf("Expected %v, received %v", ErrBrokenChain, err)
+	}
+}
+
+func TestEventsFilter(t *testing.T) {
+	auditLog := NewLog()
+	setupTestLog(t, auditLog, ActionReceiptInsert, ActionReceiptUpdate, ActionReceiptUpdate, ActionReceiptDelete)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected int
+	}{
+		{"No filter", Filter{}, 4},
+		{"Action", Filter{Action: ActionReceiptUpdate}, 2},
+		{"Principal", Filter{Principal: "apikey:other"}, 0},
+		{"Tenant", Filter{TenantID: "default"}, 4},
+		{"Time range", Filter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, 2},
+		{"Limit", Filter{Limit: 3}, 3},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if events := auditLog.Events(entry.filter); len(events) != entry.expected {
+				t.Errorf("Expected %d events, received %d", entry.expected, len(events))
+			}
+		})
+	}
+}
+
+func TestOpenLogDetectsTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, _ := OpenLog(path)
+	setupTestLog(t, auditLog, ActionReceiptInsert, ActionReceiptUpdate, ActionReceiptDelete)
+	auditLog.Close()
+
+	// Dropping the last event leaves a valid chain behind the checkpoint
+	data, _ := os.ReadFile(path)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	os.WriteFile(path, bytes.Join(lines[:2], nil), 0o600)
+	if _, err := OpenLog(path); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected %v, received %v", ErrTruncated, err)
+	}
+
+	// So does removing the log altogether
+	os.Remove(path)
+	if _, err := OpenLog(path); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected %v, received %v", ErrTruncated, err)
+	}
+
+	checkpoint, err := ReadCheckpoint(CheckpointPath(path))
+	if err != nil || checkpoint.Sequence != 3 {
+		t.Errorf("Expected the checkpoint at event 3, received %+v and %v", checkpoint, err)
+	}
+}
+
+func TestOpenLogRepairsTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, _ := OpenLog(path)
+	setupTestLog(t, auditLog, ActionReceiptInsert, ActionReceiptUpdate)
+	auditLog.Close()
+
+	// A crash while writing the third event leaves part of its line
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	file.WriteString(`{"sequence":3,"time":"2024-01-`)
+	file.Close()
+
+	auditLog, err := OpenLog(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen log: %v", err)
+	}
+	if auditLog.Repaired() == 0 {
+		t.Errorf("Expected the torn line to be reported")
+	}
+	setupTestLog(t, auditLog, ActionReceiptDelete)
+	auditLog.Close()
+
+	data, _ := os.ReadFile(path)
+	events, err := ReadEvents(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+	if len(events) != 3 || events[2].Action != ActionReceiptDelete {
+		t.Fatalf("Expected the event after the torn line to be readable, received %+v", events)
+	}
+	if err := VerifyEvents(events); err != nil {
+		t.Errorf("Expected an intact chain, received %v", err)
+	}
+}
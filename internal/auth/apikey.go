@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const hashPrefix = "sha256:"
+
+// APIKey is an entry of the keys file. Only the hash of the key is stored
+type APIKey struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// KeyStore authenticates requests by API key
+type KeyStore struct {
+	keys map[string]APIKey
+}
+
+// Returns the hash of an API key in the form stored in the keys file
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+func NewKeyStore(keys []APIKey) (*KeyStore, error) {
+	store := &KeyStore{keys: make(map[string]APIKey)}
+
+	for _, key := range keys {
+		hash := strings.ToLower(key.Hash)
+		if key.ID == "" {
+			return nil, fmt.Errorf("api key without an id")
+		}
+		digest, found := strings.CutPrefix(hash, hashPrefix)
+		if _, err := hex.DecodeString(digest); !found || err != nil || len(digest) != sha256.Size*2 {
+			return nil, fmt.Errorf("api key %s: hash must be sha256: followed by %d hex characters", key.ID, sha256.Size*2)
+		}
+		if _, exists := store.keys[hash]; exists {
+			return nil, fmt.Errorf("api key %s: duplicate hash", key.ID)
+		}
+		key.Hash = hash
+		store.keys[hash] = key
+	}
+
+	return store, nil
+}
+
+// Loads API keys from a JSON file in the form {"keys": [{"id", "hash", "scopes", "tenant"}]}
+func LoadKeyStore(path string) (*KeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse api keys file: %w", err)
+	}
+
+	return NewKeyStore(file.Keys)
+}
+
+// Returns the principal the API key belongs to
+func (s *KeyStore) Authenticate(key string) (*Principal, error) {
+	// Keys are looked up by hash, so lookup timing reveals nothing about the key itself
+	apiKey, exists := s.keys[HashKey(key)]
+	if !exists {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		ID:     apiKey.ID,
+		Method: "api-key",
+		Scopes: apiKey.Scopes,
+		Tenant: apiKey.Tenant,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyStore(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []APIKey
+		err  bool
+	}{
+		{"Valid key", []APIKey{{ID: "partner", Hash: HashKey("secret")}}, false},
+		{"Uppercase hash", []APIKey{{ID: "partner", Hash: strings.ToUpper(HashKey("secret"))}}, false},
+		{"Missing id", []APIKey{{Hash: HashKey("secret")}}, true},
+		{"Plain text key", []APIKey{{ID: "partner", Hash: "secret"}}, true},
+		{"Short hash", []APIKey{{ID: "partner", Hash: HashKey("secret")[:40]}}, true},
+		{"Non hex hash", []APIKey{{ID: "partner", Hash: hashPrefix + strings.Repeat("zz", 32)}}, true},
+		{"Duplicate key", []APIKey{{ID: "a", Hash: HashKey("secret")}, {ID: "b", Hash: HashKey("secret")}}, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			_, err := NewKeyStore(entry.keys)
+			if entry.err && err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+			if err != nil && entry.keys[0].ID != "" && !strings.Contains(err.Error(), entry.keys[len(entry.keys)-1].ID) {
+				t.Errorf("Expected the error to name the key, received %v", err)
+			}
+			if !entry.err && err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := `{"keys": [{"id": "partner", "hash": "` + HashKey("secret") + `", "scopes": ["receipts:read"]}]}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+
+	store, err := LoadKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to load keys file: %v", err)
+	}
+
+	principal, err := store.Authenticate("secret")
+	if err != nil {
+		t.Fatalf("Expected key to authenticate, got %v", err)
+	}
+	if principal.ID != "partner" || !principal.HasScope(ScopeReceiptsRead) {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	if _, err := LoadKeyStore(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	store, err := NewKeyStore([]APIKey{{ID: "partner", Hash: HashKey("secret"), Scopes: []string{ScopeReceiptsWrite}}})
+	if err != nil {
+		t.Fatalf("Failed to create key store: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{"Valid key", "secret", nil},
+		{"Invalid key", "guess", ErrInvalidCredentials},
+		{"Key hash instead of key", HashKey("secret"), ErrInvalidCredentials},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			_, err := store.Authenticate(entry.key)
+			if err != entry.err {
+				t.Errorf("Expected %v, received %v", entry.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// Permissions granted to a principal
+const (
+	ScopeReceiptsWrite  = "receipts:write"
+	ScopeReceiptsRead   = "receipts:read"
+	ScopeReceiptsDelete = "receipts:delete"
+	ScopeMembersWrite   = "members:write"
+	ScopeMembersRead    = "members:read"
+	ScopeWebhooks       = "webhooks:manage"
+	ScopeAnalyticsRead  = "analytics:read"
+	// Grants every other scope
+	ScopeAdmin = "admin"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes"`
+	// Tenant the principal is bound to, empty if not bound to one
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Returns the name recorded for actions taken by the principal
+func (p *Principal) Name() string {
+	if p == nil {
+		return "anonymous"
+	}
+	return p.Method + ":" + p.ID
+}
+
+// Returns true if the principal was granted the scope, or is an admin
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+type contextKey string
+
+const principalKey = contextKey("principal")
+
+// Returns a copy of the context carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// Returns the principal stored in the context, or nil for anonymous requests
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey).(*Principal)
+	return principal
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		scope     string
+		expected  bool
+	}{
+		{"Granted scope", &Principal{Scopes: []string{ScopeReceiptsRead}}, ScopeReceiptsRead, true},
+		{"Missing scope", &Principal{Scopes: []string{ScopeReceiptsRead}}, ScopeReceiptsDelete, false},
+		{"Admin", &Principal{Scopes: []string{ScopeAdmin}}, ScopeReceiptsDelete, true},
+		{"Anonymous", nil, ScopeReceiptsRead, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if result := entry.principal.HasScope(entry.scope); result != entry.expected {
+				t.Errorf("Expected %t, received %t", entry.expected, result)
+			}
+		})
+	}
+}
+
+func TestPrincipalFromContext(t *testing.T) {
+	if principal := PrincipalFromContext(context.Background()); principal != nil {
+		t.Errorf("Expected no principal, received %+v", principal)
+	}
+
+	principal := &Principal{ID: "partner"}
+	ctx := WithPrincipal(context.Background(), principal)
+	if received := PrincipalFromContext(ctx); received != principal {
+		t.Errorf("Expected %+v, received %+v", principal, received)
+	}
+}
@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrTokenExpired = errors.New("token expired")
+
+// JWK is a key of a JSON Web Key Set, see RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	// Symmetric key
+	K string `json:"k"`
+	// RSA public key
+	N string `json:"n"`
+	E string `json:"e"`
+	// Ed25519 public key
+	X string `json:"x"`
+}
+
+// JWTConfig describes which tokens are accepted and how their roles map to scopes
+type JWTConfig struct {
+	// Path to the JWKS file, relative to the config file
+	JWKS     string `json:"jwks"`
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// Name of the claim holding the roles, "roles" by default
+	RolesClaim string `json:"rolesClaim"`
+	// Name of the claim holding the tenant, "tenant" by default
+	TenantClaim string `json:"tenantClaim"`
+	// Scopes granted by each role
+	Roles map[string][]string `json:"roles"`
+	// Allowed clock skew, e.g. "30s"
+	Leeway string `json:"leeway"`
+}
+
+// JWTVerifier authenticates requests by bearer token
+type JWTVerifier struct {
+	keys        []verificationKey
+	issuer      string
+	audience    string
+	rolesClaim  string
+	tenantClaim string
+	roles       map[string][]string
+	leeway      time.Duration
+	now         func() time.Time
+}
+
+type verificationKey struct {
+	kid string
+	alg string
+	key any
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Loads the JWT config and the JWKS file it points to
+func LoadJWTVerifier(path string) (*JWTVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config JWTConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse jwt config: %w", err)
+	}
+	if config.JWKS == "" {
+		return nil, fmt.Errorf("jwt config: jwks path is required")
+	}
+
+	jwksPath := config.JWKS
+	if !filepath.IsAbs(jwksPath) {
+		jwksPath = filepath.Join(filepath.Dir(path), jwksPath)
+	}
+	jwks, err := os.ReadFile(jwksPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var keySet struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &keySet); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	return NewJWTVerifier(config, keySet.Keys)
+}
+
+func NewJWTVerifier(config JWTConfig, jwks []JWK) (*JWTVerifier, error) {
+	verifier := &JWTVerifier{
+		issuer:      config.Issuer,
+		audience:    config.Audience,
+		rolesClaim:  config.RolesClaim,
+		tenantClaim: config.TenantClaim,
+		roles:       config.Roles,
+		now:         time.Now,
+	}
+	if verifier.rolesClaim == "" {
+		verifier.rolesClaim = "roles"
+	}
+	if verifier.tenantClaim == "" {
+		verifier.tenantClaim = "tenant"
+	}
+	if config.Leeway != "" {
+		leeway, err := time.ParseDuration(config.Leeway)
+		if err != nil {
+			return nil, fmt.Errorf("jwt config: invalid leeway: %w", err)
+		}
+		verifier.leeway = leeway
+	}
+
+	for _, jwk := range jwks {
+		key, err := parseJWK(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: %w", jwk.Kid, err)
+		}
+		verifier.keys = append(verifier.keys, key)
+	}
+	if len(verifier.keys) == 0 {
+		return nil, fmt.Errorf("jwks contains no keys")
+	}
+
+	return verifier, nil
+}
+
+// Converts a JWK into a key usable for verification. Each key is bound
+// to a single algorithm so that a token cannot pick a weaker one
+func parseJWK(jwk JWK) (verificationKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "oct":
+		secret, err := decode(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return verificationKey{}, fmt.Errorf("invalid symmetric key")
+		}
+		return verificationKey{kid: jwk.Kid, alg: AlgHS256, key: secret}, nil
+
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid RSA modulus")
+		}
+		e, err := decode(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return verificationKey{}, fmt.Errorf("invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if key.N.BitLen() < 2048 {
+			return verificationKey{}, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return verificationKey{kid: jwk.Kid, alg: AlgRS256, key: key}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, fmt.Errorf("invalid Ed25519 key")
+		}
+		return verificationKey{kid: jwk.Kid, alg: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+	}
+
+	return verificationKey{}, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// Verifies the token signature and claims, and returns the principal it was issued to
+func (v *JWTVerifier) Authenticate(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	if !v.verifySignature(header, signingInput, signature) {
+		return nil, ErrInvalidCredentials
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return v.principal(claims)
+}
+
+// Returns true if one of the keys matching the header produced the signature
+func (v *JWTVerifier) verifySignature(header jwtHeader, signingInput, signature []byte) bool {
+	for _, key := range v.keys {
+		if key.alg != header.Alg || (header.Kid != "" && key.kid != header.Kid) {
+			continue
+		}
+
+		switch key.alg {
+		case AlgHS256:
+			mac := hmac.New(sha256.New, key.key.([]byte))
+			mac.Write(signingInput)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case AlgRS256:
+			hash := sha256.Sum256(signingInput)
+			if rsa.VerifyPKCS1v15(key.key.(*rsa.PublicKey), crypto.SHA256, hash[:], signature) == nil {
+				return true
+			}
+		case AlgEdDSA:
+			if ed25519.Verify(key.key.(ed25519.PublicKey), signingInput, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validates the registered claims and maps the roles claim to scopes
+func (v *JWTVerifier) principal(claims map[string]any) (*Principal, error) {
+	now := v.now()
+
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if now.After(exp.Add(v.leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(v.leeway).Before(nbf) {
+		return nil, ErrInvalidCredentials
+	}
+
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, ErrInvalidCredentials
+	}
+	if v.audience != "" && !slices.Contains(stringsClaim(claims, "aud"), v.audience) {
+		return nil, ErrInvalidCredentials
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	principal := &Principal{
+		ID:     subject,
+		Method: "jwt",
+		Roles:  stringsClaim(claims, v.rolesClaim),
+	}
+	principal.Tenant, _ = claims[v.tenantClaim].(string)
+	for _, role := range principal.Roles {
+		for _, scope := range v.roles[role] {
+			if !slices.Contains(principal.Scopes, scope) {
+				principal.Scopes = append(principal.Scopes, scope)
+			}
+		}
+	}
+
+	return principal, nil
+}
+
+// Decodes a base64url encoded JSON segment of the token
+func decodeSegment(segment string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(dst)
+}
+
+// Returns a NumericDate claim as time
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	number, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// Returns a claim that is either a list of strings or a space separated string
+func stringsClaim(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		var values []string
+		for _, entry := range value {
+			if s, ok := entry.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
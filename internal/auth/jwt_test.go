@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var testConfig = JWTConfig{
+	Issuer:   "https://mobile.example.com",
+	Audience: "receipt-processor",
+	Roles: map[string][]string{
+		"customer": {ScopeReceiptsWrite, ScopeReceiptsRead},
+		"support":  {ScopeReceiptsRead, ScopeReceiptsDelete},
+	},
+}
+
+type testKeys struct {
+	secret     []byte
+	rsaKey     *rsa.PrivateKey
+	ed25519Key ed25519.PrivateKey
+	jwks       []JWK
+}
+
+func setupTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+
+	secret := []byte("a-shared-secret-of-reasonable-length")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	return &testKeys{
+		secret:     secret,
+		rsaKey:     rsaKey,
+		ed25519Key: edKey,
+		jwks: []JWK{
+			{Kty: "oct", Kid: "hs", K: encode(secret)},
+			{Kty: "RSA", Kid: "rs", N: encode(rsaKey.N.Bytes()), E: encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: encode(edKey.Public().(ed25519.PublicKey))},
+		},
+	}
+}
+
+// Signs the claims with the key matching the algorithm
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := encode(header) + "." + encode(payload)
+
+	var signature []byte
+	switch alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case AlgRS256:
+		hash := sha256.Sum256([]byte(signingInput))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsaKey, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+	case AlgEdDSA:
+		signature = ed25519.Sign(k.ed25519Key, []byte(signingInput))
+	}
+
+	return signingInput + "." + encode(signature)
+}
+
+// Returns valid claims for the test config
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":   "user-42",
+		"iss":   testConfig.Issuer,
+		"aud":   []string{testConfig.Audience},
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"roles": []string{"customer"},
+	}
+}
+
+// Returns valid claims with one claim replaced or removed when value is nil
+func claimsWith(name string, value any) map[string]any {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
+
+func setupTestVerifier(t *testing.T, keys *testKeys) *JWTVerifier {
+	t.Helper()
+	verifier, err := NewJWTVerifier(testConfig, keys.jwks)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	verifier.now = func() time.Time { return testNow }
+	return verifier
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	keys := setupTestKeys(t)
+	verifier := setupTestVerifier(t, keys)
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"HS256", keys.sign(t, AlgHS256, "hs", validClaims()), nil},
+		{"RS256", keys.sign(t, AlgRS256, "rs", validClaims()), nil},
+		{"EdDSA", keys.sign(t, AlgEdDSA, "ed", validClaims()), nil},
+		{"No kid", keys.sign(t, AlgEdDSA, "", validClaims()), nil},
+		{"Unknown kid", keys.sign(t, AlgHS256, "other", validClaims()), ErrInvalidCredentials},
+		{"Algorithm not bound to key", keys.sign(t, AlgHS256, "rs", validClaims()), ErrInvalidCredentials},
+		{"Unsigned token", keys.sign(t, "none", "", validClaims()), ErrInvalidCredentials},
+		{"Expired", keys.sign(t, AlgHS256, "hs", claimsWith("exp", testNow.Add(-time.Minute).Unix())), ErrTokenExpired},
+		{"Missing expiry", keys.sign(t, AlgHS256, "hs", claimsWith("exp", nil)), ErrInvalidCredentials},
+		{"Not yet valid", keys.sign(t, AlgHS256, "hs", claimsWith("nbf", testNow.Add(time.Minute).Unix())), ErrInvalidCredentials},
+		{"Wrong issuer", keys.sign(t, AlgHS256, "hs", claimsWith("iss", "https://evil.example.com")), ErrInvalidCredentials},
+		{"Wrong audience", keys.sign(t, AlgHS256, "hs", claimsWith("aud", "other-service")), ErrInvalidCredentials},
+		{"Audience as string", keys.sign(t, AlgHS256, "hs", claimsWith("aud", testConfig.Audience)), nil},
+		{"Missing subject", keys.sign(t, AlgHS256, "hs", claimsWith("sub", nil)), ErrInvalidCredentials},
+		{"Malformed token", "not.a-token", ErrInvalidCredentials},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			_, err := verifier.Authenticate(entry.token)
+			if err != entry.err {
+				t.Errorf("Expected %v, received %v", entry.err, err)
+			}
+		})
+	}
+}
+
+func TestJWTTamperedPayload(t *testing.T) {
+	keys := setupTestKeys(t)
+	verifier := setupTestVerifier(t, keys)
+
+	token := keys.sign(t, AlgEdDSA, "ed", validClaims())
+	forged := keys.sign(t, AlgEdDSA, "ed", claimsWith("roles", []string{"support"}))
+
+	// Combine the signature of the first token with the payload of the second one
+	tampered := forged[:len(forged)-86] + token[len(token)-86:]
+	if _, err := verifier.Authenticate(tampered); err != ErrInvalidCredentials {
+		t.Errorf("Expected %v, received %v", ErrInvalidCredentials, err)
+	}
+}
+
+func TestJWTRoles(t *testing.T) {
+	keys := setupTestKeys(t)
+	verifier := setupTestVerifier(t, keys)
+
+	tests := []struct {
+		name     string
+		roles    any
+		expected []string
+	}{
+		{"Single role", []string{"customer"}, []string{ScopeReceiptsWrite, ScopeReceiptsRead}},
+		{"Several roles", []string{"customer", "support"}, []string{ScopeReceiptsWrite, ScopeReceiptsRead, ScopeReceiptsDelete}},
+		{"Space separated roles", "customer support", []string{ScopeReceiptsWrite, ScopeReceiptsRead, ScopeReceiptsDelete}},
+		{"Unknown role", []string{"intruder"}, nil},
+		{"No roles", nil, nil},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			principal, err := verifier.Authenticate(keys.sign(t, AlgHS256, "hs", claimsWith("roles", entry.roles)))
+			if err != nil {
+				t.Fatalf("Expected token to authenticate, got %v", err)
+			}
+			if principal.ID != "user-42" || principal.Method != "jwt" {
+				t.Errorf("Unexpected principal %+v", principal)
+			}
+			if !slices.Equal(principal.Scopes, entry.expected) {
+				t.Errorf("Expected scopes %v, received %v", entry.expected, principal.Scopes)
+			}
+		})
+	}
+}
+
+func TestLoadJWTVerifier(t *testing.T) {
+	keys := setupTestKeys(t)
+	dir := t.TempDir()
+
+	jwks, _ := json.Marshal(map[string]any{"keys": keys.jwks})
+	if err := os.WriteFile(filepath.Join(dir, "jwks.json"), jwks, 0600); err != nil {
+		t.Fatalf("Failed to write jwks: %v", err)
+	}
+	config := `{"jwks": "jwks.json", "roles": {"customer": ["receipts:write"]}, "leeway": "30s"}`
+	if err := os.WriteFile(filepath.Join(dir, "jwt.json"), []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	verifier, err := LoadJWTVerifier(filepath.Join(dir, "jwt.json"))
+	if err != nil {
+		t.Fatalf("Failed to load verifier: %v", err)
+	}
+	if len(verifier.keys) != 3 {
+		t.Errorf("Expected 3 keys, received %d", len(verifier.keys))
+	}
+	if verifier.leeway != 30*time.Second {
+		t.Errorf("Expected leeway of 30s, received %s", verifier.leeway)
+	}
+}
+
+func TestParseJWK(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"Unsupported key type", JWK{Kty: "EC"}},
+		{"Empty secret", JWK{Kty: "oct"}},
+		{"Short RSA key", JWK{Kty: "RSA", N: "AQAB", E: "AQAB"}},
+		{"Unsupported curve", JWK{Kty: "OKP", Crv: "X25519"}},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if _, err := parseJWK(entry.jwk); err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+		})
+	}
+}
+
+func TestJWTTenant(t *testing.T) {
+	keys := setupTestKeys(t)
+	verifier := setupTestVerifier(t, keys)
+
+	principal, err := verifier.Authenticate(keys.sign(t, AlgHS256, "hs", claimsWith("tenant", "brand-a")))
+	if err != nil {
+		t.Fatalf("Expected token to authenticate, got %v", err)
+	}
+	if principal.Tenant != "brand-a" {
+		t.Errorf("Expected tenant brand-a, received %q", principal.Tenant)
+	}
+}
@@ -0,0 +1,106 @@
+package expiry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy decides when earned points expire
+type Policy interface {
+	// Returns the time the points earned at earnedAt expire, given the
+	// last activity of the member, or the zero time if they never expire
+	ExpiresAt(earnedAt, lastActivity time.Time) time.Time
+	String() string
+}
+
+// Never lets points expire
+type Never struct{}
+
+func (Never) ExpiresAt(earnedAt, lastActivity time.Time) time.Time {
+	return time.Time{}
+}
+
+func (Never) String() string {
+	return "never"
+}
+
+// FixedLifetime expires points a number of months after they were earned
+type FixedLifetime struct {
+	Months int
+}
+
+func (p FixedLifetime) ExpiresAt(earnedAt, lastActivity time.Time) time.Time {
+	return earnedAt.AddDate(0, p.Months, 0)
+}
+
+func (p FixedLifetime) String() string {
+	return fmt.Sprintf("fixed lifetime of %d months", p.Months)
+}
+
+// EndOfCalendarYear expires points at the end of the calendar year they were
+// earned in, or of a later year when Years is greater than one
+type EndOfCalendarYear struct {
+	Years int
+}
+
+func (p EndOfCalendarYear) ExpiresAt(earnedAt, lastActivity time.Time) time.Time {
+	earnedAt = earnedAt.UTC()
+	return time.Date(earnedAt.Year()+p.Years, time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (p EndOfCalendarYear) String() string {
+	if p.Years == 1 {
+		return "end of calendar year"
+	}
+	return fmt.Sprintf("end of calendar year after %d years", p.Years)
+}
+
+// Inactivity expires every point of a member that neither earned nor
+// redeemed points for a number of months
+type Inactivity struct {
+	Months int
+}
+
+func (p Inactivity) ExpiresAt(earnedAt, lastActivity time.Time) time.Time {
+	if lastActivity.Before(earnedAt) {
+		lastActivity = earnedAt
+	}
+	return lastActivity.AddDate(0, p.Months, 0)
+}
+
+func (p Inactivity) String() string {
+	return fmt.Sprintf("%d months of inactivity", p.Months)
+}
+
+// Parses a policy from its flag value:
+//   - "never";
+//   - "fixed:<months>", e.g. "fixed:12";
+//   - "calendar-year" or "calendar-year:<years>";
+//   - "inactivity:<months>".
+func ParsePolicy(value string) (Policy, error) {
+	name, argument, hasArgument := strings.Cut(value, ":")
+
+	number := 1
+	if hasArgument {
+		parsed, err := strconv.Atoi(argument)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid expiry policy %q: %q must be a positive integer", value, argument)
+		}
+		number = parsed
+	}
+
+	switch {
+	case name == "never" && !hasArgument:
+		return Never{}, nil
+	case name == "fixed" && hasArgument:
+		return FixedLifetime{Months: number}, nil
+	case name == "calendar-year":
+		return EndOfCalendarYear{Years: number}, nil
+	case name == "inactivity" && hasArgument:
+		return Inactivity{Months: number}, nil
+	}
+
+	return nil, fmt.Errorf("invalid expiry policy %q", value)
+}
@@ -0,0 +1,70 @@
+package expiry
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Policy
+		err      bool
+	}{
+		{"never", Never{}, false},
+		{"fixed:12", FixedLifetime{Months: 12}, false},
+		{"calendar-year", EndOfCalendarYear{Years: 1}, false},
+		{"calendar-year:2", EndOfCalendarYear{Years: 2}, false},
+		{"inactivity:18", Inactivity{Months: 18}, false},
+		{"fixed", nil, true},
+		{"fixed:0", nil, true},
+		{"inactivity:soon", nil, true},
+		{"never:1", nil, true},
+		{"forever", nil, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.value, func(t *testing.T) {
+			policy, err := ParsePolicy(entry.value)
+			if entry.err && err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+			if !entry.err && err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			if policy != entry.expected {
+				t.Errorf("Expected %v, received %v", entry.expected, policy)
+			}
+		})
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       Policy
+		earnedAt     time.Time
+		lastActivity time.Time
+		expected     time.Time
+	}{
+		{"Never", Never{}, date(2024, 3, 1), date(2024, 3, 1), time.Time{}},
+		{"Fixed lifetime", FixedLifetime{Months: 12}, date(2024, 3, 1), date(2024, 6, 1), date(2025, 3, 1)},
+		{"End of calendar year", EndOfCalendarYear{Years: 1}, date(2024, 3, 1), date(2024, 3, 1), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"End of calendar year on new year's eve", EndOfCalendarYear{Years: 1}, date(2024, 12, 31), date(2024, 12, 31), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"End of following calendar year", EndOfCalendarYear{Years: 2}, date(2024, 3, 1), date(2024, 3, 1), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"Inactivity after last activity", Inactivity{Months: 6}, date(2024, 1, 1), date(2024, 3, 1), date(2024, 9, 1)},
+		{"Inactivity without later activity", Inactivity{Months: 6}, date(2024, 3, 1), time.Time{}, date(2024, 9, 1)},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if result := entry.policy.ExpiresAt(entry.earnedAt, entry.lastActivity); !result.Equal(entry.expected) {
+				t.Errorf("Expected %s, received %s", entry.expected, result)
+			}
+		})
+	}
+}
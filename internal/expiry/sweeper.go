@@ -0,0 +1,116 @@
+package expiry
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/periodic"
+)
+
+// Principal the expiries are audited under, the creator of the expiry entries
+const Principal = "system:expiry"
+
+// Sweeper expires the points of every member according to the policy.
+// Every member whose points expired is recorded in the audit log
+type Sweeper struct {
+	ledger   *models.Ledger
+	policy   Policy
+	audit    *audit.Log
+	errorLog *log.Logger
+	infoLog  *log.Logger
+	now      func() time.Time
+}
+
+// Balance of a member, the state audited for expiries
+type memberBalance struct {
+	MemberID string `json:"memberId"`
+	Balance  int    `json:"balance"`
+}
+
+// ExpiringLot is a lot with points left that will expire
+type ExpiringLot struct {
+	models.Lot
+	ExpiresAt time.Time
+}
+
+func NewSweeper(ledger *models.Ledger, policy Policy, auditLog *audit.Log, errorLog, infoLog *log.Logger) *Sweeper {
+	return &Sweeper{
+		ledger:   ledger,
+		policy:   policy,
+		audit:    auditLog,
+		errorLog: errorLog,
+		infoLog:  infoLog,
+		now:      time.Now,
+	}
+}
+
+// Sweeps the ledger every interval until the context is cancelled
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	periodic.Run(ctx, interval, nil, func() { s.Sweep() })
+}
+
+// Posts expiry entries for every expired lot and returns the number of expired points
+func (s *Sweeper) Sweep() int {
+	now := s.now()
+	total := 0
+
+	for _, member := range s.ledger.Members() {
+		account := models.MemberAccount(member.MemberID)
+		balance := s.ledger.Balance(member.TenantID, account)
+		expired, err := s.ledger.Expire(member.TenantID, member.MemberID, now, s.policy.ExpiresAt, s.policy.String())
+		if err != nil {
+			s.errorLog.Printf("Failed to expire points of member %s: %v", member.MemberID, err)
+		}
+		if expired > 0 {
+			s.record(member.TenantID, member.MemberID, balance, balance-expired)
+		}
+		total += expired
+	}
+
+	if total > 0 {
+		s.infoLog.Printf("Expired %d points", total)
+	}
+
+	return total
+}
+
+// Records the expiry of points of the member in the audit log
+func (s *Sweeper) record(tenantID, memberID string, before, after int) {
+	_, err := s.audit.Record(audit.Event{
+		TenantID:   tenantID,
+		Principal:  Principal,
+		Action:     audit.ActionPointsExpiry,
+		Resource:   models.MemberAccount(memberID),
+		BeforeHash: audit.HashState(memberBalance{MemberID: memberID, Balance: before}),
+		AfterHash:  audit.HashState(memberBalance{MemberID: memberID, Balance: after}),
+	})
+	if err != nil {
+		s.errorLog.Printf("Failed to record %s of member %s in the audit log: %v", audit.ActionPointsExpiry, memberID, err)
+	}
+}
+
+// Returns the lots of the member whose remaining points expire before now + within,
+// soonest first
+func Upcoming(ledger *models.Ledger, policy Policy, tenantID, memberID string, now time.Time, within time.Duration) []ExpiringLot {
+	lastActivity := ledger.LastActivity(tenantID, memberID)
+	deadline := now.Add(within)
+
+	var upcoming []ExpiringLot
+	for _, lot := range ledger.Lots(tenantID, memberID) {
+		expiresAt := policy.ExpiresAt(lot.EarnedAt, lastActivity)
+		if lot.Remaining <= 0 || expiresAt.IsZero() || expiresAt.After(deadline) {
+			continue
+		}
+		upcoming = append(upcoming, ExpiringLot{Lot: lot, ExpiresAt: expiresAt})
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].ExpiresAt.Before(upcoming[j].ExpiresAt)
+	})
+
+	return upcoming
+}
@@ -0,0 +1,148 @@
+package expiry
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+type TestLedger struct {
+	ledger *models.Ledger
+	now    time.Time
+}
+
+// Returns a ledger with a clock that only moves when the test sets it
+func setupTestLedger() *TestLedger {
+	d := &TestLedger{ledger: models.NewLedger(), now: date(2024, 1, 1)}
+	d.ledger.SetClock(func() time.Time { return d.now })
+	return d
+}
+
+func (d *TestLedger) earn(t *testing.T, at time.Time, memberID, receiptID string, points int) {
+	t.Helper()
+	d.now = at
+	if err := d.ledger.Earn("", memberID, receiptID, points, 0, "test"); err != nil {
+		t.Fatalf("Failed to earn points: %v", err)
+	}
+}
+
+func (d *TestLedger) redeem(t *testing.T, at time.Time, memberID string, points int) {
+	t.Helper()
+	d.now = at
+	_, _, err := d.ledger.Post(models.LedgerEntry{
+		Type:   models.EntryRedemption,
+		Debit:  models.MemberAccount(memberID),
+		Credit: models.ProgramAccount,
+		Amount: points,
+	})
+	if err != nil {
+		t.Fatalf("Failed to redeem points: %v", err)
+	}
+}
+
+func setupTestSweeper(d *TestLedger, policy Policy, now time.Time) *Sweeper {
+	var logs bytes.Buffer
+	sweeper := NewSweeper(d.ledger, policy, audit.NewLog(), log.New(&logs, "", 0), log.New(&logs, "", 0))
+	sweeper.now = func() time.Time { return now }
+	return sweeper
+}
+
+func TestSweepFixedLifetime(t *testing.T) {
+	d := setupTestLedger()
+	d.earn(t, date(2023, 1, 1), "member-1", "receipt-1", 100)
+	d.earn(t, date(2023, 6, 1), "member-1", "receipt-2", 50)
+	// Redemptions consume the oldest points first
+	d.redeem(t, date(2023, 7, 1), "member-1", 30)
+
+	sweeper := setupTestSweeper(d, FixedLifetime{Months: 12}, date(2024, 2, 1))
+	if expired := sweeper.Sweep(); expired != 70 {
+		t.Errorf("Expected 70 points to expire, received %d", expired)
+	}
+	if balance := d.ledger.Balance("", models.MemberAccount("member-1")); balance != 50 {
+		t.Errorf("Expected balance 50, received %d", balance)
+	}
+
+	// Sweeping again does not expire the same points twice
+	if expired := sweeper.Sweep(); expired != 0 {
+		t.Errorf("Expected no points to expire, received %d", expired)
+	}
+
+	entries := d.ledger.Entries("", models.MemberAccount("member-1"))
+	if entries[0].Type != models.EntryExpiry || entries[0].ReceiptID != "receipt-1" || entries[0].Reason == "" {
+		t.Errorf("Expected an expiry entry for receipt-1, received %+v", entries[0])
+	}
+
+	// Only the sweep that expired points is audited
+	events := sweeper.audit.Events(audit.Filter{Action: audit.ActionPointsExpiry})
+	if len(events) != 1 || events[0].Principal != Principal || events[0].Resource != "member:member-1" {
+		t.Errorf("Expected one audited expiry of member-1, received %+v", events)
+	}
+}
+
+func TestSweepEndOfCalendarYear(t *testing.T) {
+	d := setupTestLedger()
+	d.earn(t, date(2023, 12, 31), "member-1", "receipt-1", 100)
+	d.earn(t, date(2024, 1, 1), "member-1", "receipt-2", 50)
+
+	sweeper := setupTestSweeper(d, EndOfCalendarYear{Years: 1}, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if expired := sweeper.Sweep(); expired != 100 {
+		t.Errorf("Expected 100 points to expire, received %d", expired)
+	}
+}
+
+func TestSweepInactivity(t *testing.T) {
+	d := setupTestLedger()
+	d.earn(t, date(2023, 1, 1), "active", "receipt-1", 100)
+	d.earn(t, date(2023, 1, 1), "inactive", "receipt-2", 100)
+	d.earn(t, date(2023, 2, 1), "inactive", "receipt-3", 20)
+	// A redemption counts as activity
+	d.redeem(t, date(2023, 12, 1), "active", 10)
+
+	sweeper := setupTestSweeper(d, Inactivity{Months: 6}, date(2024, 1, 1))
+	if expired := sweeper.Sweep(); expired != 120 {
+		t.Errorf("Expected 120 points to expire, received %d", expired)
+	}
+	if balance := d.ledger.Balance("", models.MemberAccount("active")); balance != 90 {
+		t.Errorf("Expected the active member to keep 90 points, received %d", balance)
+	}
+	if balance := d.ledger.Balance("", models.MemberAccount("inactive")); balance != 0 {
+		t.Errorf("Expected the inactive member to lose every point, received %d", balance)
+	}
+}
+
+func TestSweepReversedReceipt(t *testing.T) {
+	d := setupTestLedger()
+	d.earn(t, date(2023, 1, 1), "member-1", "receipt-1", 100)
+	d.earn(t, date(2023, 6, 1), "member-1", "receipt-2", 50)
+	// Reversals take back the points of their own receipt
+	d.now = date(2023, 7, 1)
+	d.ledger.ReverseReceipt("", "member-1", "receipt-1", "test")
+
+	sweeper := setupTestSweeper(d, FixedLifetime{Months: 12}, date(2024, 2, 1))
+	if expired := sweeper.Sweep(); expired != 0 {
+		t.Errorf("Expected no points to expire, received %d", expired)
+	}
+}
+
+func TestUpcoming(t *testing.T) {
+	d := setupTestLedger()
+	d.earn(t, date(2023, 1, 1), "member-1", "receipt-1", 100)
+	d.earn(t, date(2023, 3, 1), "member-1", "receipt-2", 50)
+	d.earn(t, date(2023, 9, 1), "member-1", "receipt-3", 25)
+
+	upcoming := Upcoming(d.ledger, FixedLifetime{Months: 12}, "", "member-1", date(2023, 12, 15), 90*24*time.Hour)
+	if len(upcoming) != 2 {
+		t.Fatalf("Expected 2 expiring lots, received %d", len(upcoming))
+	}
+	if upcoming[0].ReceiptID != "receipt-1" || !upcoming[0].ExpiresAt.Equal(date(2024, 1, 1)) {
+		t.Errorf("Expected receipt-1 to expire first, received %+v", upcoming[0])
+	}
+
+	if upcoming := Upcoming(d.ledger, Never{}, "", "member-1", date(2023, 12, 15), 90*24*time.Hour); len(upcoming) != 0 {
+		t.Errorf("Expected no expiring lots, received %d", len(upcoming))
+	}
+}
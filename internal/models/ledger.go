@@ -0,0 +1,283 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of ledger entries
+const (
+	EntryEarn       = "earn"
+	EntryRedemption = "redemption"
+	EntryAdjustment = "adjustment"
+	EntryReversal   = "reversal"
+	EntryExpiry     = "expiry"
+)
+
+// Account that issues points to members and receives them back
+const ProgramAccount = "program"
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient points balance")
+	ErrIdempotencyConflict = errors.New("idempotency key reused with a different request")
+	ErrInvalidAmount       = errors.New("amount must be positive")
+)
+
+// LedgerEntry is an immutable movement of points from the Debit account
+// to the Credit account. Every entry moves a positive amount, except earn
+// and reversal entries of receipts without points, which only record their
+// spend. The balances of all accounts always add up to zero
+type LedgerEntry struct {
+	ID        string
+	TenantID  string
+	Type      string
+	Debit     string
+	Credit    string
+	Amount    int
+	MemberID  string
+	ReceiptID string
+	// Amount in cents spent on the receipt, set on earn and reversal entries
+	Spend int
+	// Earn or adjustment entry whose points an expiry entry takes back
+	LotID          string
+	IdempotencyKey string
+	Reason         string
+	CreatedBy      string
+	CreatedAt      time.Time
+}
+
+// Ledger is an append-only journal of points movements per tenant.
+// Balances are never stored, they are derived from the entries
+type Ledger struct {
+	mu      sync.RWMutex
+	entries map[string][]LedgerEntry
+	// Positions of the entries of each account, per tenant
+	accounts map[string]map[string][]int
+	// Positions of the entries of each idempotency key, per tenant
+	idempotency map[string]map[string]int
+	now         func() time.Time
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		entries:     make(map[string][]LedgerEntry),
+		accounts:    make(map[string]map[string][]int),
+		idempotency: make(map[string]map[string]int),
+		now:         time.Now,
+	}
+}
+
+// Returns the account holding the points of a member
+func MemberAccount(memberID string) string {
+	return "member:" + memberID
+}
+
+// Appends the entry to the journal and returns it with its id and time set.
+// Redemptions fail if the debited account does not hold enough points.
+// An entry with an idempotency key that was already posted is not posted
+// again: the original entry is returned with replayed set to true
+func (l *Ledger) Post(entry LedgerEntry) (posted LedgerEntry, replayed bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.post(entry)
+}
+
+func (l *Ledger) post(entry LedgerEntry) (posted LedgerEntry, replayed bool, err error) {
+	recordsSpend := (entry.Type == EntryEarn || entry.Type == EntryReversal) && entry.Spend > 0
+	if entry.Amount < 0 || (entry.Amount == 0 && !recordsSpend) {
+		return LedgerEntry{}, false, ErrInvalidAmount
+	}
+
+	tenantID := TenantKey(entry.TenantID)
+	entry.TenantID = tenantID
+
+	if entry.IdempotencyKey != "" {
+		if position, exists := l.idempotency[tenantID][entry.IdempotencyKey]; exists {
+			original := l.entries[tenantID][position]
+			if original.Type != entry.Type || original.Debit != entry.Debit ||
+				original.Credit != entry.Credit || original.Amount != entry.Amount {
+				return LedgerEntry{}, false, ErrIdempotencyConflict
+			}
+			return original, true, nil
+		}
+	}
+
+	if entry.Type == EntryRedemption && l.balance(tenantID, entry.Debit) < entry.Amount {
+		return LedgerEntry{}, false, ErrInsufficientBalance
+	}
+
+	entry.ID = uuid.New().String()
+	entry.CreatedAt = l.now().UTC()
+
+	position := len(l.entries[tenantID])
+	l.entries[tenantID] = append(l.entries[tenantID], entry)
+
+	if l.accounts[tenantID] == nil {
+		l.accounts[tenantID] = make(map[string][]int)
+	}
+	l.accounts[tenantID][entry.Debit] = append(l.accounts[tenantID][entry.Debit], position)
+	l.accounts[tenantID][entry.Credit] = append(l.accounts[tenantID][entry.Credit], position)
+
+	if entry.IdempotencyKey != "" {
+		if l.idempotency[tenantID] == nil {
+			l.idempotency[tenantID] = make(map[string]int)
+		}
+		l.idempotency[tenantID][entry.IdempotencyKey] = position
+	}
+
+	return entry, false, nil
+}
+
+// Replaces the clock used to time the entries
+func (l *Ledger) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.now = now
+}
+
+// Returns the balance of the account: the credited amounts minus the debited ones
+func (l *Ledger) Balance(tenantID, account string) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.balance(TenantKey(tenantID), account)
+}
+
+func (l *Ledger) balance(tenantID, account string) int {
+	balance := 0
+	for _, position := range l.accounts[tenantID][account] {
+		entry := l.entries[tenantID][position]
+		if entry.Credit == account {
+			balance += entry.Amount
+		}
+		if entry.Debit == account {
+			balance -= entry.Amount
+		}
+	}
+	return balance
+}
+
+// Returns the entries of the account, most recent first
+func (l *Ledger) Entries(tenantID, account string) []LedgerEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	tenantID = TenantKey(tenantID)
+	positions := l.accounts[tenantID][account]
+	entries := make([]LedgerEntry, 0, len(positions))
+	for i := len(positions) - 1; i >= 0; i-- {
+		entries = append(entries, l.entries[tenantID][positions[i]])
+	}
+	return entries
+}
+
+// Returns the net amount a receipt has earned its member, and the net amount spent on it.
+// Points that expired are no longer held by the member and are not counted
+func (l *Ledger) ReceiptPoints(tenantID, memberID, receiptID string) (points, spend int) {
+	for _, entry := range l.Entries(tenantID, MemberAccount(memberID)) {
+		if entry.ReceiptID != receiptID {
+			continue
+		}
+		switch entry.Type {
+		case EntryEarn:
+			points += entry.Amount
+			spend += entry.Spend
+		case EntryReversal:
+			points -= entry.Amount
+			spend -= entry.Spend
+		case EntryExpiry:
+			points -= entry.Amount
+		}
+	}
+	return points, spend
+}
+
+// Returns the points the member has earned with receipts, net of reversals.
+// Redemptions and expiries do not lower lifetime points
+func (l *Ledger) LifetimePoints(tenantID, memberID string) int {
+	points := 0
+	for _, entry := range l.Entries(tenantID, MemberAccount(memberID)) {
+		switch entry.Type {
+		case EntryEarn:
+			points += entry.Amount
+		case EntryReversal:
+			points -= entry.Amount
+		}
+	}
+	return points
+}
+
+// Returns the amount in cents the member has spent on receipts since the
+// provided time. A reversal only takes back the spend of its receipt counted
+// since then, so that a receipt earned before cannot lower the amount
+func (l *Ledger) SpendSince(tenantID, memberID string, since time.Time) int {
+	entries := l.Entries(tenantID, MemberAccount(memberID))
+	receipts := make(map[string]int)
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.CreatedAt.Before(since) {
+			continue
+		}
+		switch entry.Type {
+		case EntryEarn:
+			receipts[entry.ReceiptID] += entry.Spend
+		case EntryReversal:
+			receipts[entry.ReceiptID] = max(receipts[entry.ReceiptID]-entry.Spend, 0)
+		}
+	}
+
+	spend := 0
+	for _, receiptSpend := range receipts {
+		spend += receiptSpend
+	}
+	return spend
+}
+
+// Records the points a receipt earned its member and the amount in cents
+// spent on it. The spend of receipts without points is recorded all the same
+func (l *Ledger) Earn(tenantID, memberID, receiptID string, points, spend int, createdBy string) error {
+	points, spend = max(points, 0), max(spend, 0)
+	if points == 0 && spend == 0 {
+		// Nothing to record
+		return nil
+	}
+	_, _, err := l.Post(LedgerEntry{
+		TenantID:  tenantID,
+		Type:      EntryEarn,
+		Debit:     ProgramAccount,
+		Credit:    MemberAccount(memberID),
+		Amount:    points,
+		MemberID:  memberID,
+		ReceiptID: receiptID,
+		Spend:     spend,
+		CreatedBy: createdBy,
+	})
+	return err
+}
+
+// Takes back everything a receipt has earned its member that has not
+// expired, and the spend it recorded, never more than was earned
+func (l *Ledger) ReverseReceipt(tenantID, memberID, receiptID, createdBy string) error {
+	points, spend := l.ReceiptPoints(tenantID, memberID, receiptID)
+	points, spend = max(points, 0), max(spend, 0)
+	if points == 0 && spend == 0 {
+		return nil
+	}
+	_, _, err := l.Post(LedgerEntry{
+		TenantID:  tenantID,
+		Type:      EntryReversal,
+		Debit:     MemberAccount(memberID),
+		Credit:    ProgramAccount,
+		Amount:    points,
+		MemberID:  memberID,
+		ReceiptID: receiptID,
+		Spend:     spend,
+		CreatedBy: createdBy,
+	})
+	return err
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// Posts an earn entry for the member and fails the test on error
+func earn(t *testing.T, ledger *Ledger, memberID, receiptID string, points int) {
+	t.Helper()
+	if err := ledger.Earn(DefaultTenantID, memberID, receiptID, points, 0, "test"); err != nil {
+		t.Fatalf("Failed to earn points: %v", err)
+	}
+}
+
+func TestLedgerBalances(t *testing.T) {
+	ledger := NewLedger()
+	earn(t, ledger, "member-1", "receipt-1", 100)
+	earn(t, ledger, "member-1", "receipt-2", 50)
+	earn(t, ledger, "member-2", "receipt-3", 30)
+
+	_, _, err := ledger.Post(LedgerEntry{
+		Type:   EntryRedemption,
+		Debit:  MemberAccount("member-1"),
+		Credit: ProgramAccount,
+		Amount: 70,
+	})
+	if err != nil {
+		t.Fatalf("Failed to redeem points: %v", err)
+	}
+
+	tests := []struct {
+		account  string
+		expected int
+	}{
+		{MemberAccount("member-1"), 80},
+		{MemberAccount("member-2"), 30},
+		{ProgramAccount, -110},
+	}
+
+	sum := 0
+	for _, entry := range tests {
+		t.Run(entry.account, func(t *testing.T) {
+			if balance := ledger.Balance(DefaultTenantID, entry.account); balance != entry.expected {
+				t.Errorf("Expected balance %d, received %d", entry.expected, balance)
+			}
+		})
+		sum += ledger.Balance(DefaultTenantID, entry.account)
+	}
+
+	// Every entry debits and credits the same amount
+	if sum != 0 {
+		t.Errorf("Expected balances to add up to zero, received %d", sum)
+	}
+}
+
+func TestLedgerInsufficientBalance(t *testing.T) {
+	ledger := NewLedger()
+	earn(t, ledger, "member-1", "receipt-1", 10)
+
+	_, _, err := ledger.Post(LedgerEntry{
+		Type:   EntryRedemption,
+		Debit:  MemberAccount("member-1"),
+		Credit: ProgramAccount,
+		Amount: 11,
+	})
+	if err != ErrInsufficientBalance {
+		t.Errorf("Expected %v, received %v", ErrInsufficientBalance, err)
+	}
+	if balance := ledger.Balance(DefaultTenantID, MemberAccount("member-1")); balance != 10 {
+		t.Errorf("Expected balance to stay at 10, received %d", balance)
+	}
+}
+
+func TestLedgerIdempotency(t *testing.T) {
+	ledger := NewLedger()
+	earn(t, ledger, "member-1", "receipt-1", 100)
+
+	redemption := LedgerEntry{
+		Type:           EntryRedemption,
+		Debit:          MemberAccount("member-1"),
+		Credit:         ProgramAccount,
+		Amount:         40,
+		IdempotencyKey: "redeem-1",
+	}
+
+	first, replayed, err := ledger.Post(redemption)
+	if err != nil || replayed {
+		t.Fatalf("Expected first redemption to be posted, received replayed=%t err=%v", replayed, err)
+	}
+
+	second, replayed, err := ledger.Post(redemption)
+	if err != nil || !replayed {
+		t.Fatalf("Expected second redemption to be replayed, received replayed=%t err=%v", replayed, err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected the original entry %s, received %s", first.ID, second.ID)
+	}
+	if balance := ledger.Balance(DefaultTenantID, MemberAccount("member-1")); balance != 60 {
+		t.Errorf("Expected points to be redeemed once, balance is %d", balance)
+	}
+
+	redemption.Amount = 50
+	if _, _, err := ledger.Post(redemption); err != ErrIdempotencyConflict {
+		t.Errorf("Expected %v, received %v", ErrIdempotencyConflict, err)
+	}
+}
+
+func TestLedgerReverseReceipt(t *testing.T) {
+	ledger := NewLedger()
+	earn(t, ledger, "member-1", "receipt-1", 100)
+	earn(t, ledger, "member-1", "receipt-2", 20)
+
+	if err := ledger.ReverseReceipt(DefaultTenantID, "member-1", "receipt-1", "test"); err != nil {
+		t.Fatalf("Failed to reverse receipt: %v", err)
+	}
+	// A second reversal has nothing left to take back
+	if err := ledger.ReverseReceipt(DefaultTenantID, "member-1", "receipt-1", "test"); err != nil {
+		t.Fatalf("Failed to reverse receipt: %v", err)
+	}
+
+	if balance := ledger.Balance(DefaultTenantID, MemberAccount("member-1")); balance != 20 {
+		t.Errorf("Expected balance 20, received %d", balance)
+	}
+	entries := ledger.Entries(DefaultTenantID, MemberAccount("member-1"))
+	if len(entries) != 3 || entries[0].Type != EntryReversal {
+		t.Errorf("Expected a single reversal as the latest entry, received %+v", entries)
+	}
+}
+
+// Ensures that expired points are not taken back a second time by a reversal
+func TestLedgerExpireThenReverse(t *testing.T) {
+	ledger := NewLedger()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ledger.SetClock(func() time.Time { return now })
+	earn(t, ledger, "member-1", "receipt-1", 100)
+
+	// Points earned before now expire, the points of the second receipt do not
+	now = now.AddDate(1, 0, 0)
+	earn(t, ledger, "member-1", "receipt-2", 10)
+	expired, err := ledger.Expire(DefaultTenantID, "member-1", now, func(earnedAt, _ time.Time) time.Time {
+		if !earnedAt.Before(now) {
+			return time.Time{}
+		}
+		return earnedAt
+	}, "test")
+	if err != nil || expired != 100 {
+		t.Fatalf("Expected 100 expired points, received %d, %v", expired, err)
+	}
+
+	if err := ledger.ReverseReceipt(DefaultTenantID, "member-1", "receipt-1", "test"); err != nil {
+		t.Fatalf("Failed to reverse receipt: %v", err)
+	}
+
+	if balance := ledger.Balance(DefaultTenantID, MemberAccount("member-1")); balance != 10 {
+		t.Errorf("Expected the points of the second receipt to remain, received %d", balance)
+	}
+	for _, entry := range ledger.Entries(DefaultTenantID, MemberAccount("member-1")) {
+		if entry.Type == EntryReversal {
+			t.Errorf("Expected nothing left to reverse, received %+v", entry)
+		}
+	}
+}
+
+func TestLedgerInvalidEntries(t *testing.T) {
+	ledger := NewLedger()
+
+	if _, _, err := ledger.Post(LedgerEntry{Type: EntryAdjustment, Debit: ProgramAccount, Credit: MemberAccount("member-1")}); err != ErrInvalidAmount {
+		t.Errorf("Expected %v, received %v", ErrInvalidAmount, err)
+	}
+
+	// Receipts without points nor spend leave no entry
+	earn(t, ledger, "member-1", "receipt-1", 0)
+	if entries := ledger.Entries(DefaultTenantID, MemberAccount("member-1")); len(entries) != 0 {
+		t.Errorf("Expected no entries, received %d", len(entries))
+	}
+}
+
+func TestLedgerSpendWithoutPoints(t *testing.T) {
+	ledger := NewLedger()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ledger.SetClock(func() time.Time { return now })
+
+	// The spend of a receipt without points counts towards tiers
+	if err := ledger.Earn(DefaultTenantID, "member-1", "receipt-1", 0, 500, "test"); err != nil {
+		t.Fatalf("Failed to record the spend: %v", err)
+	}
+	if spend := ledger.SpendSince(DefaultTenantID, "member-1", time.Time{}); spend != 500 {
+		t.Errorf("Expected 500 cents spent, received %d", spend)
+	}
+	if balance := ledger.Balance(DefaultTenantID, MemberAccount("member-1")); balance != 0 {
+		t.Errorf("Expected no points, received %d", balance)
+	}
+
+	// A reversal after the start of the period cannot take back spend from before it
+	now = now.AddDate(0, 1, 0)
+	if err := ledger.ReverseReceipt(DefaultTenantID, "member-1", "receipt-1", "test"); err != nil {
+		t.Fatalf("Failed to reverse the receipt: %v", err)
+	}
+	if spend := ledger.SpendSince(DefaultTenantID, "member-1", time.Time{}); spend != 0 {
+		t.Errorf("Expected the spend to be taken back, received %d", spend)
+	}
+	if spend := ledger.SpendSince(DefaultTenantID, "member-1", now); spend != 0 {
+		t.Errorf("Expected no spend since the reversal, received %d", spend)
+	}
+
+	// Nothing is left to reverse
+	if err := ledger.ReverseReceipt(DefaultTenantID, "member-1", "receipt-1", "test"); err != nil {
+		t.Fatalf("Failed to reverse the receipt: %v", err)
+	}
+	if entries := ledger.Entries(DefaultTenantID, MemberAccount("member-1")); len(entries) != 2 {
+		t.Errorf("Expected an earn and a reversal, received %+v", entries)
+	}
+}
+
+func TestLedgerTenantIsolation(t *testing.T) {
+	ledger := NewLedger()
+	ledger.Earn("brand-a", "member-1", "receipt-1", 100, 0, "test")
+
+	if balance := ledger.Balance("brand-b", MemberAccount("member-1")); balance != 0 {
+		t.Errorf("Expected another tenant to see no points, received %d", balance)
+	}
+}
+
+func TestLedgerStanding(t *testing.T) {
+	ledger := NewLedger()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ledger.SetClock(func() time.Time { return now })
+
+	ledger.Earn(DefaultTenantID, "member-1", "receipt-1", 100, 2500, "test")
+	now = now.AddDate(0, 6, 0)
+	ledger.Earn(DefaultTenantID, "member-1", "receipt-2", 40, 1000, "test")
+	ledger.Post(LedgerEntry{Type: EntryRedemption, Debit: MemberAccount("member-1"), Credit: ProgramAccount, Amount: 50})
+	ledger.ReverseReceipt(DefaultTenantID, "member-1", "receipt-2", "test")
+
+	// Redemptions do not lower lifetime points, reversals do
+	if points := ledger.LifetimePoints(DefaultTenantID, "member-1"); points != 100 {
+		t.Errorf("Expected 100 lifetime points, received %d", points)
+	}
+	if spend := ledger.SpendSince(DefaultTenantID, "member-1", time.Time{}); spend != 2500 {
+		t.Errorf("Expected 2500 cents spent, received %d", spend)
+	}
+	if spend := ledger.SpendSince(DefaultTenantID, "member-1", now); spend != 0 {
+		t.Errorf("Expected nothing spent since the reversal, received %d", spend)
+	}
+}
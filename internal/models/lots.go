@@ -0,0 +1,153 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Lot is a batch of points credited to a member by an earn or adjustment entry,
+// with what remains of it after the member account was debited
+type Lot struct {
+	EntryID   string
+	ReceiptID string
+	EarnedAt  time.Time
+	Amount    int
+	Remaining int
+}
+
+// MemberRef names a member account of the ledger
+type MemberRef struct {
+	TenantID string
+	MemberID string
+}
+
+// Returns every member that has ledger entries
+func (l *Ledger) Members() []MemberRef {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var members []MemberRef
+	for tenantID, accounts := range l.accounts {
+		for account := range accounts {
+			if memberID, ok := strings.CutPrefix(account, "member:"); ok {
+				members = append(members, MemberRef{TenantID: tenantID, MemberID: memberID})
+			}
+		}
+	}
+	return members
+}
+
+// Returns the lots of the member in the order they were credited
+func (l *Ledger) Lots(tenantID, memberID string) []Lot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.lots(TenantKey(tenantID), memberID)
+}
+
+// Returns the time of the latest earn or redemption of the member
+func (l *Ledger) LastActivity(tenantID, memberID string) time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.lastActivity(TenantKey(tenantID), memberID)
+}
+
+// Posts an expiry entry for the remaining points of every lot of the member
+// that expiresAt places at or before now. expiresAt receives the time the lot
+// was earned and the last activity of the member, and returns the zero time
+// for points that never expire. Returns the number of expired points
+func (l *Ledger) Expire(tenantID, memberID string, now time.Time, expiresAt func(earnedAt, lastActivity time.Time) time.Time, reason string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tenantID = TenantKey(tenantID)
+	lastActivity := l.lastActivity(tenantID, memberID)
+
+	expired := 0
+	for _, lot := range l.lots(tenantID, memberID) {
+		expiry := expiresAt(lot.EarnedAt, lastActivity)
+		if lot.Remaining <= 0 || expiry.IsZero() || now.Before(expiry) {
+			continue
+		}
+
+		_, _, err := l.post(LedgerEntry{
+			TenantID:  tenantID,
+			Type:      EntryExpiry,
+			Debit:     MemberAccount(memberID),
+			Credit:    ProgramAccount,
+			Amount:    lot.Remaining,
+			MemberID:  memberID,
+			ReceiptID: lot.ReceiptID,
+			LotID:     lot.EntryID,
+			Reason:    reason,
+			CreatedBy: "system:expiry",
+		})
+		if err != nil {
+			return expired, err
+		}
+		expired += lot.Remaining
+	}
+
+	return expired, nil
+}
+
+// Replays the entries of the member account. Credits open new lots, expiries
+// and reversals consume their own lot first, and every other debit consumes
+// the oldest lots first
+func (l *Ledger) lots(tenantID, memberID string) []Lot {
+	account := MemberAccount(memberID)
+	var lots []Lot
+
+	consume := func(amount int, match func(Lot) bool) int {
+		for i := range lots {
+			if amount == 0 {
+				break
+			}
+			if lots[i].Remaining == 0 || (match != nil && !match(lots[i])) {
+				continue
+			}
+			taken := min(amount, lots[i].Remaining)
+			lots[i].Remaining -= taken
+			amount -= taken
+		}
+		return amount
+	}
+
+	for _, position := range l.accounts[tenantID][account] {
+		entry := l.entries[tenantID][position]
+
+		if entry.Credit == account {
+			lots = append(lots, Lot{
+				EntryID:   entry.ID,
+				ReceiptID: entry.ReceiptID,
+				EarnedAt:  entry.CreatedAt,
+				Amount:    entry.Amount,
+				Remaining: entry.Amount,
+			})
+			continue
+		}
+
+		amount := entry.Amount
+		switch {
+		case entry.Type == EntryExpiry && entry.LotID != "":
+			amount = consume(amount, func(lot Lot) bool { return lot.EntryID == entry.LotID })
+		case entry.Type == EntryReversal && entry.ReceiptID != "":
+			amount = consume(amount, func(lot Lot) bool { return lot.ReceiptID == entry.ReceiptID })
+		}
+		consume(amount, nil)
+	}
+
+	return lots
+}
+
+func (l *Ledger) lastActivity(tenantID, memberID string) time.Time {
+	var last time.Time
+	for _, position := range l.accounts[tenantID][MemberAccount(memberID)] {
+		entry := l.entries[tenantID][position]
+		if (entry.Type == EntryEarn || entry.Type == EntryRedemption) && entry.CreatedAt.After(last) {
+			last = entry.CreatedAt
+		}
+	}
+	return last
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNoMember = errors.New("no member found for that ID")
+
+// Member is a loyalty program account. Its points are held
+// by the member account of the ledger
+type Member struct {
+	ID       string
+	TenantID string
+	Name     string
+	Email    string
+	// Tier the member was last moved to, empty when it qualifies for none
+	Tier      string
+	CreatedAt time.Time
+}
+
+// MemberStore keeps the members of every tenant in separate namespaces
+type MemberStore struct {
+	mu      sync.RWMutex
+	members map[string]map[string]Member
+}
+
+func NewMemberStore() *MemberStore {
+	return &MemberStore{
+		members: make(map[string]map[string]Member),
+	}
+}
+
+func (s *MemberStore) Insert(member Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member.TenantID = TenantKey(member.TenantID)
+	tenantMembers, exists := s.members[member.TenantID]
+	if !exists {
+		tenantMembers = make(map[string]Member)
+		s.members[member.TenantID] = tenantMembers
+	}
+	tenantMembers[member.ID] = member
+
+	return nil
+}
+
+func (s *MemberStore) Get(tenantID, id string) (Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	member, exists := s.members[TenantKey(tenantID)][id]
+	if !exists {
+		return Member{}, ErrNoMember
+	}
+
+	return member, nil
+}
+
+// Moves the member to the tier
+func (s *MemberStore) SetTier(tenantID, id, tier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member, exists := s.members[TenantKey(tenantID)][id]
+	if !exists {
+		return ErrNoMember
+	}
+	member.Tier = tier
+	s.members[TenantKey(tenantID)][id] = member
+
+	return nil
+}
+
+// Returns the members of the tenant in the order they were created
+func (s *MemberStore) List(tenantID string) []Member {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := make([]Member, 0, len(s.members[TenantKey(tenantID)]))
+	for _, member := range s.members[TenantKey(tenantID)] {
+		members = append(members, member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].ID < members[j].ID
+		}
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+
+	return members
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var SimpleMember = Member{
+	ID:        "member-1",
+	Name:      "Jane Doe",
+	Email:     "jane@example.com",
+	CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestMemberInsertAndGet(t *testing.T) {
+	store := NewMemberStore()
+	store.Insert(SimpleMember)
+
+	member, err := store.Get(DefaultTenantID, SimpleMember.ID)
+	if err != nil {
+		t.Fatalf("Could not get member with ID %s", SimpleMember.ID)
+	}
+	if member.Name != SimpleMember.Name {
+		t.Errorf("Expected name %s, received %s", SimpleMember.Name, member.Name)
+	}
+
+	if _, err := store.Get("brand-a", SimpleMember.ID); err != ErrNoMember {
+		t.Errorf("Expected %v for another tenant, received %v", ErrNoMember, err)
+	}
+}
+
+func TestMemberList(t *testing.T) {
+	store := NewMemberStore()
+	for i := 3; i > 0; i-- {
+		member := SimpleMember
+		member.ID = fmt.Sprintf("member-%d", i)
+		member.CreatedAt = SimpleMember.CreatedAt.Add(time.Duration(i) * time.Hour)
+		store.Insert(member)
+	}
+	store.Insert(Member{ID: "other-tenant", TenantID: "brand-a"})
+
+	members := store.List(DefaultTenantID)
+	if len(members) != 3 {
+		t.Fatalf("Expected 3 members, received %d", len(members))
+	}
+	for i, member := range members {
+		expected := fmt.Sprintf("member-%d", i+1)
+		if member.ID != expected {
+			t.Errorf("Expected %s at position %d, received %s", expected, i, member.ID)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+// ReceiptObserver is notified when live receipts are added to the store
+// or removed from it. A revised receipt is removed, then added again.
+// Observers are called with the store locked, so they must not call it
+type ReceiptObserver interface {
+	ReceiptAdded(receipt Receipt)
+	ReceiptRemoved(receipt Receipt)
+}
+
+// Registers an observer. It is notified of the receipts already stored,
+// then of every change to the live receipts
+func (s *ReceiptStore) Observe(observer ReceiptObserver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenantReceipts := range s.receipts {
+		for _, receipt := range tenantReceipts {
+			observer.ReceiptAdded(receipt)
+		}
+	}
+	s.observers = append(s.observers, observer)
+}
+
+func (s *ReceiptStore) added(receipt Receipt) {
+	for _, observer := range s.observers {
+		observer.ReceiptAdded(receipt)
+	}
+}
+
+func (s *ReceiptStore) removed(receipt Receipt) {
+	for _, observer := range s.observers {
+		observer.ReceiptRemoved(receipt)
+	}
+}
@@ -1,51 +1,327 @@
 package models
 
 import (
-	"fmt"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tenant of receipts submitted without one
+const DefaultTenantID = "default"
+
+var (
+	ErrNoRecord      = errors.New("no receipt found for that ID")
+	ErrQuotaExceeded = errors.New("receipt quota exceeded")
+	// The receipt was revised since the revision the update is based on
+	ErrRevisionConflict = errors.New("receipt revision conflict")
 )
 
 type Receipt struct {
-	ID           string
-	Retailer     string
-	PurchaseDate string
-	PurchaseTime string
-	Total        string
-	Items        []Item
-	Points       int
+	ID       string
+	TenantID string
+	Retailer string
+	// Name the retailer is registered under, the trimmed raw name for
+	// retailers missing from the registry
+	CanonicalRetailer string
+	PurchaseDate      string
+	PurchaseTime      string
+	// Zone the purchase date and time were read in, and the instant they denote
+	TimeZone    string
+	PurchasedAt time.Time
+	// Zone named by the submitter, empty when the receipt took the zone of
+	// its retailer or of the server, so that revisions resolve it again
+	RequestedTimeZone string
+	Total             string
+	Items             []Item
+	Points            int
+	Breakdown         PointsBreakdown
+	// Name of the principal that submitted the receipt
+	SubmittedBy string
+	// Name of the principal that stored the revision
+	UpdatedBy string
+	// Loyalty member credited with the points, empty for anonymous receipts
+	MemberID string
+	// Revisions are numbered from 1, every update stores a new revision
+	Revision  int
+	CreatedAt time.Time
+	// Time the revision was stored
+	UpdatedAt time.Time
+	// Time the receipt was soft-deleted, zero for live receipts
+	DeletedAt time.Time
+}
+
+// Returns a copy of the receipt that shares no items with it, so that
+// receipts handed out by the store cannot change the stored ones
+func (r Receipt) clone() Receipt {
+	r.Items = slices.Clone(r.Items)
+	return r
 }
 
+// PointsBreakdown records how the points of a receipt were reached
+type PointsBreakdown struct {
+	// Points calculated with the rules
+	BasePoints int
+	// Tier of the member when the receipt was submitted
+	Tier       string
+	Multiplier float64
+}
+
+// ReceiptStore keeps the receipts of every tenant in separate namespaces,
+// so that a receipt can only be read or deleted by its own tenant
 type ReceiptStore struct {
-	receipts map[string]Receipt
+	mu       sync.RWMutex
+	receipts map[string]map[string]Receipt
+	// Prior revisions of every receipt, oldest first, per tenant
+	revisions map[string]map[string][]Receipt
+	// Soft-deleted receipts that can still be restored, per tenant
+	deleted map[string]map[string]Receipt
+	// Last time each live receipt was read, guarded by accessMu so that
+	// reads only need the read lock of the store
+	accessMu   sync.Mutex
+	lastAccess map[receiptKey]time.Time
+	// Maximum number of stored receipts per tenant, unlimited when absent
+	quotas map[string]int
+	// Notified of changes to the live receipts
+	observers []ReceiptObserver
+	now       func() time.Time
 }
 
 func NewStore() *ReceiptStore {
 	return &ReceiptStore{
-		receipts: make(map[string]Receipt),
+		receipts:   make(map[string]map[string]Receipt),
+		revisions:  make(map[string]map[string][]Receipt),
+		deleted:    make(map[string]map[string]Receipt),
+		lastAccess: make(map[receiptKey]time.Time),
+		quotas:     make(map[string]int),
+		now:        time.Now,
+	}
+}
+
+// Returns the tenant id the data of the tenant is kept under,
+// the default tenant for an empty id
+func TenantKey(tenantID string) string {
+	if tenantID == "" {
+		return DefaultTenantID
+	}
+	return tenantID
+}
+
+// Limits the number of receipts the tenant can store, zero removes the limit
+func (s *ReceiptStore) SetQuota(tenantID string, maxReceipts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if maxReceipts <= 0 {
+		delete(s.quotas, TenantKey(tenantID))
+		return
 	}
+	s.quotas[TenantKey(tenantID)] = maxReceipts
 }
 
+// Inserts the receipt into the namespace of its tenant
 func (s *ReceiptStore) Insert(receipt Receipt) error {
-	s.receipts[receipt.ID] = receipt
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt.TenantID = TenantKey(receipt.TenantID)
+	tenantReceipts, exists := s.receipts[receipt.TenantID]
+	if !exists {
+		tenantReceipts = make(map[string]Receipt)
+		s.receipts[receipt.TenantID] = tenantReceipts
+	}
+
+	// Replacing an existing receipt does not count against the quota
+	previous, replacing := tenantReceipts[receipt.ID]
+	if quota, limited := s.quotas[receipt.TenantID]; limited && !replacing && len(tenantReceipts) >= quota {
+		return ErrQuotaExceeded
+	}
+
+	if receipt.Revision == 0 {
+		receipt.Revision = 1
+	}
+	if receipt.CreatedAt.IsZero() {
+		receipt.CreatedAt = s.now().UTC()
+	}
+	tenantReceipts[receipt.ID] = receipt.clone()
+	if replacing {
+		s.removed(previous)
+	}
+	s.added(receipt)
+	// A new receipt replaces any deleted receipt with the same id
+	if _, wasDeleted := s.deleted[receipt.TenantID][receipt.ID]; wasDeleted {
+		delete(s.deleted[receipt.TenantID], receipt.ID)
+		delete(s.revisions[receipt.TenantID], receipt.ID)
+	}
 
 	return nil
 }
 
-func (s *ReceiptStore) Get(id string) (Receipt, error) {
-	receipt, exists := s.receipts[id]
+// Stores the receipt as a new revision of the receipt with the same id,
+// provided that the current revision is still the expected one.
+// Returns the receipt with its revision number and creation time set
+func (s *ReceiptStore) Update(receipt Receipt, expectedRevision int) (Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt.TenantID = TenantKey(receipt.TenantID)
+	current, exists := s.receipts[receipt.TenantID][receipt.ID]
+	if !exists {
+		return Receipt{}, ErrNoRecord
+	}
+	if current.Revision != expectedRevision {
+		return Receipt{}, ErrRevisionConflict
+	}
+
+	tenantRevisions, exists := s.revisions[receipt.TenantID]
 	if !exists {
-		return Receipt{}, fmt.Errorf("no receipt found for that ID")
+		tenantRevisions = make(map[string][]Receipt)
+		s.revisions[receipt.TenantID] = tenantRevisions
 	}
+	tenantRevisions[receipt.ID] = append(tenantRevisions[receipt.ID], current)
+
+	receipt.Revision = current.Revision + 1
+	receipt.SubmittedBy = current.SubmittedBy
+	receipt.CreatedAt = current.CreatedAt
+	s.receipts[receipt.TenantID][receipt.ID] = receipt.clone()
+	s.removed(current)
+	s.added(receipt)
 
 	return receipt, nil
 }
 
-func (s *ReceiptStore) Delete(id string) error {
-	_, exists := s.receipts[id]
+// Returns every revision of the receipt, oldest first
+func (s *ReceiptStore) Revisions(tenantID, id string) ([]Receipt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, exists := s.receipts[TenantKey(tenantID)][id]
+	if !exists {
+		return nil, ErrNoRecord
+	}
+
+	prior := s.revisions[TenantKey(tenantID)][id]
+	revisions := make([]Receipt, 0, len(prior)+1)
+	for _, revision := range prior {
+		revisions = append(revisions, revision.clone())
+	}
+
+	return append(revisions, current.clone()), nil
+}
+
+func (s *ReceiptStore) Get(tenantID, id string) (Receipt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	receipt, exists := s.receipts[TenantKey(tenantID)][id]
+	if !exists {
+		return Receipt{}, ErrNoRecord
+	}
+	s.touch(receipt.TenantID, id)
+
+	return receipt.clone(), nil
+}
+
+// Returns the live receipts of the tenant, oldest first
+func (s *ReceiptStore) List(tenantID string) []Receipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	receipts := make([]Receipt, 0, len(s.receipts[TenantKey(tenantID)]))
+	for _, receipt := range s.receipts[TenantKey(tenantID)] {
+		receipts = append(receipts, receipt.clone())
+	}
+
+	sort.Slice(receipts, func(i, j int) bool {
+		if receipts[i].CreatedAt.Equal(receipts[j].CreatedAt) {
+			return receipts[i].ID < receipts[j].ID
+		}
+		return receipts[i].CreatedAt.Before(receipts[j].CreatedAt)
+	})
+
+	return receipts
+}
+
+// Soft-deletes the receipt: it is no longer returned, but is kept with its
+// revisions as a tombstone until it is restored or purged
+func (s *ReceiptStore) Delete(tenantID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID = TenantKey(tenantID)
+	receipt, exists := s.receipts[tenantID][id]
 	if !exists {
-		return fmt.Errorf("no receipt found for that ID")
+		return ErrNoRecord
 	}
 
-	delete(s.receipts, id)
+	tenantDeleted, exists := s.deleted[tenantID]
+	if !exists {
+		tenantDeleted = make(map[string]Receipt)
+		s.deleted[tenantID] = tenantDeleted
+	}
+	receipt.DeletedAt = s.now().UTC()
+	tenantDeleted[id] = receipt
+	delete(s.receipts[tenantID], id)
+	s.forget(tenantID, id)
+	s.removed(receipt)
 
 	return nil
 }
+
+// Brings a soft-deleted receipt back and returns it
+func (s *ReceiptStore) Restore(tenantID, id string) (Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID = TenantKey(tenantID)
+	receipt, exists := s.deleted[tenantID][id]
+	if !exists {
+		return Receipt{}, ErrNoRecord
+	}
+
+	tenantReceipts, exists := s.receipts[tenantID]
+	if !exists {
+		tenantReceipts = make(map[string]Receipt)
+		s.receipts[tenantID] = tenantReceipts
+	}
+	if quota, limited := s.quotas[tenantID]; limited && len(tenantReceipts) >= quota {
+		return Receipt{}, ErrQuotaExceeded
+	}
+
+	receipt.DeletedAt = time.Time{}
+	tenantReceipts[id] = receipt
+	delete(s.deleted[tenantID], id)
+	s.added(receipt)
+
+	return receipt.clone(), nil
+}
+
+// Permanently removes the receipts soft-deleted before the provided time
+// and returns them
+func (s *ReceiptStore) PurgeDeleted(before time.Time) []Receipt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged []Receipt
+	for tenantID, tenantDeleted := range s.deleted {
+		for id, receipt := range tenantDeleted {
+			if !receipt.DeletedAt.Before(before) {
+				continue
+			}
+			delete(tenantDeleted, id)
+			delete(s.revisions[tenantID], id)
+			purged = append(purged, receipt)
+		}
+	}
+
+	return purged
+}
+
+// Returns the number of receipts stored by the tenant
+func (s *ReceiptStore) Count(tenantID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.receipts[TenantKey(tenantID)])
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"testing"
+	"time"
 )
 
 var SimpleReceipt = &Receipt{
@@ -46,15 +47,15 @@ func TestInsert(t *testing.T) {
 		t.Run(entry.name, func(t *testing.T) {
 			_ = d.receiptStore.Insert(*entry.receipt)
 
-			if entry.receipt == nil && len(d.receiptStore.receipts) == 1 {
-				t.Errorf("Expected receipts map to be empty, but got length %d", len(d.receiptStore.receipts))
+			if entry.receipt == nil && len(d.receiptStore.receipts[DefaultTenantID]) == 1 {
+				t.Errorf("Expected receipts map to be empty, but got length %d", len(d.receiptStore.receipts[DefaultTenantID]))
 			}
 
-			if entry.receipt != nil && len(d.receiptStore.receipts) != 1 {
-				t.Errorf("Expected a receipt, but got length %d", len(d.receiptStore.receipts))
+			if entry.receipt != nil && len(d.receiptStore.receipts[DefaultTenantID]) != 1 {
+				t.Errorf("Expected a receipt, but got length %d", len(d.receiptStore.receipts[DefaultTenantID]))
 			}
 
-			_, exists := d.receiptStore.receipts[entry.receipt.ID]
+			_, exists := d.receiptStore.receipts[DefaultTenantID][entry.receipt.ID]
 			if !exists {
 				t.Errorf("receipt with ID %v was not inserted", entry.receipt.ID)
 			}
@@ -78,7 +79,7 @@ func TestGet(t *testing.T) {
 	for _, entry := range tests {
 		t.Run(entry.name, func(t *testing.T) {
 			_ = d.receiptStore.Insert(*entry.receipt)
-			inserted, err := d.receiptStore.Get(entry.receipt.ID)
+			inserted, err := d.receiptStore.Get(DefaultTenantID, entry.receipt.ID)
 			if err != nil {
 				t.Errorf("Could not get receipt with ID %s", entry.receipt.ID)
 			}
@@ -96,7 +97,7 @@ func TestGet(t *testing.T) {
 
 func TestGetInvalidID(t *testing.T) {
 	d := setupTestDependencies()
-	_, err := d.receiptStore.Get("invalid-id")
+	_, err := d.receiptStore.Get(DefaultTenantID, "invalid-id")
 	if err == nil {
 		t.Errorf("Expected an error, but got none")
 	}
@@ -124,10 +125,10 @@ func TestDelete(t *testing.T) {
 			d.receiptStore.Insert(*SimpleReceipt)
 
 			// Attempt to delete a receipt using entry id
-			d.receiptStore.Delete(entry.id)
+			d.receiptStore.Delete(DefaultTenantID, entry.id)
 
 			// Attempt to retrieve a receipt using entry id
-			inserted, _ := d.receiptStore.Get(entry.id)
+			inserted, _ := d.receiptStore.Get(DefaultTenantID, entry.id)
 			if inserted.ID == SimpleReceipt.ID {
 				t.Errorf("Expected receipt with id %s to be deleted, but it was not.", SimpleReceipt.ID)
 			}
@@ -139,3 +140,159 @@ func TestDelete(t *testing.T) {
 	}
 
 }
+
+func TestTenantIsolation(t *testing.T) {
+	d := setupTestDependencies()
+	receipt := *SimpleReceipt
+	receipt.TenantID = "brand-a"
+	d.receiptStore.Insert(receipt)
+
+	if _, err := d.receiptStore.Get("brand-b", receipt.ID); err != ErrNoRecord {
+		t.Errorf("Expected another tenant not to read the receipt, got %v", err)
+	}
+	if err := d.receiptStore.Delete("brand-b", receipt.ID); err != ErrNoRecord {
+		t.Errorf("Expected another tenant not to delete the receipt, got %v", err)
+	}
+	if _, err := d.receiptStore.Get("brand-a", receipt.ID); err != nil {
+		t.Errorf("Expected the owning tenant to read the receipt, got %v", err)
+	}
+
+	// Receipts without a tenant belong to the default tenant
+	d.receiptStore.Insert(*SimpleReceipt)
+	if _, err := d.receiptStore.Get(DefaultTenantID, SimpleReceipt.ID); err != nil {
+		t.Errorf("Expected the receipt to be stored for the default tenant, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	d := setupTestDependencies()
+	now := time.Now()
+	d.receiptStore.Insert(Receipt{ID: "second", CreatedAt: now})
+	d.receiptStore.Insert(Receipt{ID: "first", CreatedAt: now.Add(-time.Hour)})
+	d.receiptStore.Insert(Receipt{ID: "deleted", CreatedAt: now})
+	d.receiptStore.Insert(Receipt{ID: "other", TenantID: "brand-a", CreatedAt: now})
+	d.receiptStore.Delete(DefaultTenantID, "deleted")
+
+	receipts := d.receiptStore.List(DefaultTenantID)
+	if len(receipts) != 2 || receipts[0].ID != "first" || receipts[1].ID != "second" {
+		t.Errorf("Expected the live receipts of the tenant oldest first, received %+v", receipts)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	d := setupTestDependencies()
+	d.receiptStore.SetQuota("brand-a", 2)
+
+	tests := []struct {
+		name     string
+		tenantID string
+		id       string
+		expected error
+	}{
+		{"First receipt", "brand-a", "1", nil},
+		{"Second receipt", "brand-a", "2", nil},
+		{"Over quota", "brand-a", "3", ErrQuotaExceeded},
+		{"Replacing within quota", "brand-a", "2", nil},
+		{"Other tenant is not limited", "brand-b", "3", nil},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			err := d.receiptStore.Insert(Receipt{ID: entry.id, TenantID: entry.tenantID})
+			if err != entry.expected {
+				t.Errorf("Expected %v, received %v", entry.expected, err)
+			}
+		})
+	}
+
+	// Removing the quota allows further receipts
+	d.receiptStore.SetQuota("brand-a", 0)
+	if err := d.receiptStore.Insert(Receipt{ID: "3", TenantID: "brand-a"}); err != nil {
+		t.Errorf("Expected no error after removing the quota, got %v", err)
+	}
+	if count := d.receiptStore.Count("brand-a"); count != 3 {
+		t.Errorf("Expected 3 receipts, received %d", count)
+	}
+}
+
+func TestUpdateRevisions(t *testing.T) {
+	d := setupTestDependencies()
+	d.receiptStore.Insert(*SimpleReceipt)
+
+	update := *SimpleReceipt
+	update.Retailer = "Walmart"
+	updated, err := d.receiptStore.Update(update, 1)
+	if err != nil {
+		t.Fatalf("Failed to update receipt: %v", err)
+	}
+	if updated.Revision != 2 {
+		t.Errorf("Expected revision 2, received %d", updated.Revision)
+	}
+
+	// Updates based on a stale revision are rejected
+	if _, err := d.receiptStore.Update(update, 1); err != ErrRevisionConflict {
+		t.Errorf("Expected %v, received %v", ErrRevisionConflict, err)
+	}
+	if _, err := d.receiptStore.Update(Receipt{ID: "unknown"}, 1); err != ErrNoRecord {
+		t.Errorf("Expected %v, received %v", ErrNoRecord, err)
+	}
+
+	revisions, err := d.receiptStore.Revisions(DefaultTenantID, SimpleReceipt.ID)
+	if err != nil {
+		t.Fatalf("Failed to get revisions: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Retailer != "Target" || revisions[1].Retailer != "Walmart" {
+		t.Errorf("Expected the original and the updated revision, received %+v", revisions)
+	}
+
+	// Deleting the receipt removes its history
+	d.receiptStore.Delete(DefaultTenantID, SimpleReceipt.ID)
+	d.receiptStore.Insert(*SimpleReceipt)
+	if revisions, _ := d.receiptStore.Revisions(DefaultTenantID, SimpleReceipt.ID); len(revisions) != 1 {
+		t.Errorf("Expected a single revision after deletion, received %d", len(revisions))
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	d := setupTestDependencies()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.receiptStore.now = func() time.Time { return now }
+	d.receiptStore.Insert(*SimpleReceipt)
+	d.receiptStore.Insert(Receipt{ID: "other"})
+
+	d.receiptStore.Delete(DefaultTenantID, SimpleReceipt.ID)
+	now = now.Add(time.Hour)
+	d.receiptStore.Delete(DefaultTenantID, "other")
+
+	if _, err := d.receiptStore.Get(DefaultTenantID, SimpleReceipt.ID); err != ErrNoRecord {
+		t.Errorf("Expected a deleted receipt to be hidden, received %v", err)
+	}
+
+	// Deleted receipts do not count against the quota, but restoring them does
+	d.receiptStore.SetQuota(DefaultTenantID, 1)
+	d.receiptStore.Insert(Receipt{ID: "new"})
+	if _, err := d.receiptStore.Restore(DefaultTenantID, SimpleReceipt.ID); err != ErrQuotaExceeded {
+		t.Errorf("Expected %v, received %v", ErrQuotaExceeded, err)
+	}
+	d.receiptStore.SetQuota(DefaultTenantID, 0)
+
+	restored, err := d.receiptStore.Restore(DefaultTenantID, SimpleReceipt.ID)
+	if err != nil || !restored.DeletedAt.IsZero() {
+		t.Fatalf("Expected the receipt to be restored, received %+v and %v", restored, err)
+	}
+	if _, err := d.receiptStore.Restore(DefaultTenantID, SimpleReceipt.ID); err != ErrNoRecord {
+		t.Errorf("Expected a live receipt not to be restored, received %v", err)
+	}
+
+	// Purging removes the tombstones deleted before the time
+	d.receiptStore.Delete(DefaultTenantID, SimpleReceipt.ID)
+	if purged := d.receiptStore.PurgeDeleted(now); len(purged) != 0 {
+		t.Errorf("Expected no receipt deleted before the cutoff, purged %d", len(purged))
+	}
+	if purged := d.receiptStore.PurgeDeleted(now.Add(time.Second)); len(purged) != 2 {
+		t.Errorf("Expected 2 purged receipts, purged %d", len(purged))
+	}
+	if _, err := d.receiptStore.Restore(DefaultTenantID, "other"); err != ErrNoRecord {
+		t.Errorf("Expected a purged receipt not to be restored, received %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import "time"
+
+// Approximate memory held by a receipt besides the length of its strings
+const (
+	receiptOverhead = 256
+	itemOverhead    = 48
+)
+
+type receiptKey struct {
+	tenantID string
+	id       string
+}
+
+// StoredReceipt describes a live receipt for retention decisions
+type StoredReceipt struct {
+	TenantID     string
+	ID           string
+	PurchaseDate string
+	PurchaseTime string
+	// Instant of the purchase, zero for receipts stored before it was recorded
+	PurchasedAt time.Time
+	CreatedAt   time.Time
+	// Last time the receipt was read, its creation time if it never was
+	LastAccess time.Time
+	// Estimated bytes held by the receipt and its prior revisions
+	Size int
+}
+
+// Returns a rough estimate of the memory held by the receipt, in bytes
+func (r Receipt) EstimatedSize() int {
+	size := receiptOverhead + len(r.ID) + len(r.TenantID) + len(r.Retailer) + len(r.CanonicalRetailer) +
+		len(r.PurchaseDate) + len(r.PurchaseTime) + len(r.TimeZone) + len(r.Total) +
+		len(r.SubmittedBy) + len(r.UpdatedBy) + len(r.MemberID) + len(r.Breakdown.Tier)
+	for _, item := range r.Items {
+		size += itemOverhead + len(item.ShortDescription) + len(item.Price)
+	}
+	return size
+}
+
+// Returns every live receipt of every tenant
+func (s *ReceiptStore) Stored() []StoredReceipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	var stored []StoredReceipt
+	for tenantID, tenantReceipts := range s.receipts {
+		for id, receipt := range tenantReceipts {
+			size := receipt.EstimatedSize()
+			for _, revision := range s.revisions[tenantID][id] {
+				size += revision.EstimatedSize()
+			}
+
+			lastAccess, accessed := s.lastAccess[receiptKey{tenantID, id}]
+			if !accessed {
+				lastAccess = receipt.CreatedAt
+			}
+
+			stored = append(stored, StoredReceipt{
+				TenantID:     tenantID,
+				ID:           id,
+				PurchaseDate: receipt.PurchaseDate,
+				PurchaseTime: receipt.PurchaseTime,
+				PurchasedAt:  receipt.PurchasedAt,
+				CreatedAt:    receipt.CreatedAt,
+				LastAccess:   lastAccess,
+				Size:         size,
+			})
+		}
+	}
+
+	return stored
+}
+
+// Permanently removes a live receipt and its revisions without leaving a
+// tombstone, and returns it. Points the receipt earned its member are kept
+func (s *ReceiptStore) Evict(tenantID, id string) (Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID = TenantKey(tenantID)
+	receipt, exists := s.receipts[tenantID][id]
+	if !exists {
+		return Receipt{}, ErrNoRecord
+	}
+
+	delete(s.receipts[tenantID], id)
+	delete(s.revisions[tenantID], id)
+	s.forget(tenantID, id)
+	s.removed(receipt)
+
+	return receipt, nil
+}
+
+// Records that the receipt was read
+func (s *ReceiptStore) touch(tenantID, id string) {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	s.lastAccess[receiptKey{tenantID, id}] = s.now().UTC()
+}
+
+func (s *ReceiptStore) forget(tenantID, id string) {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	delete(s.lastAccess, receiptKey{tenantID, id})
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoredAndEvict(t *testing.T) {
+	d := setupTestDependencies()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.receiptStore.now = func() time.Time { return now }
+	d.receiptStore.Insert(*SimpleReceipt)
+
+	stored := d.receiptStore.Stored()
+	if len(stored) != 1 {
+		t.Fatalf("Expected 1 stored receipt, received %d", len(stored))
+	}
+	if !stored[0].CreatedAt.Equal(now) || !stored[0].LastAccess.Equal(now) {
+		t.Errorf("Expected a receipt that was never read to be last accessed when created, received %+v", stored[0])
+	}
+
+	// Reads are tracked, and revisions add to the size of the receipt
+	now = now.Add(time.Hour)
+	receipt, _ := d.receiptStore.Get(DefaultTenantID, SimpleReceipt.ID)
+	if stored[0].Size != receipt.EstimatedSize() {
+		t.Errorf("Expected size %d, received %d", receipt.EstimatedSize(), stored[0].Size)
+	}
+	receipt.Retailer = "Walgreens"
+	d.receiptStore.Update(receipt, 1)
+
+	stored = d.receiptStore.Stored()
+	if !stored[0].LastAccess.Equal(now) {
+		t.Errorf("Expected the receipt to be last accessed at %v, received %v", now, stored[0].LastAccess)
+	}
+	if stored[0].Size <= receipt.EstimatedSize() {
+		t.Errorf("Expected revisions to add to the size, received %d", stored[0].Size)
+	}
+
+	// Evicted receipts leave no tombstone
+	if evicted, err := d.receiptStore.Evict(DefaultTenantID, SimpleReceipt.ID); err != nil || evicted.ID != SimpleReceipt.ID {
+		t.Fatalf("Failed to evict the receipt: %v", err)
+	}
+	if _, err := d.receiptStore.Evict(DefaultTenantID, SimpleReceipt.ID); err != ErrNoRecord {
+		t.Errorf("Expected %v, received %v", ErrNoRecord, err)
+	}
+	if _, err := d.receiptStore.Restore(DefaultTenantID, SimpleReceipt.ID); err != ErrNoRecord {
+		t.Errorf("Expected an evicted receipt not to be restored, received %v", err)
+	}
+	if len(d.receiptStore.Stored()) != 0 {
+		t.Error("Expected no stored receipts after eviction")
+	}
+}
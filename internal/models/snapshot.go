@@ -0,0 +1,142 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StoreEntry is a receipt of the store with its prior revisions, oldest
+// first. Soft-deleted receipts have their DeletedAt time set
+type StoreEntry struct {
+	Receipt   Receipt
+	Revisions []Receipt
+}
+
+// Returns every live and soft-deleted receipt of every tenant, ordered
+// by tenant, creation time and id
+func (s *ReceiptStore) Entries() []StoreEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []StoreEntry
+	for _, receipts := range []map[string]map[string]Receipt{s.receipts, s.deleted} {
+		for tenantID, tenantReceipts := range receipts {
+			for id, receipt := range tenantReceipts {
+				var revisions []Receipt
+				for _, revision := range s.revisions[tenantID][id] {
+					revisions = append(revisions, revision.clone())
+				}
+				entries = append(entries, StoreEntry{
+					Receipt:   receipt.clone(),
+					Revisions: revisions,
+				})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Receipt, entries[j].Receipt
+		switch {
+		case a.TenantID != b.TenantID:
+			return a.TenantID < b.TenantID
+		case !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+
+	return entries
+}
+
+// Replaces the whole content of the store with the entries at once.
+// Quotas are not enforced, so that a backup is always restored in full
+func (s *ReceiptStore) Replace(entries []StoreEntry) error {
+	if err := checkEntries(entries); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenantReceipts := range s.receipts {
+		for _, receipt := range tenantReceipts {
+			s.removed(receipt)
+		}
+	}
+	s.receipts = make(map[string]map[string]Receipt)
+	s.revisions = make(map[string]map[string][]Receipt)
+	s.deleted = make(map[string]map[string]Receipt)
+	s.accessMu.Lock()
+	s.lastAccess = make(map[receiptKey]time.Time)
+	s.accessMu.Unlock()
+
+	for _, entry := range entries {
+		s.put(entry)
+	}
+	return nil
+}
+
+// Adds the entries to the store at once, replacing the receipts of the
+// same tenant and id. Quotas are not enforced
+func (s *ReceiptStore) Merge(entries []StoreEntry) error {
+	if err := checkEntries(entries); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		tenantID, id := TenantKey(entry.Receipt.TenantID), entry.Receipt.ID
+		if receipt, live := s.receipts[tenantID][id]; live {
+			s.removed(receipt)
+		}
+		delete(s.receipts[tenantID], id)
+		delete(s.deleted[tenantID], id)
+		delete(s.revisions[tenantID], id)
+		s.forget(tenantID, id)
+		s.put(entry)
+	}
+	return nil
+}
+
+// Stores the entry in the live or deleted receipts of its tenant
+func (s *ReceiptStore) put(entry StoreEntry) {
+	receipt := entry.Receipt
+	receipt.TenantID = TenantKey(receipt.TenantID)
+
+	target := s.receipts
+	if !receipt.DeletedAt.IsZero() {
+		target = s.deleted
+	} else {
+		s.added(receipt)
+	}
+	if target[receipt.TenantID] == nil {
+		target[receipt.TenantID] = make(map[string]Receipt)
+	}
+	target[receipt.TenantID][receipt.ID] = receipt
+
+	if len(entry.Revisions) > 0 {
+		if s.revisions[receipt.TenantID] == nil {
+			s.revisions[receipt.TenantID] = make(map[string][]Receipt)
+		}
+		s.revisions[receipt.TenantID][receipt.ID] = append([]Receipt(nil), entry.Revisions...)
+	}
+}
+
+// Rejects entries without an id, or holding the same receipt twice
+func checkEntries(entries []StoreEntry) error {
+	seen := make(map[receiptKey]bool, len(entries))
+	for i, entry := range entries {
+		key := receiptKey{TenantKey(entry.Receipt.TenantID), entry.Receipt.ID}
+		if key.id == "" {
+			return fmt.Errorf("entry %d has no receipt id", i+1)
+		}
+		if seen[key] {
+			return fmt.Errorf("entry %d repeats receipt %s of tenant %s", i+1, key.id, key.tenantID)
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// Fills a store with a revised receipt, a deleted receipt and a receipt of another tenant
+func snapshotStore() *ReceiptStore {
+	store := NewStore()
+	now := time.Now()
+	store.Insert(Receipt{ID: "revised", Retailer: "Target", CreatedAt: now})
+	store.Update(Receipt{ID: "revised", Retailer: "Walgreens"}, 1)
+	store.Insert(Receipt{ID: "deleted", CreatedAt: now.Add(-time.Hour)})
+	store.Delete(DefaultTenantID, "deleted")
+	store.Insert(Receipt{ID: "other", TenantID: "brand-a", CreatedAt: now})
+	return store
+}
+
+func TestEntries(t *testing.T) {
+	entries := snapshotStore().Entries()
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, received %+v", entries)
+	}
+	// Ordered by tenant, then creation time
+	if entries[0].Receipt.ID != "other" || entries[1].Receipt.ID != "deleted" || entries[2].Receipt.ID != "revised" {
+		t.Errorf("Unexpected order %s, %s, %s", entries[0].Receipt.ID, entries[1].Receipt.ID, entries[2].Receipt.ID)
+	}
+	if entries[1].Receipt.DeletedAt.IsZero() {
+		t.Errorf("Expected the deleted receipt to keep its deletion time")
+	}
+	if len(entries[2].Revisions) != 1 || entries[2].Revisions[0].Retailer != "Target" || entries[2].Receipt.Revision != 2 {
+		t.Errorf("Expected the prior revision of the revised receipt, received %+v", entries[2])
+	}
+}
+
+func TestReplace(t *testing.T) {
+	source := snapshotStore()
+	store := NewStore()
+	store.Insert(Receipt{ID: "dropped"})
+
+	if err := store.Replace(source.Entries()); err != nil {
+		t.Fatalf("Failed to replace the store: %v", err)
+	}
+
+	if _, err := store.Get(DefaultTenantID, "dropped"); err != ErrNoRecord {
+		t.Errorf("Expected the receipts of the store to be replaced, got %v", err)
+	}
+	if revisions, err := store.Revisions(DefaultTenantID, "revised"); err != nil || len(revisions) != 2 {
+		t.Errorf("Expected both revisions of the revised receipt, received %d, %v", len(revisions), err)
+	}
+	if _, err := store.Restore(DefaultTenantID, "deleted"); err != nil {
+		t.Errorf("Expected the deleted receipt to be restorable, got %v", err)
+	}
+	if _, err := store.Get("brand-a", "other"); err != nil {
+		t.Errorf("Expected the receipt of the other tenant, got %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	store := NewStore()
+	store.Insert(Receipt{ID: "kept"})
+	store.Insert(Receipt{ID: "revised", Retailer: "Costco"})
+
+	if err := store.Merge(snapshotStore().Entries()); err != nil {
+		t.Fatalf("Failed to merge into the store: %v", err)
+	}
+
+	if _, err := store.Get(DefaultTenantID, "kept"); err != nil {
+		t.Errorf("Expected the receipts missing from the entries to be kept, got %v", err)
+	}
+	if receipt, _ := store.Get(DefaultTenantID, "revised"); receipt.Retailer != "Walgreens" {
+		t.Errorf("Expected the entry to replace the receipt with the same id, received %+v", receipt)
+	}
+	if len(store.Entries()) != 4 {
+		t.Errorf("Expected 4 entries, received %d", len(store.Entries()))
+	}
+}
+
+func TestReplaceRejectsInvalidEntries(t *testing.T) {
+	store := snapshotStore()
+	tests := map[string][]StoreEntry{
+		"No id":     {{Receipt: Receipt{Retailer: "Target"}}},
+		"Duplicate": {{Receipt: Receipt{ID: "a"}}, {Receipt: Receipt{ID: "a", TenantID: DefaultTenantID}}},
+	}
+
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Replace(entries); err == nil {
+				t.Errorf("Expected the entries to be rejected")
+			}
+			if len(store.Entries()) != 3 {
+				t.Errorf("Expected the store to be left unchanged")
+			}
+		})
+	}
+}
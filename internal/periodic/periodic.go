@@ -0,0 +1,27 @@
+// Package periodic runs the background work of the server, such as
+// expiring points or retrying webhook deliveries, on an interval
+package periodic
+
+import (
+	"context"
+	"time"
+)
+
+// Calls run right away and then every interval until the context is
+// cancelled. A value received from wake calls run early, a nil wake
+// channel never does
+func Run(ctx context.Context, interval time.Duration, wake <-chan struct{}, run func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package periodic
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wake := make(chan struct{})
+	runs := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		Run(ctx, time.Hour, wake, func() { runs <- struct{}{} })
+	}()
+
+	// Runs right away, and again when woken long before the interval
+	<-runs
+	wake <- struct{}{}
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a run after the wake up")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once the context is cancelled")
+	}
+}
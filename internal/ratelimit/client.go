@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies holds the networks allowed to set X-Forwarded-For
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// Parses a comma separated list of IP addresses or CIDR ranges
+func ParseTrustedProxies(value string) (*TrustedProxies, error) {
+	proxies := &TrustedProxies{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			proxies.prefixes = append(proxies.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies.prefixes = append(proxies.prefixes, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+// Returns true if the address belongs to one of the trusted networks
+func (p *TrustedProxies) Contains(addr netip.Addr) bool {
+	if p == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the IP address of the client that sent the request.
+// X-Forwarded-For is only honoured when the request comes from a trusted proxy,
+// in which case the list is walked from the right and the first untrusted
+// address is returned, so that clients cannot spoof their address
+func (p *TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !p.Contains(remote) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := host
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !p.Contains(addr) {
+			break
+		}
+	}
+
+	return client
+}
+
+// Returns the key used to rate limit the request: the name of the
+// authenticated principal when there is one, otherwise the client IP address.
+// Credentials are never used as keys before they are verified, so that
+// clients cannot get a fresh bucket by sending a new made-up key
+func (p *TrustedProxies) ClientKey(r *http.Request, principal string) string {
+	return Key(principal, p.ClientIP(r))
+}
+
+// Returns the key of a client: the name of its authenticated principal, or
+// its IP address when it is anonymous
+func Key(principal, ip string) string {
+	if principal != "" {
+		return "principal:" + principal
+	}
+	return "ip:" + ip
+}
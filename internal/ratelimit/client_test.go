@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		err   bool
+	}{
+		{"Empty list", "", false},
+		{"Single address", "10.0.0.1", false},
+		{"CIDR ranges", "10.0.0.0/8, 192.168.0.0/16", false},
+		{"IPv6 range", "fd00::/8", false},
+		{"Invalid address", "10.0.0", true},
+		{"Invalid range", "10.0.0.0/33", true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			_, err := ParseTrustedProxies(entry.value)
+			if entry.err && err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+			if !entry.err && err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expectedIP   string
+	}{
+		{"Direct client", "203.0.113.7:1234", "", "203.0.113.7"},
+		{"Spoofed header from untrusted client", "203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		{"Trusted proxy", "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"Chain of trusted proxies", "10.0.0.2:1234", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"Spoofed entry before real client", "10.0.0.2:1234", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"Trusted proxy without header", "10.0.0.2:1234", "", "10.0.0.2"},
+		{"Malformed header", "10.0.0.2:1234", "not-an-ip", "10.0.0.2"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = entry.remoteAddr
+			if entry.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", entry.forwardedFor)
+			}
+
+			if ip := proxies.ClientIP(req); ip != entry.expectedIP {
+				t.Errorf("Expected %s, received %s", entry.expectedIP, ip)
+			}
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	var proxies *TrustedProxies
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	if key := proxies.ClientKey(req, ""); key != "ip:203.0.113.7" {
+		t.Errorf("Expected key by IP, received %s", key)
+	}
+
+	// Unverified API keys do not select a bucket
+	req.Header.Set("X-API-Key", "made-up-key")
+	if key := proxies.ClientKey(req, ""); key != "ip:203.0.113.7" {
+		t.Errorf("Expected key by IP, received %s", key)
+	}
+
+	if key := proxies.ClientKey(req, "apikey:partner"); key != "principal:apikey:partner" {
+		t.Errorf("Expected key by principal, received %s", key)
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often idle buckets are swept from memory
+const sweepInterval = time.Minute
+
+// Limit describes a token bucket: Rate tokens are added per second,
+// up to a maximum of Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result describes the outcome of a single Allow call
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Limiter keeps a token bucket per client key
+type Limiter struct {
+	limit     Limit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func New(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Parses a limit in the form "rate:burst", e.g. "5:10" allows
+// bursts of 10 requests refilled at 5 requests per second
+func ParseLimit(value string) (Limit, error) {
+	rate, burst, found := strings.Cut(value, ":")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected rate:burst", value)
+	}
+
+	parsedRate, err := strconv.ParseFloat(rate, 64)
+	if err != nil || parsedRate <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: rate must be a positive number", value)
+	}
+
+	parsedBurst, err := strconv.Atoi(burst)
+	if err != nil || parsedBurst <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", value)
+	}
+
+	return Limit{Rate: parsedRate, Burst: parsedBurst}, nil
+}
+
+// Takes a token from the bucket of the provided key, if one is available
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill the bucket for the time elapsed since the last request
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+elapsed*l.limit.Rate)
+	b.last = now
+
+	result := Result{Limit: l.limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.durationFor(1 - b.tokens)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = l.durationFor(float64(l.limit.Burst) - b.tokens)
+
+	return result
+}
+
+// Returns the time needed to refill the provided amount of tokens
+func (l *Limiter) durationFor(tokens float64) time.Duration {
+	return time.Duration(tokens / l.limit.Rate * float64(time.Second))
+}
+
+// Removes the buckets that have refilled completely,
+// since a new bucket behaves exactly the same way
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		refilled := b.tokens + now.Sub(b.last).Seconds()*l.limit.Rate
+		if refilled >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
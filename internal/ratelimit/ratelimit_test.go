@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns a limiter with a clock that only moves when advanced by the test
+func setupTestLimiter(limit Limit) (*Limiter, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := New(limit)
+	limiter.now = func() time.Time { return now }
+	advance := func(d time.Duration) { now = now.Add(d) }
+	return limiter, advance
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected Limit
+		err      bool
+	}{
+		{"Valid limit", "5:10", Limit{Rate: 5, Burst: 10}, false},
+		{"Fractional rate", "0.5:1", Limit{Rate: 0.5, Burst: 1}, false},
+		{"Missing burst", "5", Limit{}, true},
+		{"Zero rate", "0:10", Limit{}, true},
+		{"Invalid burst", "5:ten", Limit{}, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			limit, err := ParseLimit(entry.value)
+			if entry.err && err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+			if !entry.err && err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			if limit != entry.expected {
+				t.Errorf("Expected %+v, received %+v", entry.expected, limit)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	limiter, advance := setupTestLimiter(Limit{Rate: 1, Burst: 2})
+
+	// The burst is available right away
+	for i := 0; i < 2; i++ {
+		if result := limiter.Allow("client"); !result.Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	// The bucket is empty now
+	result := limiter.Allow("client")
+	if result.Allowed {
+		t.Fatalf("Expected request to be rejected")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("Expected retry after %s, received %s", time.Second, result.RetryAfter)
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Expected 0 remaining, received %d", result.Remaining)
+	}
+
+	// Other clients have their own bucket
+	if result := limiter.Allow("other-client"); !result.Allowed {
+		t.Errorf("Expected other client to be allowed")
+	}
+
+	// A token is refilled after a second
+	advance(time.Second)
+	if result := limiter.Allow("client"); !result.Allowed {
+		t.Errorf("Expected request to be allowed after refill")
+	}
+}
+
+func TestAllowRemainingAndReset(t *testing.T) {
+	limiter, _ := setupTestLimiter(Limit{Rate: 2, Burst: 4})
+
+	result := limiter.Allow("client")
+	if result.Limit != 4 {
+		t.Errorf("Expected limit 4, received %d", result.Limit)
+	}
+	if result.Remaining != 3 {
+		t.Errorf("Expected 3 remaining, received %d", result.Remaining)
+	}
+	if result.Reset != 500*time.Millisecond {
+		t.Errorf("Expected reset in %s, received %s", 500*time.Millisecond, result.Reset)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	limiter, advance := setupTestLimiter(Limit{Rate: 1, Burst: 1})
+
+	limiter.Allow("idle-client")
+	advance(2 * sweepInterval)
+	limiter.Allow("active-client")
+
+	if _, exists := limiter.buckets["idle-client"]; exists {
+		t.Errorf("Expected idle bucket to be swept")
+	}
+	if _, exists := limiter.buckets["active-client"]; !exists {
+		t.Errorf("Expected active bucket to be kept")
+	}
+}
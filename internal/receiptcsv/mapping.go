@@ -0,0 +1,89 @@
+package receiptcsv
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Receipt fields that CSV columns map to
+const (
+	// Identifies the receipt of a row. Rows sharing an id on import are
+	// the items of a single receipt, imported receipts get a new id
+	FieldID           = "id"
+	FieldRetailer     = "retailer"
+	FieldPurchaseDate = "purchaseDate"
+	FieldPurchaseTime = "purchaseTime"
+	FieldTotal        = "total"
+	FieldMemberID     = "memberId"
+	FieldPoints       = "points"
+	// Zone the purchase date and time are read in
+	FieldTimeZone = "timeZone"
+	// Every item of the receipt in a single column
+	FieldItems = "items"
+	// Item of a row, for files with one row per item
+	FieldShortDescription = "shortDescription"
+	FieldPrice            = "price"
+)
+
+var Fields = []string{
+	FieldID, FieldRetailer, FieldPurchaseDate, FieldPurchaseTime, FieldTotal,
+	FieldMemberID, FieldPoints, FieldTimeZone, FieldItems, FieldShortDescription, FieldPrice,
+}
+
+// Mapping names the CSV column of receipt fields. Fields that are not
+// mapped are read from and written to the column of their own name
+type Mapping map[string]string
+
+// Reads a mapping from a JSON object of fields and column names
+func LoadMapping(path string) (Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping Mapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("parse CSV mapping file: %w", err)
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+
+	return mapping, nil
+}
+
+// Checks that every mapped field exists and has a column name
+func (m Mapping) Validate() error {
+	for field, column := range m {
+		if !slices.Contains(Fields, field) {
+			return fmt.Errorf("unknown CSV field %q, expected one of %s", field, strings.Join(Fields, ", "))
+		}
+		if strings.TrimSpace(column) == "" {
+			return fmt.Errorf("CSV field %q is mapped to an empty column", field)
+		}
+	}
+	return nil
+}
+
+// Returns the mapping with the columns of the override replacing its own
+func (m Mapping) Merge(override Mapping) Mapping {
+	merged := make(Mapping, len(m)+len(override))
+	for field, column := range m {
+		merged[field] = column
+	}
+	for field, column := range override {
+		merged[field] = column
+	}
+	return merged
+}
+
+// Returns the column name of the field
+func (m Mapping) Column(field string) string {
+	if column, mapped := m[field]; mapped {
+		return column
+	}
+	return field
+}
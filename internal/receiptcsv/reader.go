@@ -0,0 +1,192 @@
+// Package receiptcsv reads receipts from spreadsheets exported as CSV and
+// writes stored receipts as CSV, with configurable column names.
+//
+// A file either has one row per item, with the shortDescription and price
+// columns, or one row per receipt with an items column holding a JSON
+// array of items or description=price pairs separated by semicolons.
+package receiptcsv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+var ErrNoItemColumns = errors.New("CSV header needs an items column, or shortDescription and price columns")
+
+// Record is a receipt read from one or more rows
+type Record struct {
+	// Value of the id column, or the line of the first row when it has none
+	Key string
+	// Line of the first row of the receipt
+	Line         int
+	Retailer     string
+	PurchaseDate string
+	PurchaseTime string
+	Total        string
+	MemberID     string
+	TimeZone     string
+	Items        []models.Item
+	// Rows of the receipt that could not be read, such as rows that
+	// disagree on the retailer of the receipt
+	Err error
+}
+
+// Reads the receipts of the CSV. The header row is matched with the
+// mapping ignoring case and surrounding spaces
+func Read(r io.Reader, mapping Mapping) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Spreadsheets often start UTF-8 files with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns := make(map[string]int)
+	for _, field := range Fields {
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), mapping.Column(field)) {
+				columns[field] = i
+				break
+			}
+		}
+	}
+
+	_, hasItems := columns[FieldItems]
+	_, hasDescription := columns[FieldShortDescription]
+	_, hasPrice := columns[FieldPrice]
+	perItem := !hasItems
+	if !hasItems && !(hasDescription && hasPrice) {
+		return nil, ErrNoItemColumns
+	}
+
+	var records []*Record
+	byKey := make(map[string]*Record)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		value := func(field string) string {
+			i, exists := columns[field]
+			if !exists || i >= len(row) {
+				return ""
+			}
+			if escapedFields[field] {
+				return unescape(strings.TrimSpace(row[i]))
+			}
+			return strings.TrimSpace(row[i])
+		}
+		if isBlank(row) {
+			continue
+		}
+
+		key := value(FieldID)
+		record, grouped := byKey[key]
+		if key == "" || !perItem || !grouped {
+			record = &Record{Key: key, Line: line}
+			if record.Key == "" {
+				record.Key = fmt.Sprintf("line %d", line)
+			}
+			records = append(records, record)
+			if key != "" {
+				byKey[key] = record
+			}
+		}
+
+		// Rows of the same receipt may leave the receipt fields blank,
+		// but cannot disagree on them
+		for _, field := range []struct {
+			name   string
+			target *string
+		}{
+			{FieldRetailer, &record.Retailer},
+			{FieldPurchaseDate, &record.PurchaseDate},
+			{FieldPurchaseTime, &record.PurchaseTime},
+			{FieldTotal, &record.Total},
+			{FieldMemberID, &record.MemberID},
+			{FieldTimeZone, &record.TimeZone},
+		} {
+			current, target := value(field.name), field.target
+			switch {
+			case current == "":
+			case *target == "":
+				*target = current
+			case *target != current && record.Err == nil:
+				record.Err = fmt.Errorf("line %d: %s %q differs from %q on line %d", line, mapping.Column(field.name), current, *target, record.Line)
+			}
+		}
+
+		if !perItem {
+			items, err := parseItems(value(FieldItems))
+			if err != nil && record.Err == nil {
+				record.Err = fmt.Errorf("line %d: %w", line, err)
+			}
+			record.Items = items
+			continue
+		}
+		if description, price := value(FieldShortDescription), value(FieldPrice); description != "" || price != "" {
+			record.Items = append(record.Items, models.Item{ShortDescription: description, Price: price})
+		}
+	}
+
+	result := make([]Record, len(records))
+	for i, record := range records {
+		result[i] = *record
+	}
+	return result, nil
+}
+
+// Reads a JSON array of items, or description=price pairs separated by semicolons
+func parseItems(value string) ([]models.Item, error) {
+	if strings.HasPrefix(value, "[") {
+		var items []models.Item
+		if err := json.Unmarshal([]byte(value), &items); err != nil {
+			return nil, fmt.Errorf("items are not a valid JSON array: %w", err)
+		}
+		return items, nil
+	}
+
+	var items []models.Item
+	for _, pair := range strings.Split(value, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		separator := strings.LastIndex(pair, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("item %q is not a description=price pair", pair)
+		}
+		items = append(items, models.Item{
+			ShortDescription: strings.TrimSpace(pair[:separator]),
+			Price:            strings.TrimSpace(pair[separator+1:]),
+		})
+	}
+	return items, nil
+}
+
+func isBlank(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package receiptcsv
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+func TestReadItemRows(t *testing.T) {
+	input := "\ufeffID,Retailer,Purchase Date,purchaseTime,Total,shortDescription,price\n" +
+		"a,Target,2022-01-01,13:01,2.50,Pepsi,1.25\n" +
+		"b,Walgreens,2022-01-02,08:13,1.00,Dasani,1.00\n" +
+		"a,,,,,Pepsi,1.25\n" +
+		",,,,,,\n" +
+		"c,Target,2022-01-01,13:01,1.00,Pepsi,1.00\n" +
+		"c,Costco,2022-01-01,13:01,1.00,Pepsi,1.00\n"
+
+	records, err := Read(strings.NewReader(input), Mapping{FieldPurchaseDate: "purchase date"})
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 receipts, received %+v", records)
+	}
+
+	expected := Record{
+		Key: "a", Line: 2, Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "2.50",
+		Items: []models.Item{{ShortDescription: "Pepsi", Price: "1.25"}, {ShortDescription: "Pepsi", Price: "1.25"}},
+	}
+	if !reflect.DeepEqual(records[0], expected) {
+		t.Errorf("Expected %+v, received %+v", expected, records[0])
+	}
+	if records[1].Key != "b" || len(records[1].Items) != 1 {
+		t.Errorf("Expected receipt b with 1 item, received %+v", records[1])
+	}
+	if records[2].Err == nil || !strings.Contains(records[2].Err.Error(), "line 7: retailer \"Costco\" differs") {
+		t.Errorf("Expected the conflicting retailer to be reported, received %v", records[2].Err)
+	}
+}
+
+func TestReadReceiptRows(t *testing.T) {
+	input := "Store,purchaseDate,purchaseTime,total,memberId,items\n" +
+		"Target,2022-01-01,13:01,2.25,m1,Pepsi - 12-oz=1.25; Dasani = 1.00\n" +
+		`'=Target,2022-01-01,13:01,1.25,,"[{""shortDescription"":""Pepsi"",""price"":""1.25""}]"` + "\n" +
+		"Target,2022-01-01,13:01,1.25,,Pepsi\n" +
+		"Target,2022-01-01,13:01,'+1.25,,Pepsi=1.25\n"
+
+	records, err := Read(strings.NewReader(input), Mapping{FieldRetailer: "Store"})
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 receipts, received %+v", records)
+	}
+
+	expectedItems := []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}, {ShortDescription: "Dasani", Price: "1.00"}}
+	if records[0].Key != "line 2" || records[0].MemberID != "m1" || !reflect.DeepEqual(records[0].Items, expectedItems) {
+		t.Errorf("Unexpected first receipt %+v", records[0])
+	}
+	if records[1].Retailer != "=Target" || len(records[1].Items) != 1 || records[1].Items[0].Price != "1.25" {
+		t.Errorf("Expected the JSON items and the unescaped retailer, received %+v", records[1])
+	}
+	if records[2].Err == nil {
+		t.Errorf("Expected an item without a price to be reported")
+	}
+	if records[3].Total != "'+1.25" {
+		t.Errorf("Expected a column the writer does not escape to be read as is, received %q", records[3].Total)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := map[string]string{
+		"Empty":            "",
+		"No item columns":  "retailer,total\nTarget,1.00\n",
+		"Unbalanced quote": "retailer,items\n\"Target,a=1.00\n",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(input), nil); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+
+	if _, err := Read(strings.NewReader("retailer\n"), nil); !errors.Is(err, ErrNoItemColumns) {
+		t.Errorf("Expected ErrNoItemColumns, received %v", err)
+	}
+}
+
+// Ensures that written receipts are read back unchanged in both layouts
+func TestWriteAndRead(t *testing.T) {
+	receipts := []models.Receipt{
+		{ID: "a", Retailer: "-Target, Inc.", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "2.50", Points: 10,
+			Items: []models.Item{{ShortDescription: "Pepsi; 12=oz", Price: "1.25"}, {ShortDescription: "Dasani", Price: "1.25"}}},
+		{ID: "b", Retailer: "Walgreens", PurchaseDate: "2022-01-02", PurchaseTime: "08:13", Total: "1.00", MemberID: "m1",
+			Items: []models.Item{{ShortDescription: "Dasani", Price: "1.00"}}},
+		{ID: "c", Retailer: "\tTarget", PurchaseDate: "2022-01-03", PurchaseTime: "09:00", Total: "1.00", MemberID: "\r=m2",
+			Items: []models.Item{{ShortDescription: "@Dasani", Price: "1.00"}}},
+	}
+	mapping := Mapping{FieldRetailer: "Store", FieldPoints: "Points Awarded"}
+
+	for _, layout := range []string{LayoutItems, LayoutReceipts} {
+		t.Run(layout, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(&buf, mapping, layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, receipt := range receipts {
+				if err := writer.Write(receipt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(buf.String(), "id,Store,purchaseDate,purchaseTime,total,memberId,Points Awarded,") {
+				t.Errorf("Expected the mapped header, received %q", buf.String())
+			}
+			for _, escaped := range []string{"'-Target", "'\tTarget", "'\r=m2"} {
+				if !strings.Contains(buf.String(), escaped) {
+					t.Errorf("Expected %q to be escaped, received %q", escaped[1:], buf.String())
+				}
+			}
+
+			records, err := Read(&buf, mapping)
+			if err != nil {
+				t.Fatalf("Failed to read the written CSV: %v", err)
+			}
+			if len(records) != len(receipts) {
+				t.Fatalf("Expected %d receipts, received %d", len(receipts), len(records))
+			}
+			for i, record := range records {
+				receipt := receipts[i]
+				if record.Err != nil || record.Key != receipt.ID || record.Retailer != receipt.Retailer ||
+					record.MemberID != receipt.MemberID || !reflect.DeepEqual(record.Items, receipt.Items) {
+					t.Errorf("Expected %+v, received %+v", receipt, record)
+				}
+			}
+		})
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, nil, "xlsx"); err == nil {
+		t.Errorf("Expected an unknown layout to be rejected")
+	}
+}
+
+func TestMappingValidate(t *testing.T) {
+	if err := (Mapping{FieldRetailer: "Store"}).Validate(); err != nil {
+		t.Errorf("Expected a valid mapping, received %v", err)
+	}
+	if err := (Mapping{"store": "Store"}).Validate(); err == nil {
+		t.Errorf("Expected an unknown field to be rejected")
+	}
+	if err := (Mapping{FieldTotal: " "}).Validate(); err == nil {
+		t.Errorf("Expected an empty column to be rejected")
+	}
+
+	merged := Mapping{FieldRetailer: "Store", FieldTotal: "Amount"}.Merge(Mapping{FieldTotal: "Sum"})
+	if merged.Column(FieldRetailer) != "Store" || merged.Column(FieldTotal) != "Sum" || merged.Column(FieldPrice) != FieldPrice {
+		t.Errorf("Unexpected merged mapping %+v", merged)
+	}
+}
@@ -0,0 +1,125 @@
+package receiptcsv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Layouts of written receipts
+const (
+	// One row per item, repeating the receipt fields
+	LayoutItems = "items"
+	// One row per receipt, with its items as a JSON array
+	LayoutReceipts = "receipts"
+)
+
+// Writer writes receipts as CSV, starting with a header row
+type Writer struct {
+	csv           *csv.Writer
+	mapping       Mapping
+	layout        string
+	headerWritten bool
+}
+
+func NewWriter(w io.Writer, mapping Mapping, layout string) (*Writer, error) {
+	if layout != LayoutItems && layout != LayoutReceipts {
+		return nil, fmt.Errorf("unknown CSV layout %q, expected %s or %s", layout, LayoutItems, LayoutReceipts)
+	}
+	return &Writer{csv: csv.NewWriter(w), mapping: mapping, layout: layout}, nil
+}
+
+// Writes the header row, unless it was already written
+func (w *Writer) WriteHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+
+	fields := []string{FieldID, FieldRetailer, FieldPurchaseDate, FieldPurchaseTime, FieldTotal, FieldMemberID, FieldPoints, FieldTimeZone}
+	if w.layout == LayoutItems {
+		fields = append(fields, FieldShortDescription, FieldPrice)
+	} else {
+		fields = append(fields, FieldItems)
+	}
+
+	header := make([]string, len(fields))
+	for i, field := range fields {
+		header[i] = w.mapping.Column(field)
+	}
+	w.headerWritten = true
+	return w.csv.Write(header)
+}
+
+// Writes the rows of the receipt, after the header row
+func (w *Writer) Write(receipt models.Receipt) error {
+	if err := w.WriteHeader(); err != nil {
+		return err
+	}
+
+	row := []string{
+		receipt.ID,
+		escape(receipt.Retailer),
+		receipt.PurchaseDate,
+		receipt.PurchaseTime,
+		receipt.Total,
+		escape(receipt.MemberID),
+		strconv.Itoa(receipt.Points),
+		receipt.TimeZone,
+	}
+
+	if w.layout == LayoutReceipts {
+		items, err := json.Marshal(receipt.Items)
+		if err != nil {
+			return err
+		}
+		return w.csv.Write(append(row, string(items)))
+	}
+
+	if len(receipt.Items) == 0 {
+		return w.csv.Write(append(row, "", ""))
+	}
+	for _, item := range receipt.Items {
+		if err := w.csv.Write(append(row, escape(item.ShortDescription), item.Price)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flushes the written rows to the underlying writer
+func (w *Writer) Flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// Spreadsheets evaluate cells starting with these characters as formulas,
+// tabs and carriage returns being skipped before the formula is read
+const formulaPrefixes = "=+-@\t\r"
+
+// Free text columns the writer escapes, and the reader unescapes
+var escapedFields = map[string]bool{
+	FieldRetailer:         true,
+	FieldMemberID:         true,
+	FieldShortDescription: true,
+}
+
+// Prefixes text that a spreadsheet would evaluate with a quote
+func escape(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Removes the quote escaping a formula
+func unescape(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
@@ -0,0 +1,37 @@
+package requestid
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// Header carrying the request id in requests and responses
+const Header = "X-Request-ID"
+
+// Ids supplied by clients are kept when they are short and printable
+var validID = regexp.MustCompile(`^[\x21-\x7e]{1,128}$`)
+
+// Returns the id supplied by the client if it is acceptable, or a new id
+func New(supplied string) string {
+	if validID.MatchString(supplied) {
+		return supplied
+	}
+	return uuid.New().String()
+}
+
+type contextKey string
+
+const requestIDKey = contextKey("requestID")
+
+// Returns a copy of the context carrying the request id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// Returns the request id stored in the context, or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
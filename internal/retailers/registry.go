@@ -0,0 +1,161 @@
+// Package retailers maps the names retailers are printed under to a
+// canonical name, so that "Target", "TARGET " and "Target Store #123"
+// count as the same retailer.
+package retailers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/timezone"
+)
+
+// Names the points of the retailer rule are computed from
+const (
+	PointsFromRaw       = "raw"
+	PointsFromCanonical = "canonical"
+)
+
+// Retailer is a canonical name and the names it is printed under
+type Retailer struct {
+	Name string `json:"name"`
+	// Names matched ignoring case and repeated spaces
+	Aliases []string `json:"aliases,omitempty"`
+	// Regular expressions matched against the trimmed name
+	Patterns []string `json:"patterns,omitempty"`
+	// Zone the purchase times of the retailer are local to, such as America/Chicago
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Registry resolves names to the first retailer whose name, alias or
+// pattern matches, in the order the retailers are registered
+type Registry struct {
+	// Name the retailer points are computed from: raw or canonical
+	PointsFrom string
+	retailers  []Retailer
+	aliases    map[string]string
+	patterns   []compiledPattern
+	zones      map[string]*time.Location
+}
+
+type compiledPattern struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// Creates a registry of the retailers, checking their patterns
+func NewRegistry(pointsFrom string, retailers []Retailer) (*Registry, error) {
+	if pointsFrom == "" {
+		pointsFrom = PointsFromRaw
+	}
+	if pointsFrom != PointsFromRaw && pointsFrom != PointsFromCanonical {
+		return nil, fmt.Errorf("retailer points must be computed from %s or %s, not %q", PointsFromRaw, PointsFromCanonical, pointsFrom)
+	}
+
+	registry := &Registry{PointsFrom: pointsFrom, retailers: retailers, aliases: make(map[string]string), zones: make(map[string]*time.Location)}
+	for _, retailer := range retailers {
+		name := strings.TrimSpace(retailer.Name)
+		if name == "" {
+			return nil, errors.New("every retailer needs a canonical name")
+		}
+
+		for _, alias := range append([]string{name}, retailer.Aliases...) {
+			key := normalize(alias)
+			if existing, exists := registry.aliases[key]; exists && existing != name {
+				return nil, fmt.Errorf("alias %q is registered for both %s and %s", alias, existing, name)
+			}
+			registry.aliases[key] = name
+		}
+
+		for _, pattern := range retailer.Patterns {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("pattern of retailer %s: %w", name, err)
+			}
+			registry.patterns = append(registry.patterns, compiledPattern{name: name, pattern: compiled})
+		}
+
+		if retailer.TimeZone != "" {
+			location, err := timezone.Parse(retailer.TimeZone)
+			if err != nil {
+				return nil, fmt.Errorf("time zone of retailer %s: %w", name, err)
+			}
+			registry.zones[name] = location
+		}
+	}
+
+	return registry, nil
+}
+
+// Reads a registry from a JSON file
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		PointsFrom string     `json:"pointsFrom"`
+		Retailers  []Retailer `json:"retailers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse retailers file: %w", err)
+	}
+
+	return NewRegistry(file.PointsFrom, file.Retailers)
+}
+
+// Returns the canonical name of the retailer. Aliases are matched before
+// patterns. Names that match no retailer are returned trimmed, with
+// repeated spaces collapsed. A nil registry only trims names
+func (r *Registry) Canonicalize(raw string) string {
+	trimmed := strings.Join(strings.Fields(raw), " ")
+	if r == nil {
+		return trimmed
+	}
+
+	if name, exists := r.aliases[normalize(raw)]; exists {
+		return name
+	}
+	for _, pattern := range r.patterns {
+		if pattern.pattern.MatchString(trimmed) {
+			return pattern.name
+		}
+	}
+	return trimmed
+}
+
+// Returns the name the retailer points of a receipt are computed from
+func (r *Registry) PointsName(raw, canonical string) string {
+	if r != nil && r.PointsFrom == PointsFromCanonical {
+		return canonical
+	}
+	return raw
+}
+
+// Returns the zone the purchase times of the retailer are local to, or nil
+// when the retailer has none
+func (r *Registry) Location(canonical string) *time.Location {
+	if r == nil {
+		return nil
+	}
+	return r.zones[canonical]
+}
+
+// Returns the registered retailers
+func (r *Registry) Retailers() []Retailer {
+	if r == nil {
+		return nil
+	}
+	return r.retailers
+}
+
+// Lowercases the name and collapses its spaces
+func normalize(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,90 @@
+package retailers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	registry, err := NewRegistry(PointsFromCanonical, []Retailer{
+		{Name: "Target", Aliases: []string{"Target Stores"}, Patterns: []string{`(?i)^target\s+(store\s+)?#\d+$`}},
+		{Name: "M&M Corner Market", Aliases: []string{"M and M Corner Market", "M&M"}},
+		{Name: "Walgreens", Patterns: []string{`(?i)^walgreens\b`}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	tests := map[string]string{
+		"Target":                   "Target",
+		"TARGET ":                  "Target",
+		"target  stores":           "Target",
+		"Target Store #123":        "Target",
+		"TARGET #9":                "Target",
+		"m and m   corner market":  "M&M Corner Market",
+		"Walgreens Pharmacy #12":   "Walgreens",
+		"  Corner   Cafe ":         "Corner Cafe",
+		"Targeted Marketing Store": "Targeted Marketing Store",
+	}
+	for raw, expected := range tests {
+		if received := registry.Canonicalize(raw); received != expected {
+			t.Errorf("Expected %q to be %q, received %q", raw, expected, received)
+		}
+	}
+
+	var none *Registry
+	if received := none.Canonicalize(" TARGET  Store "); received != "TARGET Store" {
+		t.Errorf("Expected a nil registry to only trim names, received %q", received)
+	}
+}
+
+func TestPointsName(t *testing.T) {
+	raw, _ := NewRegistry("", nil)
+	canonical, _ := NewRegistry(PointsFromCanonical, nil)
+	var none *Registry
+
+	if raw.PointsName("TARGET ", "Target") != "TARGET " || none.PointsName("TARGET ", "Target") != "TARGET " {
+		t.Errorf("Expected points to use the raw name by default")
+	}
+	if canonical.PointsName("TARGET ", "Target") != "Target" {
+		t.Errorf("Expected points to use the canonical name")
+	}
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	tests := map[string][]Retailer{
+		"No name":         {{Aliases: []string{"Target"}}},
+		"Invalid pattern": {{Name: "Target", Patterns: []string{"("}}},
+		"Shared alias":    {{Name: "Target", Aliases: []string{"T"}}, {Name: "Tesco", Aliases: []string{"t"}}},
+		"Unknown zone":    {{Name: "Target", TimeZone: "America/Gotham"}},
+	}
+	for name, retailers := range tests {
+		if _, err := NewRegistry(PointsFromRaw, retailers); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := NewRegistry("both", nil); err == nil {
+		t.Errorf("Expected an unknown points basis to be rejected")
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retailers.json")
+	os.WriteFile(path, []byte(`{"pointsFrom": "canonical", "retailers": [{"name": "Target", "aliases": ["TGT"], "timeZone": "America/Chicago"}, {"name": "Tesco"}]}`), 0o600)
+
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v", err)
+	}
+	if registry.PointsFrom != PointsFromCanonical || registry.Canonicalize("tgt") != "Target" || len(registry.Retailers()) != 2 {
+		t.Errorf("Unexpected registry %+v", registry)
+	}
+	if zone := registry.Location("Target"); zone == nil || zone.String() != "America/Chicago" {
+		t.Errorf("Expected Target to be local to America/Chicago, received %v", zone)
+	}
+	if zone := registry.Location("Tesco"); zone != nil {
+		t.Errorf("Expected Tesco to have no zone, received %v", zone)
+	}
+}
@@ -0,0 +1,224 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/periodic"
+)
+
+// Principal the evictions and purges are audited under
+const Principal = "system:retention"
+
+// Reasons receipts are evicted for
+const (
+	ReasonAge    = "age"
+	ReasonCount  = "count"
+	ReasonMemory = "memory"
+)
+
+// Janitor enforces the retention policy on the store: it evicts receipts
+// that are too old or exceed the count and memory limits, and permanently
+// removes soft-deleted receipts once their retention window has passed.
+// Every removal is recorded in the audit log. Evictions make room in the
+// store, they are not deletions by the tenant: the points of evicted
+// receipts are kept and no webhook event is published
+type Janitor struct {
+	store    *models.ReceiptStore
+	policy   Policy
+	audit    *audit.Log
+	errorLog *log.Logger
+	infoLog  *log.Logger
+	now      func() time.Time
+
+	mu      sync.Mutex
+	metrics Metrics
+}
+
+// Metrics counts the work done by the janitor since it started
+type Metrics struct {
+	Sweeps    int              `json:"sweeps"`
+	LastSweep time.Time        `json:"lastSweep"`
+	Evictions map[string]int64 `json:"evictions"`
+	Purged    int64            `json:"purged"`
+	// Store usage after the last sweep
+	Receipts       int   `json:"receipts"`
+	EstimatedBytes int64 `json:"estimatedBytes"`
+}
+
+func NewJanitor(store *models.ReceiptStore, policy Policy, auditLog *audit.Log, errorLog, infoLog *log.Logger) *Janitor {
+	return &Janitor{
+		store:    store,
+		policy:   policy,
+		audit:    auditLog,
+		errorLog: errorLog,
+		infoLog:  infoLog,
+		now:      time.Now,
+		metrics:  Metrics{Evictions: map[string]int64{ReasonAge: 0, ReasonCount: 0, ReasonMemory: 0}},
+	}
+}
+
+// Sweeps the store every interval until the context is cancelled
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	periodic.Run(ctx, interval, nil, func() { j.Sweep() })
+}
+
+// Purges expired tombstones and evicts the receipts the policy does not
+// keep, and returns the number of removed receipts
+func (j *Janitor) Sweep() int {
+	now := j.now()
+
+	purged := 0
+	if j.policy.DeletedRetention > 0 {
+		for _, receipt := range j.store.PurgeDeleted(now.Add(-j.policy.DeletedRetention)) {
+			j.record(audit.ActionReceiptPurge, receipt)
+			purged++
+		}
+	}
+
+	evictions := make(map[string]int64)
+	stored := j.store.Stored()
+
+	// Evict receipts past the maximum age
+	if j.policy.MaxAge > 0 {
+		kept := stored[:0]
+		for _, receipt := range stored {
+			if j.expired(receipt, now) {
+				j.evict(receipt, ReasonAge, evictions)
+				continue
+			}
+			kept = append(kept, receipt)
+		}
+		stored = kept
+	}
+
+	// Evict in order until the count and memory limits are met
+	j.sortForEviction(stored)
+	var bytes int64
+	for _, receipt := range stored {
+		bytes += int64(receipt.Size)
+	}
+	for len(stored) > 0 {
+		reason := ""
+		switch {
+		case j.policy.MaxCount > 0 && len(stored) > j.policy.MaxCount:
+			reason = ReasonCount
+		case j.policy.MaxBytes > 0 && bytes > j.policy.MaxBytes:
+			reason = ReasonMemory
+		}
+		if reason == "" {
+			break
+		}
+		j.evict(stored[0], reason, evictions)
+		bytes -= int64(stored[0].Size)
+		stored = stored[1:]
+	}
+
+	evicted := j.measure(now, purged, evictions, len(stored), bytes)
+	if purged > 0 || evicted > 0 {
+		j.infoLog.Printf("Purged %d deleted receipts and evicted %d receipts", purged, evicted)
+	}
+
+	return purged + evicted
+}
+
+// Returns the policy enforced by the janitor
+func (j *Janitor) Policy() Policy {
+	return j.policy
+}
+
+// Returns a copy of the metrics
+func (j *Janitor) Metrics() Metrics {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	metrics := j.metrics
+	metrics.Evictions = make(map[string]int64, len(j.metrics.Evictions))
+	for reason, count := range j.metrics.Evictions {
+		metrics.Evictions[reason] = count
+	}
+	return metrics
+}
+
+// Reports whether the receipt is older than the maximum age. Receipts
+// stored before purchase instants were recorded fall back to their
+// purchase date and time read in UTC
+func (j *Janitor) expired(receipt models.StoredReceipt, now time.Time) bool {
+	since := receipt.CreatedAt
+	if j.policy.AgeBasis == AgeByPurchaseDate {
+		since = receipt.PurchasedAt
+		if since.IsZero() {
+			purchasedAt, err := time.Parse("2006-01-02 15:04", receipt.PurchaseDate+" "+receipt.PurchaseTime)
+			if err != nil {
+				return false
+			}
+			since = purchasedAt
+		}
+	}
+	return !since.IsZero() && now.Sub(since) > j.policy.MaxAge
+}
+
+// Sorts the receipts in the order they are evicted in: least recently
+// read first for LRU eviction, earliest stored first otherwise
+func (j *Janitor) sortForEviction(stored []models.StoredReceipt) {
+	key := func(receipt models.StoredReceipt) time.Time {
+		if j.policy.Eviction == EvictLRU {
+			return receipt.LastAccess
+		}
+		return receipt.CreatedAt
+	}
+	sort.Slice(stored, func(i, k int) bool {
+		if key(stored[i]).Equal(key(stored[k])) {
+			return stored[i].ID < stored[k].ID
+		}
+		return key(stored[i]).Before(key(stored[k]))
+	})
+}
+
+func (j *Janitor) evict(receipt models.StoredReceipt, reason string, evictions map[string]int64) {
+	evicted, err := j.store.Evict(receipt.TenantID, receipt.ID)
+	if err != nil {
+		// The receipt was deleted since the sweep started
+		return
+	}
+	j.record(audit.ActionReceiptEvict, evicted)
+	evictions[reason]++
+}
+
+// Records the removal of the receipt in the audit log
+func (j *Janitor) record(action string, receipt models.Receipt) {
+	_, err := j.audit.Record(audit.Event{
+		TenantID:   receipt.TenantID,
+		Principal:  Principal,
+		Action:     action,
+		Resource:   "receipt:" + receipt.ID,
+		BeforeHash: audit.HashState(receipt),
+	})
+	if err != nil {
+		j.errorLog.Printf("Failed to record %s of receipt %s in the audit log: %v", action, receipt.ID, err)
+	}
+}
+
+// Adds the results of a sweep to the metrics and returns the number of evicted receipts
+func (j *Janitor) measure(now time.Time, purged int, evictions map[string]int64, receipts int, bytes int64) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	evicted := 0
+	for reason, count := range evictions {
+		j.metrics.Evictions[reason] += count
+		evicted += int(count)
+	}
+	j.metrics.Sweeps++
+	j.metrics.LastSweep = now.UTC()
+	j.metrics.Purged += int64(purged)
+	j.metrics.Receipts = receipts
+	j.metrics.EstimatedBytes = bytes
+
+	return evicted
+}
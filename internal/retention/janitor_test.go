@@ -0,0 +1,252 @@
+package retention
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Creates a janitor enforcing the policy with logs written to a buffer
+func newTestJanitor(store *models.ReceiptStore, policy Policy) *Janitor {
+	var logs bytes.Buffer
+	if policy.AgeBasis == "" {
+		policy.AgeBasis = AgeByIngestion
+	}
+	if policy.Eviction == "" {
+		policy.Eviction = EvictOldest
+	}
+	return NewJanitor(store, policy, audit.NewLog(), log.New(&logs, "", 0), log.New(&logs, "", 0))
+}
+
+// Stores receipts created an hour apart, starting at the provided time
+func insertReceipts(t *testing.T, store *models.ReceiptStore, start time.Time, ids ...string) {
+	for i, id := range ids {
+		receipt := models.Receipt{
+			ID:           id,
+			PurchaseDate: "2024-01-01",
+			PurchaseTime: "12:00",
+			CreatedAt:    start.Add(time.Duration(i) * time.Hour),
+		}
+		if err := store.Insert(receipt); err != nil {
+			t.Fatalf("Failed to insert receipt %s: %v", id, err)
+		}
+	}
+}
+
+// Returns whether the receipts can still be read, without recording an access
+func storedIDs(store *models.ReceiptStore) map[string]bool {
+	ids := make(map[string]bool)
+	for _, receipt := range store.Stored() {
+		ids[receipt.ID] = true
+	}
+	return ids
+}
+
+func TestSweepDeleted(t *testing.T) {
+	store := models.NewStore()
+	store.Insert(models.Receipt{ID: "receipt-1"})
+	store.Delete("", "receipt-1")
+
+	janitor := newTestJanitor(store, Policy{DeletedRetention: 24 * time.Hour})
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected int
+	}{
+		{"Within the retention window", time.Now().Add(23 * time.Hour), 0},
+		{"After the retention window", time.Now().Add(25 * time.Hour), 1},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			janitor.now = func() time.Time { return entry.now }
+			if purged := janitor.Sweep(); purged != entry.expected {
+				t.Errorf("Expected %d purged receipts, received %d", entry.expected, purged)
+			}
+		})
+	}
+
+	if metrics := janitor.Metrics(); metrics.Purged != 1 || metrics.Sweeps != 2 {
+		t.Errorf("Expected 1 purged receipt over 2 sweeps, received %+v", metrics)
+	}
+}
+
+func TestSweepMaxAge(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		basis    string
+		now      time.Time
+		expected map[string]bool
+	}{
+		{"Ingestion within max age", AgeByIngestion, start.Add(24 * time.Hour), map[string]bool{"first": true, "second": true, "third": true}},
+		{"Ingestion past max age", AgeByIngestion, start.Add(25*time.Hour + 30*time.Minute), map[string]bool{"third": true}},
+		{"Purchase date within max age", AgeByPurchaseDate, start.Add(35 * time.Hour), map[string]bool{"first": true, "second": true, "third": true}},
+		{"Purchase date past max age", AgeByPurchaseDate, start.Add(37 * time.Hour), map[string]bool{}},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			store := models.NewStore()
+			insertReceipts(t, store, start, "first", "second", "third")
+
+			janitor := newTestJanitor(store, Policy{MaxAge: 24 * time.Hour, AgeBasis: entry.basis})
+			janitor.now = func() time.Time { return entry.now }
+
+			evicted := janitor.Sweep()
+
+			remaining := storedIDs(store)
+			if len(remaining) != len(entry.expected) {
+				t.Errorf("Expected %d remaining receipts, received %v", len(entry.expected), remaining)
+			}
+			for id := range entry.expected {
+				if !remaining[id] {
+					t.Errorf("Expected receipt %s to be kept", id)
+				}
+			}
+			if metrics := janitor.Metrics(); metrics.Evictions[ReasonAge] != int64(evicted) || metrics.Receipts != len(remaining) {
+				t.Errorf("Expected %d age evictions and %d receipts, received %+v", evicted, len(remaining), metrics)
+			}
+		})
+	}
+}
+
+func TestSweepMaxAgeSkipsUnparsedPurchaseDate(t *testing.T) {
+	store := models.NewStore()
+	store.Insert(models.Receipt{ID: "receipt-1", PurchaseDate: "not-a-date", PurchaseTime: "12:00"})
+
+	janitor := newTestJanitor(store, Policy{MaxAge: time.Hour, AgeBasis: AgeByPurchaseDate})
+	janitor.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+
+	if evicted := janitor.Sweep(); evicted != 0 {
+		t.Errorf("Expected receipts without a valid purchase date to be kept, %d evicted", evicted)
+	}
+}
+
+func TestSweepMaxCount(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		eviction string
+		expected map[string]bool
+	}{
+		// "first" is read, so it is the most recently used receipt
+		{"Oldest first", EvictOldest, map[string]bool{"third": true}},
+		{"Least recently used", EvictLRU, map[string]bool{"first": true}},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			store := models.NewStore()
+			insertReceipts(t, store, start, "first", "second", "third")
+			store.Get("", "first")
+
+			janitor := newTestJanitor(store, Policy{MaxCount: 1, Eviction: entry.eviction})
+
+			if evicted := janitor.Sweep(); evicted != 2 {
+				t.Errorf("Expected 2 evicted receipts, received %d", evicted)
+			}
+
+			remaining := storedIDs(store)
+			for id := range entry.expected {
+				if !remaining[id] || len(remaining) != 1 {
+					t.Errorf("Expected only receipt %s to be kept, received %v", id, remaining)
+				}
+			}
+			if metrics := janitor.Metrics(); metrics.Evictions[ReasonCount] != 2 {
+				t.Errorf("Expected 2 count evictions, received %+v", metrics.Evictions)
+			}
+		})
+	}
+}
+
+func TestSweepMaxBytes(t *testing.T) {
+	store := models.NewStore()
+	insertReceipts(t, store, time.Now().Add(-time.Hour), "first", "second", "third")
+
+	var total int64
+	for _, receipt := range store.Stored() {
+		total += int64(receipt.Size)
+	}
+
+	// Leave room for two of the three receipts
+	janitor := newTestJanitor(store, Policy{MaxBytes: total - 1})
+
+	if evicted := janitor.Sweep(); evicted != 1 {
+		t.Errorf("Expected 1 evicted receipt, received %d", evicted)
+	}
+	if storedIDs(store)["first"] {
+		t.Error("Expected the oldest receipt to be evicted")
+	}
+
+	metrics := janitor.Metrics()
+	if metrics.Evictions[ReasonMemory] != 1 {
+		t.Errorf("Expected 1 memory eviction, received %+v", metrics.Evictions)
+	}
+	if metrics.EstimatedBytes > total-1 || metrics.Receipts != 2 {
+		t.Errorf("Expected 2 receipts within %d bytes, received %+v", total-1, metrics)
+	}
+}
+
+func TestSweepAudited(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := models.NewStore()
+	insertReceipts(t, store, start, "first", "second")
+	store.Insert(models.Receipt{ID: "deleted", TenantID: "brand-a"})
+	store.Delete("brand-a", "deleted")
+
+	janitor := newTestJanitor(store, Policy{DeletedRetention: time.Hour, MaxCount: 1})
+	janitor.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if removed := janitor.Sweep(); removed != 2 {
+		t.Fatalf("Expected 2 removed receipts, received %d", removed)
+	}
+
+	events := janitor.audit.Events(audit.Filter{Principal: Principal})
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 audit events, received %+v", events)
+	}
+	for _, event := range events {
+		switch event.Action {
+		case audit.ActionReceiptEvict:
+			if event.Resource != "receipt:first" || event.TenantID != models.DefaultTenantID || event.BeforeHash == "" || event.AfterHash != "" {
+				t.Errorf("Unexpected eviction event %+v", event)
+			}
+		case audit.ActionReceiptPurge:
+			if event.Resource != "receipt:deleted" || event.TenantID != "brand-a" {
+				t.Errorf("Unexpected purge event %+v", event)
+			}
+		default:
+			t.Errorf("Unexpected audit event %+v", event)
+		}
+	}
+}
+
+func TestSweepMaxAgePurchaseInstant(t *testing.T) {
+	// Bought at noon in New York, 17:00 UTC
+	store := models.NewStore()
+	store.Insert(models.Receipt{
+		ID:           "receipt-1",
+		PurchaseDate: "2024-01-01",
+		PurchaseTime: "12:00",
+		TimeZone:     "America/New_York",
+		PurchasedAt:  time.Date(2024, 1, 1, 17, 0, 0, 0, time.UTC),
+	})
+
+	janitor := newTestJanitor(store, Policy{MaxAge: time.Hour, AgeBasis: AgeByPurchaseDate})
+	janitor.now = func() time.Time { return time.Date(2024, 1, 1, 17, 30, 0, 0, time.UTC) }
+	if evicted := janitor.Sweep(); evicted != 0 {
+		t.Errorf("Expected the receipt bought 30 minutes ago to be kept, %d evicted", evicted)
+	}
+
+	janitor.now = func() time.Time { return time.Date(2024, 1, 1, 18, 30, 0, 0, time.UTC) }
+	if evicted := janitor.Sweep(); evicted != 1 {
+		t.Errorf("Expected the receipt bought 90 minutes ago to be evicted, %d evicted", evicted)
+	}
+}
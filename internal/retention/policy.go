@@ -0,0 +1,69 @@
+package retention
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Times the age of a receipt is measured from
+const (
+	AgeByIngestion    = "ingestion"
+	AgeByPurchaseDate = "purchaseDate"
+)
+
+// Orders receipts are evicted in when a limit is exceeded
+const (
+	EvictOldest = "oldest"
+	EvictLRU    = "lru"
+)
+
+// Policy limits the receipts kept in the store. Zero values disable a limit
+type Policy struct {
+	// Time a soft-deleted receipt can still be restored
+	DeletedRetention time.Duration
+	// Maximum age of a receipt, measured by AgeBasis
+	MaxAge   time.Duration
+	AgeBasis string
+	// Maximum number of live receipts across tenants
+	MaxCount int
+	// Maximum estimated memory held by live receipts and their revisions
+	MaxBytes int64
+	// Order receipts are evicted in once MaxCount or MaxBytes is exceeded
+	Eviction string
+}
+
+// Returns an error if the policy is not valid
+func (p Policy) Validate() error {
+	switch {
+	case p.DeletedRetention < 0 || p.MaxAge < 0:
+		return fmt.Errorf("retention durations cannot be negative")
+	case p.MaxCount < 0 || p.MaxBytes < 0:
+		return fmt.Errorf("retention limits cannot be negative")
+	case p.AgeBasis != AgeByIngestion && p.AgeBasis != AgeByPurchaseDate:
+		return fmt.Errorf("invalid retention age basis %q, expected %s or %s", p.AgeBasis, AgeByIngestion, AgeByPurchaseDate)
+	case p.Eviction != EvictOldest && p.Eviction != EvictLRU:
+		return fmt.Errorf("invalid eviction order %q, expected %s or %s", p.Eviction, EvictOldest, EvictLRU)
+	}
+	return nil
+}
+
+// Parses a size in bytes with an optional KB, MB or GB suffix, e.g. 512MB.
+// Suffixes are powers of 1024
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for suffix, factor := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if number, found := strings.CutSuffix(value, suffix); found {
+			value, multiplier = strings.TrimSpace(number), factor
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected bytes or a number with a KB, MB or GB suffix", value)
+	}
+	return size * multiplier, nil
+}
@@ -0,0 +1,61 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+		valid    bool
+	}{
+		{"0", 0, true},
+		{"2048", 2048, true},
+		{"64KB", 64 << 10, true},
+		{"512mb", 512 << 20, true},
+		{"2 GB", 2 << 30, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"1TB", 0, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.value, func(t *testing.T) {
+			size, err := ParseSize(entry.value)
+			if (err == nil) != entry.valid {
+				t.Fatalf("Expected valid to be %v, received error %v", entry.valid, err)
+			}
+			if size != entry.expected {
+				t.Errorf("Expected %d, received %d", entry.expected, size)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	valid := Policy{DeletedRetention: time.Hour, AgeBasis: AgeByIngestion, Eviction: EvictLRU}
+
+	tests := []struct {
+		name   string
+		modify func(*Policy)
+		valid  bool
+	}{
+		{"Valid", func(p *Policy) {}, true},
+		{"Negative max age", func(p *Policy) { p.MaxAge = -time.Hour }, false},
+		{"Negative max count", func(p *Policy) { p.MaxCount = -1 }, false},
+		{"Unknown age basis", func(p *Policy) { p.AgeBasis = "updated" }, false},
+		{"Unknown eviction", func(p *Policy) { p.Eviction = "random" }, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			policy := valid
+			entry.modify(&policy)
+			if err := policy.Validate(); (err == nil) != entry.valid {
+				t.Errorf("Expected valid to be %v, received error %v", entry.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Package scoring holds the rules that receipts are awarded points by,
+// which tenants can tune
+package scoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Characters counted by the retailer rule
+const (
+	// Letters a to z, in either case, and digits 0 to 9
+	CharactersASCII = "ascii"
+	// Letters and decimal digits of every script, combining marks excluded
+	CharactersUnicode = "unicode"
+)
+
+// Units item description lengths are measured in
+const (
+	LengthBytes = "bytes"
+	// Code points, a letter followed by a combining mark counts twice
+	LengthRunes = "runes"
+	// User-perceived characters, such as a letter and its combining marks
+	// or an emoji sequence
+	LengthGraphemes = "graphemes"
+)
+
+// Rules holds the amounts awarded by each points rule.
+// A rule awarding zero points is effectively disabled
+type Rules struct {
+	// Points per alphanumeric character in the retailer name
+	RetailerCharPoints int `json:"retailerCharPoints"`
+	// Points if the total is a round dollar amount
+	RoundTotalPoints int `json:"roundTotalPoints"`
+	// Points if the total is a multiple of 0.25
+	QuarterPoints int `json:"quarterPoints"`
+	// Points for every two items
+	ItemPairPoints int `json:"itemPairPoints"`
+	// Item prices are multiplied by DescriptionPriceMultiplier when the
+	// trimmed description length is a multiple of DescriptionLengthMultiple
+	DescriptionLengthMultiple  int     `json:"descriptionLengthMultiple"`
+	DescriptionPriceMultiplier float64 `json:"descriptionPriceMultiplier"`
+	// Points if the day of the purchase date is odd
+	OddDayPoints int `json:"oddDayPoints"`
+	// Points if the purchase time falls between AfternoonStart and AfternoonEnd
+	AfternoonPoints int    `json:"afternoonPoints"`
+	AfternoonStart  string `json:"afternoonStart"`
+	AfternoonEnd    string `json:"afternoonEnd"`
+	// Characters the retailer rule counts: ascii or unicode, ascii when empty
+	RetailerCharacters string `json:"retailerCharacters,omitempty"`
+	// Unit of the item description length: bytes, runes or graphemes, bytes when empty
+	DescriptionLengthUnit string `json:"descriptionLengthUnit,omitempty"`
+}
+
+// Returns the rules of the receipt processor challenge
+func DefaultRules() Rules {
+	return Rules{
+		RetailerCharPoints:         1,
+		RoundTotalPoints:           50,
+		QuarterPoints:              25,
+		ItemPairPoints:             5,
+		DescriptionLengthMultiple:  3,
+		DescriptionPriceMultiplier: 0.2,
+		OddDayPoints:               6,
+		AfternoonPoints:            10,
+		AfternoonStart:             "14:00",
+		AfternoonEnd:               "16:00",
+		RetailerCharacters:         CharactersASCII,
+		DescriptionLengthUnit:      LengthBytes,
+	}
+}
+
+// Checks that the rules name known character sets and length units, and
+// that the afternoon window of an enabled afternoon rule is well formed
+func (r Rules) Validate() error {
+	switch r.RetailerCharacters {
+	case "", CharactersASCII, CharactersUnicode:
+	default:
+		return fmt.Errorf("retailerCharacters must be %s or %s, not %q", CharactersASCII, CharactersUnicode, r.RetailerCharacters)
+	}
+
+	switch r.DescriptionLengthUnit {
+	case "", LengthBytes, LengthRunes, LengthGraphemes:
+	default:
+		return fmt.Errorf("descriptionLengthUnit must be %s, %s or %s, not %q", LengthBytes, LengthRunes, LengthGraphemes, r.DescriptionLengthUnit)
+	}
+
+	if r.AfternoonPoints != 0 {
+		start, err := time.Parse("15:04", r.AfternoonStart)
+		if err != nil {
+			return fmt.Errorf("afternoonStart must be a time in the HH:MM format, not %q", r.AfternoonStart)
+		}
+		end, err := time.Parse("15:04", r.AfternoonEnd)
+		if err != nil {
+			return fmt.Errorf("afternoonEnd must be a time in the HH:MM format, not %q", r.AfternoonEnd)
+		}
+		if !start.Before(end) {
+			return fmt.Errorf("afternoonStart %s must be before afternoonEnd %s", r.AfternoonStart, r.AfternoonEnd)
+		}
+	}
+
+	return nil
+}
+
+// Reads rules from a JSON file. Amounts the file omits keep their default
+func LoadRules(path string) (Rules, error) {
+	rules := DefaultRules()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := rules.Validate(); err != nil {
+		return rules, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return rules, nil
+}
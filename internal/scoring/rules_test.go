@@ -0,0 +1,90 @@
+package scoring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRulesValidate(t *testing.T) {
+	unicodeRules := DefaultRules()
+	unicodeRules.RetailerCharacters = CharactersUnicode
+	unicodeRules.DescriptionLengthUnit = LengthGraphemes
+
+	unknownCharacters := DefaultRules()
+	unknownCharacters.RetailerCharacters = "latin"
+
+	unknownUnit := DefaultRules()
+	unknownUnit.DescriptionLengthUnit = "words"
+
+	malformedStart := DefaultRules()
+	malformedStart.AfternoonStart = "2pm"
+
+	outOfRangeEnd := DefaultRules()
+	outOfRangeEnd.AfternoonEnd = "25:00"
+
+	reversedWindow := DefaultRules()
+	reversedWindow.AfternoonStart, reversedWindow.AfternoonEnd = "16:00", "14:00"
+
+	disabledAfternoon := DefaultRules()
+	disabledAfternoon.AfternoonPoints = 0
+	disabledAfternoon.AfternoonStart, disabledAfternoon.AfternoonEnd = "", ""
+
+	tests := []struct {
+		name  string
+		rules Rules
+		valid bool
+	}{
+		{"Default rules", DefaultRules(), true},
+		{"Omitted modes", Rules{}, true},
+		{"Unicode rules", unicodeRules, true},
+		{"Unknown characters", unknownCharacters, false},
+		{"Unknown length unit", unknownUnit, false},
+		{"Malformed afternoon start", malformedStart, false},
+		{"Out of range afternoon end", outOfRangeEnd, false},
+		{"Reversed afternoon window", reversedWindow, false},
+		{"Disabled afternoon rule", disabledAfternoon, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			if err := entry.rules.Validate(); (err == nil) != entry.valid {
+				t.Errorf("Expected valid to be %t, received %v", entry.valid, err)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	rules, err := LoadRules(write("partial.json", `{"oddDayPoints": 3}`))
+	if err != nil {
+		t.Fatalf("Expected rules to load, received %v", err)
+	}
+	expected := DefaultRules()
+	expected.OddDayPoints = 3
+	if rules != expected {
+		t.Errorf("Expected omitted amounts to keep their default, received %+v", rules)
+	}
+
+	for name, content := range map[string]string{
+		"malformed.json": `{"oddDayPoints":`,
+		"invalid.json":   `{"retailerCharacters": "latin"}`,
+	} {
+		if _, err := LoadRules(write(name, content)); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+
+	if _, err := LoadRules(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected a missing file to be rejected")
+	}
+}
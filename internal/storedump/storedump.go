@@ -0,0 +1,234 @@
+// Package storedump writes the receipt store as NDJSON and reads it back,
+// to back up the store and to migrate it between storage backends.
+//
+// The first line of a dump is a Header carrying the format version, and
+// every following line is a receipt with its prior revisions.
+package storedump
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Name of the dump format in the header line
+const Format = "receipt-store"
+
+// Version of the format written by Write. Read accepts this version and older ones
+const Version = 1
+
+// Media type of dumps
+const ContentType = "application/x-ndjson"
+
+// HTTP header carrying the format version of a dump
+const VersionHeader = "X-Dump-Format-Version"
+
+// Largest line of a dump, a receipt with all of its revisions
+const maxLineBytes = 16 << 20
+
+var ErrFormat = errors.New("not a receipt store dump")
+
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Number of receipt lines following the header
+	Receipts int `json:"receipts"`
+}
+
+// Receipt is the dumped form of a stored receipt
+type Receipt struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenantId"`
+	Retailer string `json:"retailer"`
+	// Absent from dumps written before retailers were canonicalized
+	CanonicalRetailer string `json:"canonicalRetailer,omitempty"`
+	PurchaseDate      string `json:"purchaseDate"`
+	PurchaseTime      string `json:"purchaseTime"`
+	// Absent from dumps written before purchase times were zoned
+	TimeZone    string     `json:"timeZone,omitempty"`
+	PurchasedAt *time.Time `json:"purchasedAt,omitempty"`
+	// Zone named by the submitter, absent when the zone was a default
+	RequestedTimeZone string     `json:"requestedTimeZone,omitempty"`
+	Total             string     `json:"total"`
+	Items             []Item     `json:"items"`
+	Points            int        `json:"points"`
+	Breakdown         Breakdown  `json:"breakdown"`
+	SubmittedBy       string     `json:"submittedBy,omitempty"`
+	UpdatedBy         string     `json:"updatedBy,omitempty"`
+	MemberID          string     `json:"memberId,omitempty"`
+	Revision          int        `json:"revision"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	UpdatedAt         time.Time  `json:"updatedAt"`
+	DeletedAt         *time.Time `json:"deletedAt,omitempty"`
+	Revisions         []Receipt  `json:"revisions,omitempty"`
+}
+
+type Item struct {
+	ShortDescription string `json:"shortDescription"`
+	Price            string `json:"price"`
+}
+
+type Breakdown struct {
+	BasePoints int     `json:"basePoints"`
+	Tier       string  `json:"tier,omitempty"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// Writes the header line followed by one line per entry
+func Write(w io.Writer, entries []models.StoreEntry, now time.Time) error {
+	encoder := json.NewEncoder(w)
+
+	header := Header{Format: Format, Version: Version, CreatedAt: now.UTC(), Receipts: len(entries)}
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		receipt := fromModel(entry.Receipt)
+		for _, revision := range entry.Revisions {
+			receipt.Revisions = append(receipt.Revisions, fromModel(revision))
+		}
+		if err := encoder.Encode(receipt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads a whole dump. The dump is rejected if its header is missing or
+// of a newer version, or if it holds fewer or more receipts than announced.
+// Reading stops at the first receipt past the announced number
+func Read(r io.Reader) (Header, []models.StoreEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+
+	var header Header
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return header, nil, err
+		}
+		return header, nil, fmt.Errorf("%w: the dump is empty", ErrFormat)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != Format {
+		return header, nil, fmt.Errorf("%w: the first line is not a %s header", ErrFormat, Format)
+	}
+	if header.Version < 1 || header.Version > Version {
+		return header, nil, fmt.Errorf("%w: version %d is not supported, expected at most %d", ErrFormat, header.Version, Version)
+	}
+
+	// The announced number is not trusted with an allocation
+	entries := make([]models.StoreEntry, 0, min(max(header.Receipts, 0), 1024))
+	for line := 2; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if len(entries) == header.Receipts {
+			return header, nil, fmt.Errorf("%w: the header announces %d receipts, found more", ErrFormat, header.Receipts)
+		}
+
+		var receipt Receipt
+		if err := json.Unmarshal(scanner.Bytes(), &receipt); err != nil {
+			return header, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if receipt.ID == "" {
+			return header, nil, fmt.Errorf("line %d: receipt has no id", line)
+		}
+
+		entry := models.StoreEntry{Receipt: receipt.toModel()}
+		for _, revision := range receipt.Revisions {
+			entry.Revisions = append(entry.Revisions, revision.toModel())
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return header, nil, err
+	}
+
+	// A dump cut short, by a failed transfer for instance, is not restored
+	if len(entries) != header.Receipts {
+		return header, nil, fmt.Errorf("%w: the header announces %d receipts, found %d", ErrFormat, header.Receipts, len(entries))
+	}
+
+	return header, entries, nil
+}
+
+func fromModel(receipt models.Receipt) Receipt {
+	dumped := Receipt{
+		ID:                receipt.ID,
+		TenantID:          receipt.TenantID,
+		Retailer:          receipt.Retailer,
+		CanonicalRetailer: receipt.CanonicalRetailer,
+		PurchaseDate:      receipt.PurchaseDate,
+		PurchaseTime:      receipt.PurchaseTime,
+		TimeZone:          receipt.TimeZone,
+		RequestedTimeZone: receipt.RequestedTimeZone,
+		Total:             receipt.Total,
+		Items:             make([]Item, 0, len(receipt.Items)),
+		Points:            receipt.Points,
+		Breakdown: Breakdown{
+			BasePoints: receipt.Breakdown.BasePoints,
+			Tier:       receipt.Breakdown.Tier,
+			Multiplier: receipt.Breakdown.Multiplier,
+		},
+		SubmittedBy: receipt.SubmittedBy,
+		UpdatedBy:   receipt.UpdatedBy,
+		MemberID:    receipt.MemberID,
+		Revision:    receipt.Revision,
+		CreatedAt:   receipt.CreatedAt,
+		UpdatedAt:   receipt.UpdatedAt,
+	}
+	for _, item := range receipt.Items {
+		dumped.Items = append(dumped.Items, Item{ShortDescription: item.ShortDescription, Price: item.Price})
+	}
+	if !receipt.PurchasedAt.IsZero() {
+		purchasedAt := receipt.PurchasedAt
+		dumped.PurchasedAt = &purchasedAt
+	}
+	if !receipt.DeletedAt.IsZero() {
+		deletedAt := receipt.DeletedAt
+		dumped.DeletedAt = &deletedAt
+	}
+	return dumped
+}
+
+func (r Receipt) toModel() models.Receipt {
+	receipt := models.Receipt{
+		ID:                r.ID,
+		TenantID:          r.TenantID,
+		Retailer:          r.Retailer,
+		CanonicalRetailer: r.CanonicalRetailer,
+		PurchaseDate:      r.PurchaseDate,
+		PurchaseTime:      r.PurchaseTime,
+		TimeZone:          r.TimeZone,
+		RequestedTimeZone: r.RequestedTimeZone,
+		Total:             r.Total,
+		Points:            r.Points,
+		Breakdown: models.PointsBreakdown{
+			BasePoints: r.Breakdown.BasePoints,
+			Tier:       r.Breakdown.Tier,
+			Multiplier: r.Breakdown.Multiplier,
+		},
+		SubmittedBy: r.SubmittedBy,
+		UpdatedBy:   r.UpdatedBy,
+		MemberID:    r.MemberID,
+		Revision:    r.Revision,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+	for _, item := range r.Items {
+		receipt.Items = append(receipt.Items, models.Item{ShortDescription: item.ShortDescription, Price: item.Price})
+	}
+	if r.PurchasedAt != nil {
+		receipt.PurchasedAt = *r.PurchasedAt
+	}
+	if r.DeletedAt != nil {
+		receipt.DeletedAt = *r.DeletedAt
+	}
+	return receipt
+}
@@ -0,0 +1,79 @@
+package storedump
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	created := time.Date(2022, 1, 2, 13, 13, 0, 0, time.UTC)
+	entries := []models.StoreEntry{
+		{
+			Receipt: models.Receipt{
+				ID: "a", TenantID: "brand-a", Retailer: "Walgreens", CanonicalRetailer: "Walgreens", PurchaseDate: "2022-01-02", PurchaseTime: "13:13", Total: "1.25",
+				TimeZone: "America/Chicago", PurchasedAt: created.Add(6 * time.Hour),
+				Items:  []models.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+				Points: 62, Breakdown: models.PointsBreakdown{BasePoints: 31, Tier: "gold", Multiplier: 2},
+				MemberID: "m1", SubmittedBy: "apikey:partner", Revision: 2, CreatedAt: created, UpdatedAt: created.Add(time.Hour),
+			},
+			Revisions: []models.Receipt{{ID: "a", TenantID: "brand-a", Retailer: "Target", Revision: 1, CreatedAt: created, UpdatedAt: created}},
+		},
+		{Receipt: models.Receipt{ID: "b", TenantID: "default", Revision: 1, CreatedAt: created, DeletedAt: created.Add(time.Minute)}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries, created); err != nil {
+		t.Fatalf("Failed to write dump: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Errorf("Expected a header and 2 receipt lines, received %d lines", lines)
+	}
+
+	header, read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read dump: %v", err)
+	}
+	if header.Format != Format || header.Version != Version || header.Receipts != 2 || !header.CreatedAt.Equal(created) {
+		t.Errorf("Unexpected header %+v", header)
+	}
+	if !reflect.DeepEqual(read, entries) {
+		t.Errorf("Expected %+v, received %+v", entries, read)
+	}
+}
+
+func TestReadRejectsInvalidDumps(t *testing.T) {
+	header := `{"format":"receipt-store","version":1,"createdAt":"2022-01-02T13:13:00Z","receipts":1}`
+	tests := []struct {
+		name   string
+		dump   string
+		format bool
+	}{
+		{"Empty", "", true},
+		{"No header", `{"id":"a"}`, true},
+		{"Newer version", `{"format":"receipt-store","version":2,"receipts":0}`, true},
+		{"Cut short", header + "\n", true},
+		{"Too long", header + "\n" + `{"id":"a"}` + "\n" + `{"id":"b"}`, true},
+		{"Huge announcement", `{"format":"receipt-store","version":1,"receipts":1000000000000}` + "\n" + `{"id":"a"}`, true},
+		{"Negative announcement", `{"format":"receipt-store","version":1,"receipts":-1}` + "\n" + `{"id":"a"}`, true},
+		{"Malformed receipt", header + "\n" + `{"id":`, false},
+		{"Receipt without id", header + "\n" + `{"retailer":"Target"}`, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			_, _, err := Read(strings.NewReader(entry.dump))
+			if err == nil {
+				t.Fatalf("Expected the dump to be rejected")
+			}
+			if errors.Is(err, ErrFormat) != entry.format {
+				t.Errorf("Expected ErrFormat: %t, received %v", entry.format, err)
+			}
+		})
+	}
+}
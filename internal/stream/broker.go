@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Events queued for a subscriber that is slower than the publishers.
+// A subscriber falling further behind is disconnected and resumes
+// from the buffer when it reconnects
+const subscriberQueue = 64
+
+// Event is a message streamed to the subscribers of its tenant
+type Event struct {
+	// Increases with every published event, across tenants
+	ID       uint64
+	Type     string
+	TenantID string
+	// JSON encoded payload
+	Data []byte
+}
+
+// Broker fans published events out to the subscribers of their tenant,
+// and keeps the most recent events of each tenant so that subscribers can
+// resume without a busy tenant pushing out the events of the others
+type Broker struct {
+	mu sync.Mutex
+	// Most recent events by tenant
+	buffers     map[string][]Event
+	size        int
+	lastID      uint64
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Subscription receives the events of a tenant until it is cancelled,
+// or until the broker closes its channel
+type Subscription struct {
+	tenantID string
+	events   chan Event
+	broker   *Broker
+}
+
+// Creates a broker keeping the provided number of most recent events of each tenant
+func NewBroker(size int) *Broker {
+	return &Broker{
+		buffers:     make(map[string][]Event),
+		size:        max(size, 1),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Encodes the data and sends the event to the subscribers of the tenant
+func (b *Broker) Publish(tenantID, eventType string, data any) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, TenantID: models.TenantKey(tenantID), Data: payload}
+
+	buffer := append(b.buffers[event.TenantID], event)
+	if len(buffer) > b.size {
+		buffer = slices.Clone(buffer[len(buffer)-b.size:])
+	}
+	b.buffers[event.TenantID] = buffer
+
+	for subscription := range b.subscribers {
+		if subscription.tenantID != event.TenantID {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			// Disconnect the subscriber rather than block the publisher
+			b.remove(subscription)
+		}
+	}
+
+	return event, nil
+}
+
+// Subscribes to the events of the tenant published after the event with
+// the provided id, zero for new events only. Returns the buffered events
+// to replay first. Events that left the buffer of the tenant cannot be replayed
+func (b *Broker) Subscribe(tenantID string, lastEventID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscription := &Subscription{
+		tenantID: models.TenantKey(tenantID),
+		events:   make(chan Event, subscriberQueue),
+		broker:   b,
+	}
+	if b.closed {
+		close(subscription.events)
+		return subscription, nil
+	}
+	b.subscribers[subscription] = struct{}{}
+
+	var backlog []Event
+	if lastEventID > 0 {
+		for _, event := range b.buffers[subscription.tenantID] {
+			if event.ID > lastEventID {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	return subscription, backlog
+}
+
+// Ends every subscription and rejects new ones, so that streams end on shutdown
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for subscription := range b.subscribers {
+		b.remove(subscription)
+	}
+}
+
+// Returns the number of active subscriptions
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+func (b *Broker) remove(subscription *Subscription) {
+	if _, exists := b.subscribers[subscription]; !exists {
+		return
+	}
+	delete(b.subscribers, subscription)
+	close(subscription.events)
+}
+
+// Returns the channel the events are received on, closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Ends the subscription
+func (s *Subscription) Cancel() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"testing"
+)
+
+func TestPublishToTenant(t *testing.T) {
+	broker := NewBroker(10)
+	subscription, backlog := broker.Subscribe("tenant-a", 0)
+	defer subscription.Cancel()
+
+	if len(backlog) != 0 {
+		t.Errorf("Expected no backlog for new events only, received %d", len(backlog))
+	}
+
+	broker.Publish("tenant-b", "receipt.processed", map[string]string{"id": "other"})
+	broker.Publish("tenant-a", "receipt.processed", map[string]string{"id": "receipt-1"})
+
+	event := <-subscription.Events()
+	if event.TenantID != "tenant-a" || string(event.Data) != `{"id":"receipt-1"}` || event.ID != 2 {
+		t.Errorf("Expected only the event of the tenant, received %+v", event)
+	}
+	if len(subscription.Events()) != 0 {
+		t.Errorf("Expected no other queued event, received %d", len(subscription.Events()))
+	}
+}
+
+func TestResume(t *testing.T) {
+	broker := NewBroker(3)
+	for i := 0; i < 5; i++ {
+		broker.Publish("", "receipt.processed", i)
+	}
+	broker.Publish("other", "receipt.processed", 5)
+
+	tests := []struct {
+		name        string
+		lastEventID uint64
+		expected    []uint64
+	}{
+		{"Within the buffer", 3, []uint64{4, 5}},
+		{"Before the buffer", 1, []uint64{3, 4, 5}},
+		{"Up to date", 5, nil},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			subscription, backlog := broker.Subscribe("default", entry.lastEventID)
+			defer subscription.Cancel()
+
+			if len(backlog) != len(entry.expected) {
+				t.Fatalf("Expected %d replayed events, received %d", len(entry.expected), len(backlog))
+			}
+			for i, id := range entry.expected {
+				if backlog[i].ID != id {
+					t.Errorf("Expected event %d to be replayed, received %d", id, backlog[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestBusyTenantKeepsOthersReplayable(t *testing.T) {
+	broker := NewBroker(2)
+	broker.Publish("quiet", "receipt.processed", 1)
+	broker.Publish("quiet", "receipt.processed", 2)
+	for i := 3; i <= 12; i++ {
+		broker.Publish("busy", "receipt.processed", i)
+	}
+
+	subscription, backlog := broker.Subscribe("quiet", 1)
+	subscription.Cancel()
+	if len(backlog) != 1 || backlog[0].ID != 2 {
+		t.Errorf("Expected event 2 of the quiet tenant to be replayed, received %+v", backlog)
+	}
+
+	subscription, backlog = broker.Subscribe("busy", 1)
+	subscription.Cancel()
+	if len(backlog) != 2 || backlog[0].ID != 11 || backlog[1].ID != 12 {
+		t.Errorf("Expected the 2 most recent events of the busy tenant, received %+v", backlog)
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	broker := NewBroker(10)
+	subscription, _ := broker.Subscribe("", 0)
+
+	for i := 0; i <= subscriberQueue; i++ {
+		broker.Publish("", "receipt.processed", i)
+	}
+
+	if broker.Subscribers() != 0 {
+		t.Errorf("Expected the slow subscriber to be disconnected")
+	}
+	received := 0
+	for range subscription.Events() {
+		received++
+	}
+	if received != subscriberQueue {
+		t.Errorf("Expected the %d queued events before the channel closed, received %d", subscriberQueue, received)
+	}
+	subscription.Cancel()
+}
+
+func TestClose(t *testing.T) {
+	broker := NewBroker(10)
+	subscription, _ := broker.Subscribe("", 0)
+
+	broker.Close()
+
+	if _, open := <-subscription.Events(); open {
+		t.Error("Expected the subscription to end when the broker closes")
+	}
+	late, _ := broker.Subscribe("", 0)
+	if _, open := <-late.Events(); open {
+		t.Error("Expected subscriptions to a closed broker to end immediately")
+	}
+}
@@ -0,0 +1,123 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
+)
+
+var (
+	ErrUnknownTenant = errors.New("unknown tenant")
+	validID          = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+)
+
+// Tenant is a brand whose receipts are kept apart from every other brand
+type Tenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Maximum number of stored receipts, unlimited when zero
+	MaxReceipts int `json:"maxReceipts"`
+	// Points rules of the tenant, the server defaults when nil
+	Rules *scoring.Rules `json:"rules"`
+}
+
+// Registry holds the tenants the server accepts
+type Registry struct {
+	tenants map[string]*Tenant
+}
+
+// Returns the tenant used when a request does not name one
+func Default() *Tenant {
+	return &Tenant{ID: models.DefaultTenantID}
+}
+
+// Creates a registry of the tenants, the default tenant is always included
+func NewRegistry(tenants []Tenant) (*Registry, error) {
+	registry := &Registry{tenants: map[string]*Tenant{models.DefaultTenantID: Default()}}
+
+	for _, tenant := range tenants {
+		if !validID.MatchString(tenant.ID) {
+			return nil, fmt.Errorf("invalid tenant id %q", tenant.ID)
+		}
+		if tenant.MaxReceipts < 0 {
+			return nil, fmt.Errorf("tenant %s: maxReceipts cannot be negative", tenant.ID)
+		}
+		if tenant.Rules != nil {
+			if err := tenant.Rules.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", tenant.ID, err)
+			}
+		}
+		registry.tenants[tenant.ID] = &tenant
+	}
+
+	return registry, nil
+}
+
+// Loads tenants from a JSON file in the form {"tenants": [{"id", "name", "maxReceipts", "rules"}]}.
+// Rules only need to list the amounts that differ from the default rules
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Tenants []json.RawMessage `json:"tenants"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse tenants file: %w", err)
+	}
+
+	tenants := make([]Tenant, 0, len(file.Tenants))
+	for _, raw := range file.Tenants {
+		// Decode the rules on top of the defaults
+		rules := scoring.DefaultRules()
+		tenant := Tenant{Rules: &rules}
+		if err := json.Unmarshal(raw, &tenant); err != nil {
+			return nil, fmt.Errorf("parse tenants file: %w", err)
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	return NewRegistry(tenants)
+}
+
+// Returns the tenant with the provided id
+func (r *Registry) Get(id string) (*Tenant, error) {
+	tenant, exists := r.tenants[id]
+	if !exists {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+// Calls fn for every registered tenant
+func (r *Registry) Each(fn func(*Tenant)) {
+	for _, tenant := range r.tenants {
+		fn(tenant)
+	}
+}
+
+type contextKey string
+
+const tenantKey = contextKey("tenant")
+
+// Returns a copy of the context carrying the tenant
+func WithTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// Returns the tenant stored in the context, or the default tenant
+func FromContext(ctx context.Context) *Tenant {
+	tenant, ok := ctx.Value(tenantKey).(*Tenant)
+	if !ok || tenant == nil {
+		return Default()
+	}
+	return tenant
+}
@@ -0,0 +1,89 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/scoring"
+)
+
+func TestNewRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []Tenant
+		err     bool
+	}{
+		{"No tenants", nil, false},
+		{"Valid tenants", []Tenant{{ID: "brand-a"}, {ID: "brand_b", MaxReceipts: 10}}, false},
+		{"Invalid id", []Tenant{{ID: "brand a"}}, true},
+		{"Empty id", []Tenant{{ID: ""}}, true},
+		{"Negative quota", []Tenant{{ID: "brand-a", MaxReceipts: -1}}, true},
+		{"Unknown length unit", []Tenant{{ID: "brand-a", Rules: &scoring.Rules{DescriptionLengthUnit: "words"}}}, true},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			registry, err := NewRegistry(entry.tenants)
+			if entry.err && err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+			if !entry.err {
+				if err != nil {
+					t.Fatalf("Expected no error, but got %v", err)
+				}
+				if _, err := registry.Get(models.DefaultTenantID); err != nil {
+					t.Errorf("Expected the default tenant to be registered")
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	data := `{"tenants": [
+		{"id": "brand-a", "name": "Brand A", "maxReceipts": 100, "rules": {"oddDayPoints": 0}},
+		{"id": "brand-b"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write tenants file: %v", err)
+	}
+
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("Failed to load tenants: %v", err)
+	}
+
+	brandA, err := registry.Get("brand-a")
+	if err != nil {
+		t.Fatalf("Expected brand-a to be registered: %v", err)
+	}
+	if brandA.MaxReceipts != 100 {
+		t.Errorf("Expected quota of 100, received %d", brandA.MaxReceipts)
+	}
+
+	// Omitted rule amounts keep their default value
+	expected := scoring.DefaultRules()
+	expected.OddDayPoints = 0
+	if *brandA.Rules != expected {
+		t.Errorf("Expected rules %+v, received %+v", expected, *brandA.Rules)
+	}
+
+	if _, err := registry.Get("brand-c"); err != ErrUnknownTenant {
+		t.Errorf("Expected %v, received %v", ErrUnknownTenant, err)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if tenant := FromContext(context.Background()); tenant.ID != models.DefaultTenantID {
+		t.Errorf("Expected the default tenant, received %s", tenant.ID)
+	}
+
+	ctx := WithTenant(context.Background(), &Tenant{ID: "brand-a"})
+	if tenant := FromContext(ctx); tenant.ID != "brand-a" {
+		t.Errorf("Expected brand-a, received %s", tenant.ID)
+	}
+}
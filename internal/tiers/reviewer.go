@@ -0,0 +1,68 @@
+package tiers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/periodic"
+)
+
+// Principal the transitions made by the reviewer are audited under
+const Principal = "system:tiers"
+
+// Reviewer moves members between tiers as their standing changes over time,
+// such as when spend falls out of the trailing twelve months.
+// Every transition is recorded in the audit log
+type Reviewer struct {
+	program  *Program
+	members  *models.MemberStore
+	ledger   *models.Ledger
+	audit    *audit.Log
+	errorLog *log.Logger
+	infoLog  *log.Logger
+	now      func() time.Time
+}
+
+func NewReviewer(program *Program, members *models.MemberStore, ledger *models.Ledger, auditLog *audit.Log, errorLog, infoLog *log.Logger) *Reviewer {
+	return &Reviewer{
+		program:  program,
+		members:  members,
+		ledger:   ledger,
+		audit:    auditLog,
+		errorLog: errorLog,
+		infoLog:  infoLog,
+		now:      time.Now,
+	}
+}
+
+// Reviews every member each interval until the context is cancelled
+func (r *Reviewer) Run(ctx context.Context, interval time.Duration) {
+	periodic.Run(ctx, interval, nil, func() { r.Review() })
+}
+
+// Moves every member with ledger activity to the tier it qualifies for
+// and returns the number of members whose tier changed
+func (r *Reviewer) Review() int {
+	now := r.now()
+	changed := 0
+
+	for _, ref := range r.ledger.Members() {
+		transition, moved, err := r.program.Review(r.members, r.ledger, ref.TenantID, ref.MemberID, now)
+		if err != nil {
+			r.errorLog.Printf("Failed to review the tier of member %s: %v", ref.MemberID, err)
+			continue
+		}
+		if moved {
+			r.infoLog.Printf("Member %s moved to tier %q", transition.MemberID, transition.To)
+			if _, err := r.audit.Record(transition.AuditEvent(Principal)); err != nil {
+				r.errorLog.Printf("Failed to record %s of member %s in the audit log: %v", audit.ActionMemberTier, transition.MemberID, err)
+			}
+			changed++
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,187 @@
+package tiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Standings that tier thresholds are measured against
+const (
+	// Points earned with receipts, net of reversals
+	BasisLifetimePoints = "lifetimePoints"
+	// Dollars spent on receipts over the trailing twelve months
+	BasisTrailingSpend = "trailingSpend"
+)
+
+// Tier is a level of the loyalty program whose members earn
+// their receipt points multiplied
+type Tier struct {
+	Name string `json:"name"`
+	// Minimum standing of the members of the tier
+	Threshold  float64 `json:"threshold"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// Transition is the move of a member from one tier to another
+type Transition struct {
+	TenantID string
+	MemberID string
+	From     string
+	To       string
+}
+
+// Tier of a member, the state audited for transitions
+type memberTier struct {
+	MemberID string `json:"memberId"`
+	Tier     string `json:"tier"`
+}
+
+// Program holds the tiers members are promoted and demoted between
+type Program struct {
+	Basis string
+	// Tiers sorted by threshold, lowest first
+	Tiers []Tier
+}
+
+// Creates a program of the tiers, measured against the basis
+func NewProgram(basis string, tiers []Tier) (*Program, error) {
+	if basis != BasisLifetimePoints && basis != BasisTrailingSpend {
+		return nil, fmt.Errorf("invalid tier basis %q, expected %s or %s", basis, BasisLifetimePoints, BasisTrailingSpend)
+	}
+
+	sorted := make([]Tier, len(tiers))
+	copy(sorted, tiers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Threshold < sorted[j].Threshold
+	})
+
+	names := make(map[string]bool)
+	for i, tier := range sorted {
+		if tier.Name == "" {
+			return nil, fmt.Errorf("tier %d: name is required", i)
+		}
+		if names[tier.Name] {
+			return nil, fmt.Errorf("tier %s is defined twice", tier.Name)
+		}
+		names[tier.Name] = true
+		if tier.Threshold < 0 {
+			return nil, fmt.Errorf("tier %s: threshold cannot be negative", tier.Name)
+		}
+		if i > 0 && tier.Threshold == sorted[i-1].Threshold {
+			return nil, fmt.Errorf("tiers %s and %s have the same threshold", sorted[i-1].Name, tier.Name)
+		}
+		if tier.Multiplier <= 0 {
+			return nil, fmt.Errorf("tier %s: multiplier must be positive", tier.Name)
+		}
+	}
+
+	return &Program{Basis: basis, Tiers: sorted}, nil
+}
+
+// Loads the program from a JSON file in the form
+// {"basis": "lifetimePoints", "tiers": [{"name", "threshold", "multiplier"}]}
+func LoadProgram(path string) (*Program, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Basis string `json:"basis"`
+		Tiers []Tier `json:"tiers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse tiers file: %w", err)
+	}
+
+	return NewProgram(file.Basis, file.Tiers)
+}
+
+// Returns the tier with the provided name
+func (p *Program) Get(name string) (Tier, bool) {
+	if p == nil {
+		return Tier{}, false
+	}
+	for _, tier := range p.Tiers {
+		if tier.Name == name {
+			return tier, true
+		}
+	}
+	return Tier{}, false
+}
+
+// Returns the multiplier of the named tier, 1 for members without a tier
+func (p *Program) Multiplier(name string) float64 {
+	tier, ok := p.Get(name)
+	if !ok {
+		return 1
+	}
+	return tier.Multiplier
+}
+
+// Returns the highest tier whose threshold the standing reaches,
+// and false if it reaches none
+func (p *Program) TierFor(standing float64) (Tier, bool) {
+	if p == nil {
+		return Tier{}, false
+	}
+	for i := len(p.Tiers) - 1; i >= 0; i-- {
+		if standing >= p.Tiers[i].Threshold {
+			return p.Tiers[i], true
+		}
+	}
+	return Tier{}, false
+}
+
+// Returns the standing of the member at the time now, in the unit of the basis
+func (p *Program) Standing(ledger *models.Ledger, tenantID, memberID string, now time.Time) float64 {
+	if p.Basis == BasisTrailingSpend {
+		return float64(ledger.SpendSince(tenantID, memberID, now.AddDate(-1, 0, 0))) / 100
+	}
+	return float64(ledger.LifetimePoints(tenantID, memberID))
+}
+
+// Moves the member to the tier its standing qualifies for, and reports whether its tier changed.
+// Members are never moved without a program
+func (p *Program) Review(members *models.MemberStore, ledger *models.Ledger, tenantID, memberID string, now time.Time) (Transition, bool, error) {
+	transition := Transition{TenantID: tenantID, MemberID: memberID}
+	if p == nil {
+		return transition, false, nil
+	}
+
+	member, err := members.Get(tenantID, memberID)
+	if err != nil {
+		return transition, false, err
+	}
+
+	tier, _ := p.TierFor(p.Standing(ledger, tenantID, memberID, now))
+	transition.From, transition.To = member.Tier, tier.Name
+	if tier.Name == member.Tier {
+		return transition, false, nil
+	}
+
+	err = members.SetTier(tenantID, memberID, tier.Name)
+	if err != nil {
+		return transition, false, err
+	}
+
+	return transition, true, nil
+}
+
+// Returns the audit event recording the transition on behalf of the principal
+func (t Transition) AuditEvent(principal string) audit.Event {
+	return audit.Event{
+		TenantID:   t.TenantID,
+		Principal:  principal,
+		Action:     audit.ActionMemberTier,
+		Resource:   models.MemberAccount(t.MemberID),
+		BeforeHash: audit.HashState(memberTier{MemberID: t.MemberID, Tier: t.From}),
+		AfterHash:  audit.HashState(memberTier{MemberID: t.MemberID, Tier: t.To}),
+	}
+}
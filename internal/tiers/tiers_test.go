@@ -0,0 +1,127 @@
+package tiers
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"kweeuhree.receipt-processor-challenge/internal/audit"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+var testTiers = []Tier{
+	{Name: "gold", Threshold: 500, Multiplier: 1.5},
+	{Name: "silver", Threshold: 100, Multiplier: 1.2},
+	{Name: "bronze", Threshold: 0, Multiplier: 1},
+}
+
+func TestNewProgram(t *testing.T) {
+	tests := []struct {
+		name  string
+		basis string
+		tiers []Tier
+		valid bool
+	}{
+		{"Lifetime points", BasisLifetimePoints, testTiers, true},
+		{"Trailing spend", BasisTrailingSpend, testTiers, true},
+		{"Unknown basis", "visits", testTiers, false},
+		{"Missing name", BasisLifetimePoints, []Tier{{Threshold: 0, Multiplier: 1}}, false},
+		{"Duplicate name", BasisLifetimePoints, []Tier{{Name: "gold", Multiplier: 1}, {Name: "gold", Threshold: 10, Multiplier: 2}}, false},
+		{"Duplicate threshold", BasisLifetimePoints, []Tier{{Name: "silver", Multiplier: 1}, {Name: "gold", Multiplier: 2}}, false},
+		{"Negative threshold", BasisLifetimePoints, []Tier{{Name: "gold", Threshold: -1, Multiplier: 1}}, false},
+		{"Zero multiplier", BasisLifetimePoints, []Tier{{Name: "gold", Threshold: 0}}, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			_, err := NewProgram(entry.basis, entry.tiers)
+			if (err == nil) != entry.valid {
+				t.Errorf("Expected valid to be %t, received error %v", entry.valid, err)
+			}
+		})
+	}
+}
+
+func TestTierFor(t *testing.T) {
+	program, _ := NewProgram(BasisLifetimePoints, testTiers)
+
+	tests := []struct {
+		standing float64
+		expected string
+	}{
+		{0, "bronze"},
+		{99, "bronze"},
+		{100, "silver"},
+		{499.99, "silver"},
+		{500, "gold"},
+		{10000, "gold"},
+	}
+
+	for _, entry := range tests {
+		tier, _ := program.TierFor(entry.standing)
+		if tier.Name != entry.expected {
+			t.Errorf("Expected %s for %v, received %s", entry.expected, entry.standing, tier.Name)
+		}
+	}
+
+	// Members without a tier or without a program earn unmultiplied points
+	var none *Program
+	if multiplier := none.Multiplier("gold"); multiplier != 1 {
+		t.Errorf("Expected multiplier 1 without a program, received %v", multiplier)
+	}
+	if multiplier := program.Multiplier(""); multiplier != 1 {
+		t.Errorf("Expected multiplier 1 without a tier, received %v", multiplier)
+	}
+}
+
+func TestReviewTrailingSpend(t *testing.T) {
+	program, _ := NewProgram(BasisTrailingSpend, testTiers)
+	members := models.NewMemberStore()
+	members.Insert(models.Member{ID: "member-1"})
+
+	ledger := models.NewLedger()
+	now := date(2024, 1, 1)
+	ledger.SetClock(func() time.Time { return now })
+	// $600 spent on a single receipt
+	ledger.Earn("", "member-1", "receipt-1", 10, 60000, "test")
+
+	var logs bytes.Buffer
+	auditLog := audit.NewLog()
+	reviewer := NewReviewer(program, members, ledger, auditLog, log.New(&logs, "", 0), log.New(&logs, "", 0))
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected string
+		changed  int
+	}{
+		{"Promoted", date(2024, 6, 1), "gold", 1},
+		{"Unchanged", date(2024, 12, 31), "gold", 0},
+		{"Demoted when the spend leaves the trailing year", date(2025, 1, 2), "bronze", 1},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			reviewer.now = func() time.Time { return entry.now }
+
+			if changed := reviewer.Review(); changed != entry.changed {
+				t.Errorf("Expected %d changes, received %d", entry.changed, changed)
+			}
+			member, _ := members.Get("", "member-1")
+			if member.Tier != entry.expected {
+				t.Errorf("Expected tier %s, received %s", entry.expected, member.Tier)
+			}
+		})
+	}
+
+	// The promotion and the demotion are audited
+	events := auditLog.Events(audit.Filter{Action: audit.ActionMemberTier, Principal: Principal})
+	if len(events) != 2 || events[0].Resource != "member:member-1" {
+		t.Errorf("Expected two audited transitions of member-1, received %+v", events)
+	}
+}
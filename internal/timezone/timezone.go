@@ -0,0 +1,125 @@
+// Package timezone resolves the zones receipts are printed in and turns
+// their wall clock purchase date and time into an instant.
+package timezone
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// Zones resolve on hosts without a zone database, such as scratch containers
+	_ "time/tzdata"
+)
+
+// Layouts of the purchase date and time of receipts
+const (
+	DateLayout = "2006-01-02"
+	TimeLayout = "15:04"
+)
+
+// Offsets from UTC span -12:00 to +14:00 in practice
+const maxOffset = 14 * time.Hour
+
+var (
+	ErrUnknownZone = errors.New("unknown time zone")
+	offsetPattern  = regexp.MustCompile(`^(?:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+)
+
+// Returns the zone named by an IANA name, such as America/New_York,
+// an offset from UTC, such as +02:00, -0530 or UTC+9, or UTC or Z
+func Parse(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	switch strings.ToUpper(name) {
+	case "":
+		return nil, ErrUnknownZone
+	case "Z", "UTC", "GMT":
+		return time.UTC, nil
+	}
+
+	if match := offsetPattern.FindStringSubmatch(strings.ToUpper(name)); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		// Minutes are optional
+		minutes, _ := strconv.Atoi(match[3])
+		offset := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+		if minutes >= 60 || offset > maxOffset {
+			return nil, fmt.Errorf("%w: offset %s is out of range", ErrUnknownZone, name)
+		}
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(formatOffset(offset), int(offset.Seconds())), nil
+	}
+
+	// The zone of the server is not a zone receipts can name
+	if name == "Local" {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownZone, name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownZone, name)
+	}
+	return location, nil
+}
+
+// Returns the instant the wall clock date and time denote in the zone.
+// A time skipped by a daylight saving transition is read with the offset in
+// effect before it, moving it forward by the length of the gap, and a time
+// repeated by a transition denotes its first occurrence
+func Instant(date, clock string, location *time.Location) (time.Time, error) {
+	wall, err := time.Parse(DateLayout+" "+TimeLayout, date+" "+clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Offsets in effect a day before and a day after cover any transition
+	// close to the wall clock time
+	_, before := wall.Add(-24 * time.Hour).In(location).Zone()
+	_, after := wall.Add(24 * time.Hour).In(location).Zone()
+
+	var instant time.Time
+	for _, offset := range []int{before, after} {
+		candidate := wall.Add(-time.Duration(offset) * time.Second)
+		if sameWallClock(candidate.In(location), wall) {
+			if instant.IsZero() || candidate.Before(instant) {
+				instant = candidate
+			}
+		}
+	}
+	if instant.IsZero() {
+		// No offset yields the wall clock time, which falls in a gap
+		instant = wall.Add(-time.Duration(before) * time.Second)
+	}
+
+	return instant.In(location), nil
+}
+
+// Returns the wall clock date and time of the instant in the zone
+func Local(instant time.Time, location *time.Location) (date, clock string) {
+	local := instant.In(location)
+	return local.Format(DateLayout), local.Format(TimeLayout)
+}
+
+// Returns the name a zone is stored under
+func Name(location *time.Location) string {
+	if location == nil {
+		return time.UTC.String()
+	}
+	return location.String()
+}
+
+func sameWallClock(local, wall time.Time) bool {
+	year, month, day := local.Date()
+	wallYear, wallMonth, wallDay := wall.Date()
+	return year == wallYear && month == wallMonth && day == wallDay &&
+		local.Hour() == wall.Hour() && local.Minute() == wall.Minute()
+}
+
+func formatOffset(offset time.Duration) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, int(offset.Hours()), int(offset.Minutes())%60)
+}
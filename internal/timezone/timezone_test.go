@@ -0,0 +1,98 @@
+package timezone
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		offset   int
+	}{
+		{"America/New_York", "America/New_York", -5 * 3600},
+		{"Asia/Kolkata", "Asia/Kolkata", 19800},
+		{"UTC", "UTC", 0},
+		{"z", "UTC", 0},
+		{"+02:00", "+02:00", 7200},
+		{"-0530", "-05:30", -19800},
+		{"UTC+9", "+09:00", 9 * 3600},
+		{"+14:00", "+14:00", 14 * 3600},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			location, err := Parse(entry.name)
+			if err != nil {
+				t.Fatalf("Failed to parse zone: %v", err)
+			}
+			// Offsets of named zones are checked in winter
+			_, offset := time.Date(2024, time.January, 15, 12, 0, 0, 0, location).Zone()
+			if location.String() != entry.expected || offset != entry.offset {
+				t.Errorf("Expected %s at %d, received %s at %d", entry.expected, entry.offset, location, offset)
+			}
+		})
+	}
+
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons", "+15:00", "+02:60", "02:00", "../etc/passwd"} {
+		if _, err := Parse(name); !errors.Is(err, ErrUnknownZone) {
+			t.Errorf("Expected %q to be rejected, received %v", name, err)
+		}
+	}
+}
+
+func TestInstant(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		date     string
+		clock    string
+		expected string
+		local    string
+	}{
+		{"Summer time", "America/New_York", "2024-07-01", "14:30", "2024-07-01T18:30:00Z", "2024-07-01 14:30"},
+		{"Fixed offset crossing midnight", "+05:30", "2024-01-01", "00:15", "2023-12-31T18:45:00Z", "2024-01-01 00:15"},
+		// Clocks jump from 02:00 to 03:00, 02:30 is read as standard time
+		{"Spring forward gap", "America/New_York", "2024-03-10", "02:30", "2024-03-10T07:30:00Z", "2024-03-10 03:30"},
+		{"Spring forward start of gap", "America/New_York", "2024-03-10", "02:00", "2024-03-10T07:00:00Z", "2024-03-10 03:00"},
+		{"Before spring forward", "America/New_York", "2024-03-10", "01:59", "2024-03-10T06:59:00Z", "2024-03-10 01:59"},
+		{"After spring forward", "America/New_York", "2024-03-10", "03:00", "2024-03-10T07:00:00Z", "2024-03-10 03:00"},
+		// Clocks fall back from 02:00 to 01:00, 01:30 happens twice
+		{"Fall back repeated hour", "America/New_York", "2024-11-03", "01:30", "2024-11-03T05:30:00Z", "2024-11-03 01:30"},
+		{"After fall back", "America/New_York", "2024-11-03", "02:00", "2024-11-03T07:00:00Z", "2024-11-03 02:00"},
+		{"London gap", "Europe/London", "2024-03-31", "01:30", "2024-03-31T01:30:00Z", "2024-03-31 02:30"},
+		{"Southern hemisphere repeated hour", "Australia/Sydney", "2024-04-07", "02:30", "2024-04-06T15:30:00Z", "2024-04-07 02:30"},
+		// Lord Howe Island shifts its clocks by half an hour
+		{"Half hour gap", "Australia/Lord_Howe", "2024-10-06", "02:15", "2024-10-05T15:45:00Z", "2024-10-06 02:45"},
+		// Samoa skipped the 30th of December 2011 when it crossed the date line
+		{"Skipped day", "Pacific/Apia", "2011-12-30", "12:00", "2011-12-30T22:00:00Z", "2011-12-31 12:00"},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			location, err := Parse(entry.zone)
+			if err != nil {
+				t.Fatalf("Failed to parse zone: %v", err)
+			}
+
+			instant, err := Instant(entry.date, entry.clock, location)
+			if err != nil {
+				t.Fatalf("Failed to resolve instant: %v", err)
+			}
+			if received := instant.UTC().Format(time.RFC3339); received != entry.expected {
+				t.Errorf("Expected %s, received %s", entry.expected, received)
+			}
+
+			date, clock := Local(instant, location)
+			if received := date + " " + clock; received != entry.local {
+				t.Errorf("Expected local time %s, received %s", entry.local, received)
+			}
+		})
+	}
+
+	if _, err := Instant("2024-02-30", "12:00", time.UTC); err == nil {
+		t.Errorf("Expected an invalid date to be rejected")
+	}
+}
@@ -1,11 +1,13 @@
 package validator
 
 import (
+	"net/mail"
 	"strconv"
 	"strings"
 	"time"
 
 	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/timezone"
 )
 
 // Validator struct contains a map of validation errors
@@ -66,8 +68,20 @@ func (v *Validator) ValidTime(timeString string) bool {
 	return err == nil
 }
 
+// Returns true if a value is an IANA time zone or an offset from UTC
+func (v *Validator) ValidTimeZone(name string) bool {
+	_, err := timezone.Parse(name)
+	return err == nil
+}
+
 // Returns true if a total is valid number
 func (v *Validator) ValidNumber(total string) bool {
 	_, err := strconv.ParseFloat(total, 64)
 	return err == nil
 }
+
+// Returns true if a value is a plain email address
+func (v *Validator) ValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
@@ -328,3 +328,28 @@ func TestValidTime(t *testing.T) {
 		})
 	}
 }
+
+func TestValidEmail(t *testing.T) {
+	d := setupTestDependencies()
+	tests := []struct {
+		name   string
+		email  string
+		result bool
+	}{
+		{"Valid email", "jane@example.com", true},
+		{"Valid email", "jane.doe+points@example.co.uk", true},
+		{"Invalid email", "jane", false},
+		{"Invalid email", "jane@", false},
+		{"Email with display name", "Jane <jane@example.com>", false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			result := d.validator.ValidEmail(entry.email)
+
+			if result != entry.result {
+				t.Errorf("Expected %t, but got %t", entry.result, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+	"kweeuhree.receipt-processor-challenge/internal/periodic"
+)
+
+// States of a delivery
+const (
+	StatusPending = "pending"
+	// Dead letters exhausted their attempts and are no longer retried
+	StatusDead = "dead"
+)
+
+var ErrNoDelivery = errors.New("no webhook delivery found for that ID")
+
+// Event is the JSON payload delivered to subscribers
+type Event struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	TenantID string    `json:"tenantId"`
+	Time     time.Time `json:"time"`
+	Data     any       `json:"data"`
+}
+
+// Delivery is an event waiting to be delivered to a subscription
+type Delivery struct {
+	ID             string
+	SubscriptionID string
+	TenantID       string
+	EventID        string
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttempt    time.Time
+	// Outcome of the last failed attempt
+	LastError      string
+	LastStatusCode int
+	CreatedAt      time.Time
+}
+
+// RetryPolicy spaces out the attempts of a failing delivery. The delay
+// doubles after every attempt, starting at InitialBackoff and capped at MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Number of subscriptions delivered to at the same time by default
+const DefaultWorkers = 8
+
+// Deliveries kept for each subscription by default, the oldest are
+// dropped beyond them so that an unreachable subscriber cannot grow
+// the outbox without bound
+const (
+	DefaultMaxPending = 10000
+	DefaultMaxDead    = 1000
+)
+
+// Dropped counts the deliveries of a subscription dropped over the limits
+type Dropped struct {
+	Pending int64 `json:"pending"`
+	Dead    int64 `json:"dead"`
+}
+
+// Retries for about a day before dead-lettering a delivery
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 10, InitialBackoff: 30 * time.Second, MaxBackoff: 6 * time.Hour}
+
+// Returns the delay before the attempt following the provided number of attempts
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxBackoff)
+}
+
+// Outbox holds the deliveries of published events until their subscriber
+// accepts them, retrying failed attempts with exponential backoff.
+// Delivered events are dropped, dead letters are kept until redelivered
+// or until newer dead letters of their subscription push them out
+type Outbox struct {
+	subscriptions *SubscriptionStore
+	policy        RetryPolicy
+	client        *http.Client
+	errorLog      *log.Logger
+	infoLog       *log.Logger
+	now           func() time.Time
+
+	mu         sync.Mutex
+	deliveries []*Delivery
+	// IDs of the deliveries being attempted
+	inFlight map[string]bool
+	// Subscriptions a worker is delivering to, keyed by tenant and ID
+	busy map[string]bool
+	// Deliveries kept for each subscription, by status
+	maxPending int
+	maxDead    int
+	// Deliveries dropped over the limits, keyed by tenant and subscription ID
+	dropped map[string]*Dropped
+	// Bounds the subscriptions delivered to at the same time
+	workers chan struct{}
+	// Wakes Run up when an event is published
+	wake chan struct{}
+}
+
+func NewOutbox(subscriptions *SubscriptionStore, policy RetryPolicy, errorLog, infoLog *log.Logger) *Outbox {
+	return &Outbox{
+		subscriptions: subscriptions,
+		policy:        policy,
+		client:        newClient(false),
+		errorLog:      errorLog,
+		infoLog:       infoLog,
+		now:           time.Now,
+		inFlight:      make(map[string]bool),
+		busy:          make(map[string]bool),
+		maxPending:    DefaultMaxPending,
+		maxDead:       DefaultMaxDead,
+		dropped:       make(map[string]*Dropped),
+		workers:       make(chan struct{}, DefaultWorkers),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Allows deliveries to loopback, private and link-local addresses,
+// for subscribers running next to the server in development and tests
+func (o *Outbox) AllowPrivateNetworks() {
+	o.client = newClient(true)
+}
+
+// Sets the number of subscriptions delivered to at the same time.
+// It must be called before the outbox is run
+func (o *Outbox) SetWorkers(n int) {
+	o.workers = make(chan struct{}, max(n, 1))
+}
+
+// Sets the number of pending deliveries and of dead letters kept for each
+// subscription. It must be called before events are published
+func (o *Outbox) SetLimits(maxPending, maxDead int) {
+	o.maxPending = max(maxPending, 1)
+	o.maxDead = max(maxDead, 1)
+}
+
+// Queues a delivery of the event to every subscription of the tenant
+// registered for its type, and returns the number of queued deliveries
+func (o *Outbox) Publish(tenantID, eventType string, data any) (int, error) {
+	subscriptions := o.subscriptions.Subscribed(tenantID, eventType)
+	if len(subscriptions) == 0 {
+		return 0, nil
+	}
+
+	now := o.now().UTC()
+	event := Event{
+		ID:       uuid.New().String(),
+		Type:     eventType,
+		TenantID: models.TenantKey(tenantID),
+		Time:     now,
+		Data:     data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	o.mu.Lock()
+	for _, subscription := range subscriptions {
+		o.deliveries = append(o.deliveries, &Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			TenantID:       event.TenantID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        payload,
+			Status:         StatusPending,
+			NextAttempt:    now,
+			CreatedAt:      now,
+		})
+		o.trim(event.TenantID, subscription.ID, StatusPending, o.maxPending)
+	}
+	o.mu.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return len(subscriptions), nil
+}
+
+// Attempts the due deliveries every interval, and as soon as an event
+// is published, until the context is cancelled. Rounds run without
+// waiting for the previous ones, so a subscriber slow to answer only
+// holds up its own deliveries
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	var rounds sync.WaitGroup
+	defer rounds.Wait()
+
+	periodic.Run(ctx, interval, o.wake, func() {
+		rounds.Add(1)
+		go func() {
+			defer rounds.Done()
+			o.Dispatch(ctx)
+		}()
+	})
+}
+
+// Attempts every pending delivery that is due and returns the number delivered.
+// The deliveries of a subscription are attempted in order by one worker, and
+// the subscriptions a worker is still busy with are left to a later round
+func (o *Outbox) Dispatch(ctx context.Context) int {
+	now := o.now()
+
+	o.mu.Lock()
+	var keys []string
+	due := make(map[string][]Delivery)
+	for _, delivery := range o.deliveries {
+		key := delivery.TenantID + "/" + delivery.SubscriptionID
+		if delivery.Status != StatusPending || delivery.NextAttempt.After(now) || o.inFlight[delivery.ID] || o.busy[key] {
+			continue
+		}
+		if _, ok := due[key]; !ok {
+			keys = append(keys, key)
+		}
+		o.inFlight[delivery.ID] = true
+		due[key] = append(due[key], *delivery)
+	}
+	for _, key := range keys {
+		o.busy[key] = true
+	}
+	o.mu.Unlock()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		delivered int
+		attempted int
+	)
+	for _, key := range keys {
+		attempted += len(due[key])
+		wg.Add(1)
+		go func(key string, deliveries []Delivery) {
+			defer wg.Done()
+			o.workers <- struct{}{}
+			defer func() { <-o.workers }()
+
+			n := o.deliver(ctx, deliveries)
+
+			o.mu.Lock()
+			delete(o.busy, key)
+			o.mu.Unlock()
+
+			mu.Lock()
+			delivered += n
+			mu.Unlock()
+		}(key, due[key])
+	}
+	wg.Wait()
+
+	if delivered > 0 {
+		o.infoLog.Printf("Delivered %d of %d due webhook deliveries", delivered, attempted)
+	}
+
+	return delivered
+}
+
+// Attempts the deliveries of one subscription in order and returns the number delivered
+func (o *Outbox) deliver(ctx context.Context, deliveries []Delivery) int {
+	delivered := 0
+	for _, delivery := range deliveries {
+		subscription, err := o.subscriptions.Get(delivery.TenantID, delivery.SubscriptionID)
+		if err != nil {
+			// The subscription was deleted since the event was published
+			o.remove(delivery)
+			continue
+		}
+
+		statusCode, err := o.send(ctx, subscription, delivery)
+		if o.complete(delivery.ID, statusCode, err) {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// Returns the undelivered deliveries of the subscription, oldest first
+func (o *Outbox) Deliveries(tenantID, subscriptionID string) []Delivery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var deliveries []Delivery
+	for _, delivery := range o.deliveries {
+		if delivery.TenantID == models.TenantKey(tenantID) && delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+
+	return deliveries
+}
+
+// Returns the number of deliveries of the subscription dropped over the limits
+func (o *Outbox) Dropped(tenantID, subscriptionID string) Dropped {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if dropped, ok := o.dropped[models.TenantKey(tenantID)+"/"+subscriptionID]; ok {
+		return *dropped
+	}
+	return Dropped{}
+}
+
+// Queues a dead letter of the subscription for delivery again, with its attempts reset
+func (o *Outbox) Redeliver(tenantID, subscriptionID, id string) (Delivery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, delivery := range o.deliveries {
+		if delivery.ID != id || delivery.TenantID != models.TenantKey(tenantID) || delivery.SubscriptionID != subscriptionID {
+			continue
+		}
+		if delivery.Status != StatusDead {
+			return Delivery{}, fmt.Errorf("%w: delivery %s is %s", ErrNoDelivery, id, delivery.Status)
+		}
+		delivery.Status = StatusPending
+		delivery.Attempts = 0
+		delivery.NextAttempt = o.now().UTC()
+
+		select {
+		case o.wake <- struct{}{}:
+		default:
+		}
+		return *delivery, nil
+	}
+
+	return Delivery{}, ErrNoDelivery
+}
+
+// Posts the signed payload of the delivery to the subscription URL
+// and returns the response status code
+func (o *Outbox) send(ctx context.Context, subscription Subscription, delivery Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "receipt-processor-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, o.now(), delivery.Payload))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Records the outcome of an attempt and reports whether the delivery succeeded.
+// Delivered events leave the outbox, failed ones are retried or dead-lettered
+func (o *Outbox) complete(id string, statusCode int, sendErr error) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.inFlight, id)
+	for i, delivery := range o.deliveries {
+		if delivery.ID != id {
+			continue
+		}
+
+		delivery.Attempts++
+		if sendErr == nil {
+			o.deliveries = append(o.deliveries[:i], o.deliveries[i+1:]...)
+			return true
+		}
+
+		delivery.LastError = sendErr.Error()
+		delivery.LastStatusCode = statusCode
+		if delivery.Attempts >= o.policy.MaxAttempts {
+			delivery.Status = StatusDead
+			o.errorLog.Printf("Webhook delivery %s of %s dead-lettered after %d attempts: %v", delivery.ID, delivery.EventType, delivery.Attempts, sendErr)
+			o.trim(delivery.TenantID, delivery.SubscriptionID, StatusDead, o.maxDead)
+			return false
+		}
+		delivery.NextAttempt = o.now().UTC().Add(o.policy.Backoff(delivery.Attempts))
+		return false
+	}
+
+	return false
+}
+
+// Removes a delivery of a deleted subscription, and the count of its dropped deliveries
+func (o *Outbox) remove(removed Delivery) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.inFlight, removed.ID)
+	delete(o.dropped, removed.TenantID+"/"+removed.SubscriptionID)
+	for i, delivery := range o.deliveries {
+		if delivery.ID == removed.ID {
+			o.deliveries = append(o.deliveries[:i], o.deliveries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Drops the oldest deliveries of the subscription with the status beyond
+// the limit, other than those being attempted. The caller holds the lock
+func (o *Outbox) trim(tenantID, subscriptionID, status string, limit int) {
+	excess := -limit
+	for _, delivery := range o.deliveries {
+		if delivery.TenantID == tenantID && delivery.SubscriptionID == subscriptionID && delivery.Status == status {
+			excess++
+		}
+	}
+	if excess <= 0 {
+		return
+	}
+
+	kept := o.deliveries[:0]
+	dropped := 0
+	for _, delivery := range o.deliveries {
+		if dropped < excess && delivery.TenantID == tenantID && delivery.SubscriptionID == subscriptionID &&
+			delivery.Status == status && !o.inFlight[delivery.ID] {
+			dropped++
+			continue
+		}
+		kept = append(kept, delivery)
+	}
+	clear(o.deliveries[len(kept):])
+	o.deliveries = kept
+	if dropped == 0 {
+		return
+	}
+
+	key := tenantID + "/" + subscriptionID
+	if o.dropped[key] == nil {
+		o.dropped[key] = &Dropped{}
+	}
+	if status == StatusDead {
+		o.dropped[key].Dead += int64(dropped)
+	} else {
+		o.dropped[key].Pending += int64(dropped)
+	}
+	o.errorLog.Printf("Dropped the %d oldest %s webhook deliveries of subscription %s over the limit of %d", dropped, status, subscriptionID, limit)
+}
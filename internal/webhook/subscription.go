@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"kweeuhree.receipt-processor-challenge/internal/models"
+)
+
+// Receipt lifecycle events partners can subscribe to
+const (
+	EventReceiptProcessed = "receipt.processed"
+	EventReceiptUpdated   = "receipt.updated"
+	EventReceiptDeleted   = "receipt.deleted"
+	EventReceiptRestored  = "receipt.restored"
+)
+
+// Events a subscription can be registered for
+var EventTypes = []string{EventReceiptProcessed, EventReceiptUpdated, EventReceiptDeleted, EventReceiptRestored}
+
+var ErrNoSubscription = errors.New("no webhook subscription found for that ID")
+
+// Subscription registers a URL to be notified of events of a tenant
+type Subscription struct {
+	ID       string
+	TenantID string
+	URL      string
+	Events   []string
+	// Key the payloads delivered to the URL are signed with
+	Secret    string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// Reports whether the subscription is registered for the event type
+func (s Subscription) Subscribed(eventType string) bool {
+	return slices.Contains(s.Events, eventType)
+}
+
+// SubscriptionStore keeps the subscriptions of every tenant in separate namespaces
+type SubscriptionStore struct {
+	mu            sync.RWMutex
+	subscriptions map[string]map[string]Subscription
+}
+
+func NewSubscriptionStore() *SubscriptionStore {
+	return &SubscriptionStore{
+		subscriptions: make(map[string]map[string]Subscription),
+	}
+}
+
+// Stores a subscription to the events at the URL with a new id and secret, and returns it
+func (s *SubscriptionStore) Create(tenantID, url string, events []string, createdBy string) (Subscription, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	subscription := Subscription{
+		ID:        uuid.New().String(),
+		TenantID:  models.TenantKey(tenantID),
+		URL:       url,
+		Events:    slices.Clone(events),
+		Secret:    secret,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantSubscriptions, exists := s.subscriptions[subscription.TenantID]
+	if !exists {
+		tenantSubscriptions = make(map[string]Subscription)
+		s.subscriptions[subscription.TenantID] = tenantSubscriptions
+	}
+	tenantSubscriptions[subscription.ID] = subscription
+
+	return subscription, nil
+}
+
+func (s *SubscriptionStore) Get(tenantID, id string) (Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subscription, exists := s.subscriptions[models.TenantKey(tenantID)][id]
+	if !exists {
+		return Subscription{}, ErrNoSubscription
+	}
+
+	return subscription, nil
+}
+
+// Returns the subscriptions of the tenant in the order they were created
+func (s *SubscriptionStore) List(tenantID string) []Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subscriptions := make([]Subscription, 0, len(s.subscriptions[models.TenantKey(tenantID)]))
+	for _, subscription := range s.subscriptions[models.TenantKey(tenantID)] {
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].ID < subscriptions[j].ID
+		}
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+
+	return subscriptions
+}
+
+func (s *SubscriptionStore) Delete(tenantID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.subscriptions[models.TenantKey(tenantID)][id]; !exists {
+		return ErrNoSubscription
+	}
+	delete(s.subscriptions[models.TenantKey(tenantID)], id)
+
+	return nil
+}
+
+// Returns the subscriptions of the tenant registered for the event type
+func (s *SubscriptionStore) Subscribed(tenantID, eventType string) []Subscription {
+	var subscribed []Subscription
+	for _, subscription := range s.List(tenantID) {
+		if subscription.Subscribed(eventType) {
+			subscribed = append(subscribed, subscription)
+		}
+	}
+	return subscribed
+}
+
+// Returns a random 256-bit signing key, hex encoded
+func newSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// Timeout of a single delivery attempt
+const sendTimeout = 10 * time.Second
+
+var ErrForbiddenAddress = errors.New("webhook address is not publicly routable")
+
+// Networks subscribers cannot be reached on besides loopback, private,
+// link-local and multicast addresses, which netip reports on its own
+var reservedPrefixes = []netip.Prefix{
+	// This network
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// Carrier-grade NAT
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// Benchmarking
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// Reserved and broadcast
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// IPv4-IPv6 translation, which embeds IPv4 addresses
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// Returns true if deliveries may be sent to the address. Loopback, private,
+// link-local, such as the 169.254.169.254 cloud metadata service, and other
+// addresses that do not reach the public internet are refused
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the client deliveries are sent with. Unless private networks are
+// allowed, the address every connection dials, once the host is resolved,
+// must be public, so that subscribers cannot reach internal services by
+// naming them or by a host resolving to them. Redirects are not followed
+// and proxies are not used, since either would dial another address
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !PublicAddress(addr) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   sendTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			// Answer with the redirect, which fails the attempt
+			return http.ErrUseLastResponse
+		},
+	}
+}
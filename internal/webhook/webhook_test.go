@@ -0,0 +1,367 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Receiver records the deliveries it accepts and fails the first ones on demand
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Creates an outbox with a subscription to processed receipts at the receiver
+func newTestOutbox(t *testing.T, rc *receiver, policy RetryPolicy) (*Outbox, Subscription, *time.Time) {
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	subscriptions := NewSubscriptionStore()
+	subscription, err := subscriptions.Create("tenant-a", server.URL, []string{EventReceiptProcessed}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	var logs bytes.Buffer
+	outbox := NewOutbox(subscriptions, policy, log.New(&logs, "", 0), log.New(&logs, "", 0))
+	outbox.AllowPrivateNetworks()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	outbox.now = func() time.Time { return now }
+
+	return outbox, subscription, &now
+}
+
+func TestPublishAndDeliver(t *testing.T) {
+	rc := &receiver{}
+	outbox, subscription, now := newTestOutbox(t, rc, DefaultRetryPolicy)
+
+	// Events of other types and tenants are not delivered to the subscription
+	for _, event := range []struct{ tenantID, eventType string }{
+		{"tenant-a", EventReceiptDeleted},
+		{"tenant-b", EventReceiptProcessed},
+	} {
+		if queued, _ := outbox.Publish(event.tenantID, event.eventType, nil); queued != 0 {
+			t.Errorf("Expected no delivery of %s to %s, queued %d", event.eventType, event.tenantID, queued)
+		}
+	}
+
+	queued, err := outbox.Publish("tenant-a", EventReceiptProcessed, map[string]any{"id": "receipt-1", "points": 28})
+	if err != nil || queued != 1 {
+		t.Fatalf("Expected 1 queued delivery, received %d and %v", queued, err)
+	}
+
+	if delivered := outbox.Dispatch(context.Background()); delivered != 1 {
+		t.Fatalf("Expected 1 delivery, received %d", delivered)
+	}
+	if len(rc.requests) != 1 {
+		t.Fatalf("Expected the receiver to get 1 request, received %d", len(rc.requests))
+	}
+
+	req, body := rc.requests[0], rc.bodies[0]
+	if req.Header.Get(HeaderEvent) != EventReceiptProcessed || req.Header.Get(HeaderDelivery) == "" {
+		t.Errorf("Expected event and delivery headers, received %v", req.Header)
+	}
+	if err := Verify(subscription.Secret, req.Header.Get(HeaderSignature), body, 5*time.Minute, *now); err != nil {
+		t.Errorf("Expected a valid signature, received %v", err)
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if event.Type != EventReceiptProcessed || event.TenantID != "tenant-a" || event.Data.(map[string]any)["id"] != "receipt-1" {
+		t.Errorf("Unexpected payload %+v", event)
+	}
+
+	// Delivered events leave the outbox
+	if deliveries := outbox.Deliveries("tenant-a", subscription.ID); len(deliveries) != 0 {
+		t.Errorf("Expected no undelivered deliveries, received %d", len(deliveries))
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	rc := &receiver{failures: 2}
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	outbox, subscription, now := newTestOutbox(t, rc, policy)
+
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+
+	// First attempt fails and is retried after a minute
+	if delivered := outbox.Dispatch(context.Background()); delivered != 0 {
+		t.Fatalf("Expected the first attempt to fail, delivered %d", delivered)
+	}
+	delivery := outbox.Deliveries("tenant-a", subscription.ID)[0]
+	if delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusServiceUnavailable || !delivery.NextAttempt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected a retry in a minute after 1 attempt, received %+v", delivery)
+	}
+
+	// Not due yet
+	*now = now.Add(59 * time.Second)
+	outbox.Dispatch(context.Background())
+	if len(rc.requests) != 1 {
+		t.Errorf("Expected no attempt before the backoff elapsed, received %d requests", len(rc.requests))
+	}
+
+	// Second attempt fails and the delay doubles
+	*now = now.Add(time.Second)
+	outbox.Dispatch(context.Background())
+	delivery = outbox.Deliveries("tenant-a", subscription.ID)[0]
+	if delivery.Attempts != 2 || !delivery.NextAttempt.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("Expected a retry in two minutes after 2 attempts, received %+v", delivery)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if delivered := outbox.Dispatch(context.Background()); delivered != 1 {
+		t.Errorf("Expected the third attempt to succeed, delivered %d", delivered)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	rc := &receiver{failures: 3}
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Minute}
+	outbox, subscription, now := newTestOutbox(t, rc, policy)
+
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+	for i := 0; i < 3; i++ {
+		outbox.Dispatch(context.Background())
+		*now = now.Add(time.Minute)
+	}
+
+	deliveries := outbox.Deliveries("tenant-a", subscription.ID)
+	if len(deliveries) != 1 || deliveries[0].Status != StatusDead || deliveries[0].Attempts != 2 {
+		t.Fatalf("Expected 1 dead letter after 2 attempts, received %+v", deliveries)
+	}
+	if len(rc.requests) != 2 {
+		t.Errorf("Expected dead letters not to be retried, received %d requests", len(rc.requests))
+	}
+
+	// Dead letters can be queued again by hand
+	if _, err := outbox.Redeliver("tenant-b", subscription.ID, deliveries[0].ID); err == nil {
+		t.Error("Expected dead letters of other tenants not to be redelivered")
+	}
+	if _, err := outbox.Redeliver("tenant-a", subscription.ID, deliveries[0].ID); err != nil {
+		t.Fatalf("Failed to redeliver: %v", err)
+	}
+	outbox.Dispatch(context.Background())
+	*now = now.Add(time.Minute)
+	if delivered := outbox.Dispatch(context.Background()); delivered != 1 {
+		t.Errorf("Expected the redelivered event to be delivered, delivered %d", delivered)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	rc := &receiver{failures: 10}
+	policy := RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Minute, MaxBackoff: time.Minute}
+	outbox, subscription, _ := newTestOutbox(t, rc, policy)
+	outbox.SetLimits(2, 1)
+
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+	oldest := outbox.Deliveries("tenant-a", subscription.ID)[0]
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+
+	deliveries := outbox.Deliveries("tenant-a", subscription.ID)
+	if len(deliveries) != 2 || deliveries[0].ID == oldest.ID || deliveries[1].ID == oldest.ID {
+		t.Fatalf("Expected the oldest pending delivery to be dropped, received %+v", deliveries)
+	}
+	if dropped := outbox.Dropped("tenant-a", subscription.ID); dropped != (Dropped{Pending: 1}) {
+		t.Errorf("Expected 1 dropped pending delivery, received %+v", dropped)
+	}
+
+	// Both remaining deliveries fail their only attempt, the older dead letter is dropped
+	outbox.Dispatch(context.Background())
+
+	deliveries = outbox.Deliveries("tenant-a", subscription.ID)
+	if len(deliveries) != 1 || deliveries[0].Status != StatusDead {
+		t.Fatalf("Expected 1 dead letter to be kept, received %+v", deliveries)
+	}
+	if dropped := outbox.Dropped("tenant-a", subscription.ID); dropped != (Dropped{Pending: 1, Dead: 1}) {
+		t.Errorf("Expected 1 dropped pending delivery and 1 dropped dead letter, received %+v", dropped)
+	}
+	if dropped := outbox.Dropped("tenant-b", subscription.ID); dropped != (Dropped{}) {
+		t.Errorf("Expected no drops reported to other tenants, received %+v", dropped)
+	}
+}
+
+func TestDeletedSubscription(t *testing.T) {
+	rc := &receiver{}
+	outbox, subscription, _ := newTestOutbox(t, rc, DefaultRetryPolicy)
+
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+	outbox.subscriptions.Delete("tenant-a", subscription.ID)
+
+	if delivered := outbox.Dispatch(context.Background()); delivered != 0 || len(rc.requests) != 0 {
+		t.Errorf("Expected no delivery to a deleted subscription, received %d requests", len(rc.requests))
+	}
+	if deliveries := outbox.Deliveries("tenant-a", subscription.ID); len(deliveries) != 0 {
+		t.Errorf("Expected the deliveries of a deleted subscription to be dropped, received %d", len(deliveries))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, entry := range tests {
+		if backoff := policy.Backoff(entry.attempts); backoff != entry.expected {
+			t.Errorf("Expected a backoff of %s after %d attempts, received %s", entry.expected, entry.attempts, backoff)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	payload := []byte(`{"id":"event-1"}`)
+	header := Sign("secret", now, payload)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		payload []byte
+		now     time.Time
+		valid   bool
+	}{
+		{"Valid", "secret", header, payload, now.Add(time.Minute), true},
+		{"Wrong secret", "other", header, payload, now, false},
+		{"Modified payload", "secret", header, []byte(`{"id":"event-2"}`), now, false},
+		{"Expired", "secret", header, payload, now.Add(10 * time.Minute), false},
+		{"Malformed", "secret", "v1=abc", payload, now, false},
+	}
+
+	for _, entry := range tests {
+		t.Run(entry.name, func(t *testing.T) {
+			err := Verify(entry.secret, entry.header, entry.payload, 5*time.Minute, entry.now)
+			if (err == nil) != entry.valid {
+				t.Errorf("Expected valid to be %v, received %v", entry.valid, err)
+			}
+		})
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+
+	for _, test := range tests {
+		if public := PublicAddress(netip.MustParseAddr(test.addr)); public != test.public {
+			t.Errorf("Expected %s public to be %t", test.addr, test.public)
+		}
+	}
+}
+
+func TestPrivateAddressRefused(t *testing.T) {
+	rc := &receiver{}
+	outbox, subscription, _ := newTestOutbox(t, rc, DefaultRetryPolicy)
+	outbox.client = newClient(false)
+
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+	if delivered := outbox.Dispatch(context.Background()); delivered != 0 || len(rc.requests) != 0 {
+		t.Fatalf("Expected no delivery to a loopback address, received %d requests", len(rc.requests))
+	}
+	deliveries := outbox.Deliveries("tenant-a", subscription.ID)
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].LastError, ErrForbiddenAddress.Error()) {
+		t.Errorf("Expected the forbidden address to be reported, received %+v", deliveries)
+	}
+}
+
+func TestRedirectRefused(t *testing.T) {
+	target := &receiver{}
+	targetServer := httptest.NewServer(target)
+	t.Cleanup(targetServer.Close)
+
+	outbox, _, _ := newTestOutbox(t, &receiver{}, DefaultRetryPolicy)
+	redirect := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	outbox.subscriptions = NewSubscriptionStore()
+	if _, err := outbox.subscriptions.Create("tenant-a", redirect.URL, []string{EventReceiptProcessed}, "tester"); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+	if delivered := outbox.Dispatch(context.Background()); delivered != 0 || len(target.requests) != 0 {
+		t.Errorf("Expected the redirect not to be followed, received %d requests", len(target.requests))
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+
+	rc := &receiver{}
+	outbox, _, _ := newTestOutbox(t, rc, DefaultRetryPolicy)
+	if _, err := outbox.subscriptions.Create("tenant-b", slow.URL, []string{EventReceiptProcessed}, "tester"); err != nil {
+		t.Fatalf("Failed to create subscription: %v", err)
+	}
+
+	outbox.Publish("tenant-b", EventReceiptProcessed, nil)
+	go outbox.Dispatch(context.Background())
+	<-started
+
+	// The subscriber of the other tenant is not held up by the slow one
+	outbox.Publish("tenant-a", EventReceiptProcessed, nil)
+	if delivered := outbox.Dispatch(context.Background()); delivered != 1 || len(rc.requests) != 1 {
+		t.Errorf("Expected 1 delivery next to the slow subscriber, received %d requests", len(rc.requests))
+	}
+}